@@ -0,0 +1,163 @@
+package osqt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ATCAttribute is the table attribute marking tables defined by osquery's automatic table construction.
+const ATCAttribute = "auto_table_construction"
+
+// ATCTable is a table osquery builds at runtime from a SQLite database on the host, as configured in the
+// auto_table_construction section of an osquery config. Every column of an ATC table is TEXT.
+type ATCTable struct {
+	Name     string   `json:"-"`
+	Query    string   `json:"query"`
+	Path     string   `json:"path"`
+	Columns  []string `json:"columns"`
+	Platform string   `json:"platform,omitempty"`
+}
+
+// ATCConfig is the auto_table_construction section of an osquery config.
+type ATCConfig struct {
+	Tables map[string]*ATCTable `json:"auto_table_construction"`
+}
+
+// LoadATCConfig reads the ATC tables from the osquery config at fileloc, ignoring every other section.
+func LoadATCConfig(fileloc string) (*ATCConfig, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading osquery config: %v", err)
+	}
+
+	config := &ATCConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, xerrors.Errorf("error parsing osquery config %s: %v", fileloc, err)
+	}
+	for name, atc := range config.Tables {
+		if atc == nil {
+			return nil, xerrors.Errorf("ATC table %s is empty", name)
+		}
+		atc.Name = name
+		if err := atc.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// Validate returns an error if osquery would reject the table's configuration.
+func (a *ATCTable) Validate() error {
+	if !tableNameRegexp.MatchString(a.Name) {
+		return xerrors.Errorf("ATC table name %q is not a valid table name", a.Name)
+	}
+	if strings.TrimSpace(a.Query) == "" {
+		return xerrors.Errorf("ATC table %s has no query", a.Name)
+	}
+	if strings.TrimSpace(a.Path) == "" {
+		return xerrors.Errorf("ATC table %s has no database path", a.Name)
+	}
+	if len(a.Columns) == 0 {
+		return xerrors.Errorf("ATC table %s has no columns", a.Name)
+	}
+	seen := map[string]bool{}
+	for _, col := range a.Columns {
+		if !tableNameRegexp.MatchString(col) {
+			return xerrors.Errorf("ATC table %s column %q is not a valid column name", a.Name, col)
+		}
+		if seen[col] {
+			return xerrors.Errorf("ATC table %s has column %s more than once", a.Name, col)
+		}
+		seen[col] = true
+	}
+	if _, err := a.namespaces(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// namespaces returns the namespaces whose platforms match the table's platform. Like osquery, the platform may be
+// a comma separated list, and is available everywhere when empty, "all" or "any".
+func (a *ATCTable) namespaces() ([]string, error) {
+	nsids := []string{}
+	for _, platform := range strings.Split(a.Platform, ",") {
+		nsid := strings.ToLower(strings.TrimSpace(platform))
+		switch nsid {
+		case "", "all", "any":
+			nsid = "specs"
+		case "darwin", "linux", "windows", "freebsd", "posix":
+		default:
+			return nil, xerrors.Errorf("ATC table %s has unsupported platform %q", a.Name, platform)
+		}
+		if !containsName(nsids, nsid) {
+			nsids = append(nsids, nsid)
+		}
+	}
+	sort.Strings(nsids)
+	return nsids, nil
+}
+
+// Table returns the osquery table the configuration defines.
+func (a *ATCTable) Table() *Table {
+	t := NewEmptyTable()
+	t.Name = a.Name
+	t.Description = fmt.Sprintf("Automatically constructed from the SQLite database at %s.", a.Path)
+	t.Attributes[ATCAttribute] = true
+	t.Schema = NewEmptySchema(t)
+	for idx, name := range a.Columns {
+		col := NewEmptyColumn()
+		col.Index = idx
+		col.Name = name
+		col.Type = "TEXT"
+		t.Schema.Columns = append(t.Schema.Columns, col)
+	}
+	return t
+}
+
+// RegisterATCTable adds the table atc defines to the parser, in the namespace of each platform it is configured
+// for, so queries of it can be linted and served like those of any other table. Like RegisterTable, it returns
+// an error if the parser already has a table of that name, as osquery does not let ATC tables replace built in
+// tables.
+func (p *Parser) RegisterATCTable(atc *ATCTable) error {
+	if err := atc.Validate(); err != nil {
+		return err
+	}
+	nsids, err := atc.namespaces()
+	if err != nil {
+		return err
+	}
+
+	tables := make([]*Table, 0, len(nsids))
+	for _, nsid := range nsids {
+		t := atc.Table()
+		t.NamespaceID = nsid
+		tables = append(tables, t)
+	}
+	if err := p.registerTables(tables); err != nil {
+		return xerrors.Errorf("ATC table %s: %v", atc.Name, err)
+	}
+	return nil
+}
+
+// RegisterATCConfig registers every table of config with RegisterATCTable, in name order.
+func (p *Parser) RegisterATCConfig(config *ATCConfig) error {
+	names := make([]string, 0, len(config.Tables))
+	for name := range config.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		atc := config.Tables[name]
+		atc.Name = name
+		if err := p.RegisterATCTable(atc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
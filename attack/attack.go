@@ -0,0 +1,321 @@
+// Package attack maps osquery tables to the data sources of MITRE ATT&CK, to report which techniques the tables
+// available on a platform can observe.
+package attack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Mapping maps ATT&CK data components, such as "Process: Process Creation", to the osquery tables collecting them
+// and the techniques they detect. Techniques names the techniques by ID.
+type Mapping struct {
+	DataComponents map[string]*DataComponent `json:"data_components,omitempty" yaml:"data_components,omitempty"`
+	Techniques     map[string]string         `json:"techniques,omitempty" yaml:"techniques,omitempty"`
+}
+
+// DataComponent is an ATT&CK data component: the Tables collecting it, and the IDs of the Techniques it detects.
+type DataComponent struct {
+	Tables     []string `json:"tables,omitempty" yaml:"tables,omitempty"`
+	Techniques []string `json:"techniques,omitempty" yaml:"techniques,omitempty"`
+}
+
+// defaultComponents are the bundled data components of the tables of osquery's specs.
+var defaultComponents = map[string]*DataComponent{
+	"Process: Process Creation": {
+		Tables:     []string{"process_events", "bpf_process_events", "es_process_events", "processes"},
+		Techniques: []string{"T1059", "T1053", "T1204", "T1218", "T1543", "T1036", "T1569"},
+	},
+	"Process: Process Metadata": {
+		Tables:     []string{"processes", "process_envs"},
+		Techniques: []string{"T1036", "T1134"},
+	},
+	"Command: Command Execution": {
+		Tables:     []string{"shell_history", "powershell_events"},
+		Techniques: []string{"T1059", "T1070", "T1552"},
+	},
+	"File: File Creation": {
+		Tables:     []string{"file_events", "ntfs_journal_events", "es_process_file_events"},
+		Techniques: []string{"T1105", "T1547", "T1574", "T1036"},
+	},
+	"File: File Modification": {
+		Tables:     []string{"file_events", "ntfs_journal_events", "es_process_file_events"},
+		Techniques: []string{"T1222", "T1546", "T1574", "T1098"},
+	},
+	"File: File Deletion": {
+		Tables:     []string{"file_events", "ntfs_journal_events"},
+		Techniques: []string{"T1070", "T1485"},
+	},
+	"File: File Metadata": {
+		Tables:     []string{"file", "hash", "authenticode", "signature"},
+		Techniques: []string{"T1036", "T1553", "T1027"},
+	},
+	"Network Traffic: Network Connection Creation": {
+		Tables:     []string{"socket_events", "bpf_socket_events", "process_open_sockets"},
+		Techniques: []string{"T1071", "T1021", "T1041", "T1095", "T1571"},
+	},
+	"Network Traffic: Network Traffic Flow": {
+		Tables:     []string{"process_open_sockets", "listening_ports"},
+		Techniques: []string{"T1571", "T1090", "T1205"},
+	},
+	"Scheduled Job: Scheduled Job Metadata": {
+		Tables:     []string{"crontab", "scheduled_tasks", "launchd", "systemd_units"},
+		Techniques: []string{"T1053"},
+	},
+	"Service: Service Metadata": {
+		Tables:     []string{"services", "systemd_units", "launchd", "startup_items"},
+		Techniques: []string{"T1543", "T1569"},
+	},
+	"Windows Registry: Windows Registry Key Modification": {
+		Tables:     []string{"registry"},
+		Techniques: []string{"T1547", "T1112", "T1546"},
+	},
+	"Kernel: Kernel Module Load": {
+		Tables:     []string{"kernel_modules", "kernel_extensions"},
+		Techniques: []string{"T1547", "T1014"},
+	},
+	"Driver: Driver Load": {
+		Tables:     []string{"drivers", "kernel_extensions"},
+		Techniques: []string{"T1014", "T1543"},
+	},
+	"Module: Module Load": {
+		Tables:     []string{"process_memory_map"},
+		Techniques: []string{"T1574", "T1055", "T1129"},
+	},
+	"User Account: User Account Metadata": {
+		Tables:     []string{"users", "groups", "user_groups"},
+		Techniques: []string{"T1136", "T1087", "T1078"},
+	},
+	"Logon Session: Logon Session Creation": {
+		Tables:     []string{"logged_in_users", "last", "user_events"},
+		Techniques: []string{"T1078", "T1021"},
+	},
+	"WMI: WMI Creation": {
+		Tables:     []string{"wmi_event_filters", "wmi_cli_event_consumers", "wmi_script_event_consumers", "wmi_filter_consumer_binding"},
+		Techniques: []string{"T1546"},
+	},
+	"Container: Container Creation": {
+		Tables:     []string{"docker_containers"},
+		Techniques: []string{"T1610"},
+	},
+	"Drive: Drive Access": {
+		Tables:     []string{"mounts", "usb_devices"},
+		Techniques: []string{"T1091", "T1052"},
+	},
+	"Firewall: Firewall Metadata": {
+		Tables:     []string{"alf", "iptables", "windows_firewall_rules"},
+		Techniques: []string{"T1562"},
+	},
+}
+
+// defaultTechniques names the techniques of defaultComponents.
+var defaultTechniques = map[string]string{
+	"T1014": "Rootkit",
+	"T1021": "Remote Services",
+	"T1027": "Obfuscated Files or Information",
+	"T1036": "Masquerading",
+	"T1041": "Exfiltration Over C2 Channel",
+	"T1052": "Exfiltration Over Physical Medium",
+	"T1053": "Scheduled Task/Job",
+	"T1055": "Process Injection",
+	"T1059": "Command and Scripting Interpreter",
+	"T1070": "Indicator Removal",
+	"T1071": "Application Layer Protocol",
+	"T1078": "Valid Accounts",
+	"T1087": "Account Discovery",
+	"T1090": "Proxy",
+	"T1091": "Replication Through Removable Media",
+	"T1095": "Non-Application Layer Protocol",
+	"T1098": "Account Manipulation",
+	"T1105": "Ingress Tool Transfer",
+	"T1112": "Modify Registry",
+	"T1129": "Shared Modules",
+	"T1134": "Access Token Manipulation",
+	"T1136": "Create Account",
+	"T1204": "User Execution",
+	"T1205": "Traffic Signaling",
+	"T1218": "System Binary Proxy Execution",
+	"T1222": "File and Directory Permissions Modification",
+	"T1485": "Data Destruction",
+	"T1543": "Create or Modify System Process",
+	"T1546": "Event Triggered Execution",
+	"T1547": "Boot or Logon Autostart Execution",
+	"T1552": "Unsecured Credentials",
+	"T1553": "Subvert Trust Controls",
+	"T1562": "Impair Defenses",
+	"T1569": "System Services",
+	"T1571": "Non-Standard Port",
+	"T1574": "Hijack Execution Flow",
+	"T1610": "Deploy Container",
+}
+
+// DefaultMapping returns a copy of the bundled mapping of osquery's tables to ATT&CK data components.
+func DefaultMapping() *Mapping {
+	m := &Mapping{}
+	m.Merge(&Mapping{DataComponents: defaultComponents, Techniques: defaultTechniques})
+	return m
+}
+
+// LoadMapping returns the bundled mapping overridden by the JSON or YAML mapping file fileloc.
+func LoadMapping(fileloc string) (*Mapping, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	override := &Mapping{}
+	switch filepath.Ext(fileloc) {
+	case ".json":
+		err = json.Unmarshal(data, override)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, override)
+	default:
+		return nil, xerrors.Errorf("unsupported ATT&CK mapping file extension for %s (expected .json or .yaml)", fileloc)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing ATT&CK mapping %s: %v", fileloc, err)
+	}
+
+	m := DefaultMapping()
+	m.Merge(override)
+	return m, nil
+}
+
+// Merge copies the data components and technique names of other into m. The tables and techniques of a data
+// component are replaced when other sets them, and a data component of other with neither removes it.
+func (m *Mapping) Merge(other *Mapping) {
+	if m.DataComponents == nil {
+		m.DataComponents = map[string]*DataComponent{}
+	}
+	if m.Techniques == nil {
+		m.Techniques = map[string]string{}
+	}
+	for name, dc := range other.DataComponents {
+		if dc == nil || (dc.Tables == nil && dc.Techniques == nil) {
+			delete(m.DataComponents, name)
+			continue
+		}
+		existing, ok := m.DataComponents[name]
+		if !ok {
+			existing = &DataComponent{}
+			m.DataComponents[name] = existing
+		}
+		if dc.Tables != nil {
+			existing.Tables = append([]string{}, dc.Tables...)
+		}
+		if dc.Techniques != nil {
+			existing.Techniques = append([]string{}, dc.Techniques...)
+		}
+	}
+	for id, name := range other.Techniques {
+		m.Techniques[id] = name
+	}
+}
+
+// ComponentCoverage is a data component of a coverage report, with the tables collecting it that are available.
+type ComponentCoverage struct {
+	Name       string   `json:"name"`
+	DataSource string   `json:"data_source"`
+	Tables     []string `json:"tables"`
+	Observable bool     `json:"observable"`
+}
+
+// TechniqueCoverage is a technique of a coverage report, with the observable data components detecting it.
+type TechniqueCoverage struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	Observable bool     `json:"observable"`
+	Components []string `json:"data_components"`
+}
+
+// Report is the ATT&CK coverage of the tables available on a platform.
+type Report struct {
+	Platform   string               `json:"platform,omitempty"`
+	Observable int                  `json:"observable"`
+	Techniques []*TechniqueCoverage `json:"techniques"`
+	Components []*ComponentCoverage `json:"data_components"`
+}
+
+// Coverage reports the techniques of mapping observable with the tables of parser available on goos, or with
+// every table of parser if goos is empty. A technique is observable if any data component detecting it is
+// collected by an available table. A nil mapping uses the bundled one.
+func Coverage(parser *osqt.Parser, goos string, mapping *Mapping) *Report {
+	if mapping == nil {
+		mapping = DefaultMapping()
+	}
+
+	available := map[string]bool{}
+	if goos != "" {
+		for name := range parser.TablesFor(goos) {
+			available[name] = true
+		}
+	} else {
+		parser.RLock()
+		for _, ns := range parser.Namespaces {
+			for name := range ns.Tables {
+				available[name] = true
+			}
+		}
+		parser.RUnlock()
+	}
+
+	report := &Report{Platform: goos, Techniques: []*TechniqueCoverage{}, Components: []*ComponentCoverage{}}
+	names := make([]string, 0, len(mapping.DataComponents))
+	for name := range mapping.DataComponents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ids := []string{}
+	techniques := map[string]*TechniqueCoverage{}
+	for _, name := range names {
+		dc := mapping.DataComponents[name]
+		cc := &ComponentCoverage{Name: name, DataSource: DataSource(name), Tables: []string{}}
+		for _, table := range dc.Tables {
+			if available[table] {
+				cc.Tables = append(cc.Tables, table)
+			}
+		}
+		cc.Observable = len(cc.Tables) > 0
+		report.Components = append(report.Components, cc)
+
+		for _, id := range dc.Techniques {
+			tc, ok := techniques[id]
+			if !ok {
+				tc = &TechniqueCoverage{ID: id, Name: mapping.Techniques[id], Components: []string{}}
+				techniques[id] = tc
+				ids = append(ids, id)
+			}
+			if cc.Observable {
+				tc.Observable = true
+				tc.Components = append(tc.Components, name)
+			}
+		}
+	}
+
+	sort.Strings(ids)
+	for _, id := range ids {
+		tc := techniques[id]
+		if tc.Observable {
+			report.Observable++
+		}
+		report.Techniques = append(report.Techniques, tc)
+	}
+	return report
+}
+
+// DataSource returns the data source of a data component named "Data Source: Component".
+func DataSource(component string) string {
+	if idx := strings.Index(component, ": "); idx >= 0 {
+		return component[:idx]
+	}
+	return component
+}
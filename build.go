@@ -0,0 +1,197 @@
+package osqt
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Availability describes when the tables of a namespace are present in an osquery build.
+type Availability string
+
+// The availabilities of namespaces.
+const (
+	// AvailablePlatform tables are built for every platform their namespace applies to, and can be disabled with
+	// osquery's --disable_tables flag.
+	AvailablePlatform Availability = "platform"
+	// AvailableAlways tables are osquery's own utility tables, such as osquery_info and time. They are built on
+	// every platform and cannot be disabled.
+	AvailableAlways Availability = "always"
+	// AvailableOptional tables depend on a library osquery can be built without, such as YARA or The Sleuth Kit.
+	AvailableOptional Availability = "optional"
+)
+
+// NamespaceAvailability records the namespaces whose tables are not simply available on the platforms the
+// namespace applies to. Namespaces not listed are AvailablePlatform.
+var NamespaceAvailability = map[string]Availability{
+	"utility":   AvailableAlways,
+	"yara":      AvailableOptional,
+	"smart":     AvailableOptional,
+	"lldpd":     AvailableOptional,
+	"sleuthkit": AvailableOptional,
+}
+
+// AvailabilityOf returns the availability of the tables in the namespace nsid.
+func AvailabilityOf(nsid string) Availability {
+	if a, ok := NamespaceAvailability[nsid]; ok {
+		return a
+	}
+	return AvailablePlatform
+}
+
+// BuildConfig describes how an osquery deployment was built and configured, which together with its platform
+// determine the tables it serves. The zero value is a build with every optional namespace and no disabled tables.
+type BuildConfig struct {
+	// Without lists the optional namespaces the build was compiled without (e.g. yara or lldpd).
+	Without []string
+	// DisabledTables lists the tables disabled with osquery's --disable_tables flag.
+	DisabledTables []string
+	// EnabledTables lists the tables enabled with osquery's --enable_tables flag. When it is set, every other
+	// table is disabled. Tables that are also in DisabledTables stay disabled.
+	EnabledTables []string
+}
+
+// Validate returns an error if the configuration names a namespace that is not optional.
+func (b *BuildConfig) Validate() error {
+	for _, nsid := range b.Without {
+		if AvailabilityOf(nsid) != AvailableOptional {
+			return xerrors.Errorf("%s is not an optional namespace (optional: %s)", nsid, strings.Join(OptionalNamespaces(), ", "))
+		}
+	}
+	return nil
+}
+
+// Includes returns true if a build with this configuration serves the table name from the namespace nsid, given
+// the namespace applies to its platform. A nil BuildConfig includes every table.
+func (b *BuildConfig) Includes(nsid, name string) bool {
+	if b == nil {
+		return true
+	}
+
+	switch AvailabilityOf(nsid) {
+	case AvailableAlways:
+		return true
+	case AvailableOptional:
+		for _, without := range b.Without {
+			if without == nsid {
+				return false
+			}
+		}
+	}
+	if containsName(b.DisabledTables, name) {
+		return false
+	}
+	return len(b.EnabledTables) == 0 || containsName(b.EnabledTables, name)
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFlagFile reads the --disable_tables and --enable_tables flags from an osquery flag file (as passed to
+// osqueryd with --flagfile), ignoring every other flag.
+func ParseFlagFile(path string) (*BuildConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading flag file: %v", err)
+	}
+
+	build := &BuildConfig{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// flags are written --name=value, and osquery also accepts --name value
+		name, value := line, ""
+		if idx := strings.IndexAny(line, "= \t"); idx >= 0 {
+			name, value = line[:idx], strings.TrimSpace(line[idx+1:])
+		}
+		switch strings.TrimLeft(name, "-") {
+		case "disable_tables":
+			build.DisabledTables = append(build.DisabledTables, SplitTableList(value)...)
+		case "enable_tables":
+			build.EnabledTables = append(build.EnabledTables, SplitTableList(value)...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("error reading flag file: %v", err)
+	}
+	return build, nil
+}
+
+// SplitTableList splits a comma separated list of table names, as given to --disable_tables, dropping quotes and
+// empty entries.
+func SplitTableList(list string) []string {
+	names := []string{}
+	for _, name := range strings.Split(strings.Trim(list, `"'`), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// OptionalNamespaces returns the namespaces an osquery build can be compiled without, in sorted order.
+func OptionalNamespaces() []string {
+	names := []string{}
+	for nsid, a := range NamespaceAvailability {
+		if a == AvailableOptional {
+			names = append(names, nsid)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TablesForBuild returns every table an osquery build with the given configuration serves on the given GOOS
+// runtime, keyed by table name.
+func (p *Parser) TablesForBuild(goos string, build *BuildConfig) map[string]*Table {
+	p.RLock()
+	defer p.RUnlock()
+
+	tables := map[string]*Table{}
+	for _, nsid := range GOOSToApplicableNamespaces[goos] {
+		ns, ok := p.Namespaces[nsid]
+		if !ok {
+			continue
+		}
+		for tname, table := range ns.Tables {
+			if build.Includes(nsid, tname) {
+				tables[tname] = table
+			}
+		}
+	}
+
+	return tables
+}
+
+// ApplyBuildConfig removes the tables an osquery build with the given configuration does not serve on any
+// platform, so exports of the parser describe that build. It returns the number of tables removed.
+func (p *Parser) ApplyBuildConfig(build *BuildConfig) int {
+	p.Lock()
+	defer p.Unlock()
+
+	removed := 0
+	for nsid, ns := range p.Namespaces {
+		for tname := range ns.Tables {
+			if !build.Includes(nsid, tname) {
+				delete(ns.Tables, tname)
+				removed++
+			}
+		}
+	}
+
+	return removed
+}
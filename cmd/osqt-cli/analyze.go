@@ -0,0 +1,634 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/attack"
+	"github.com/gen0cide/osqt/pack"
+	"github.com/gen0cide/osqt/query"
+)
+
+var (
+	analyzeCommands = []cli.Command{
+		{
+			Name:  "coverage",
+			Usage: "Reports which tables are available on each platform and which are platform-exclusive.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the report in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: analyzeCoverage,
+		},
+		{
+			Name:  "query-compat",
+			Usage: "Reports, for each platform, whether every table and column a query uses exists there.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &inputQuery,
+					Usage:       "Query to check.",
+					EnvVar:      "OSQT_INPUT_QUERY",
+				},
+				cli.StringFlag{
+					Name:        "file",
+					Destination: &queryFile,
+					Usage:       "File containing the SQL to check (instead of --query).",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the report in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: analyzeQueryCompat,
+		},
+		{
+			Name:  "cost",
+			Usage: "Scores queries by the expensive patterns they use, such as full scans of file and hash and unconstrained joins.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &inputQuery,
+					Usage:       "Query to score.",
+					EnvVar:      "OSQT_INPUT_QUERY",
+				},
+				cli.StringFlag{
+					Name:        "file",
+					Destination: &queryFile,
+					Usage:       "File containing the SQL to score (instead of --query).",
+				},
+				cli.StringFlag{
+					Name:        "pack",
+					Destination: &packPath,
+					Usage:       "osquery JSON pack or Fleet YAML pack whose queries are scored at their own intervals (instead of --query).",
+				},
+				cli.IntFlag{
+					Name:        "interval",
+					Destination: &costInterval,
+					Usage:       "Interval in seconds the query is scheduled at, to score its evented tables (0 skips them).",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the report in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: analyzeCost,
+		},
+		{
+			Name:  "attack-coverage",
+			Usage: "Reports which MITRE ATT&CK techniques are observable with the tables available on a platform.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "platform",
+					Destination: &filterPlatform,
+					Usage:       "Only count tables available on this platform (options: 'windows', 'linux', 'darwin', 'freebsd').",
+				},
+				cli.StringFlag{
+					Name:        "mapping",
+					Destination: &mappingFile,
+					Usage:       "JSON or YAML file of ATT&CK data components and technique names, overriding the bundled ones (a data component with no tables or techniques is removed).",
+					EnvVar:      "OSQT_ATTACK_MAPPING",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the report in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: analyzeAttackCoverage,
+		},
+		columnsCommand,
+		hiddenColumnsCommand,
+		{
+			Name:  "deprecations",
+			Usage: "Lists deprecated tables and columns, and flags the queries and packs still using them.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &inputQuery,
+					Usage:       "Query to check.",
+					EnvVar:      "OSQT_INPUT_QUERY",
+				},
+				cli.StringFlag{
+					Name:        "file",
+					Destination: &queryFile,
+					Usage:       "File containing the SQL to check (instead of --query).",
+				},
+				cli.StringFlag{
+					Name:        "pack",
+					Destination: &packPath,
+					Usage:       "osquery JSON pack or Fleet YAML pack whose queries are checked (instead of --query).",
+				},
+				cli.BoolFlag{
+					Name:        "skip-heuristics",
+					Destination: &skipDeprecationHeuristics,
+					Usage:       "Only count tables and columns the --deprecations overlay marks, not those whose descriptions say they are deprecated.",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the report in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: analyzeDeprecations,
+		},
+	}
+
+	costInterval              int
+	skipDeprecationHeuristics bool
+)
+
+// queryCost is the cost of a single named query, for the structured form of the analyze cost command's output.
+type queryCost struct {
+	Query    string `json:"query,omitempty"`
+	Interval int    `json:"interval,omitempty"`
+	*query.Cost
+}
+
+// deprecationsReport is the structured form of the analyze deprecations command's output: the deprecated tables
+// and columns of the schema, and the uses of them by the queries checked.
+type deprecationsReport struct {
+	Deprecated []*deprecatedItem    `json:"deprecated"`
+	Queries    []*queryDeprecations `json:"queries,omitempty"`
+}
+
+// deprecatedItem is a deprecated table, or a deprecated column if Column is set.
+type deprecatedItem struct {
+	Table  string `json:"table"`
+	Column string `json:"column,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// queryDeprecations is the uses of deprecated tables and columns by a single named query.
+type queryDeprecations struct {
+	Query    string           `json:"query,omitempty"`
+	Findings []*query.Finding `json:"findings"`
+}
+
+// coverageReport is the structured form of the analyze coverage command's output.
+type coverageReport struct {
+	Platforms []string            `json:"platforms"`
+	Counts    map[string]int      `json:"counts"`
+	Matrix    map[string][]string `json:"matrix"`
+	Exclusive map[string][]string `json:"exclusive"`
+}
+
+// supportedPlatforms returns the GOOS values osqt knows about in a stable order.
+func supportedPlatforms() []string {
+	platforms := []string{}
+	for goos := range osqt.GOOSToApplicableNamespaces {
+		platforms = append(platforms, goos)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+func analyzeCoverage(c *cli.Context) error {
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+
+	report := &coverageReport{
+		Platforms: supportedPlatforms(),
+		Counts:    map[string]int{},
+		Matrix:    map[string][]string{},
+		Exclusive: map[string][]string{},
+	}
+
+	for _, goos := range report.Platforms {
+		tables := parser.TablesFor(goos)
+		report.Counts[goos] = len(tables)
+		for tname := range tables {
+			report.Matrix[tname] = append(report.Matrix[tname], goos)
+		}
+	}
+
+	for tname, platforms := range report.Matrix {
+		if len(platforms) == 1 {
+			report.Exclusive[platforms[0]] = append(report.Exclusive[platforms[0]], tname)
+		}
+	}
+	for _, tables := range report.Exclusive {
+		sort.Strings(tables)
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render coverage report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "text":
+		return printCoverage(report)
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+}
+
+func printCoverage(report *coverageReport) error {
+	names := make([]string, 0, len(report.Matrix))
+	for tname := range report.Matrix {
+		names = append(names, tname)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "TABLE\t%s\n", strings.ToUpper(strings.Join(report.Platforms, "\t")))
+	for _, tname := range names {
+		available := map[string]bool{}
+		for _, goos := range report.Matrix[tname] {
+			available[goos] = true
+		}
+		cells := make([]string, len(report.Platforms))
+		for idx, goos := range report.Platforms {
+			cells[idx] = "-"
+			if available[goos] {
+				cells[idx] = "x"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", tname, strings.Join(cells, "\t"))
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "PLATFORM\tTABLES\tEXCLUSIVE")
+	for _, goos := range report.Platforms {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", goos, report.Counts[goos], len(report.Exclusive[goos]))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, goos := range report.Platforms {
+		if len(report.Exclusive[goos]) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s exclusive: %s\n", goos, strings.Join(report.Exclusive[goos], ", "))
+	}
+
+	return nil
+}
+
+func analyzeQueryCompat(c *cli.Context) error {
+	sql := inputQuery
+	if queryFile != "" {
+		data, err := ioutil.ReadFile(queryFile)
+		if err != nil {
+			return xerrors.Errorf("error reading --file: %v", err)
+		}
+		sql = string(data)
+	}
+	if sql == "" {
+		return xerrors.New("--query QUERY or --file PATH is required")
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	report, err := query.CheckCompatibility(parser, sql)
+	if err != nil {
+		return xerrors.Errorf("error scanning query: %v", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render compatibility report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "text":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PLATFORM\tVERDICT\tMISSING")
+		for _, compat := range report {
+			verdict := "compatible"
+			if !compat.Compatible {
+				verdict = "incompatible"
+			}
+			missing := append(append([]string{}, compat.MissingTables...), compat.MissingColumns...)
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", compat.Platform, verdict, strings.Join(missing, ", "))
+		}
+		return tw.Flush()
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+}
+
+func analyzeCost(c *cli.Context) error {
+	type costInput struct {
+		name     string
+		sql      string
+		interval int
+	}
+
+	inputs := []*costInput{}
+	switch {
+	case packPath != "":
+		p, err := pack.Load(packPath)
+		if err != nil {
+			return err
+		}
+		for _, q := range p.SortedQueries() {
+			inputs = append(inputs, &costInput{name: q.Name, sql: q.SQL, interval: q.Interval})
+		}
+	case queryFile != "":
+		data, err := ioutil.ReadFile(queryFile)
+		if err != nil {
+			return xerrors.Errorf("error reading --file: %v", err)
+		}
+		inputs = append(inputs, &costInput{sql: string(data), interval: costInterval})
+	case inputQuery != "":
+		inputs = append(inputs, &costInput{sql: inputQuery, interval: costInterval})
+	default:
+		return xerrors.New("--query QUERY, --file PATH or --pack PACK is required")
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+
+	report := []*queryCost{}
+	for _, in := range inputs {
+		cost, err := query.EstimateCost(parser, in.sql, in.interval)
+		if err != nil {
+			if in.name != "" {
+				return xerrors.Errorf("query %s: %v", in.name, err)
+			}
+			return xerrors.Errorf("error scanning query: %v", err)
+		}
+		report = append(report, &queryCost{Query: in.name, Interval: in.interval, Cost: cost})
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render cost report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "text":
+		for _, qc := range report {
+			if qc.Query != "" {
+				fmt.Printf("%s: ", qc.Query)
+			}
+			fmt.Printf("score %d (%s)\n", qc.Score, qc.Rating)
+			for _, f := range qc.Factors {
+				fmt.Printf("  %d:%d: +%d %s: %s\n", f.Line, f.Column, f.Score, f.Kind, f.Message)
+				if f.Suggestion != "" {
+					fmt.Printf("      suggestion: %s\n", f.Suggestion)
+				}
+			}
+		}
+		return nil
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+}
+
+func analyzeAttackCoverage(c *cli.Context) error {
+	if _, ok := osqt.GOOSToApplicableNamespaces[filterPlatform]; filterPlatform != "" && !ok {
+		return xerrors.Errorf("--platform value provided (%s) was not valid (valid: 'windows', 'linux', 'darwin', 'freebsd').", filterPlatform)
+	}
+
+	mapping := attack.DefaultMapping()
+	if mappingFile != "" {
+		var err error
+		if mapping, err = attack.LoadMapping(mappingFile); err != nil {
+			return err
+		}
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	report := attack.Coverage(parser, filterPlatform, mapping)
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render ATT&CK coverage report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "text":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TECHNIQUE\tNAME\tVERDICT\tDATA COMPONENTS")
+		for _, tc := range report.Techniques {
+			verdict := "observable"
+			if !tc.Observable {
+				verdict = "blind"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", tc.ID, tc.Name, verdict, strings.Join(tc.Components, ", "))
+		}
+
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "DATA COMPONENT\tTABLES")
+		for _, cc := range report.Components {
+			tables := "-"
+			if cc.Observable {
+				tables = strings.Join(cc.Tables, ", ")
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", cc.Name, tables)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		platform := "any platform"
+		if report.Platform != "" {
+			platform = report.Platform
+		}
+		fmt.Printf("\n%d of %d techniques observable on %s.\n", report.Observable, len(report.Techniques), platform)
+		return nil
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+}
+
+func analyzeDeprecations(c *cli.Context) error {
+	type deprecationInput struct {
+		name string
+		sql  string
+	}
+
+	inputs := []*deprecationInput{}
+	switch {
+	case packPath != "":
+		p, err := pack.Load(packPath)
+		if err != nil {
+			return err
+		}
+		for _, q := range p.SortedQueries() {
+			inputs = append(inputs, &deprecationInput{name: q.Name, sql: q.SQL})
+		}
+	case queryFile != "":
+		data, err := ioutil.ReadFile(queryFile)
+		if err != nil {
+			return xerrors.Errorf("error reading --file: %v", err)
+		}
+		inputs = append(inputs, &deprecationInput{sql: string(data)})
+	case inputQuery != "":
+		inputs = append(inputs, &deprecationInput{sql: inputQuery})
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	if !skipDeprecationHeuristics {
+		log.Debugf("Marked %d tables and columns deprecated by their descriptions.", parser.DetectDeprecations())
+	}
+
+	report := &deprecationsReport{Deprecated: []*deprecatedItem{}}
+	for _, table := range allTables(parser) {
+		if table.Deprecated != "" {
+			report.Deprecated = append(report.Deprecated, &deprecatedItem{Table: table.Name, Reason: table.Deprecated})
+		}
+		for _, col := range table.AllColumns("") {
+			if col.Deprecated != "" {
+				report.Deprecated = append(report.Deprecated, &deprecatedItem{Table: table.Name, Column: col.Name, Reason: col.Deprecated})
+			}
+		}
+	}
+	for _, in := range inputs {
+		findings, err := query.CheckDeprecations(parser, in.sql)
+		if err != nil {
+			if in.name != "" {
+				return xerrors.Errorf("query %s: %v", in.name, err)
+			}
+			return xerrors.Errorf("error scanning query: %v", err)
+		}
+		report.Queries = append(report.Queries, &queryDeprecations{Query: in.name, Findings: findings})
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render deprecations report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "text":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TABLE\tCOLUMN\tREASON")
+		for _, item := range report.Deprecated {
+			column := item.Column
+			if column == "" {
+				column = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", item.Table, column, item.Reason)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		using := 0
+		for _, qd := range report.Queries {
+			if len(qd.Findings) == 0 {
+				continue
+			}
+			using++
+			fmt.Println()
+			if qd.Query != "" {
+				fmt.Printf("%s:\n", qd.Query)
+			}
+			for _, f := range qd.Findings {
+				fmt.Printf("  %d:%d: %s\n", f.Line, f.Column, f.Message)
+			}
+		}
+		if len(report.Queries) > 0 {
+			fmt.Printf("\n%d of %d queries use deprecated tables or columns.\n", using, len(report.Queries))
+		}
+		return nil
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	// registers the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/zaplog"
+)
+
+var (
+	atcConfigPath  string
+	atcName        string
+	atcPath        string
+	atcColumns     string
+	atcQuery       string
+	atcSourceTable string
+	atcPlatform    string
+)
+
+// registerATCConfig adds the tables of --atc-config, if any, to parser.
+func registerATCConfig(parser *osqt.Parser) error {
+	if atcConfigPath == "" {
+		return nil
+	}
+
+	config, err := osqt.LoadATCConfig(atcConfigPath)
+	if err != nil {
+		return err
+	}
+	if err := parser.RegisterATCConfig(config); err != nil {
+		return err
+	}
+	log.Debugf("Registered %d ATC tables from %s.", len(config.Tables), atcConfigPath)
+	return nil
+}
+
+func genATC(c *cli.Context) error {
+	if atcName == "" {
+		return xerrors.New("--name NAME was not provided")
+	}
+	if atcPath == "" {
+		return xerrors.New("--path PATH was not provided")
+	}
+
+	atc := &osqt.ATCTable{
+		Name:     atcName,
+		Path:     atcPath,
+		Columns:  osqt.SplitTableList(atcColumns),
+		Query:    atcQuery,
+		Platform: atcPlatform,
+	}
+	if atc.Query == "" {
+		if atcSourceTable == "" {
+			return xerrors.New("either --query SQL or --source-table TABLE must be provided")
+		}
+		atc.Query = fmt.Sprintf("SELECT %s FROM %s;", strings.Join(atc.Columns, ", "), atcSourceTable)
+	}
+
+	// without a schema, the table is still checked on its own
+	parser := osqt.NewParser(zaplog.New(log.Named("parser")))
+	if schemaPath != "" || specsDir != "" {
+		var err error
+		if parser, err = loadParser(); err != nil {
+			return err
+		}
+	}
+	if err := parser.RegisterATCTable(atc); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(atc.Path); err == nil {
+		if err := checkATCDatabase(atc); err != nil {
+			return err
+		}
+		log.Infof("Checked the query of %s against %s.", atc.Name, atc.Path)
+	} else {
+		log.Debugf("%s is not on this host, not checking the query of %s against it.", atc.Path, atc.Name)
+	}
+
+	data, err := json.MarshalIndent(&osqt.ATCConfig{Tables: map[string]*osqt.ATCTable{atc.Name: atc}}, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("error attempting to render ATC config: %v", err)
+	}
+
+	if outputFile == "" {
+		fmt.Printf("%s\n", string(data))
+		return nil
+	}
+
+	if err := writeOutputFile(outputFile, data); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("ATC config for %s written to %s. Pass it to --atc-config to lint and serve queries of the table.", atc.Name, outputFile)
+	return nil
+}
+
+// checkATCDatabase runs the query of atc against a local copy of its database, and returns an error if the query
+// fails or returns a different number of columns than the table declares.
+func checkATCDatabase(atc *osqt.ATCTable) error {
+	db, err := sql.Open("sqlite3", "file:"+atc.Path+"?mode=ro")
+	if err != nil {
+		return xerrors.Errorf("error opening %s: %v", atc.Path, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM (%s) LIMIT 0", strings.TrimRight(strings.TrimSpace(atc.Query), ";")))
+	if err != nil {
+		return xerrors.Errorf("ATC query failed against %s: %v", atc.Path, err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(cols) != len(atc.Columns) {
+		return xerrors.Errorf("ATC query returns %d columns (%s) but %d columns are declared", len(cols), strings.Join(cols, ", "), len(atc.Columns))
+	}
+	return nil
+}
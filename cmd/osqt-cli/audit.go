@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+
+	osquery "github.com/osquery/osquery-go"
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/virtual"
+	"github.com/gen0cide/osqt/zaplog"
+)
+
+var (
+	osqueryiPath    string
+	extensionSocket string
+	auditCommands   = []cli.Command{
+		{
+			Name:  "agent",
+			Usage: "Compares the schema of a locally running osquery against the parsed spec files.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "target-os",
+					Value:       runtime.GOOS,
+					Destination: &targetOS,
+					Usage:       "Platform the running agent was built for.",
+					EnvVar:      "OSQT_TARGET_OS",
+				},
+				cli.StringFlag{
+					Name:        "osqueryi",
+					Destination: &osqueryiPath,
+					Value:       "osqueryi",
+					Usage:       "Path to the osqueryi binary used to dump the live schema.",
+					EnvVar:      "OSQT_OSQUERYI_PATH",
+				},
+				cli.StringFlag{
+					Name:        "socket",
+					Destination: &extensionSocket,
+					Usage:       "Read the live schema over this osquery extension socket instead of running osqueryi.",
+					EnvVar:      "OSQT_EXTENSION_SOCKET",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the report in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: auditAgent,
+		},
+	}
+)
+
+// auditLabels describes schema changes from the point of view of the running agent.
+var auditLabels = map[osqt.ChangeKind]string{
+	osqt.TableRemoved:  "missing table",
+	osqt.ColumnRemoved: "missing column",
+	osqt.ColumnRetyped: "type mismatch",
+	osqt.TableAdded:    "extra table",
+	osqt.ColumnAdded:   "extra column",
+	osqt.TableMoved:    "moved table",
+}
+
+// liveSchemaFromOsqueryi runs osqueryi's .schema command and parses the result.
+func liveSchemaFromOsqueryi(binary string) (*osqt.Parser, error) {
+	out, err := exec.Command(binary, ".schema").Output()
+	if err != nil {
+		return nil, xerrors.Errorf("error running %s .schema: %v", binary, err)
+	}
+
+	live := osqt.NewParser(zaplog.New(log.Named("live")))
+	if err := live.ParseOsqueryiSchema(bytes.NewReader(out)); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// liveSchemaFromSocket enumerates the active tables over the extension socket and asks osquery for their columns.
+func liveSchemaFromSocket(socket string) (*osqt.Parser, error) {
+	client, err := osquery.NewClient(socket, 10*time.Second)
+	if err != nil {
+		return nil, xerrors.Errorf("error connecting to extension socket %s: %v", socket, err)
+	}
+	defer client.Close()
+
+	tables, err := client.QueryRows("SELECT name FROM osquery_registry WHERE registry = 'table' AND active = 1")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]string{}
+	for _, row := range tables {
+		tname := row["name"]
+		columns, err := tableColumns(client, tname)
+		if err != nil {
+			log.Warnf("Could not describe table %s: %v", tname, err)
+			continue
+		}
+		for _, col := range columns {
+			rows = append(rows, map[string]string{"table_name": tname, "name": col["name"], "type": col["type"]})
+		}
+	}
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	live := osqt.NewParser(zaplog.New(log.Named("live")))
+	if err := live.ParseOsqueryiSchema(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// tableColumns returns the columns osquery declares for a table, in order, hidden columns included: a SELECT *
+// would leave them out. PRAGMA table_xinfo lists hidden columns of virtual tables, which table_info skips, but
+// needs SQLite 3.26, so older osquery releases fall back to table_info.
+func tableColumns(client *osquery.ExtensionManagerClient, table string) ([]map[string]string, error) {
+	var err error
+	for _, pragma := range []string{"table_xinfo", "table_info"} {
+		var columns []map[string]string
+		columns, err = client.QueryRows(fmt.Sprintf("PRAGMA %s(%s)", pragma, table))
+		if err == nil && len(columns) > 0 {
+			return columns, nil
+		}
+	}
+	if err == nil {
+		err = xerrors.New("osquery returned no columns")
+	}
+	return nil, err
+}
+
+// projectForPlatform flattens the tables available on goos (including their extended columns) into a parser
+// shaped like one produced by ParseOsqueryiSchema, so the two can be diffed directly.
+func projectForPlatform(parser *osqt.Parser, goos string) *osqt.Parser {
+	projected := osqt.NewParser(zaplog.New(log.Named("projected")))
+	ns := osqt.NewNamespace(osqt.DeployedNamespace, "Expected osquery tables", projected, nil)
+
+	for tname, table := range parser.TablesFor(goos) {
+		flat := osqt.NewEmptyTable()
+		flat.Name = tname
+		flat.NamespaceID = ns.Key
+		flat.Schema = osqt.NewEmptySchema(flat)
+		flat.Schema.Columns = virtual.PlatformColumns(table, goos)
+		ns.Tables[tname] = flat
+	}
+
+	projected.InjectTables(map[string]*osqt.Namespace{ns.Key: ns})
+	return projected
+}
+
+func auditAgent(c *cli.Context) error {
+	if _, ok := osqt.GOOSToApplicableNamespaces[targetOS]; !ok {
+		return xerrors.Errorf("--target-os value provided (%s) was not valid (valid: 'windows', 'linux', 'darwin', 'freebsd').", targetOS)
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+
+	var live *osqt.Parser
+	if extensionSocket != "" {
+		live, err = liveSchemaFromSocket(extensionSocket)
+	} else {
+		live, err = liveSchemaFromOsqueryi(osqueryiPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	d := osqt.DiffParsers(projectForPlatform(parser, targetOS), live)
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render audit as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		for _, change := range d.Changes {
+			target := change.Table
+			if change.Column != "" {
+				target = fmt.Sprintf("%s.%s", change.Table, change.Column)
+			}
+			if change.Kind == osqt.ColumnRetyped {
+				fmt.Printf("%-15s %s (spec: %s, agent: %s)\n", auditLabels[change.Kind], target, change.OldType, change.NewType)
+				continue
+			}
+			fmt.Printf("%-15s %s\n", auditLabels[change.Kind], target)
+		}
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	log.Infof("%d differences between the %s specs and the running agent (%d missing from the agent).", len(d.Changes), targetOS, len(d.Breaking()))
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql" // registers the mysql database/sql driver
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt/internal/rusage"
+)
+
+var (
+	benchAddr     string
+	benchDatabase string
+	benchClients  int
+	benchDuration time.Duration
+	workloadPath  string
+	benchCommand  = cli.Command{
+		Name:  "bench",
+		Usage: "Benchmarks the virtual server with concurrent MySQL clients issuing a weighted query mix. The cpu and heap use reported for an in-process server include that of the clients.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "schema",
+				Destination: &schemaPath,
+				Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+				EnvVar:      "OSQT_SCHEMA_PATH",
+			},
+			cli.StringFlag{
+				Name:        "specs-dir",
+				Destination: &specsDir,
+				Usage:       "Path to the OSQuery specs directory to parse.",
+				EnvVar:      "OSQT_SPECS_DIR",
+			},
+			cli.StringFlag{
+				Name:        "target-os",
+				Value:       runtime.GOOS,
+				Destination: &targetOS,
+				Usage:       "Runtime to target for the OSQuery dynamic configuration (what tables to use).",
+				EnvVar:      "OSQT_TARGET_OS",
+			},
+			cli.StringFlag{
+				Name:        "addr",
+				Destination: &benchAddr,
+				Usage:       "Benchmark an already running server at this address instead of starting one in-process.",
+			},
+			cli.StringFlag{
+				Name:        "database",
+				Destination: &benchDatabase,
+				Usage:       "Database the clients query (defaults to the default database of the server).",
+			},
+			cli.StringFlag{
+				Name:        "workload",
+				Destination: &workloadPath,
+				Usage:       "Path to a YAML workload file listing queries and their relative weights (required).",
+				EnvVar:      "OSQT_BENCH_WORKLOAD",
+			},
+			cli.IntFlag{
+				Name:        "clients",
+				Destination: &benchClients,
+				Value:       4,
+				Usage:       "Number of concurrent MySQL clients to simulate.",
+			},
+			cli.DurationFlag{
+				Name:        "duration",
+				Destination: &benchDuration,
+				Value:       10 * time.Second,
+				Usage:       "How long to run the benchmark for.",
+			},
+		}, schemaOverlayFlags...),
+		Action: runBench,
+	}
+)
+
+// workloadQuery is a single entry within a benchmark workload file.
+type workloadQuery struct {
+	Query  string `json:"query" yaml:"query"`
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// benchResult holds the outcome of a single query issued by a benchmark client.
+type benchResult struct {
+	latency time.Duration
+	err     error
+}
+
+func loadWorkload(fileloc string) ([]string, error) {
+	filebytes, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []workloadQuery{}
+	if err := yaml.Unmarshal(filebytes, &entries); err != nil {
+		return nil, xerrors.Errorf("error parsing workload file: %v", err)
+	}
+
+	// expand the weighted entries so clients can pick uniformly from the mix
+	mix := []string{}
+	for _, entry := range entries {
+		weight := entry.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		for i := 0; i < weight; i++ {
+			mix = append(mix, entry.Query)
+		}
+	}
+	if len(mix) == 0 {
+		return nil, xerrors.New("workload file did not contain any queries")
+	}
+
+	return mix, nil
+}
+
+func freeLocalAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+
+	return l.Addr().String(), nil
+}
+
+func waitForListener(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, 250*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return xerrors.Errorf("server at %s did not start listening within %v", addr, timeout)
+}
+
+func runBench(c *cli.Context) error {
+	if workloadPath == "" {
+		return xerrors.New("--workload PATH was not provided")
+	}
+	if benchClients < 1 {
+		return xerrors.New("--clients must be at least 1")
+	}
+
+	mix, err := loadWorkload(workloadPath)
+	if err != nil {
+		return err
+	}
+
+	inProcess := benchAddr == ""
+	if inProcess {
+		parser, err := loadParser()
+		if err != nil {
+			return err
+		}
+
+		db, err := buildDatabase(parser, targetOS)
+		if err != nil {
+			return err
+		}
+		if benchDatabase == "" {
+			benchDatabase = db.Databases()[0]
+		}
+
+		benchAddr, err = freeLocalAddr()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := db.Start("tcp", benchAddr); err != nil {
+				log.Errorf("Benchmark server exited: %v", err)
+			}
+		}()
+
+		if err := waitForListener(benchAddr, 10*time.Second); err != nil {
+			return err
+		}
+		log.Infof("Started in-process server at %s", benchAddr)
+	}
+
+	conn, err := sql.Open("mysql", fmt.Sprintf("root@tcp(%s)/%s", benchAddr, benchDatabase))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(benchClients)
+	conn.SetMaxIdleConns(benchClients)
+
+	usageBefore := rusage.ProcessCPUTime()
+	start := time.Now()
+	deadline := start.Add(benchDuration)
+
+	var wg sync.WaitGroup
+	results := make([][]benchResult, benchClients)
+	for i := 0; i < benchClients; i++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(client)))
+			for time.Now().Before(deadline) {
+				query := mix[rng.Intn(len(mix))]
+				qstart := time.Now()
+				err := drainQuery(conn, query)
+				results[client] = append(results[client], benchResult{
+					latency: time.Since(qstart),
+					err:     err,
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	cpu := rusage.ProcessCPUTime() - usageBefore
+
+	latencies := []time.Duration{}
+	failures := 0
+	for _, clientResults := range results {
+		for _, res := range clientResults {
+			if res.err != nil {
+				failures++
+				log.Debugf("Query failed: %v", res.err)
+				continue
+			}
+			latencies = append(latencies, res.latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "clients\t%d\n", benchClients)
+	fmt.Fprintf(tw, "elapsed\t%v\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "queries\t%d\n", len(latencies)+failures)
+	fmt.Fprintf(tw, "failures\t%d\n", failures)
+	fmt.Fprintf(tw, "throughput\t%.2f queries/sec\n", float64(len(latencies))/elapsed.Seconds())
+	for _, pct := range []float64{50, 90, 95, 99} {
+		fmt.Fprintf(tw, "p%.0f latency\t%v\n", pct, percentile(latencies, pct))
+	}
+	// the in-process server shares this process with the benchmark clients, so its cpu and heap figures include
+	// the clients' own; benchmark a server started separately with --addr to measure it alone
+	if inProcess {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		fmt.Fprintf(tw, "process cpu\t%v (%.1f%% of one core, server and clients)\n", cpu.Round(time.Millisecond), 100*cpu.Seconds()/elapsed.Seconds())
+		fmt.Fprintf(tw, "process heap\t%.2f MiB in use, %.2f MiB reserved (server and clients)\n", float64(mem.HeapAlloc)/(1<<20), float64(mem.Sys)/(1<<20))
+	}
+
+	return tw.Flush()
+}
+
+func drainQuery(conn *sql.DB, query string) error {
+	rows, err := conn.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+
+	return rows.Err()
+}
+
+func percentile(sorted []time.Duration, pct float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * pct / 100)
+	return sorted[idx].Round(time.Microsecond)
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+var minColumnTables int
+
+// snakeCase matches the lower case, underscore separated column names osquery's specs use.
+var snakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// columnsReport is the structured form of the analyze columns command's output.
+type columnsReport struct {
+	Tables       int                 `json:"tables"`
+	Names        int                 `json:"names"`
+	Common       []*columnFrequency  `json:"common"`
+	Inconsistent []*columnTypeReport `json:"inconsistent_types"`
+	Outliers     []*columnOutlier    `json:"naming_outliers"`
+}
+
+// columnFrequency is a column name shared by many tables.
+type columnFrequency struct {
+	Name   string   `json:"name"`
+	Count  int      `json:"count"`
+	Tables []string `json:"tables"`
+}
+
+// columnTypeReport is a column name declared with different types by different tables, with the tables declaring
+// each type.
+type columnTypeReport struct {
+	Name  string              `json:"name"`
+	Types map[string][]string `json:"types"`
+}
+
+// columnOutlier is a column breaking the naming convention of the specs: either not snake case, or spelling a
+// name other tables spell differently (e.g. file_name where more tables use filename).
+type columnOutlier struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	Kind       string `json:"kind"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+var columnsCommand = cli.Command{
+	Name:  "columns",
+	Usage: "Reports column names shared by many tables, names declared with inconsistent types, and names breaking the naming convention.",
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:        "schema",
+			Destination: &schemaPath,
+			Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+			EnvVar:      "OSQT_SCHEMA_PATH",
+		},
+		cli.StringFlag{
+			Name:        "specs-dir",
+			Destination: &specsDir,
+			Usage:       "Path to the OSQuery specs directory to parse.",
+			EnvVar:      "OSQT_SPECS_DIR",
+		},
+		cli.IntFlag{
+			Name:        "min-tables",
+			Destination: &minColumnTables,
+			Usage:       "Report column names shared by at least this many tables.",
+			Value:       5,
+		},
+		cli.StringFlag{
+			Name:        "output-format",
+			Destination: &outputFormat,
+			Usage:       "Format to write the report in (options: 'text' or 'json').",
+			Value:       "text",
+		},
+	}, schemaOverlayFlags...),
+	Action: analyzeColumns,
+}
+
+func analyzeColumns(c *cli.Context) error {
+	if outputFormat != "text" && outputFormat != "json" {
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	report := columnsReportFor(parser, minColumnTables)
+
+	if outputFormat == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render columns report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	}
+	return printColumnsReport(report)
+}
+
+// columnsReportFor analyzes the column names of every table of parser, reporting those shared by at least
+// minTables tables.
+func columnsReportFor(parser *osqt.Parser, minTables int) *columnsReport {
+	tables := map[string][]string{}
+	types := map[string]map[string][]string{}
+	// spellings groups the names by their letters alone, so file_name and filename are spellings of one name
+	spellings := map[string]map[string]bool{}
+	outliers := []*columnOutlier{}
+
+	report := &columnsReport{
+		Common:       []*columnFrequency{},
+		Inconsistent: []*columnTypeReport{},
+		Outliers:     []*columnOutlier{},
+	}
+	for _, table := range allTables(parser) {
+		report.Tables++
+		for _, col := range table.AllColumns("") {
+			tables[col.Name] = append(tables[col.Name], table.Name)
+			if types[col.Name] == nil {
+				types[col.Name] = map[string][]string{}
+			}
+			types[col.Name][col.Type] = append(types[col.Name][col.Type], table.Name)
+
+			key := strings.Replace(strings.ToLower(col.Name), "_", "", -1)
+			if spellings[key] == nil {
+				spellings[key] = map[string]bool{}
+			}
+			spellings[key][col.Name] = true
+
+			if !snakeCase.MatchString(col.Name) {
+				outliers = append(outliers, &columnOutlier{
+					Table:      table.Name,
+					Column:     col.Name,
+					Kind:       "not-snake-case",
+					Suggestion: toSnakeCase(col.Name),
+				})
+			}
+		}
+	}
+	report.Names = len(tables)
+
+	for name, names := range tables {
+		if len(names) >= minTables {
+			sort.Strings(names)
+			report.Common = append(report.Common, &columnFrequency{Name: name, Count: len(names), Tables: names})
+		}
+		if len(types[name]) > 1 {
+			for _, names := range types[name] {
+				sort.Strings(names)
+			}
+			report.Inconsistent = append(report.Inconsistent, &columnTypeReport{Name: name, Types: types[name]})
+		}
+	}
+	sort.Slice(report.Common, func(i, j int) bool {
+		if report.Common[i].Count != report.Common[j].Count {
+			return report.Common[i].Count > report.Common[j].Count
+		}
+		return report.Common[i].Name < report.Common[j].Name
+	})
+	sort.Slice(report.Inconsistent, func(i, j int) bool { return report.Inconsistent[i].Name < report.Inconsistent[j].Name })
+
+	// a spelling used by fewer tables than another spelling of the same name is an outlier
+	for _, variants := range spellings {
+		if len(variants) < 2 {
+			continue
+		}
+		preferred := ""
+		for name := range variants {
+			if preferred == "" || len(tables[name]) > len(tables[preferred]) ||
+				(len(tables[name]) == len(tables[preferred]) && name < preferred) {
+				preferred = name
+			}
+		}
+		for name := range variants {
+			if name == preferred || len(tables[name]) == len(tables[preferred]) {
+				continue
+			}
+			for _, tname := range tables[name] {
+				outliers = append(outliers, &columnOutlier{Table: tname, Column: name, Kind: "variant-spelling", Suggestion: preferred})
+			}
+		}
+	}
+	sort.Slice(outliers, func(i, j int) bool {
+		if outliers[i].Table != outliers[j].Table {
+			return outliers[i].Table < outliers[j].Table
+		}
+		if outliers[i].Column != outliers[j].Column {
+			return outliers[i].Column < outliers[j].Column
+		}
+		return outliers[i].Kind < outliers[j].Kind
+	})
+	report.Outliers = append(report.Outliers, outliers...)
+
+	return report
+}
+
+// allTables returns every table of parser, ordered by name and then namespace.
+func allTables(parser *osqt.Parser) []*osqt.Table {
+	parser.RLock()
+	defer parser.RUnlock()
+
+	ret := []*osqt.Table{}
+	for _, ns := range parser.Namespaces {
+		for _, table := range ns.Tables {
+			ret = append(ret, table)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Name != ret[j].Name {
+			return ret[i].Name < ret[j].Name
+		}
+		return ret[i].NamespaceID < ret[j].NamespaceID
+	})
+	return ret
+}
+
+// toSnakeCase converts a camel case or otherwise punctuated name to snake case.
+func toSnakeCase(name string) string {
+	b := &strings.Builder{}
+	prevLower := false
+	for _, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if prevLower {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r - 'A' + 'a')
+			prevLower = false
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+			prevLower = true
+		default:
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+			prevLower = false
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+func printColumnsReport(report *columnsReport) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLUMN\tTABLES")
+	for _, cf := range report.Common {
+		fmt.Fprintf(tw, "%s\t%d\n", cf.Name, cf.Count)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "COLUMN\tTYPE\tTABLES")
+	for _, ct := range report.Inconsistent {
+		typs := make([]string, 0, len(ct.Types))
+		for typ := range ct.Types {
+			typs = append(typs, typ)
+		}
+		sort.Strings(typs)
+		for _, typ := range typs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", ct.Name, typ, strings.Join(ct.Types[typ], ", "))
+		}
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "TABLE\tCOLUMN\tOUTLIER\tSUGGESTION")
+	for _, o := range report.Outliers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Table, o.Column, o.Kind, o.Suggestion)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d column names across %d tables: %d common, %d with inconsistent types, %d naming outliers.\n",
+		report.Names, report.Tables, len(report.Common), len(report.Inconsistent), len(report.Outliers))
+	return nil
+}
+
+// tableVisibility is a table of the analyze hidden-columns command's output: its aliases, the columns SELECT *
+// leaves out, and the aliases of its columns.
+type tableVisibility struct {
+	Table         string              `json:"table"`
+	Aliases       []string            `json:"aliases,omitempty"`
+	Hidden        []*visibilityColumn `json:"hidden_columns,omitempty"`
+	ColumnAliases []*visibilityColumn `json:"column_aliases,omitempty"`
+}
+
+// visibilityColumn is a hidden or aliased column, with the platforms it only exists on if it is declared by
+// extended schemas.
+type visibilityColumn struct {
+	Column    string   `json:"column"`
+	Alias     string   `json:"alias,omitempty"`
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+var hiddenColumnsCommand = cli.Command{
+	Name:  "hidden-columns",
+	Usage: "Lists, for each table, the hidden columns SELECT * leaves out and the aliases of the table and its columns.",
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:        "schema",
+			Destination: &schemaPath,
+			Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+			EnvVar:      "OSQT_SCHEMA_PATH",
+		},
+		cli.StringFlag{
+			Name:        "specs-dir",
+			Destination: &specsDir,
+			Usage:       "Path to the OSQuery specs directory to parse.",
+			EnvVar:      "OSQT_SPECS_DIR",
+		},
+		cli.StringFlag{
+			Name:        "output-format",
+			Destination: &outputFormat,
+			Usage:       "Format to write the report in (options: 'text' or 'json').",
+			Value:       "text",
+		},
+	}, schemaOverlayFlags...),
+	Action: analyzeHiddenColumns,
+}
+
+func analyzeHiddenColumns(c *cli.Context) error {
+	if outputFormat != "text" && outputFormat != "json" {
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	report := []*tableVisibility{}
+	for _, table := range allTables(parser) {
+		if tv := tableVisibilityOf(table); tv != nil {
+			report = append(report, tv)
+		}
+	}
+
+	if outputFormat == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render hidden columns report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tKIND\tNAME\tREFERS TO\tPLATFORMS")
+	for _, tv := range report {
+		for _, alias := range tv.Aliases {
+			fmt.Fprintf(tw, "%s\ttable alias\t%s\t%s\t\n", tv.Table, alias, tv.Table)
+		}
+		for _, vc := range tv.Hidden {
+			fmt.Fprintf(tw, "%s\thidden column\t%s\t\t%s\n", tv.Table, vc.Column, strings.Join(vc.Platforms, ", "))
+		}
+		for _, vc := range tv.ColumnAliases {
+			fmt.Fprintf(tw, "%s\tcolumn alias\t%s\t%s\t%s\n", tv.Table, vc.Alias, vc.Column, strings.Join(vc.Platforms, ", "))
+		}
+	}
+	return tw.Flush()
+}
+
+// tableVisibilityOf returns the aliases and hidden and aliased columns of table, or nil if it has none. Columns of
+// extended schemas are listed once with every platform declaring them.
+func tableVisibilityOf(table *osqt.Table) *tableVisibility {
+	tv := &tableVisibility{Table: table.Name, Aliases: table.Aliases}
+	hidden := map[string]*visibilityColumn{}
+	aliases := map[string]*visibilityColumn{}
+	add := func(col *osqt.Column, platform string) {
+		if col.Hidden() {
+			vc, ok := hidden[col.Name]
+			if !ok {
+				vc = &visibilityColumn{Column: col.Name}
+				hidden[col.Name] = vc
+				tv.Hidden = append(tv.Hidden, vc)
+			}
+			if platform != "" {
+				vc.Platforms = append(vc.Platforms, platform)
+			}
+		}
+		for _, alias := range col.Aliases {
+			vc, ok := aliases[alias]
+			if !ok {
+				vc = &visibilityColumn{Column: col.Name, Alias: alias}
+				aliases[alias] = vc
+				tv.ColumnAliases = append(tv.ColumnAliases, vc)
+			}
+			if platform != "" {
+				vc.Platforms = append(vc.Platforms, platform)
+			}
+		}
+	}
+
+	table.RLock()
+	if table.Schema != nil {
+		for _, col := range table.Schema.Columns {
+			add(col, "")
+		}
+	}
+	platforms := make([]string, 0, len(table.ExtendedSchemas))
+	for platform := range table.ExtendedSchemas {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	for _, platform := range platforms {
+		for _, col := range table.ExtendedSchemas[platform].Columns {
+			add(col, platform)
+		}
+	}
+	table.RUnlock()
+
+	if len(tv.Aliases) == 0 && len(tv.Hidden) == 0 && len(tv.ColumnAliases) == 0 {
+		return nil
+	}
+	return tv
+}
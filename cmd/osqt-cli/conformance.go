@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+)
+
+var (
+	conformanceDSN     string
+	conformanceDrivers cli.StringSlice
+	conformanceTimeout time.Duration
+	conformanceCommand = cli.Command{
+		Name:  "conformance",
+		Usage: "Replays the statements MySQL client libraries issue against a running virtual server, through the Go driver, and reports how many of each library's statements it handles. The libraries themselves are not run.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "dsn",
+				Destination: &conformanceDSN,
+				Usage:       "Go MySQL DSN of the running server, e.g. root@tcp(127.0.0.1:3306)/vosqt (required).",
+				EnvVar:      "OSQT_CONFORMANCE_DSN",
+			},
+			cli.StringSliceFlag{
+				Name:  "driver",
+				Value: &conformanceDrivers,
+				Usage: "Only replay the statements of this client library (repeatable, options: " + strings.Join(conformanceDriverNames(), ", ") + ").",
+			},
+			cli.DurationFlag{
+				Name:        "timeout",
+				Destination: &conformanceTimeout,
+				Value:       10 * time.Second,
+				Usage:       "How long each check may take.",
+			},
+			cli.StringFlag{
+				Name:        "output-format",
+				Destination: &outputFormat,
+				Usage:       "Format to write the results in (options: 'text' or 'json').",
+				Value:       "text",
+			},
+		},
+		Action: runConformance,
+	}
+)
+
+// conformanceCheck is a statement or exchange a client library depends on. Drivers are the libraries that
+// issue it, and Run performs it on a connection of its own, using table, an osquery table the server serves.
+type conformanceCheck struct {
+	Name    string
+	Drivers []string
+	Run     func(ctx context.Context, conn *sql.Conn, table string) error
+}
+
+// conformanceResult is the outcome of a single conformanceCheck.
+type conformanceResult struct {
+	Check   string   `json:"check"`
+	Drivers []string `json:"drivers"`
+	Passed  bool     `json:"passed"`
+	Error   string   `json:"error,omitempty"`
+	Elapsed string   `json:"elapsed"`
+}
+
+// statementCoverage counts the checks of a client library that passed. It measures only whether the server
+// handles the statements the library is known to issue, replayed through the Go driver; the library itself is
+// never run, so full coverage is not proof that it works.
+type statementCoverage struct {
+	Passed int `json:"passed"`
+	Total  int `json:"total"`
+}
+
+// String implements the fmt.Stringer interface.
+func (c *statementCoverage) String() string {
+	return fmt.Sprintf("%d/%d statements", c.Passed, c.Total)
+}
+
+// conformanceReport is the structured form of the conformance command's output. Drivers maps each client library
+// to the statement coverage of its checks.
+type conformanceReport struct {
+	Results []*conformanceResult          `json:"results"`
+	Drivers map[string]*statementCoverage `json:"drivers"`
+}
+
+// queryCheck returns a check that runs query, with {table} replaced by the table's name, and reads every row of
+// its result.
+func queryCheck(query string, args ...interface{}) func(context.Context, *sql.Conn, string) error {
+	return func(ctx context.Context, conn *sql.Conn, table string) error {
+		return drainConn(ctx, conn, strings.Replace(query, "{table}", table, -1), args...)
+	}
+}
+
+// execCheck returns a check that executes each statement in turn.
+func execCheck(stmts ...string) func(context.Context, *sql.Conn, string) error {
+	return func(ctx context.Context, conn *sql.Conn, table string) error {
+		for _, stmt := range stmts {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return xerrors.Errorf("%s: %v", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// conformanceChecks are the statements known to be issued by the Go driver, MySQL Connector/J (JDBC), PyMySQL and
+// mysqlclient (python), SQLAlchemy, the Node.js mysql packages (node) and database tools such as DBeaver and Grafana
+// (tools), which browse the server's metadata. Every check is issued through the Go driver, so the wire protocol
+// details of the other libraries are not exercised.
+var conformanceChecks = []*conformanceCheck{
+	{Name: "ping", Drivers: []string{"go", "jdbc", "python", "sqlalchemy", "node", "tools"}, Run: func(ctx context.Context, conn *sql.Conn, table string) error {
+		return conn.PingContext(ctx)
+	}},
+	{Name: "select literal", Drivers: []string{"go", "jdbc", "python", "sqlalchemy", "node", "tools"}, Run: queryCheck("SELECT 1")},
+	{Name: "select expression alias", Drivers: []string{"node"}, Run: queryCheck("SELECT 1 + 1 AS solution")},
+	{Name: "prepared statement", Drivers: []string{"go", "jdbc"}, Run: queryCheck("SELECT * FROM {table} LIMIT ?", 1)},
+	{Name: "max_allowed_packet", Drivers: []string{"go"}, Run: queryCheck("SELECT @@max_allowed_packet")},
+	{Name: "session variables", Drivers: []string{"jdbc"}, Run: queryCheck("SELECT @@session.auto_increment_increment AS auto_increment_increment, @@character_set_client AS character_set_client, @@character_set_connection AS character_set_connection, @@character_set_results AS character_set_results, @@collation_server AS collation_server, @@max_allowed_packet AS max_allowed_packet, @@sql_mode AS sql_mode, @@system_time_zone AS system_time_zone, @@time_zone AS time_zone")},
+	{Name: "show variables", Drivers: []string{"jdbc", "tools"}, Run: queryCheck("SHOW VARIABLES")},
+	{Name: "set names", Drivers: []string{"jdbc", "python", "sqlalchemy"}, Run: execCheck("SET NAMES utf8mb4")},
+	{Name: "set autocommit", Drivers: []string{"jdbc", "python"}, Run: execCheck("SET autocommit=1")},
+	{Name: "version", Drivers: []string{"python", "tools"}, Run: queryCheck("SELECT VERSION()")},
+	{Name: "show warnings", Drivers: []string{"python"}, Run: queryCheck("SHOW WARNINGS")},
+	{Name: "sql_mode", Drivers: []string{"sqlalchemy"}, Run: queryCheck("SHOW VARIABLES LIKE 'sql_mode'")},
+	{Name: "current database", Drivers: []string{"sqlalchemy", "tools"}, Run: queryCheck("SELECT DATABASE()")},
+	{Name: "show collation", Drivers: []string{"sqlalchemy"}, Run: queryCheck("SHOW COLLATION")},
+	{Name: "cast returns", Drivers: []string{"sqlalchemy"}, Run: queryCheck("SELECT CAST('test plain returns' AS CHAR(60)) AS anon_1")},
+	{Name: "transaction", Drivers: []string{"jdbc", "python", "sqlalchemy"}, Run: execCheck("BEGIN", "COMMIT")},
+	{Name: "show databases", Drivers: []string{"tools"}, Run: queryCheck("SHOW DATABASES")},
+	{Name: "show tables", Drivers: []string{"sqlalchemy", "tools"}, Run: queryCheck("SHOW TABLES")},
+	{Name: "show full tables", Drivers: []string{"tools"}, Run: queryCheck("SHOW FULL TABLES")},
+	{Name: "describe table", Drivers: []string{"tools"}, Run: queryCheck("DESCRIBE {table}")},
+	{Name: "show columns", Drivers: []string{"sqlalchemy", "tools"}, Run: queryCheck("SHOW FULL COLUMNS FROM {table}")},
+	{Name: "information_schema tables", Drivers: []string{"jdbc", "tools"}, Run: queryCheck("SELECT table_name, table_type FROM information_schema.tables WHERE table_schema = DATABASE()")},
+	{Name: "information_schema columns", Drivers: []string{"jdbc", "tools"}, Run: queryCheck("SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = '{table}'")},
+	{Name: "select table rows", Drivers: []string{"go", "jdbc", "python", "sqlalchemy", "node", "tools"}, Run: queryCheck("SELECT * FROM {table} LIMIT 1")},
+}
+
+// conformanceDriverNames returns the client libraries the checks cover, in sorted order.
+func conformanceDriverNames() []string {
+	names := []string{}
+	for _, check := range conformanceChecks {
+		for _, driver := range check.Drivers {
+			if !containsString(names, driver) {
+				names = append(names, driver)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func containsString(list []string, s string) bool {
+	for _, elm := range list {
+		if elm == s {
+			return true
+		}
+	}
+	return false
+}
+
+// drainConn runs query on conn and reads every row of its result.
+func drainConn(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) error {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+
+	return rows.Err()
+}
+
+// conformanceTable returns the first table the server lists, for the checks that query one.
+func conformanceTable(ctx context.Context, db *sql.DB) (string, error) {
+	var table string
+	if err := db.QueryRowContext(ctx, "SHOW TABLES").Scan(&table); err != nil {
+		return "", xerrors.Errorf("error listing the server's tables: %v", err)
+	}
+	return table, nil
+}
+
+func runConformance(c *cli.Context) error {
+	if conformanceDSN == "" {
+		return xerrors.New("--dsn DSN was not provided")
+	}
+	known := conformanceDriverNames()
+	for _, driver := range conformanceDrivers {
+		if !containsString(known, driver) {
+			return xerrors.Errorf("unsupported --driver %q (options: %s)", driver, strings.Join(known, ", "))
+		}
+	}
+
+	db, err := sql.Open("mysql", conformanceDSN)
+	if err != nil {
+		return xerrors.Errorf("error parsing --dsn: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	tctx, tcancel := context.WithTimeout(ctx, conformanceTimeout)
+	table, err := conformanceTable(tctx, db)
+	tcancel()
+	if err != nil {
+		return err
+	}
+	log.Debugf("Running conformance checks against table %s.", table)
+
+	report := &conformanceReport{Results: []*conformanceResult{}, Drivers: map[string]*statementCoverage{}}
+	for _, check := range conformanceChecks {
+		drivers := []string{}
+		for _, driver := range check.Drivers {
+			if len(conformanceDrivers) == 0 || containsString(conformanceDrivers, driver) {
+				drivers = append(drivers, driver)
+			}
+		}
+		if len(drivers) == 0 {
+			continue
+		}
+
+		result := &conformanceResult{Check: check.Name, Drivers: drivers, Passed: true}
+		start := time.Now()
+		if err := runConformanceCheck(ctx, db, check, table); err != nil {
+			result.Passed, result.Error = false, err.Error()
+		}
+		result.Elapsed = time.Since(start).Round(time.Microsecond).String()
+		report.Results = append(report.Results, result)
+
+		for _, driver := range drivers {
+			coverage, ok := report.Drivers[driver]
+			if !ok {
+				coverage = &statementCoverage{}
+				report.Drivers[driver] = coverage
+			}
+			coverage.Total++
+			if result.Passed {
+				coverage.Passed++
+			}
+		}
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render conformance report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		if err := printConformance(report); err != nil {
+			return err
+		}
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	for _, coverage := range report.Drivers {
+		if coverage.Passed < coverage.Total {
+			return cli.NewExitError("", 1)
+		}
+	}
+	return nil
+}
+
+// runConformanceCheck runs check on a connection of its own, so statements that change the session do not affect
+// the checks that follow.
+func runConformanceCheck(ctx context.Context, db *sql.DB, check *conformanceCheck, table string) error {
+	ctx, cancel := context.WithTimeout(ctx, conformanceTimeout)
+	defer cancel()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return check.Run(ctx, conn, table)
+}
+
+func printConformance(report *conformanceReport) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tDRIVERS\tRESULT\tELAPSED\tERROR")
+	for _, r := range report.Results {
+		result := "pass"
+		if !r.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Check, strings.Join(r.Drivers, ","), result, r.Elapsed, r.Error)
+	}
+
+	drivers := make([]string, 0, len(report.Drivers))
+	for driver := range report.Drivers {
+		drivers = append(drivers, driver)
+	}
+	sort.Strings(drivers)
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "DRIVER\tSTATEMENT COVERAGE")
+	for _, driver := range drivers {
+		fmt.Fprintf(tw, "%s\t%s\n", driver, report.Drivers[driver])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt/internal/rusage"
+)
+
+var (
+	pprofAddr string
+	startTime = time.Now()
+)
+
+// runtimeMetrics is the payload served at /debug/runtime.
+type runtimeMetrics struct {
+	Uptime       string `json:"uptime"`
+	Goroutines   int    `json:"goroutines"`
+	CPUs         int    `json:"cpus"`
+	CPUTime      string `json:"cpu_time"`
+	HeapAlloc    uint64 `json:"heap_alloc_bytes"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	Sys          uint64 `json:"sys_bytes"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"gc_pause_total_ns"`
+}
+
+func serveRuntimeMetrics(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(&runtimeMetrics{
+		Uptime:       time.Since(startTime).Round(time.Second).String(),
+		Goroutines:   runtime.NumGoroutine(),
+		CPUs:         runtime.NumCPU(),
+		CPUTime:      rusage.ProcessCPUTime().String(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapObjects:  mem.HeapObjects,
+		Sys:          mem.Sys,
+		NumGC:        mem.NumGC,
+		PauseTotalNs: mem.PauseTotalNs,
+	})
+	if err != nil {
+		log.Debugf("Error writing runtime metrics: %v", err)
+	}
+}
+
+// startDiagnostics exposes net/http/pprof, expvar, and runtime metrics on addr in the background.
+func startDiagnostics(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/runtime", serveRuntimeMetrics)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return xerrors.Errorf("error starting diagnostics listener: %v", err)
+	}
+
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			log.Errorf("Diagnostics server exited: %v", err)
+		}
+	}()
+
+	log.Infof("Serving pprof and runtime diagnostics at http://%s/debug/", l.Addr().String())
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/zaplog"
+)
+
+var (
+	failOn      string
+	diffCommand = cli.Command{
+		Name:      "diff",
+		Usage:     "Compares two schema files (or specs directories) and reports added, removed, and retyped tables and columns.",
+		ArgsUsage: "OLD NEW",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "fail-on",
+				Destination: &failOn,
+				Value:       "none",
+				Usage:       "Exit non-zero when changes of this class are found (options: 'none', 'breaking', 'any').",
+				EnvVar:      "OSQT_DIFF_FAIL_ON",
+			},
+			cli.StringFlag{
+				Name:        "output-format",
+				Destination: &outputFormat,
+				Usage:       "Format to write the report in (options: 'text' or 'json').",
+				Value:       "text",
+			},
+		},
+		Action: diffSchemas,
+	}
+)
+
+// loadParserFrom parses a schema file or a specs directory into a new parser.
+func loadParserFrom(loc string) (*osqt.Parser, error) {
+	defer phase("parse " + loc)()
+
+	parser := osqt.NewParserWithOptions(zaplog.New(log.Named("parser")), parserOptions())
+	if isValidDirectory(loc) == nil {
+		if err := parser.ParseDirectory(loc); err != nil {
+			return nil, xerrors.Errorf("error attempting to parse directory %s: %v", loc, err)
+		}
+		recordParser(parser, -1)
+		return parser, nil
+	}
+
+	if err := parseSchemaFile(parser, loc); err != nil {
+		return nil, xerrors.Errorf("error attempting to load %s: %v", loc, err)
+	}
+	recordParser(parser, 1)
+	return parser, nil
+}
+
+func diffSchemas(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("diff requires exactly two arguments: OLD NEW")
+	}
+	if failOn != "none" && failOn != "breaking" && failOn != "any" {
+		return xerrors.Errorf("unsupported --fail-on %q (options: 'none', 'breaking', 'any')", failOn)
+	}
+
+	oldParser, err := loadParserFrom(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	newParser, err := loadParserFrom(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	d := osqt.DiffParsers(oldParser, newParser)
+	breaking := d.Breaking()
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render diff as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		for _, change := range d.Changes {
+			marker := " "
+			if change.Breaking() {
+				marker = "!"
+			}
+			fmt.Fprintf(os.Stdout, "%s %s\n", marker, change)
+		}
+		log.Infof("%d changes found (%d breaking).", len(d.Changes), len(breaking))
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	if failOn == "breaking" && len(breaking) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d breaking schema changes found", len(breaking)), 2)
+	}
+	if failOn == "any" && len(d.Changes) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d schema changes found", len(d.Changes)), 2)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt/generator"
+)
+
+var dryRun = false
+
+// writeOutputFile writes data to fileloc, or only reports what the write would do when --dry-run is set.
+func writeOutputFile(fileloc string, data []byte) error {
+	if dryRun {
+		change, err := generator.PlanFile(fileloc, data)
+		if err != nil {
+			return xerrors.Errorf("error planning write to %s: %v", fileloc, err)
+		}
+		printFileChanges([]*generator.FileChange{change})
+		return nil
+	}
+
+	if err := ioutil.WriteFile(fileloc, data, 0644); err != nil {
+		return xerrors.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+// writeOutputFiles writes files, keyed by slash separated paths relative to dir, under dir in order of path,
+// creating their directories. In dry-run mode the changes are printed instead.
+func writeOutputFiles(dir string, files map[string][]byte) error {
+	paths := make([]string, 0, len(files))
+	for rel := range files {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	for _, rel := range paths {
+		fileloc := filepath.Join(dir, filepath.FromSlash(rel))
+		if !dryRun {
+			if err := os.MkdirAll(filepath.Dir(fileloc), 0755); err != nil {
+				return xerrors.Errorf("error creating directory for %s: %v", rel, err)
+			}
+		}
+		if err := writeOutputFile(fileloc, files[rel]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printFileChanges prints the planned changes to stdout, followed by a diff for small modified text files.
+func printFileChanges(changes []*generator.FileChange) {
+	counts := map[generator.FileAction]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+		fmt.Printf("[dry-run] %s\n", change.String())
+		if change.Diff == "" {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(change.Diff, "\n"), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	log.Infof("Dry run: %d files would be created, %d modified, %d deleted, %d unchanged.", counts[generator.FileCreate], counts[generator.FileModify], counts[generator.FileDelete], counts[generator.FileUnchanged])
+}
@@ -1,26 +1,66 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/urfave/cli"
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v3"
 
 	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/attack"
+	"github.com/gen0cide/osqt/export"
+	"github.com/gen0cide/osqt/generator"
+	"github.com/gen0cide/osqt/virtual"
+	"github.com/gen0cide/osqt/zaplog"
 )
 
 var (
 	outputFile   string
 	outputFormat string
 	specsDir     string
-	expCommands  = []cli.Command{
+	maxTokens    int
+	manifestGens cli.StringSlice
+	filterTables cli.StringSlice
+	splitDir     string
+	withMetadata bool
+	mappingFile  string
+
+	// exportBuildFlags describe the osquery build being exported, whose tables are the only ones exported.
+	exportBuildFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:        "build-without",
+			Destination: &buildWithout,
+			Usage:       "Comma separated optional namespaces the target osquery build was compiled without (e.g. 'yara,sleuthkit'), whose tables are not exported.",
+			EnvVar:      "OSQT_BUILD_WITHOUT",
+		},
+		cli.StringFlag{
+			Name:        "disable-tables",
+			Destination: &disableTables,
+			Usage:       "Comma separated tables to leave out, as osqueryd's --disable_tables flag does.",
+			EnvVar:      "OSQT_DISABLE_TABLES",
+		},
+		cli.StringFlag{
+			Name:        "enable-tables",
+			Destination: &enableTables,
+			Usage:       "Comma separated tables to export, leaving out every other table, as osqueryd's --enable_tables flag does. --disable-tables takes precedence.",
+			EnvVar:      "OSQT_ENABLE_TABLES",
+		},
+	}
+
+	expCommands = []cli.Command{
 		{
 			Name:  "schema",
-			Usage: "Exports a structured JSON or YAML file containing the Schema of OSQuery's tables.",
-			Flags: []cli.Flag{
+			Usage: "Exports a structured JSON, YAML, TOML or JSONL file containing the Schema of OSQuery's tables.",
+			Flags: append(append([]cli.Flag{
 				cli.StringFlag{
 					Name:        "specs-dir",
 					Destination: &specsDir,
@@ -36,16 +76,293 @@ var (
 				cli.StringFlag{
 					Name:        "output-format",
 					Destination: &outputFormat,
-					Usage:       "Format to write the the generated schema in (options: 'json' or 'yaml').",
+					Usage:       "Format to write the the generated schema in (options: 'json', 'yaml', 'toml' or 'jsonl' (one table per line)).",
 					Value:       "json",
 					EnvVar:      "OSQT_OUTPUT_FORMAT",
 				},
-			},
+				cli.StringFlag{
+					Name:        "target-os, platform",
+					Destination: &targetOS,
+					Usage:       "Only export the namespaces and extended schemas available on this platform (options: 'windows', 'linux', 'darwin', 'freebsd').",
+					EnvVar:      "OSQT_TARGET_OS",
+				},
+				cli.StringSliceFlag{
+					Name:  "table",
+					Value: &filterTables,
+					Usage: "Only export the table with this name or alias (may be repeated).",
+				},
+				cli.StringFlag{
+					Name:        "namespace",
+					Destination: &filterNamespace,
+					Usage:       "Only export the tables within this namespace (e.g. 'darwin').",
+				},
+				cli.StringFlag{
+					Name:        "split-dir",
+					Destination: &splitDir,
+					Usage:       "Write each table to its own <namespace>/<table> file under this directory instead of a single schema file.",
+					EnvVar:      "OSQT_SPLIT_DIR",
+				},
+				cli.BoolFlag{
+					Name:        "metadata",
+					Destination: &withMetadata,
+					Usage:       "Wrap the schema in an envelope recording the osqt and osquery versions it was generated by and its checksum (json, yaml and toml only).",
+					EnvVar:      "OSQT_METADATA",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
 			Action: exportSchema,
 		},
+		{
+			Name:  "ai-context",
+			Usage: "Exports a chunked JSONL corpus of table and column documentation for retrieval-augmented assistants.",
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "output-file",
+					Destination: &outputFile,
+					Usage:       "Path to write the JSONL corpus (STDOUT if empty).",
+					EnvVar:      "OSQT_OUTPUT_FILE",
+				},
+				cli.IntFlag{
+					Name:        "max-tokens",
+					Destination: &maxTokens,
+					Value:       export.DefaultMaxTokens,
+					Usage:       "Split records estimated to be larger than this many tokens into multiple chunks.",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
+			Action: exportAIContext,
+		},
+		{
+			Name:  "csv",
+			Usage: "Exports a CSV catalog of every column, one row per table and column, with its type, description, platforms and options.",
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "output-file",
+					Destination: &outputFile,
+					Usage:       "Path to write the CSV catalog (STDOUT if empty).",
+					EnvVar:      "OSQT_OUTPUT_FILE",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
+			Action: exportCSV,
+		},
+		{
+			Name:  "ecs",
+			Usage: "Exports the Elastic Common Schema field of each column with a known mapping (pid to process.pid, path to file.path) and the columns without one.",
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "mapping",
+					Destination: &mappingFile,
+					Usage:       "JSON or YAML file of column and table.column to ECS field mappings, overriding the bundled ones (an empty field unmaps a column).",
+					EnvVar:      "OSQT_ECS_MAPPING",
+				},
+				cli.StringFlag{
+					Name:        "output-file",
+					Destination: &outputFile,
+					Usage:       "File to write the mapping report to (defaults to stdout).",
+					EnvVar:      "OSQT_OUTPUT_FILE",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the mapping report in (options: 'json' or 'yaml').",
+					Value:       "json",
+					EnvVar:      "OSQT_OUTPUT_FORMAT",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
+			Action: exportECS,
+		},
+		{
+			Name:  "sqlite",
+			Usage: "Exports a SQLite database file containing every table's schema (and optionally fixture rows).",
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "output",
+					Destination: &outputFile,
+					Usage:       "Path to write the SQLite database to (required).",
+					EnvVar:      "OSQT_OUTPUT_FILE",
+				},
+				cli.StringFlag{
+					Name:        "fixtures-dir",
+					Destination: &fixturesDir,
+					Usage:       "Directory of <table>.json or <table>.yaml fixture files to load into the tables.",
+					EnvVar:      "OSQT_FIXTURES_DIR",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
+			Action: exportSQLite,
+		},
+		{
+			Name:  "manifest",
+			Usage: "Exports a release manifest: tool version, schema fingerprint, per-platform table counts, and generated output hashes.",
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "output-file",
+					Destination: &outputFile,
+					Usage:       "File to write the manifest to (defaults to stdout).",
+					EnvVar:      "OSQT_OUTPUT_FILE",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the manifest in (options: 'json' or 'yaml').",
+					Value:       "json",
+					EnvVar:      "OSQT_OUTPUT_FORMAT",
+				},
+				cli.StringSliceFlag{
+					Name:  "target",
+					Value: &manifestGens,
+					Usage: "Generator whose output is hashed into the manifest (repeatable, defaults to every registered generator).",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
+			Action: exportManifest,
+		},
+		{
+			Name:  "test-vectors",
+			Usage: "Exports spec snippets for every feature of the table spec syntax paired with the JSON osqt parses them into, for validating other spec parsers.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "output-file",
+					Destination: &outputFile,
+					Usage:       "File to write the test vectors to (defaults to stdout).",
+					EnvVar:      "OSQT_OUTPUT_FILE",
+				},
+			},
+			Action: exportTestVectors,
+		},
+		{
+			Name:  "specs",
+			Usage: "Regenerates canonical .table spec files from a schema, writing them under specs/ of the output directory.",
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "output-dir",
+					Destination: &outputDir,
+					Usage:       "Directory to write the specs directory into (required).",
+					EnvVar:      "OSQT_OUTPUT_DIR",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
+			Action: exportSpecs,
+		},
+		{
+			Name:  "ossem",
+			Usage: "Writes an OSSEM data dictionary entry for each table on each platform, as <platform>/osquery/<table>.yml under the output directory.",
+			Flags: append(append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "mapping",
+					Destination: &mappingFile,
+					Usage:       "JSON or YAML file of ATT&CK data components, overriding the bundled ones the entries' attack_data_sources are taken from.",
+					EnvVar:      "OSQT_ATTACK_MAPPING",
+				},
+				cli.StringFlag{
+					Name:        "output-dir",
+					Destination: &outputDir,
+					Usage:       "Directory to write the data dictionary into (required).",
+					EnvVar:      "OSQT_OUTPUT_DIR",
+				},
+			}, exportBuildFlags...), schemaOverlayFlags...),
+			Action: exportOSSEM,
+		},
 	}
 )
 
+// loadExportParser loads the parser like loadParser, and removes the tables the build described by
+// --build-without, --disable-tables and --enable-tables does not serve.
+func loadExportParser() (*osqt.Parser, error) {
+	build := buildConfig()
+	if err := build.Validate(); err != nil {
+		return nil, xerrors.Errorf("--build-without value was invalid: %v", err)
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return nil, err
+	}
+	if removed := parser.ApplyBuildConfig(build); removed > 0 {
+		log.Debugf("Left %d tables the target build does not serve out of the export.", removed)
+	}
+	return parser, nil
+}
+
 func isValidDirectory(loc string) error {
 	fsinfo, err := os.Stat(loc)
 	if err != nil {
@@ -64,46 +381,554 @@ func exportSchema(c *cli.Context) error {
 	if err := isValidDirectory(specsDir); err != nil {
 		return xerrors.Errorf("--specs-dir value was invalid: %v", err)
 	}
+	if _, ok := osqt.GOOSToApplicableNamespaces[targetOS]; targetOS != "" && !ok {
+		return xerrors.Errorf("--target-os value provided (%s) was not valid (valid: 'windows', 'linux', 'darwin', 'freebsd').", targetOS)
+	}
+	if _, ok := schemaFormats[outputFormat]; !ok {
+		return xerrors.Errorf("unsupported --output-format %q (options: 'json', 'yaml', 'toml' or 'jsonl')", outputFormat)
+	}
+	if splitDir != "" && outputFile != "" {
+		return xerrors.New("--split-dir and --output-file cannot be used together")
+	}
+	if withMetadata && (splitDir != "" || outputFormat == "jsonl") {
+		return xerrors.New("--metadata cannot be used with --split-dir or the jsonl format, which have no top level to hold it")
+	}
+
+	// the specs are loaded like every other command's, so --json-schemas, --deprecations, --fleet-schema and
+	// --atc-config reach the export, less the tables the --build-without build does not serve
+	parser, err := loadExportParser()
+	if err != nil {
+		return err
+	}
+
+	namespaces := parser.Namespaces
+	if targetOS != "" {
+		namespaces = parser.NamespacesFor(targetOS)
+		log.Debugf("Exporting the %d namespaces available on %s.", len(namespaces), targetOS)
+	}
+	namespaces, err = filterExportNamespaces(parser, namespaces)
+	if err != nil {
+		return err
+	}
+
+	tables := 0
+	for _, ns := range namespaces {
+		tables += len(ns.Tables)
+	}
+
+	if splitDir != "" {
+		return exportSplitSchema(namespaces)
+	}
+
+	var meta *osqt.SchemaMetadata
+	if withMetadata {
+		meta, err = exportMetadata(namespaces)
+		if err != nil {
+			return err
+		}
+	}
+
+	// JSON is streamed rather than built in memory, except for dry runs which diff the whole file
+	if !dryRun && (outputFormat == "json" || outputFormat == "jsonl") {
+		return streamSchema(meta, namespaces, tables)
+	}
+
+	var doc interface{} = namespaces
+	if meta != nil {
+		doc = &osqt.SchemaEnvelope{Metadata: meta, Namespaces: namespaces}
+	}
+	data, err := renderSchema(doc)
+	if err != nil {
+		return err
+	}
+
+	if outputFile == "" {
+		fmt.Printf("%s\n", strings.TrimRight(string(data), "\n"))
+		return nil
+	}
+
+	if err := writeOutputFile(outputFile, data); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("%d table schemas written to %s (%d bytes).", tables, outputFile, len(data))
+
+	return nil
+}
+
+// exportMetadata returns the metadata of the versioned export of namespaces, with the osquery release detected
+// from the git checkout holding --specs-dir. A release that cannot be detected is left out.
+func exportMetadata(namespaces map[string]*osqt.Namespace) (*osqt.SchemaMetadata, error) {
+	version, commit, err := osqt.DetectOSQueryRelease(specsDir)
+	if err != nil {
+		log.Warnf("Could not detect the osquery release of %s, leaving it out of the metadata: %v", specsDir, err)
+	}
+	meta, err := osqt.NewSchemaMetadata(namespaces, version, commit)
+	if err != nil {
+		return nil, xerrors.Errorf("error attempting to build schema metadata: %v", err)
+	}
+	log.Debugf("Exporting schema of osquery %s (%s), sha256 %s.", version, commit, meta.SHA256)
+	return meta, nil
+}
+
+// streamSchema writes namespaces as JSON or JSONL straight to the output file or stdout, one table at a time,
+// wrapped in a versioned envelope if meta is not nil. The output file is written next to its destination and
+// moved into place once complete.
+func streamSchema(meta *osqt.SchemaMetadata, namespaces map[string]*osqt.Namespace, tables int) error {
+	write := export.WriteSchemaJSON
+	switch {
+	case outputFormat == "jsonl":
+		write = export.WriteTablesJSONL
+	case meta != nil:
+		write = func(w io.Writer, namespaces map[string]*osqt.Namespace) error {
+			return export.WriteEnvelopeJSON(w, meta, namespaces)
+		}
+	}
+
+	if outputFile == "" {
+		if err := write(os.Stdout, namespaces); err != nil {
+			return xerrors.Errorf("error attempting to render tables as %s: %v", strings.ToUpper(outputFormat), err)
+		}
+		if outputFormat == "json" {
+			fmt.Println()
+		}
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+".")
+	if err != nil {
+		return xerrors.Errorf("error writing output file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
 
-	parser := osqt.NewParser(log.Named("parser"))
+	if err := write(tmp, namespaces); err != nil {
+		tmp.Close()
+		return xerrors.Errorf("error writing output file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return xerrors.Errorf("error writing output file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return xerrors.Errorf("error writing output file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), outputFile); err != nil {
+		return xerrors.Errorf("error writing output file: %v", err)
+	}
 
-	if err := parser.ParseDirectory(specsDir); err != nil {
-		return xerrors.Errorf("error attempting to parse directory: %v", err)
+	size := int64(0)
+	if info, err := os.Stat(outputFile); err == nil {
+		size = info.Size()
 	}
+	log.Infof("%d table schemas written to %s (%d bytes).", tables, outputFile, size)
+	return nil
+}
+
+// schemaFormats maps the --output-format values of schema exports to their file extensions.
+var schemaFormats = map[string]string{
+	"json":  ".json",
+	"yaml":  ".yaml",
+	"toml":  ".toml",
+	"jsonl": ".jsonl",
+}
 
+// renderSchema encodes v, the namespaces or a single table of a schema export, in the --output-format. JSONL
+// writes one table per line.
+func renderSchema(v interface{}) ([]byte, error) {
 	var data []byte
 	var err error
+	switch outputFormat {
+	case "yaml":
+		data, err = yaml.Marshal(v)
+	case "toml":
+		data, err = export.MarshalTOML(v)
+	case "jsonl":
+		if namespaces, ok := v.(map[string]*osqt.Namespace); ok {
+			data, err = export.MarshalTablesJSONL(namespaces)
+		} else if data, err = json.Marshal(v); err == nil {
+			data = append(data, '\n')
+		}
+	default:
+		data, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error attempting to render tables as %s: %v", strings.ToUpper(outputFormat), err)
+	}
+	return data, nil
+}
 
-	if outputFormat == "yaml" {
-		data, err = yaml.Marshal(parser.Namespaces)
-		if err != nil {
-			return xerrors.Errorf("error attempting to render tables as YAML: %v", err)
+// exportSplitSchema writes every table of namespaces to its own file, --split-dir/<namespace>/<table>.<format>.
+func exportSplitSchema(namespaces map[string]*osqt.Namespace) error {
+	ext := schemaFormats[outputFormat]
+
+	nsids := make([]string, 0, len(namespaces))
+	for nsid := range namespaces {
+		nsids = append(nsids, nsid)
+	}
+	sort.Strings(nsids)
+
+	files := 0
+	for _, nsid := range nsids {
+		ns := namespaces[nsid]
+		tnames := make([]string, 0, len(ns.Tables))
+		for tname := range ns.Tables {
+			tnames = append(tnames, tname)
+		}
+		sort.Strings(tnames)
+
+		dir := filepath.Join(splitDir, nsid)
+		if !dryRun {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return xerrors.Errorf("error creating directory for namespace %s: %v", nsid, err)
+			}
+		}
+		for _, tname := range tnames {
+			data, err := renderSchema(ns.Tables[tname])
+			if err != nil {
+				return xerrors.Errorf("table %s: %v", tname, err)
+			}
+			if err := writeOutputFile(filepath.Join(dir, tname+ext), data); err != nil {
+				return err
+			}
+			files++
+		}
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("%d table schemas written to %s.", files, splitDir)
+	return nil
+}
+
+// filterExportNamespaces returns the namespaces holding only the tables the --table and --namespace flags select,
+// dropping namespaces left empty. It returns an error if a --table matched no table.
+func filterExportNamespaces(parser *osqt.Parser, namespaces map[string]*osqt.Namespace) (map[string]*osqt.Namespace, error) {
+	if len(filterTables) == 0 && filterNamespace == "" {
+		return namespaces, nil
+	}
+
+	matched := map[string]bool{}
+	filtered := map[string]*osqt.Namespace{}
+	for nsid, ns := range namespaces {
+		if filterNamespace != "" && nsid != filterNamespace {
+			continue
+		}
+		selected := osqt.NewNamespace(ns.Key, ns.Name, parser, ns.Logger())
+		selected.Availability = ns.Availability
+		for tname, table := range ns.Tables {
+			if len(filterTables) > 0 {
+				name := exportTableMatch(table)
+				if name == "" {
+					continue
+				}
+				matched[name] = true
+			}
+			selected.Tables[tname] = table
 		}
+		if len(selected.Tables) > 0 {
+			filtered[nsid] = selected
+		}
+	}
+
+	for _, name := range filterTables {
+		if !matched[name] {
+			return nil, xerrors.Errorf("--table %s did not match any table being exported", name)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, xerrors.New("the filters did not match any table")
+	}
+	return filtered, nil
+}
+
+// exportTableMatch returns the --table value naming table or one of its aliases, or an empty string if none does.
+func exportTableMatch(table *osqt.Table) string {
+	for _, name := range filterTables {
+		if strings.EqualFold(table.Name, name) {
+			return name
+		}
+		for _, alias := range table.Aliases {
+			if strings.EqualFold(alias, name) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func exportAIContext(c *cli.Context) error {
+	parser, err := loadExportParser()
+	if err != nil {
+		return err
+	}
+
+	records := export.AIContext(parser, maxTokens)
+	data, err := export.MarshalJSONL(records)
+	if err != nil {
+		return xerrors.Errorf("error attempting to render context records: %v", err)
+	}
+
+	if outputFile == "" {
+		fmt.Printf("%s", string(data))
+		return nil
+	}
+
+	if err := writeOutputFile(outputFile, data); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("%d context records written to %s (%d bytes).", len(records), outputFile, len(data))
+	return nil
+}
+
+func exportCSV(c *cli.Context) error {
+	parser, err := loadExportParser()
+	if err != nil {
+		return err
+	}
+
+	rows := export.ColumnCatalog(parser)
+	buf := new(bytes.Buffer)
+	if err := export.WriteCatalogCSV(buf, rows); err != nil {
+		return xerrors.Errorf("error attempting to render column catalog: %v", err)
+	}
+
+	if outputFile == "" {
+		fmt.Printf("%s", buf.String())
+		return nil
+	}
+
+	if err := writeOutputFile(outputFile, buf.Bytes()); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("%d columns written to %s (%d bytes).", len(rows), outputFile, buf.Len())
+	return nil
+}
+
+func exportECS(c *cli.Context) error {
+	if outputFormat != "json" && outputFormat != "yaml" {
+		return xerrors.Errorf("unsupported --output-format %q (options: 'json' or 'yaml')", outputFormat)
+	}
+
+	mapping := export.DefaultECSMapping()
+	if mappingFile != "" {
+		var err error
+		if mapping, err = export.LoadECSMapping(mappingFile); err != nil {
+			return err
+		}
+	}
+
+	parser, err := loadExportParser()
+	if err != nil {
+		return err
+	}
+
+	report := export.ECSFields(parser, mapping)
+	var data []byte
+	if outputFormat == "yaml" {
+		data, err = yaml.Marshal(report)
 	} else {
-		data, err = json.MarshalIndent(parser.Namespaces, "", "  ")
+		data, err = json.MarshalIndent(report, "", "  ")
+	}
+	if err != nil {
+		return xerrors.Errorf("error attempting to render ECS mapping: %v", err)
+	}
+
+	if outputFile == "" {
+		fmt.Printf("%s\n", strings.TrimRight(string(data), "\n"))
+		return nil
+	}
+	log.Infof("%d of %d columns map to ECS fields.", len(report.Mapped), report.Columns)
+	return writeOutputFile(outputFile, data)
+}
+
+func exportSQLite(c *cli.Context) error {
+	if outputFile == "" {
+		return xerrors.New("--output PATH was not provided")
+	}
+
+	parser, err := loadExportParser()
+	if err != nil {
+		return err
+	}
+
+	fixtures := virtual.Fixtures{}
+	if fixturesDir != "" {
+		fixtures, err = virtual.LoadFixtures(fixturesDir)
 		if err != nil {
-			return xerrors.Errorf("error attempting to render tables as JSON: %v", err)
+			return err
 		}
 	}
 
+	// build the database in a scratch location so a failed export never clobbers an existing file
+	tmp, err := ioutil.TempDir("", "osqt-sqlite-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	dbfile := filepath.Join(tmp, "osquery.db")
+	if err := export.WriteSQLite(parser, dbfile, fixtures); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(dbfile)
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(outputFile, data); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("SQLite database written to %s (%d bytes, fixtures for %d tables).", outputFile, len(data), len(fixtures))
+	return nil
+}
+
+func exportManifest(c *cli.Context) error {
+	parser, err := loadExportParser()
+	if err != nil {
+		return err
+	}
+
+	targets := []string(manifestGens)
+	if len(targets) == 0 {
+		targets = generator.Names()
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	manifest, err := export.BuildManifest(ctx, parser, targets, log.Named("generator"))
+	if err != nil {
+		return err
+	}
+	manifest.Source = schemaPath
+	if specsDir != "" {
+		manifest.Source = specsDir
+	}
+
+	var data []byte
+	switch outputFormat {
+	case "json":
+		data, err = json.MarshalIndent(manifest, "", "  ")
+	case "yaml":
+		data, err = yaml.Marshal(manifest)
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'json' or 'yaml')", outputFormat)
+	}
+	if err != nil {
+		return xerrors.Errorf("error attempting to render manifest: %v", err)
+	}
+
 	if outputFile == "" {
 		fmt.Printf("%s\n", string(data))
 		return nil
 	}
+	if err := writeOutputFile(outputFile, data); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("Manifest for %d tables and %d targets written to %s.", manifest.Tables, len(manifest.Targets), outputFile)
+	return nil
+}
+
+func exportTestVectors(c *cli.Context) error {
+	suite, err := export.TestVectors(osqt.NewParser(zaplog.New(log.Named("parser"))))
+	if err != nil {
+		return err
+	}
 
-	fw, err := os.Create(outputFile)
+	data, err := json.MarshalIndent(suite, "", "  ")
 	if err != nil {
-		return xerrors.Errorf("error opening output file for writing data: %v", err)
+		return xerrors.Errorf("error attempting to render test vectors: %v", err)
+	}
+
+	if outputFile == "" {
+		fmt.Printf("%s\n", string(data))
+		return nil
+	}
+
+	if err := writeOutputFile(outputFile, data); err != nil {
+		return err
 	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("%d test vectors written to %s (%d bytes).", len(suite.Vectors), outputFile, len(data))
+	return nil
+}
 
-	defer fw.Close()
+func exportSpecs(c *cli.Context) error {
+	if outputDir == "" {
+		return xerrors.New("--output-dir PATH was not provided")
+	}
 
-	bytesWritten, err := fw.Write(data)
+	parser, err := loadExportParser()
 	if err != nil {
-		return xerrors.Errorf("error writing output file: %v", err)
+		return err
+	}
+	files, err := export.Specs(parser)
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutputFiles(outputDir, files); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	log.Infof("%d spec files written to %s.", len(files), filepath.Join(outputDir, "specs"))
+	return nil
+}
+
+func exportOSSEM(c *cli.Context) error {
+	if outputDir == "" {
+		return xerrors.New("--output-dir PATH was not provided")
 	}
 
-	log.Infof("%d table schemas written to %s (%d bytes).", len(parser.Namespaces), outputFile, bytesWritten)
+	mapping := attack.DefaultMapping()
+	if mappingFile != "" {
+		var err error
+		if mapping, err = attack.LoadMapping(mappingFile); err != nil {
+			return err
+		}
+	}
+
+	parser, err := loadExportParser()
+	if err != nil {
+		return err
+	}
+	files, err := export.OSSEMDictionary(parser, mapping)
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutputFiles(outputDir, files); err != nil {
+		return err
+	}
+	if dryRun {
+		return nil
+	}
 
+	log.Infof("%d OSSEM data dictionary entries written to %s.", len(files), outputDir)
 	return nil
 }
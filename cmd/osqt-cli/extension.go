@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"time"
+
+	osquery "github.com/osquery/osquery-go"
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt/virtual"
+)
+
+var (
+	fixturesDir      string
+	syntheticRows    int
+	syntheticSeed    int64
+	extensionName    string
+	extensionTables  cli.StringSlice
+	extensionCommand = cli.Command{
+		Name:  "extension",
+		Usage: "Registers the parsed tables with a running osquery as extension table plugins serving fixture or synthetic data.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "schema",
+				Destination: &schemaPath,
+				Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+				EnvVar:      "OSQT_SCHEMA_PATH",
+			},
+			cli.StringFlag{
+				Name:        "specs-dir",
+				Destination: &specsDir,
+				Usage:       "Path to the OSQuery specs directory to parse.",
+				EnvVar:      "OSQT_SPECS_DIR",
+			},
+			cli.StringFlag{
+				Name:        "target-os",
+				Value:       runtime.GOOS,
+				Destination: &targetOS,
+				Usage:       "Platform whose tables (and extended columns) should be registered.",
+				EnvVar:      "OSQT_TARGET_OS",
+			},
+			cli.StringFlag{
+				Name:        "socket",
+				Destination: &extensionSocket,
+				Usage:       "Path to the osquery extension socket to register with (required).",
+				EnvVar:      "OSQT_EXTENSION_SOCKET",
+			},
+			cli.StringFlag{
+				Name:        "name",
+				Destination: &extensionName,
+				Value:       "osqt",
+				Usage:       "Name the extension registers itself under.",
+				EnvVar:      "OSQT_EXTENSION_NAME",
+			},
+			cli.StringSliceFlag{
+				Name:  "table",
+				Value: &extensionTables,
+				Usage: "Only register this table (can be repeated). Defaults to every table for the target OS that osquery does not already provide.",
+			},
+			cli.StringFlag{
+				Name:        "fixtures-dir",
+				Destination: &fixturesDir,
+				Usage:       "Directory of <table>.json or <table>.yaml files containing the rows to serve.",
+				EnvVar:      "OSQT_FIXTURES_DIR",
+			},
+			cli.IntFlag{
+				Name:        "synthetic-rows",
+				Destination: &syntheticRows,
+				Value:       3,
+				Usage:       "Number of synthetic rows to serve for tables without a fixture.",
+			},
+			cli.Int64Flag{
+				Name:        "seed",
+				Destination: &syntheticSeed,
+				Usage:       "Seed for the synthetic rows. The same seed generates the same rows on every run.",
+				EnvVar:      "OSQT_SEED",
+			},
+		}, schemaOverlayFlags...),
+		Action: runExtension,
+	}
+)
+
+func runExtension(c *cli.Context) error {
+	if extensionSocket == "" {
+		return xerrors.New("--socket PATH was not provided")
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+
+	fixtures := virtual.Fixtures{}
+	if fixturesDir != "" {
+		fixtures, err = virtual.LoadFixtures(fixturesDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	tables := parser.TablesFor(targetOS)
+	if len(tables) == 0 {
+		return xerrors.Errorf("no tables found for --target-os %s", targetOS)
+	}
+
+	server, err := osquery.NewExtensionManagerServer(extensionName, extensionSocket, osquery.ServerTimeout(10*time.Second))
+	if err != nil {
+		return xerrors.Errorf("error creating extension server: %v", err)
+	}
+
+	// osquery refuses to register a table plugin under the name of a table it already has, failing the whole
+	// extension, so only the tables it lacks are served
+	builtin, err := registeredTables(extensionSocket)
+	if err != nil {
+		return err
+	}
+	selected := extensionTables.Value()
+	if len(selected) == 0 {
+		for tname := range tables {
+			if builtin[tname] {
+				log.Debugf("Skipping table %s, which osquery already provides", tname)
+				continue
+			}
+			selected = append(selected, tname)
+		}
+		if len(selected) == 0 {
+			return xerrors.Errorf("osquery already provides every table for %s, select tables with --table", targetOS)
+		}
+		sort.Strings(selected)
+	}
+
+	faker := virtual.NewFaker(syntheticSeed)
+	for _, tname := range selected {
+		table, ok := tables[tname]
+		if !ok {
+			return xerrors.Errorf("table %s does not exist for %s", tname, targetOS)
+		}
+		if builtin[tname] {
+			return xerrors.Errorf("table %s is already provided by osquery and cannot be registered by an extension", tname)
+		}
+		server.RegisterPlugin(virtual.NewTablePlugin(table, targetOS, fixtures, syntheticRows, faker))
+		log.Debugf("Registered table plugin %s (fixture: %v)", tname, fixtures[tname] != nil)
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	log.Infof("Registering %d tables with osquery at %s as extension %s.", len(selected), extensionSocket, extensionName)
+	return server.Run()
+}
+
+// registeredTables returns the names of the tables registered with the osquery at socket, whether built in or
+// provided by other extensions.
+func registeredTables(socket string) (map[string]bool, error) {
+	client, err := osquery.NewClient(socket, 10*time.Second)
+	if err != nil {
+		return nil, xerrors.Errorf("error connecting to extension socket %s: %v", socket, err)
+	}
+	defer client.Close()
+
+	rows, err := client.QueryRows("SELECT name FROM osquery_registry WHERE registry = 'table'")
+	if err != nil {
+		return nil, xerrors.Errorf("error listing the tables of osquery: %v", err)
+	}
+	names := map[string]bool{}
+	for _, row := range rows {
+		names[row["name"]] = true
+	}
+	return names, nil
+}
@@ -1,13 +1,41 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
 	"github.com/urfave/cli"
 	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt/generator"
 )
 
 var (
-	schemaPath  string
-	inputQuery  string
+	schemaPath string
+	inputQuery string
+	outputDir  string
+
+	docsLocale       string
+	translationsDir  string
+	referenceFormat  string
+	typesLang        string
+	typesPackage     string
+	packQueries      string
+	packName         string
+	packFormat       string
+	packInterval     int
+	warehouseDialect string
+	splunkSourcetype string
+	splunkQueryName  string
+	splunkPrefix     string
+	sigmaProduct     string
+	pluginPath       string
+	pluginParams     cli.StringSlice
+
 	genCommands = []cli.Command{
 		{
 			Name:  "result-schema",
@@ -22,15 +50,363 @@ var (
 				cli.StringFlag{
 					Name:        "schema",
 					Destination: &schemaPath,
-					Usage:       "Path to a previously exported OSQuery schema JSON file.",
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON file.",
 					EnvVar:      "OSQT_SCHEMA_PATH",
 				},
 			},
 			Action: genResultSchema,
 		},
+		{
+			Name:  "atc",
+			Usage: "Emits an osquery automatic table construction config for a SQLite database, checking it against the schema.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file, to check the table name against.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse, to check the table name against.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "name",
+					Destination: &atcName,
+					Usage:       "Name of the table osquery constructs (required).",
+				},
+				cli.StringFlag{
+					Name:        "path",
+					Destination: &atcPath,
+					Usage:       "Path of the SQLite database on the host (required). When it exists locally, the query is checked against it.",
+				},
+				cli.StringFlag{
+					Name:        "columns",
+					Destination: &atcColumns,
+					Usage:       "Comma separated columns of the table, in the order the query returns them (required).",
+				},
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &atcQuery,
+					Usage:       "Query run against the SQLite database to produce the table's rows.",
+				},
+				cli.StringFlag{
+					Name:        "source-table",
+					Destination: &atcSourceTable,
+					Usage:       "Table of the SQLite database to select the columns from, instead of --query.",
+				},
+				cli.StringFlag{
+					Name:        "platform",
+					Destination: &atcPlatform,
+					Usage:       "Platforms the table is constructed on (e.g. 'darwin' or 'linux,darwin'; defaults to all).",
+				},
+				cli.StringFlag{
+					Name:        "output-file",
+					Destination: &outputFile,
+					Usage:       "File to write the ATC config to (defaults to stdout).",
+					EnvVar:      "OSQT_OUTPUT_FILE",
+				},
+			}, schemaOverlayFlags...),
+			Action: genATC,
+		},
+		{
+			Name:  "docs",
+			Usage: "Generates markdown docs, updating only the osqt-managed regions of pages that already exist.",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "locale",
+					Destination: &docsLocale,
+					Usage:       "Render the docs in this locale (e.g. 'ja') using its translation overlay, falling back to English.",
+					EnvVar:      "OSQT_LOCALE",
+				},
+				cli.StringFlag{
+					Name:        "translations-dir",
+					Destination: &translationsDir,
+					Value:       "translations",
+					Usage:       "Directory containing the <locale>.yaml translation overlays.",
+					EnvVar:      "OSQT_TRANSLATIONS_DIR",
+				},
+			),
+			Action: runGenerator("docs", func() map[string]string {
+				return map[string]string{"locale": docsLocale, "translations-dir": translationsDir}
+			}),
+		},
+		{
+			Name:  "reference",
+			Usage: "Generates a single-file plain-text schema reference suited to pagers and screen readers.",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "format",
+					Destination: &referenceFormat,
+					Value:       "text",
+					Usage:       "Format of the reference (options: 'text').",
+				},
+			),
+			Action: runGenerator("reference", func() map[string]string {
+				return map[string]string{"format": referenceFormat}
+			}),
+		},
+		{
+			Name:  "types",
+			Usage: "Generates Go structs and TypeScript interfaces for table rows, including nested types for JSON columns.",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "lang",
+					Destination: &typesLang,
+					Value:       "all",
+					Usage:       "Language to generate types for (options: 'go', 'ts' or 'all').",
+				},
+				cli.StringFlag{
+					Name:        "package",
+					Destination: &typesPackage,
+					Value:       "osquery",
+					Usage:       "Package name of the generated Go file.",
+				},
+			),
+			Action: runGenerator("types", func() map[string]string {
+				return map[string]string{"lang": typesLang, "package": typesPackage}
+			}),
+		},
+		{
+			Name:  "fleet-pack",
+			Usage: "Generates a Fleet/Kolide (or osquery JSON) query pack, restricting each query to the platforms that have its tables.",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "queries",
+					Destination: &packQueries,
+					Usage:       "osquery JSON pack or Fleet YAML pack whose queries are validated and emitted (defaults to every table's example queries).",
+				},
+				cli.StringFlag{
+					Name:        "name",
+					Destination: &packName,
+					Usage:       "Name of the generated pack (defaults to the name of the --queries pack, or 'osqt').",
+				},
+				cli.StringFlag{
+					Name:        "format",
+					Destination: &packFormat,
+					Value:       "yaml",
+					Usage:       "Format of the pack (options: 'yaml' for Fleet YAML or 'json' for an osquery JSON pack).",
+				},
+				cli.IntFlag{
+					Name:        "interval",
+					Destination: &packInterval,
+					Value:       3600,
+					Usage:       "Interval in seconds of queries that do not set one.",
+				},
+			),
+			Action: runGenerator("fleet-pack", func() map[string]string {
+				return map[string]string{
+					"queries":  packQueries,
+					"name":     packName,
+					"format":   packFormat,
+					"interval": strconv.Itoa(packInterval),
+				}
+			}),
+		},
+		{
+			Name:  "warehouse",
+			Usage: "Generates BigQuery JSON schemas or Snowflake DDL for each table, for loading query results into a data warehouse.",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "dialect",
+					Destination: &warehouseDialect,
+					Value:       "bigquery",
+					Usage:       "Warehouse to generate schemas for (options: 'bigquery' or 'snowflake').",
+				},
+			),
+			Action: runGenerator("warehouse", func() map[string]string {
+				return map[string]string{"dialect": warehouseDialect}
+			}),
+		},
+		{
+			Name:  "splunk",
+			Usage: "Generates Splunk props.conf, eventtypes.conf and tags.conf aliasing osquery result columns to CIM data model fields.",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "mapping",
+					Destination: &mappingFile,
+					Usage:       "JSON or YAML file of table to CIM data model, tag and field mappings, overriding the bundled ones (an empty field unaliases a column).",
+					EnvVar:      "OSQT_SPLUNK_MAPPING",
+				},
+				cli.StringFlag{
+					Name:        "sourcetype",
+					Destination: &splunkSourcetype,
+					Value:       "osquery:results",
+					Usage:       "Sourcetype of the osquery results, with {table} replaced by the table name if the results of each table have their own.",
+				},
+				cli.StringFlag{
+					Name:        "query-name",
+					Destination: &splunkQueryName,
+					Value:       "{table}",
+					Usage:       "Name of the scheduled query reading each table, with {table} replaced by the table name. Results are matched on it alone or as a pack query (pack_<pack>_<name>).",
+				},
+				cli.StringFlag{
+					Name:        "field-prefix",
+					Destination: &splunkPrefix,
+					Value:       "columns.",
+					Usage:       "Prefix of the column fields extracted from the results (e.g. 'columns.' for osquery's event format).",
+				},
+			),
+			Action: runGenerator("splunk", func() map[string]string {
+				return map[string]string{"mapping": mappingFile, "sourcetype": splunkSourcetype, "query-name": splunkQueryName, "field-prefix": splunkPrefix}
+			}),
+		},
+		{
+			Name:  "sigma-fields",
+			Usage: "Generates, for each table, the Sigma logsource and the fields rules for it may use.",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "product",
+					Destination: &sigmaProduct,
+					Value:       "osquery",
+					Usage:       "Product of the logsources, whose service is the table name.",
+				},
+			),
+			Action: runGenerator("sigma-fields", func() map[string]string {
+				return map[string]string{"product": sigmaProduct}
+			}),
+		},
+		{
+			Name:      "exec",
+			Usage:     "Runs an external generator plugin, which reads the schema as JSON on stdin and replies with the files to write on stdout.",
+			ArgsUsage: "[PLUGIN ARGS...]",
+			Flags: generatorFlags(
+				cli.StringFlag{
+					Name:        "plugin",
+					Destination: &pluginPath,
+					Usage:       "Path of the plugin executable (required).",
+					EnvVar:      "OSQT_GENERATOR_PLUGIN",
+				},
+				cli.StringSliceFlag{
+					Name:  "param",
+					Value: &pluginParams,
+					Usage: "Parameter passed to the plugin as key=value (repeatable).",
+				},
+			),
+			Action: genExec,
+		},
+		{
+			Name:   "site",
+			Usage:  "Generates a static HTML documentation site with one page per table.",
+			Flags:  generatorFlags(),
+			Action: runGenerator("site"),
+		},
 	}
 )
 
+// generatorFlags returns the flags shared by every generator backed subcommand.
+func generatorFlags(extra ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:        "schema",
+			Destination: &schemaPath,
+			Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+			EnvVar:      "OSQT_SCHEMA_PATH",
+		},
+		cli.StringFlag{
+			Name:        "specs-dir",
+			Destination: &specsDir,
+			Usage:       "Path to the OSQuery specs directory to parse.",
+			EnvVar:      "OSQT_SPECS_DIR",
+		},
+		cli.StringFlag{
+			Name:        "output-dir",
+			Destination: &outputDir,
+			Usage:       "Directory to write the generated files into (required).",
+			EnvVar:      "OSQT_OUTPUT_DIR",
+		},
+	}
+	flags = append(flags, schemaOverlayFlags...)
+	return append(flags, extra...)
+}
+
+// signalContext returns a context that is cancelled when the process receives SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Warnf("Received %v, cancelling...", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+
+	return ctx, cancel
+}
+
+// runGenerator returns a cli action that runs the named generator with the given parameters.
+func runGenerator(name string, params ...func() map[string]string) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		g, ok := generator.Lookup(name)
+		if !ok {
+			return xerrors.Errorf("no generator registered as %s", name)
+		}
+
+		merged := map[string]string{}
+		for _, fn := range params {
+			for key, val := range fn() {
+				merged[key] = val
+			}
+		}
+		return generate(g, merged)
+	}
+}
+
+// genExec runs the generator plugin of --plugin, passing it any arguments and the --param parameters.
+func genExec(c *cli.Context) error {
+	if pluginPath == "" {
+		return xerrors.New("--plugin PATH was not provided")
+	}
+
+	params := map[string]string{}
+	for _, param := range pluginParams {
+		idx := strings.Index(param, "=")
+		if idx <= 0 {
+			return xerrors.Errorf("--param %q is not of the form key=value", param)
+		}
+		params[param[:idx]] = param[idx+1:]
+	}
+	return generate(generator.NewExecGenerator(pluginPath, c.Args()...), params)
+}
+
+// generate runs g against the loaded schema into --output-dir, or reports the changes it would make with --dry-run.
+func generate(g generator.Generator, params map[string]string) error {
+	if outputDir == "" {
+		return xerrors.New("--output-dir DIR was not provided")
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if dryRun {
+		changes, err := generator.Plan(ctx, g, parser, outputDir, params, log.Named("generator"))
+		if err != nil {
+			return err
+		}
+		printFileChanges(changes)
+		return nil
+	}
+
+	if err := generator.Run(ctx, g, parser, outputDir, params, log.Named("generator")); err != nil {
+		return err
+	}
+
+	log.Infof("%s output written to %s.", g.Name(), outputDir)
+	return nil
+}
+
 func genResultSchema(c *cli.Context) error {
 	if schemaPath == "" {
 		return xerrors.New("--schema path was not provided")
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/pack"
+	"github.com/gen0cide/osqt/query"
+)
+
+var (
+	queryFile    string
+	packPath     string
+	varsPath     string
+	flagFile     string
+	lintCommands = []cli.Command{
+		{
+			Name:  "query",
+			Usage: "Lints a query against the schema, reporting likely mistakes and fragile constructs.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &inputQuery,
+					Usage:       "Query to lint.",
+					EnvVar:      "OSQT_INPUT_QUERY",
+				},
+				cli.StringFlag{
+					Name:        "file",
+					Destination: &queryFile,
+					Usage:       "File containing the SQL to lint (instead of --query).",
+				},
+				cli.StringFlag{
+					Name:        "vars",
+					Destination: &varsPath,
+					Usage:       "YAML or JSON file of values for templated queries ({{ .Var }} or @var placeholders).",
+					EnvVar:      "OSQT_VARS",
+				},
+				cli.StringFlag{
+					Name:        "flagfile",
+					Destination: &flagFile,
+					Usage:       "osquery flag file of the target deployment. Queries of tables its --disable_tables and --enable_tables flags disable are warned about.",
+					EnvVar:      "OSQT_FLAGFILE",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the findings in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: lintQuery,
+		},
+		{
+			Name:      "pack",
+			Usage:     "Lints every query in an osquery JSON pack or Fleet YAML pack against the schema.",
+			ArgsUsage: "PACK",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "vars",
+					Destination: &varsPath,
+					Usage:       "YAML or JSON file of values for templated queries ({{ .Var }} or @var placeholders).",
+					EnvVar:      "OSQT_VARS",
+				},
+				cli.StringFlag{
+					Name:        "flagfile",
+					Destination: &flagFile,
+					Usage:       "osquery flag file of the target deployment. Queries of tables its --disable_tables and --enable_tables flags disable are warned about.",
+					EnvVar:      "OSQT_FLAGFILE",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the findings in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: lintPack,
+		},
+		specLintCommand,
+	}
+)
+
+// templateRule is the rule name reported when a templated query cannot be expanded.
+const templateRule = "template"
+
+// loadVariables reads --vars, returning empty variables when it was not given.
+func loadVariables() (pack.Variables, error) {
+	if varsPath == "" {
+		return pack.Variables{}, nil
+	}
+	return pack.LoadVariables(varsPath)
+}
+
+// loadFlagFile reads --flagfile, returning nil when it was not given.
+func loadFlagFile() (*osqt.BuildConfig, error) {
+	if flagFile == "" {
+		return nil, nil
+	}
+	return osqt.ParseFlagFile(flagFile)
+}
+
+// lintTemplated expands sql with vars if it is templated and lints the result, along with the tables build does
+// not serve when it is not nil. A query that cannot be expanded is reported as a single error finding.
+func lintTemplated(parser *osqt.Parser, sql string, vars pack.Variables, build *osqt.BuildConfig) ([]*query.Finding, error) {
+	if pack.IsTemplated(sql) {
+		expanded, err := pack.Expand(sql, vars)
+		if err != nil {
+			if varsPath == "" {
+				err = xerrors.Errorf("%v (pass --vars to provide values)", err)
+			}
+			return []*query.Finding{{
+				Rule:     templateRule,
+				Severity: query.SeverityError,
+				Message:  err.Error(),
+				Line:     1,
+				Column:   1,
+			}}, nil
+		}
+		sql = expanded
+	}
+
+	findings, err := query.Lint(parser, sql)
+	if err != nil {
+		return nil, xerrors.Errorf("error scanning query: %v", err)
+	}
+	if build != nil {
+		disabled, err := query.CheckBuild(parser, sql, build)
+		if err != nil {
+			return nil, xerrors.Errorf("error scanning query: %v", err)
+		}
+		findings = append(findings, disabled...)
+		sort.SliceStable(findings, func(i, j int) bool { return findings[i].Pos < findings[j].Pos })
+	}
+	return findings, nil
+}
+
+// findingLocation formats where a finding is as line:column, followed by the statement number for inputs that
+// contain several statements.
+func findingLocation(f *query.Finding) string {
+	if f.Statement > 0 {
+		return fmt.Sprintf("%d:%d (statement %d)", f.Line, f.Column, f.Statement)
+	}
+	return fmt.Sprintf("%d:%d", f.Line, f.Column)
+}
+
+// printSuggestion prints how to fix a finding, if its rule suggests a fix, below the finding.
+func printSuggestion(f *query.Finding) {
+	if f.Suggestion != "" {
+		fmt.Printf("    suggestion: %s\n", f.Suggestion)
+	}
+}
+
+func hasErrors(findings []*query.Finding) bool {
+	for _, f := range findings {
+		if f.Severity == query.SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func lintQuery(c *cli.Context) error {
+	sql := inputQuery
+	if queryFile != "" {
+		data, err := ioutil.ReadFile(queryFile)
+		if err != nil {
+			return xerrors.Errorf("error reading --file: %v", err)
+		}
+		sql = string(data)
+	}
+	if sql == "" {
+		return xerrors.New("--query QUERY or --file PATH is required")
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	vars, err := loadVariables()
+	if err != nil {
+		return err
+	}
+	build, err := loadFlagFile()
+	if err != nil {
+		return err
+	}
+
+	findings, err := lintTemplated(parser, sql, vars, build)
+	if err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render findings as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		for _, f := range findings {
+			fmt.Printf("%s: %s: %s [%s]\n", findingLocation(f), f.Severity, f.Message, f.Rule)
+			printSuggestion(f)
+		}
+		if len(findings) == 0 {
+			log.Info("No problems found.")
+		}
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	if hasErrors(findings) {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
+
+// packFindings are the findings for one query of a pack.
+type packFindings struct {
+	Query    string           `json:"query"`
+	Findings []*query.Finding `json:"findings"`
+}
+
+func lintPack(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("the path to a single pack is required")
+	}
+
+	p, err := pack.Load(c.Args().First())
+	if err != nil {
+		return err
+	}
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	vars, err := loadVariables()
+	if err != nil {
+		return err
+	}
+	build, err := loadFlagFile()
+	if err != nil {
+		return err
+	}
+
+	results := []*packFindings{}
+	failed, total := false, 0
+	for _, q := range p.SortedQueries() {
+		findings, err := lintTemplated(parser, q.SQL, vars, build)
+		if err != nil {
+			return xerrors.Errorf("query %s: %v", q.Name, err)
+		}
+		results = append(results, &packFindings{Query: q.Name, Findings: findings})
+		failed = failed || hasErrors(findings)
+		total += len(findings)
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render findings as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		for _, r := range results {
+			for _, f := range r.Findings {
+				fmt.Printf("%s:%s: %s: %s [%s]\n", r.Query, findingLocation(f), f.Severity, f.Message, f.Rule)
+				printSuggestion(f)
+			}
+		}
+		if total == 0 {
+			log.Infof("No problems found in %d queries.", len(results))
+		}
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	if failed {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
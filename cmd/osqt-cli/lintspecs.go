@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/zaplog"
+)
+
+// specLintCommand lints the spec files of a specs directory.
+var specLintCommand = cli.Command{
+	Name:  "specs",
+	Usage: "Checks the spec files of a specs directory for missing documentation, duplicate or unknown columns, and tables no platform serves.",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "specs-dir",
+			Destination: &specsDir,
+			Usage:       "Path to the OSQuery specs directory to check (required).",
+			EnvVar:      "OSQT_SPECS_DIR",
+		},
+		cli.StringFlag{
+			Name:        "output-format",
+			Destination: &outputFormat,
+			Usage:       "Format to write the findings in (options: 'text' or 'json').",
+			Value:       "text",
+		},
+	},
+	Action: lintSpecs,
+}
+
+// Rules of the findings of lint specs.
+const (
+	specRuleParse              = "parse"
+	specRuleMissingDescription = "missing-description"
+	specRuleDuplicateColumn    = "duplicate-column"
+	specRuleMissingExamples    = "missing-examples"
+	specRuleDescriptionPeriod  = "description-period"
+	specRuleUnknownType        = "unknown-type"
+	specRuleMissingAttribution = "platform-attribution"
+)
+
+// specFinding is a quality problem of a spec file. Line is 0 when the problem cannot be tied to a line.
+type specFinding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Table    string `json:"table,omitempty"`
+	Column   string `json:"column,omitempty"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func lintSpecs(c *cli.Context) error {
+	if specsDir == "" {
+		return xerrors.New("--specs-dir PATH was not provided")
+	}
+	if err := isValidDirectory(specsDir); err != nil {
+		return xerrors.Errorf("--specs-dir value was invalid: %v", err)
+	}
+	if outputFormat != "text" && outputFormat != "json" {
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	findings, files, err := lintSpecsDir(specsDir)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, f := range findings {
+		failed = failed || f.Severity == "error"
+	}
+
+	if outputFormat == "json" {
+		data, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render findings as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	} else {
+		for _, f := range findings {
+			loc := f.File
+			if f.Line > 0 {
+				loc = fmt.Sprintf("%s:%d", f.File, f.Line)
+			}
+			fmt.Printf("%s: %s: %s [%s]\n", loc, f.Severity, f.Message, f.Rule)
+		}
+		if len(findings) == 0 {
+			log.Infof("No problems found in %d spec files.", files)
+		}
+	}
+
+	if failed {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
+
+// lintSpecsDir parses and checks every spec file under dir, returning the findings in file order and the number
+// of spec files checked.
+func lintSpecsDir(dir string) ([]*specFinding, int, error) {
+	parser := osqt.NewParserWithOptions(zaplog.New(log.Named("parser")), parserOptions())
+	findings := []*specFinding{}
+	files := 0
+	err := filepath.Walk(dir, func(fileloc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(fileloc) != ".table" {
+			return nil
+		}
+		files++
+		rel, err := filepath.Rel(dir, fileloc)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		src, err := ioutil.ReadFile(fileloc)
+		if err != nil {
+			return err
+		}
+		tbl, err := parser.ParseTableDef(fileloc)
+		if err != nil {
+			findings = append(findings, &specFinding{File: rel, Rule: specRuleParse, Severity: "error", Message: err.Error()})
+			return nil
+		}
+		for _, f := range lintSpec(tbl, filepath.Base(filepath.Dir(fileloc)), string(src)) {
+			f.File = rel
+			findings = append(findings, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, xerrors.Errorf("error walking specs directory: %v", err)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, files, nil
+}
+
+// lintSpec checks the table parsed from the spec source src, found in the namespace directory nsid.
+func lintSpec(tbl *osqt.Table, nsid string, src string) []*specFinding {
+	findings := []*specFinding{}
+	add := func(line int, column, rule, severity, format string, args ...interface{}) {
+		findings = append(findings, &specFinding{
+			Line:     line,
+			Table:    tbl.Name,
+			Column:   column,
+			Rule:     rule,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, d := range tbl.Diagnostics {
+		add(d.Line, "", specRuleParse, string(d.Severity), "%s", d.Message)
+	}
+
+	descLine := declarationLine(src, "description")
+	switch {
+	case strings.TrimSpace(tbl.Description) == "":
+		add(descLine, "", specRuleMissingDescription, "warning", "table %s has no description", tbl.Name)
+	case !endsSentence(tbl.Description):
+		add(descLine, "", specRuleDescriptionPeriod, "warning", "description of table %s does not end in a period", tbl.Name)
+	}
+	if len(tbl.Examples) == 0 {
+		add(0, "", specRuleMissingExamples, "warning", "table %s has no examples", tbl.Name)
+	}
+	if !attributed(tbl, nsid) {
+		add(0, "", specRuleMissingAttribution, "error", "table %s is in %s/, which is not a platform directory, and declares no extended_schema platforms", tbl.Name, nsid)
+	}
+
+	schemas := []*osqt.Schema{}
+	if tbl.Schema != nil {
+		schemas = append(schemas, tbl.Schema)
+	}
+	platforms := make([]string, 0, len(tbl.ExtendedSchemas))
+	for platform := range tbl.ExtendedSchemas {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	for _, platform := range platforms {
+		schemas = append(schemas, tbl.ExtendedSchemas[platform])
+	}
+
+	// extended schemas shared by several platforms are copied into each, so their columns are checked once
+	checked, shadowed := map[string]bool{}, map[string]bool{}
+	for idx, schema := range schemas {
+		seen := map[string]bool{}
+		for _, col := range schema.Columns {
+			line := columnLine(src, col.Name)
+			if seen[col.Name] {
+				add(line, col.Name, specRuleDuplicateColumn, "error", "column %s is declared more than once in the same schema of %s", col.Name, tbl.Name)
+				continue
+			}
+			seen[col.Name] = true
+			if idx > 0 && tbl.Schema != nil && columnOf(tbl.Schema, col.Name) != nil {
+				if shadowed[col.Name] {
+					continue
+				}
+				shadowed[col.Name] = true
+				add(line, col.Name, specRuleDuplicateColumn, "error", "column %s of %s is declared by both its schema and an extended_schema", col.Name, tbl.Name)
+				continue
+			}
+
+			key := col.Name + "\x00" + col.Type + "\x00" + col.Description
+			if checked[key] {
+				continue
+			}
+			checked[key] = true
+
+			if _, ok := col.ColumnType(); !ok {
+				add(line, col.Name, specRuleUnknownType, "error", "column %s of %s has unknown type %s", col.Name, tbl.Name, col.Type)
+			}
+			if strings.TrimSpace(col.Description) == "" {
+				add(line, col.Name, specRuleMissingDescription, "warning", "column %s of %s has no description", col.Name, tbl.Name)
+			} else if !endsSentence(col.Description) {
+				add(line, col.Name, specRuleDescriptionPeriod, "warning", "description of column %s of %s does not end in a period", col.Name, tbl.Name)
+			}
+		}
+	}
+
+	return findings
+}
+
+// attributed returns true if the table is served by some platform, either through its namespace directory or
+// the platforms of its extended schemas.
+func attributed(tbl *osqt.Table, nsid string) bool {
+	if len(tbl.ExtendedSchemas) > 0 {
+		return true
+	}
+	for _, namespaces := range osqt.GOOSToApplicableNamespaces {
+		for _, ns := range namespaces {
+			if ns == nsid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func columnOf(schema *osqt.Schema, name string) *osqt.Column {
+	for _, col := range schema.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+// endsSentence returns true if desc ends like a sentence. Descriptions ending in a closing parenthesis or quote
+// after the period, or in a question or exclamation mark, count.
+func endsSentence(desc string) bool {
+	desc = strings.TrimRight(strings.TrimSpace(desc), `)"'`)
+	return strings.HasSuffix(desc, ".") || strings.HasSuffix(desc, "?") || strings.HasSuffix(desc, "!")
+}
+
+// declarationLine returns the line of src on which the call of the function name starts, or 0 if it has none.
+func declarationLine(src string, name string) int {
+	return lineOf(src, regexp.MustCompile(`(?m)^\s*`+regexp.QuoteMeta(name)+`\s*\(`))
+}
+
+// columnLine returns the line of src declaring the column name, or 0 if it cannot be found.
+func columnLine(src string, name string) int {
+	return lineOf(src, regexp.MustCompile(`Column\(\s*["']`+regexp.QuoteMeta(name)+`["']`))
+}
+
+func lineOf(src string, re *regexp.Regexp) int {
+	loc := re.FindStringIndex(src)
+	if loc == nil {
+		return 0
+	}
+	return strings.Count(src[:loc[0]], "\n") + 1
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/zaplog"
+)
+
+var (
+	jsonSchemasPath  string
+	fleetSchemaPath  string
+	deprecationsPath string
+
+	// schemaOverlayFlags are the flags of every command loading its schema with loadParser, naming the overlays,
+	// metadata and ATC tables it applies to the schema.
+	schemaOverlayFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:        "json-schemas",
+			Destination: &jsonSchemasPath,
+			Usage:       "YAML or JSON overlay declaring the JSON sub-schemas of columns that hold JSON documents.",
+			EnvVar:      "OSQT_JSON_SCHEMAS",
+		},
+		cli.StringFlag{
+			Name:        "deprecations",
+			Destination: &deprecationsPath,
+			Usage:       "YAML or JSON overlay marking tables and columns deprecated, with the reason and what to use instead.",
+			EnvVar:      "OSQT_DEPRECATIONS",
+		},
+		cli.StringFlag{
+			Name:        "atc-config",
+			Destination: &atcConfigPath,
+			Usage:       "osquery config whose auto_table_construction tables are added to the schema.",
+			EnvVar:      "OSQT_ATC_CONFIG",
+		},
+		cli.StringFlag{
+			Name:        "fleet-schema",
+			Destination: &fleetSchemaPath,
+			Usage:       "Fleet schema YAML (a directory of <table>.yml files or a single file) whose notes and examples are merged into the tables.",
+			EnvVar:      "OSQT_FLEET_SCHEMA",
+		},
+	}
+)
+
+// loadParser builds a parser from either --specs-dir or --schema, preferring the specs directory when both are set.
+// The --json-schemas and --deprecations overlays and --fleet-schema metadata, if any, are applied to the result,
+// and the tables of --atc-config added to it.
+func loadParser() (*osqt.Parser, error) {
+	parser, err := loadBaseParser()
+	if err != nil {
+		return nil, err
+	}
+
+	if jsonSchemasPath != "" {
+		if err := applyJSONSchemas(parser); err != nil {
+			return nil, err
+		}
+	}
+
+	if deprecationsPath != "" {
+		if err := applyDeprecations(parser); err != nil {
+			return nil, err
+		}
+	}
+
+	if fleetSchemaPath != "" {
+		if err := applyFleetSchema(parser); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := registerATCConfig(parser); err != nil {
+		return nil, err
+	}
+
+	return parser, nil
+}
+
+// applyJSONSchemas applies the --json-schemas overlay to parser, timed as its own phase.
+func applyJSONSchemas(parser *osqt.Parser) error {
+	defer phase("json-schemas")()
+	overlay, err := osqt.LoadJSONOverlay(jsonSchemasPath)
+	if err != nil {
+		return err
+	}
+	applied, err := parser.ApplyJSONOverlay(overlay)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Applied JSON sub-schemas to %d columns from %s.", applied, jsonSchemasPath)
+	return nil
+}
+
+// applyDeprecations applies the --deprecations overlay to parser, timed as its own phase.
+func applyDeprecations(parser *osqt.Parser) error {
+	defer phase("deprecations")()
+	overlay, err := osqt.LoadDeprecationOverlay(deprecationsPath)
+	if err != nil {
+		return err
+	}
+	applied, err := parser.ApplyDeprecationOverlay(overlay)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Marked %d tables and columns deprecated from %s.", applied, deprecationsPath)
+	return nil
+}
+
+// applyFleetSchema applies the --fleet-schema metadata to parser, timed as its own phase.
+func applyFleetSchema(parser *osqt.Parser) error {
+	defer phase("fleet-schema")()
+	return parser.ParseFleetSchema(fleetSchemaPath)
+}
+
+// parserOptions returns the options of the parsers of spec directories, as set by the global flags.
+func parserOptions() osqt.ParserOptions {
+	return osqt.ParserOptions{Strict: strictSpecs}
+}
+
+func loadBaseParser() (*osqt.Parser, error) {
+	defer phase("parse")()
+
+	parser := osqt.NewParserWithOptions(zaplog.New(log.Named("parser")), parserOptions())
+	if schemaPath == "" && specsDir == "" {
+		return nil, xerrors.New("--schema PATH or --specs-dir PATH are required!")
+	}
+
+	if specsDir != "" {
+		if err := isValidDirectory(specsDir); err != nil {
+			return nil, xerrors.Errorf("--specs-dir value was invalid: %v", err)
+		}
+		if err := parser.ParseDirectory(specsDir); err != nil {
+			return nil, xerrors.Errorf("error attempting to parse directory: %v", err)
+		}
+		recordParser(parser, -1)
+		return parser, nil
+	}
+
+	if err := parseSchemaFile(parser, schemaPath); err != nil {
+		return nil, err
+	}
+	recordParser(parser, 1)
+
+	return parser, nil
+}
+
+// parseSchemaFile loads a previously exported schema into parser based on the file's extension. Locations with a
+// URL scheme (https://, s3://, gs://) are fetched instead of read from disk.
+func parseSchemaFile(parser *osqt.Parser, fileloc string) error {
+	var err error
+	switch {
+	case osqt.IsSchemaURL(fileloc):
+		err = parser.ParseSchemaURL(context.Background(), fileloc)
+	case filepath.Ext(fileloc) == ".json":
+		return parser.ParseJSONSchemaFile(fileloc)
+	case filepath.Ext(fileloc) == ".yaml" || filepath.Ext(fileloc) == ".yml":
+		err = parser.ParseYAMLSchemaFile(fileloc)
+	default:
+		return xerrors.Errorf("unsupported schema file extension for %s (expected .json or .yaml)", fileloc)
+	}
+
+	yerr := &osqt.YAMLError{}
+	if explainYAMLErrors && xerrors.As(err, &yerr) {
+		fmt.Fprint(os.Stderr, yerr.Explain())
+	}
+	return err
+}
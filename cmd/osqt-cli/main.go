@@ -11,8 +11,10 @@ import (
 	"github.com/urfave/cli"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/xerrors"
 
 	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/query"
 )
 
 var (
@@ -20,6 +22,10 @@ var (
 	quiet      = false
 	jsonOutput = false
 	log        *zap.SugaredLogger
+
+	explainYAMLErrors   = false
+	expensiveTablesPath string
+	strictSpecs         = false
 )
 
 func customTime(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
@@ -42,6 +48,16 @@ func customCaller(t zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
 	)
 }
 
+func startDiagnosticsIfEnabled() error {
+	if err := setupTracing(); err != nil {
+		return err
+	}
+	if pprofAddr == "" {
+		return nil
+	}
+	return startDiagnostics(pprofAddr)
+}
+
 func main() {
 	aa := zap.NewDevelopmentEncoderConfig()
 	aa.EncodeLevel = zapcore.CapitalColorLevelEncoder
@@ -87,9 +103,75 @@ func main() {
 			Usage:       "Output all logging messages as JSON.",
 			EnvVar:      "OSQT_JSON_OUTPUT",
 		},
+		cli.BoolFlag{
+			Name:        "dry-run",
+			Destination: &dryRun,
+			Usage:       "Report the files that would be created or modified (with diffs for small text files) instead of writing them.",
+			EnvVar:      "OSQT_DRY_RUN",
+		},
+		cli.BoolFlag{
+			Name:        "strict-specs",
+			Destination: &strictSpecs,
+			Usage:       "Fail parsing a spec on any declaration or keyword argument the parser does not understand, instead of skipping it with a warning.",
+			EnvVar:      "OSQT_STRICT_SPECS",
+		},
+		cli.StringFlag{
+			Name:        "expensive-tables",
+			Destination: &expensiveTablesPath,
+			Usage:       "YAML or JSON file of the tables lint requires queries to constrain (replacing the defaults: file, hash, yara, deb_packages and rpm_packages).",
+			EnvVar:      "OSQT_EXPENSIVE_TABLES",
+		},
+		cli.BoolFlag{
+			Name:        "explain-yaml-errors",
+			Destination: &explainYAMLErrors,
+			Usage:       "When a YAML schema file fails to load, print each problem with the surrounding lines of the file.",
+			EnvVar:      "OSQT_EXPLAIN_YAML_ERRORS",
+		},
+		cli.StringFlag{
+			Name:        "otel-exporter",
+			Destination: &otelExporter,
+			Value:       "none",
+			Usage:       "Export OpenTelemetry traces of parsing and query execution (options: 'none', 'stdout', 'otlp').",
+			EnvVar:      "OSQT_OTEL_EXPORTER",
+		},
+		cli.StringFlag{
+			Name:        "otel-endpoint",
+			Destination: &otelEndpoint,
+			Usage:       "host:port of the OTLP/HTTP collector (defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment).",
+			EnvVar:      "OSQT_OTEL_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:        "summary",
+			Destination: &summaryFormat,
+			Value:       "text",
+			Usage:       "Report what the run did and how long each phase took when it ends (options: 'text', 'json', 'none'; written to stderr).",
+			EnvVar:      "OSQT_SUMMARY",
+		},
+		cli.StringFlag{
+			Name:        "pprof-addr",
+			Destination: &pprofAddr,
+			Usage:       "Expose net/http/pprof and runtime metrics on this address (e.g. 127.0.0.1:6060).",
+			EnvVar:      "OSQT_PPROF_ADDR",
+		},
 	}
 
 	app.Commands = []cli.Command{
+		benchCommand,
+		conformanceCommand,
+		diffCommand,
+		extensionCommand,
+		translateCommand,
+		{
+			Name:        "audit",
+			Usage:       "Audit running osquery deployments against the spec files.",
+			Subcommands: auditCommands,
+		},
+		{
+			Name:        "analyze",
+			Aliases:     []string{"a"},
+			Usage:       "Analyze a structured schema and report on its contents.",
+			Subcommands: analyzeCommands,
+		},
 		{
 			Name:        "export",
 			Aliases:     []string{"e"},
@@ -102,18 +184,71 @@ func main() {
 			Usage:       "Generate various output based on a structured schema.",
 			Subcommands: genCommands,
 		},
+		{
+			Name:        "lint",
+			Aliases:     []string{"l"},
+			Usage:       "Check queries against a structured schema, and spec files, for common mistakes.",
+			Subcommands: lintCommands,
+		},
+		{
+			Name:        "query",
+			Aliases:     []string{"q"},
+			Usage:       "Inspect and run queries against the virtual engine in-process.",
+			Subcommands: queryCommands,
+		},
 		{
 			Name:        "server",
 			Aliases:     []string{"s"},
 			Usage:       "Runs a local MySQL-compatible server mimicking OSQuery's database.",
 			Subcommands: serveCommands,
 		},
+		{
+			Name:        "stats",
+			Usage:       "Report statistics about the spec files behind a schema.",
+			Subcommands: statsCommands,
+		},
+		{
+			Name:        "suggest",
+			Usage:       "Suggest tables relevant to a plain English description.",
+			Subcommands: suggestCommands,
+		},
+		{
+			Name:        "tables",
+			Aliases:     []string{"t"},
+			Usage:       "Enumerate and filter the OSQuery tables within a schema.",
+			Subcommands: tableCommands,
+		},
+		{
+			Name:        "test",
+			Usage:       "Regression test packs against fixture data and golden results.",
+			Subcommands: testCommands,
+		},
+		{
+			Name:        "validate",
+			Usage:       "Validate osquery deployment files against a structured schema.",
+			Subcommands: validateCommands,
+		},
 	}
 
 	sort.Sort(cli.FlagsByName(app.Flags))
 	sort.Sort(cli.CommandsByName(app.Commands))
 
 	app.Before = func(c *cli.Context) error {
+		switch summaryFormat {
+		case "text", "json", "none":
+		default:
+			return xerrors.Errorf("unsupported --summary %q (options: 'text', 'json', 'none')", summaryFormat)
+		}
+		summary.Command = commandName(c.Args())
+
+		if expensiveTablesPath != "" {
+			tables, err := query.LoadExpensiveTables(expensiveTablesPath)
+			if err != nil {
+				return err
+			}
+			query.SetExpensiveTables(tables)
+		}
+
 		opts := []zap.Option{}
 		lvl := zapcore.InfoLevel
 		if c.Bool("debug") == true {
@@ -126,6 +261,7 @@ func main() {
 		if c.Bool("quiet") == true {
 			lvl = zapcore.ErrorLevel
 		}
+		opts = append(opts, zap.Hooks(countWarnings))
 		if c.Bool("json") == true {
 			aa := zap.NewDevelopmentEncoderConfig()
 			bb := zap.New(zapcore.NewCore(
@@ -134,7 +270,7 @@ func main() {
 				lvl,
 			), opts...)
 			log = bb.Sugar()
-			return nil
+			return startDiagnosticsIfEnabled()
 		}
 		aa := zap.NewDevelopmentEncoderConfig()
 		aa.EncodeLevel = zapcore.CapitalColorLevelEncoder
@@ -146,10 +282,22 @@ func main() {
 			lvl,
 		), opts...)
 		log = bb.Sugar()
-		return nil
+		return startDiagnosticsIfEnabled()
+	}
+
+	// commands that fail with an exit code (e.g. lint finding errors) exit from within Run
+	exit := cli.OsExiter
+	cli.OsExiter = func(code int) {
+		shutdownTracing()
+		printSummary(xerrors.Errorf("exit status %d", code))
+		exit(code)
 	}
 
 	err := app.Run(os.Args)
+	shutdownTracing()
+	if serr := printSummary(err); serr != nil && err == nil {
+		err = serr
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/query"
+	"github.com/gen0cide/osqt/zaplog"
+)
+
+var (
+	historyDir    string
+	recordHistory bool
+)
+
+// qualityReport counts the problems found parsing a specs directory and linting the example queries of its
+// tables. Reports exported as JSON can be kept in a directory and compared across runs with --history.
+type qualityReport struct {
+	GeneratedAt   time.Time       `json:"generated_at"`
+	SpecsDir      string          `json:"specs_dir"`
+	Files         int             `json:"files"`
+	Tables        int             `json:"tables"`
+	ParseErrors   int             `json:"parse_errors"`
+	ParseWarnings int             `json:"parse_warnings"`
+	LintErrors    int             `json:"lint_errors"`
+	LintWarnings  int             `json:"lint_warnings"`
+	Issues        []*qualityIssue `json:"issues,omitempty"`
+	Trend         *qualityTrend   `json:"trend,omitempty"`
+}
+
+// qualityIssue is a single problem counted by a qualityReport.
+type qualityIssue struct {
+	File    string `json:"file"`
+	Table   string `json:"table,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// qualityTrend compares a report with the reports of previous runs.
+type qualityTrend struct {
+	Status string          `json:"status"`
+	Delta  map[string]int  `json:"delta,omitempty"`
+	Runs   []*qualityPoint `json:"runs"`
+}
+
+// qualityPoint is the counts of one run, for plotting.
+type qualityPoint struct {
+	GeneratedAt   time.Time `json:"generated_at"`
+	ParseErrors   int       `json:"parse_errors"`
+	ParseWarnings int       `json:"parse_warnings"`
+	LintErrors    int       `json:"lint_errors"`
+	LintWarnings  int       `json:"lint_warnings"`
+	Total         int       `json:"total"`
+}
+
+func (r *qualityReport) point() *qualityPoint {
+	return &qualityPoint{
+		GeneratedAt:   r.GeneratedAt,
+		ParseErrors:   r.ParseErrors,
+		ParseWarnings: r.ParseWarnings,
+		LintErrors:    r.LintErrors,
+		LintWarnings:  r.LintWarnings,
+		Total:         r.ParseErrors + r.ParseWarnings + r.LintErrors + r.LintWarnings,
+	}
+}
+
+var qualityCommand = cli.Command{
+	Name:  "quality",
+	Usage: "Reports parse warnings and example query lint findings for a specs directory, optionally trended against previous reports.",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "specs-dir",
+			Destination: &specsDir,
+			Usage:       "Path to the OSQuery specs directory to check (required).",
+		},
+		cli.StringFlag{
+			Name:        "history",
+			Destination: &historyDir,
+			Usage:       "Directory of JSON quality reports from previous runs to compare against.",
+		},
+		cli.BoolFlag{
+			Name:        "record",
+			Destination: &recordHistory,
+			Usage:       "Save this run's report into the --history directory.",
+		},
+		cli.StringFlag{
+			Name:        "output-format",
+			Destination: &outputFormat,
+			Usage:       "Format to write the report in (options: 'text' or 'json').",
+			Value:       "text",
+		},
+	},
+	Action: statsQuality,
+}
+
+func statsQuality(c *cli.Context) error {
+	if specsDir == "" {
+		return xerrors.New("--specs-dir PATH was not provided")
+	}
+	if err := isValidDirectory(specsDir); err != nil {
+		return xerrors.Errorf("--specs-dir value was invalid: %v", err)
+	}
+	if recordHistory && historyDir == "" {
+		return xerrors.New("--record requires --history DIR")
+	}
+	if outputFormat != "text" && outputFormat != "json" {
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	report, err := checkSpecQuality(specsDir)
+	if err != nil {
+		return err
+	}
+
+	if historyDir != "" {
+		history, err := loadQualityHistory(historyDir)
+		if err != nil {
+			return err
+		}
+		report.Trend = qualityTrendFor(report, history)
+
+		if recordHistory {
+			if err := recordQualityReport(historyDir, report); err != nil {
+				return err
+			}
+		}
+	}
+
+	if outputFormat == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render quality report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	}
+	return printQuality(report)
+}
+
+// checkSpecQuality parses every spec file under dir, counting the files that fail to parse and the warnings and
+// errors logged while parsing the rest, then lints each table's examples against the tables that did parse.
+func checkSpecQuality(dir string) (*qualityReport, error) {
+	report := &qualityReport{GeneratedAt: time.Now().UTC(), SpecsDir: dir}
+
+	messages := []string{}
+	logger := log.Named("parser").Desugar().WithOptions(zap.Hooks(func(e zapcore.Entry) error {
+		if e.Level >= zapcore.WarnLevel {
+			messages = append(messages, e.Message)
+		}
+		return nil
+	})).Sugar()
+
+	parser := osqt.NewParser(zaplog.New(logger))
+	files := map[*osqt.Table]string{}
+	err := filepath.Walk(dir, func(fileloc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(fileloc) != ".table" {
+			return nil
+		}
+		report.Files++
+		rel, err := filepath.Rel(dir, fileloc)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		before := len(messages)
+		tbl, err := parser.ParseTableDef(fileloc)
+		if err != nil {
+			report.ParseErrors++
+			report.Issues = append(report.Issues, &qualityIssue{File: rel, Kind: "parse-error", Message: err.Error()})
+			return nil
+		}
+		for _, msg := range messages[before:] {
+			report.ParseWarnings++
+			report.Issues = append(report.Issues, &qualityIssue{File: rel, Table: tbl.Name, Kind: "parse-warning", Message: msg})
+		}
+
+		nsid := filepath.Base(filepath.Dir(fileloc))
+		ns, ok := parser.Namespaces[nsid]
+		if !ok {
+			ns = osqt.NewNamespace(nsid, osqt.CanonicalPlatforms[nsid], parser, nil)
+			parser.Namespaces[nsid] = ns
+		}
+		tbl.NamespaceID, tbl.Namespace = nsid, ns
+		ns.Tables[tbl.Name] = tbl
+		files[tbl] = rel
+		report.Tables++
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("error walking specs directory: %v", err)
+	}
+
+	tables := make([]*osqt.Table, 0, len(files))
+	for tbl := range files {
+		tables = append(tables, tbl)
+	}
+	sort.Slice(tables, func(i, j int) bool { return files[tables[i]] < files[tables[j]] })
+	for _, tbl := range tables {
+		for _, example := range tbl.Examples {
+			findings, err := query.Lint(parser, example)
+			if err != nil {
+				report.LintErrors++
+				report.Issues = append(report.Issues, &qualityIssue{File: files[tbl], Table: tbl.Name, Kind: "lint-error", Message: err.Error()})
+				continue
+			}
+			for _, f := range findings {
+				kind := "lint-warning"
+				switch f.Severity {
+				case query.SeverityError:
+					kind = "lint-error"
+					report.LintErrors++
+				case query.SeverityWarning:
+					report.LintWarnings++
+				default:
+					continue
+				}
+				report.Issues = append(report.Issues, &qualityIssue{File: files[tbl], Table: tbl.Name, Kind: kind, Message: fmt.Sprintf("%s [%s]", f.Message, f.Rule)})
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// loadQualityHistory reads the JSON quality reports in dir, oldest first. Files that are not quality reports are
+// skipped.
+func loadQualityHistory(dir string) ([]*qualityReport, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []*qualityReport{}, nil
+	} else if err != nil {
+		return nil, xerrors.Errorf("error reading --history directory: %v", err)
+	}
+
+	history := []*qualityReport{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		report := &qualityReport{}
+		if err := json.Unmarshal(data, report); err != nil || report.GeneratedAt.IsZero() {
+			log.Warnw("Skipping file that is not a quality report.", "file", entry.Name())
+			continue
+		}
+		history = append(history, report)
+	}
+
+	sort.Slice(history, func(i, j int) bool { return history[i].GeneratedAt.Before(history[j].GeneratedAt) })
+	return history, nil
+}
+
+// qualityTrendFor compares report with the most recent report in history. The trend is improving when the total
+// number of problems went down, regressing when it went up and unchanged otherwise.
+func qualityTrendFor(report *qualityReport, history []*qualityReport) *qualityTrend {
+	trend := &qualityTrend{Runs: make([]*qualityPoint, 0, len(history)+1)}
+	for _, prev := range history {
+		trend.Runs = append(trend.Runs, prev.point())
+	}
+	current := report.point()
+	trend.Runs = append(trend.Runs, current)
+
+	if len(history) == 0 {
+		trend.Status = "first"
+		return trend
+	}
+
+	prev := history[len(history)-1].point()
+	trend.Delta = map[string]int{
+		"parse_errors":   current.ParseErrors - prev.ParseErrors,
+		"parse_warnings": current.ParseWarnings - prev.ParseWarnings,
+		"lint_errors":    current.LintErrors - prev.LintErrors,
+		"lint_warnings":  current.LintWarnings - prev.LintWarnings,
+		"total":          current.Total - prev.Total,
+	}
+	switch {
+	case current.Total < prev.Total:
+		trend.Status = "improving"
+	case current.Total > prev.Total:
+		trend.Status = "regressing"
+	default:
+		trend.Status = "unchanged"
+	}
+	return trend
+}
+
+// recordQualityReport saves report into dir, named after the time it was generated.
+func recordQualityReport(dir string, report *qualityReport) error {
+	if !dryRun {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return xerrors.Errorf("error creating --history directory: %v", err)
+		}
+	}
+
+	saved := *report
+	saved.Trend = nil
+	data, err := json.MarshalIndent(&saved, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("error attempting to render quality report as JSON: %v", err)
+	}
+	fileloc := filepath.Join(dir, fmt.Sprintf("quality-%s.json", report.GeneratedAt.Format("20060102T150405Z")))
+	return writeOutputFile(fileloc, data)
+}
+
+func printQuality(report *qualityReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, issue := range report.Issues {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", issue.File, issue.Kind, issue.Message)
+	}
+	if len(report.Issues) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	current := report.point()
+	if report.Trend == nil || report.Trend.Delta == nil {
+		fmt.Fprintf(w, "METRIC\tCOUNT\n")
+		fmt.Fprintf(w, "parse_errors\t%d\nparse_warnings\t%d\nlint_errors\t%d\nlint_warnings\t%d\ntotal\t%d\n",
+			current.ParseErrors, current.ParseWarnings, current.LintErrors, current.LintWarnings, current.Total)
+	} else {
+		fmt.Fprintf(w, "METRIC\tCOUNT\tCHANGE\n")
+		for _, row := range []struct {
+			name  string
+			count int
+		}{
+			{"parse_errors", current.ParseErrors},
+			{"parse_warnings", current.ParseWarnings},
+			{"lint_errors", current.LintErrors},
+			{"lint_warnings", current.LintWarnings},
+			{"total", current.Total},
+		} {
+			fmt.Fprintf(w, "%s\t%d\t%+d\n", row.name, row.count, report.Trend.Delta[row.name])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d tables parsed from %d files.", report.Tables, report.Files)
+	if report.Trend != nil {
+		fmt.Printf(" Trend over %d runs: %s.", len(report.Trend.Runs), report.Trend.Status)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt/query"
+	"github.com/gen0cide/osqt/virtual"
+)
+
+var (
+	queryCommands = []cli.Command{
+		{
+			Name:  "explain",
+			Usage: "Prints the plan the virtual engine resolves a query to, with the tables and columns it reads.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "target-os",
+					Value:       runtime.GOOS,
+					Destination: &targetOS,
+					Usage:       "Runtime to target for the OSQuery dynamic configuration (what tables to use).",
+					EnvVar:      "OSQT_TARGET_OS",
+				},
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &inputQuery,
+					Usage:       "Query to explain.",
+					EnvVar:      "OSQT_INPUT_QUERY",
+				},
+				cli.StringFlag{
+					Name:        "file",
+					Destination: &queryFile,
+					Usage:       "File containing the SQL to explain (instead of --query).",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the plan in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: explainQuery,
+		},
+		{
+			Name:  "run",
+			Usage: "Runs one or more queries in-process against the virtual engine and writes their results, without starting a server.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "target-os",
+					Value:       runtime.GOOS,
+					Destination: &targetOS,
+					Usage:       "Runtime to target for the OSQuery dynamic configuration (what tables to use).",
+					EnvVar:      "OSQT_TARGET_OS",
+				},
+				cli.StringFlag{
+					Name:        "fixtures",
+					Destination: &fixturesDir,
+					Usage:       "Directory of <table>.json or <table>.yaml files whose rows are loaded into the tables before the queries run.",
+					EnvVar:      "OSQT_FIXTURES_DIR",
+				},
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &inputQuery,
+					Usage:       "Query to run. Several may be separated by semicolons.",
+					EnvVar:      "OSQT_INPUT_QUERY",
+				},
+				cli.StringFlag{
+					Name:        "query-file",
+					Destination: &queryFile,
+					Usage:       "File containing the semicolon separated queries to run (instead of --query).",
+				},
+				cli.StringFlag{
+					Name:        "output",
+					Destination: &outputFormat,
+					Usage:       "Format to write the results in (options: 'table', 'json' or 'csv').",
+					Value:       "table",
+				},
+			}, schemaOverlayFlags...),
+			Action: runQueries,
+		},
+	}
+)
+
+// queryResult is the result of one query run by the query run command. Each row holds a value for every column,
+// in the order of Columns, so columns sharing a name are kept apart. Values are rendered as strings, the way
+// osquery logs them, and NULL as nil.
+type queryResult struct {
+	Query   string      `json:"query"`
+	Columns []string    `json:"columns"`
+	Rows    [][]*string `json:"rows"`
+}
+
+// resultRow renders the first n values of a result row, one for each column of its schema.
+func resultRow(row []interface{}, n int) []*string {
+	cells := make([]*string, n)
+	for idx := 0; idx < n && idx < len(row); idx++ {
+		if row[idx] == nil {
+			continue
+		}
+		val := resultValue(row[idx])
+		cells[idx] = &val
+	}
+	return cells
+}
+
+// cellText renders a value of a resultRow for display, substituting null for NULL.
+func cellText(cell *string, null string) string {
+	if cell == nil {
+		return null
+	}
+	return *cell
+}
+
+// readInputQuery returns the SQL of the file flag fileFlag names, or else of --query.
+func readInputQuery(fileFlag string) (string, error) {
+	sql := inputQuery
+	if queryFile != "" {
+		data, err := ioutil.ReadFile(queryFile)
+		if err != nil {
+			return "", xerrors.Errorf("error reading --%s: %v", fileFlag, err)
+		}
+		sql = string(data)
+	}
+	if strings.TrimSpace(sql) == "" {
+		return "", xerrors.Errorf("--query QUERY or --%s PATH is required", fileFlag)
+	}
+	return sql, nil
+}
+
+func explainQuery(c *cli.Context) error {
+	sql, err := readInputQuery("file")
+	if err != nil {
+		return err
+	}
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	db, err := buildDatabase(parser, targetOS)
+	if err != nil {
+		return err
+	}
+
+	plan, err := db.Explain(context.Background(), strings.TrimRight(strings.TrimSpace(sql), ";"))
+	if err != nil {
+		return xerrors.Errorf("error explaining query: %v", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render plan as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "text":
+		printPlan(plan)
+		return nil
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+}
+
+func printPlan(plan *virtual.Plan) {
+	fmt.Println(strings.TrimRight(plan.Tree, "\n"))
+	fmt.Println()
+	fmt.Printf("tables:  %s\n", strings.Join(plan.Tables, ", "))
+	fmt.Printf("columns: %s\n", strings.Join(plan.Columns, ", "))
+}
+
+func runQueries(c *cli.Context) error {
+	switch outputFormat {
+	case "table", "json", "csv":
+	default:
+		return xerrors.Errorf("unsupported --output %q (options: 'table', 'json' or 'csv')", outputFormat)
+	}
+	sql, err := readInputQuery("query-file")
+	if err != nil {
+		return err
+	}
+	segments, err := query.SplitStatements(sql)
+	if err != nil {
+		return xerrors.Errorf("error splitting queries: %v", err)
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	db, err := buildDatabase(parser, targetOS)
+	if err != nil {
+		return err
+	}
+	if err := loadFixturesDir(db); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	results := make([]*queryResult, 0, len(segments))
+	for idx, seg := range segments {
+		schema, rows, err := db.Query(ctx, seg.SQL)
+		if err != nil {
+			return xerrors.Errorf("query %d: %v", idx+1, err)
+		}
+
+		result := &queryResult{Query: seg.SQL, Columns: make([]string, 0, len(schema)), Rows: make([][]*string, 0, len(rows))}
+		for _, col := range schema {
+			result.Columns = append(result.Columns, col.Name)
+		}
+		for _, row := range rows {
+			result.Rows = append(result.Rows, resultRow(row, len(schema)))
+		}
+		results = append(results, result)
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render results as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "csv":
+		return printResultsCSV(results)
+	default:
+		return printResultsTable(results)
+	}
+}
+
+// printResultsCSV writes each result as a header row followed by its rows, separating results with a blank line.
+// CSV has no NULL, so NULL values are written as empty fields.
+func printResultsCSV(results []*queryResult) error {
+	for idx, result := range results {
+		if idx > 0 {
+			fmt.Println()
+		}
+		w := csv.NewWriter(os.Stdout)
+		if err := w.Write(result.Columns); err != nil {
+			return err
+		}
+		for _, row := range result.Rows {
+			record := make([]string, len(row))
+			for i, cell := range row {
+				record[i] = cellText(cell, "")
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printResultsTable writes each result as an aligned table, preceded by its query when there are several.
+func printResultsTable(results []*queryResult) error {
+	for idx, result := range results {
+		if len(results) > 1 {
+			if idx > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("-- %s\n", result.Query)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(result.Columns, "\t")))
+		for _, row := range result.Rows {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				cells[i] = cellText(cell, "NULL")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("(%d rows)\n", len(result.Rows))
+	}
+	return nil
+}
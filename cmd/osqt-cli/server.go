@@ -1,8 +1,16 @@
 package main
 
 import (
-	"path/filepath"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli"
 	"golang.org/x/xerrors"
@@ -13,23 +21,121 @@ import (
 
 var (
 	listenAddr    string
+	listenSocket  string
+	socketMode    string
 	targetOS      string
+	allowlistPath string
+	denylistPath  string
+	storePath     string
+	recordDir     string
+	resultsLog    string
+	buildWithout  string
+	disableTables string
+	enableTables  string
+	eventRate     float64
+	protocol      string
+	httpAddr      string
+	grpcAddr      string
+	auditLogPath  string
+	drainTimeout  time.Duration
+	serverLimits  virtual.Limits
 	serveCommands = []cli.Command{
 		{
 			Name:  "run",
-			Usage: "Launches a MySQL compatible server with OSQuery tables setup.",
-			Flags: []cli.Flag{
+			Usage: "Launches a MySQL (or PostgreSQL) compatible server with OSQuery tables setup.",
+			Flags: append([]cli.Flag{
 				cli.StringFlag{
 					Name:        "listen-addr",
 					Destination: &listenAddr,
 					Value:       "127.0.0.1:13306",
-					Usage:       "Sets the listening server socket that will accept MySQL connections.",
+					Usage:       "Sets the listening server socket that will accept client connections (defaults to 127.0.0.1:15432 for postgres).",
 					EnvVar:      "OSQT_LISTENING_ADDR",
 				},
+				cli.StringFlag{
+					Name:        "listen-socket",
+					Destination: &listenSocket,
+					Usage:       "Listen on a unix domain socket at this path instead of a TCP address, for local-only tooling.",
+					EnvVar:      "OSQT_LISTEN_SOCKET",
+				},
+				cli.StringFlag{
+					Name:        "socket-mode",
+					Destination: &socketMode,
+					Value:       "0600",
+					Usage:       "Octal file permissions applied to the --listen-socket socket.",
+					EnvVar:      "OSQT_SOCKET_MODE",
+				},
+				cli.StringFlag{
+					Name:        "protocol",
+					Destination: &protocol,
+					Value:       "mysql",
+					Usage:       "Wire protocol the server speaks (options: 'mysql' or 'postgres').",
+					EnvVar:      "OSQT_PROTOCOL",
+				},
+				cli.StringFlag{
+					Name:        "http-addr",
+					Destination: &httpAddr,
+					Usage:       "Also serve a JSON query API (POST /query, GET /schema) on this address.",
+					EnvVar:      "OSQT_HTTP_ADDR",
+				},
+				cli.StringFlag{
+					Name:        "grpc-addr",
+					Destination: &grpcAddr,
+					Usage:       "Also serve the VirtualDatabase gRPC service (Query, ListTables, DescribeTable) on this address.",
+					EnvVar:      "OSQT_GRPC_ADDR",
+				},
+				cli.StringFlag{
+					Name:        "audit-log",
+					Destination: &auditLogPath,
+					Usage:       "Append a JSON line for every statement executed (client, duration, row count) to this file.",
+					EnvVar:      "OSQT_AUDIT_LOG",
+				},
+				cli.IntFlag{
+					Name:        "max-connections",
+					Destination: &serverLimits.MaxConnections,
+					Usage:       "Maximum number of client connections open at once (0 for no limit).",
+					EnvVar:      "OSQT_MAX_CONNECTIONS",
+				},
+				cli.Float64Flag{
+					Name:        "rate-limit",
+					Destination: &serverLimits.QueriesPerSecond,
+					Usage:       "Maximum statements per second each connection may execute (0 for no limit).",
+					EnvVar:      "OSQT_RATE_LIMIT",
+				},
+				cli.IntFlag{
+					Name:        "rate-burst",
+					Destination: &serverLimits.QueryBurst,
+					Usage:       "Statements a connection may execute back to back before --rate-limit applies (defaults to the rate).",
+					EnvVar:      "OSQT_RATE_BURST",
+				},
+				cli.DurationFlag{
+					Name:        "idle-timeout",
+					Destination: &serverLimits.IdleTimeout,
+					Usage:       "Close connections that have not sent a statement for this long (0 to keep them open).",
+					EnvVar:      "OSQT_IDLE_TIMEOUT",
+				},
+				cli.DurationFlag{
+					Name:        "watchdog-latency",
+					Destination: &serverLimits.WatchdogLatency,
+					Usage:       "Stop statements running longer than this with osqueryd's watchdog error (0 for no limit).",
+					EnvVar:      "OSQT_WATCHDOG_LATENCY",
+				},
+				cli.DurationFlag{
+					Name:        "watchdog-cpu",
+					Destination: &serverLimits.WatchdogCPU,
+					Usage:       "Stop statements using more than this much CPU time with osqueryd's watchdog error (0 for no limit, Linux only).",
+					EnvVar:      "OSQT_WATCHDOG_CPU",
+				},
+				cli.DurationFlag{
+					Name:        "shutdown-timeout",
+					Destination: &drainTimeout,
+					Value:       30 * time.Second,
+					Usage:       "How long to wait for running statements to finish after SIGINT/SIGTERM before closing connections.",
+					EnvVar:      "OSQT_SHUTDOWN_TIMEOUT",
+				},
 				cli.StringFlag{
 					Name:        "schema",
 					Destination: &schemaPath,
-					Usage:       "Path to a previously exported OSQuery schema JSON or YAML file.",
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
 					EnvVar:      "OSQT_SCHEMA_PATH",
 				},
 				cli.StringFlag{
@@ -42,78 +148,474 @@ var (
 					Name:        "target-os",
 					Value:       runtime.GOOS,
 					Destination: &targetOS,
-					Usage:       "Runtime to target for the OSQuery dynamic configuration (what tables to use).",
+					Usage:       "Runtime to target for the OSQuery dynamic configuration (what tables to use). A comma separated list serves one osquery_<os> database per platform.",
 					EnvVar:      "OSQT_TARGET_OS",
 				},
-			},
+				cli.StringFlag{
+					Name:        "build-without",
+					Destination: &buildWithout,
+					Usage:       "Comma separated optional namespaces the target osquery build was compiled without (e.g. 'yara,sleuthkit'), whose tables are not served.",
+					EnvVar:      "OSQT_BUILD_WITHOUT",
+				},
+				cli.StringFlag{
+					Name:        "disable-tables",
+					Destination: &disableTables,
+					Usage:       "Comma separated tables to leave out, as osqueryd's --disable_tables flag does.",
+					EnvVar:      "OSQT_DISABLE_TABLES",
+				},
+				cli.StringFlag{
+					Name:        "enable-tables",
+					Destination: &enableTables,
+					Usage:       "Comma separated tables to serve, leaving out every other table, as osqueryd's --enable_tables flag does. --disable-tables takes precedence.",
+					EnvVar:      "OSQT_ENABLE_TABLES",
+				},
+				cli.StringFlag{
+					Name:        "extension-socket",
+					Destination: &extensionSocket,
+					Usage:       "Proxy table reads to the osquery instance listening on this extension socket instead of serving empty tables.",
+					EnvVar:      "OSQT_EXTENSION_SOCKET",
+				},
+				cli.StringFlag{
+					Name:        "record-dir",
+					Destination: &recordDir,
+					Usage:       "Answer queries with results recorded in this directory. With --extension-socket, queries without a recording are forwarded to osquery and their results recorded, unless --dry-run is set.",
+					EnvVar:      "OSQT_RECORD_DIR",
+				},
+				cli.Float64Flag{
+					Name:        "event-rate",
+					Destination: &eventRate,
+					Usage:       "Simulate events in the evented tables (e.g. process_events), appending this many rows per second to each.",
+					EnvVar:      "OSQT_EVENT_RATE",
+				},
+				cli.Int64Flag{
+					Name:        "seed",
+					Destination: &syntheticSeed,
+					Usage:       "Seed for simulated events. The same seed generates the same events on every run.",
+					EnvVar:      "OSQT_SEED",
+				},
+				cli.StringFlag{
+					Name:        "store",
+					Destination: &storePath,
+					Usage:       "Keep table rows in this on-disk database file so inserted rows and fixtures survive restarts.",
+					EnvVar:      "OSQT_STORE_PATH",
+				},
+				cli.StringFlag{
+					Name:        "fixtures-dir",
+					Destination: &fixturesDir,
+					Usage:       "Directory of <table>.json or <table>.yaml files whose rows are loaded into the tables at startup.",
+					EnvVar:      "OSQT_FIXTURES_DIR",
+				},
+				cli.StringFlag{
+					Name:        "results-log",
+					Destination: &resultsLog,
+					Usage:       "Load the rows osqueryd last logged for each scheduled query in this results log (e.g. /var/log/osquery/osqueryd.results.log) into the matching tables. Takes precedence over --fixtures-dir.",
+					EnvVar:      "OSQT_RESULTS_LOG",
+				},
+				cli.StringFlag{
+					Name:        "allowlist",
+					Destination: &allowlistPath,
+					Usage:       "Path to a YAML or JSON query policy. Only queries listed in it will be executed.",
+					EnvVar:      "OSQT_ALLOWLIST",
+				},
+				cli.StringFlag{
+					Name:        "denylist",
+					Destination: &denylistPath,
+					Usage:       "Path to a YAML or JSON query policy. Queries listed in it will be rejected.",
+					EnvVar:      "OSQT_DENYLIST",
+				},
+			}, schemaOverlayFlags...),
 			Action: runServer,
 		},
+		{
+			Name:  "fingerprint",
+			Usage: "Prints the normalized form and fingerprint of a query for use in allowlist/denylist policies.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "query",
+					Destination: &inputQuery,
+					Usage:       "Query to fingerprint.",
+					EnvVar:      "OSQT_INPUT_QUERY",
+				},
+			},
+			Action: fingerprintQuery,
+		},
 	}
 )
 
+func fingerprintQuery(c *cli.Context) error {
+	if inputQuery == "" {
+		return xerrors.New("--query QUERY was not provided")
+	}
+
+	fmt.Printf("normalized:  %s\n", virtual.NormalizeQuery(inputQuery))
+	fmt.Printf("fingerprint: %s\n", virtual.Fingerprint(inputQuery))
+	return nil
+}
+
+func loadQueryPolicy() (*virtual.QueryPolicy, error) {
+	if allowlistPath != "" && denylistPath != "" {
+		return nil, xerrors.New("--allowlist and --denylist cannot be used together")
+	}
+	if allowlistPath != "" {
+		return virtual.LoadQueryPolicy(allowlistPath, virtual.PolicyAllowlist)
+	}
+	if denylistPath != "" {
+		return virtual.LoadQueryPolicy(denylistPath, virtual.PolicyDenylist)
+	}
+	return nil, nil
+}
+
 func runServer(c *cli.Context) error {
-	if schemaPath == "" && specsDir == "" {
-		return xerrors.New("--schema PATH or --specs-dir PATH are required!")
+	if protocol != "mysql" && protocol != "postgres" {
+		return xerrors.Errorf("unsupported --protocol %q (options: 'mysql' or 'postgres')", protocol)
+	}
+	if protocol == "postgres" && !c.IsSet("listen-addr") {
+		listenAddr = "127.0.0.1:15432"
+	}
+
+	listenProto := "tcp"
+	if listenSocket != "" {
+		if c.IsSet("listen-addr") {
+			return xerrors.New("--listen-addr and --listen-socket cannot be used together")
+		}
+		listenProto, listenAddr = "unix", listenSocket
+	}
+	mode, err := strconv.ParseUint(socketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return xerrors.Errorf("--socket-mode value %q is not a valid octal permission", socketMode)
+	}
+
+	policy, err := loadQueryPolicy()
+	if err != nil {
+		return err
+	}
+	if err := buildConfig().Validate(); err != nil {
+		return xerrors.Errorf("--build-without value was invalid: %v", err)
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
 	}
 
-	parser := osqt.NewParser(log.Named("parser"))
-	if specsDir != "" {
-		err := parser.ParseDirectory(specsDir)
+	if extensionSocket != "" && storePath != "" {
+		return xerrors.New("--extension-socket and --store cannot be used together")
+	}
+
+	setup := []func(*virtual.Database) error{}
+	var provider *virtual.ExtensionProvider
+	if extensionSocket != "" {
+		provider, err = virtual.NewExtensionProvider(extensionSocket, 10*time.Second)
 		if err != nil {
 			return err
 		}
-	} else {
-		switch filepath.Ext(schemaPath) {
-		case ".json":
-			err := parser.ParseJSONSchemaFile(schemaPath)
-			if err != nil {
-				return err
-			}
-		case ".yaml":
-			err := parser.ParseYAMLSchemaFile(schemaPath)
-			if err != nil {
-				return err
-			}
+		defer provider.Close()
+	}
+	switch {
+	case recordDir != "":
+		recorder, err := virtual.NewRecorder(recordDir, provider, dryRun)
+		if err != nil {
+			return err
+		}
+		setup = append(setup, func(db *virtual.Database) error { return db.SetRecorder(recorder) })
+		if provider != nil && dryRun {
+			log.Infof("Dry run: forwarding unrecorded queries to the osquery extension socket at %s without recording them to %s.", extensionSocket, recordDir)
+		} else if provider != nil {
+			log.Infof("Recording query results from the osquery extension socket at %s to %s.", extensionSocket, recordDir)
+		} else {
+			log.Infof("Replaying query results recorded in %s.", recordDir)
 		}
+	case provider != nil:
+		setup = append(setup, func(db *virtual.Database) error { return db.SetExtensionProvider(provider) })
+		log.Infof("Proxying table reads to the osquery extension socket at %s.", extensionSocket)
+	}
+	if storePath != "" {
+		store, err := virtual.OpenStore(storePath)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		setup = append(setup, func(db *virtual.Database) error { return db.SetStore(store) })
+		log.Infof("Persisting table rows to %s.", storePath)
 	}
 
-	db, err := virtual.NewDatabase("vosqt", parser, log.Named("db"))
+	var simulator *virtual.EventSimulator
+	if eventRate > 0 {
+		simulator, err = virtual.NewEventSimulator(eventRate, virtual.NewFaker(syntheticSeed))
+		if err != nil {
+			return err
+		}
+		setup = append(setup, func(db *virtual.Database) error { return simulateEvents(db, parser, simulator) })
+	}
+
+	db, err := buildDatabase(parser, targetOS, setup...)
 	if err != nil {
 		return err
 	}
 
-	namespaces, found := osqt.GOOSToApplicableNamespaces[targetOS]
-	if !found {
-		return xerrors.Errorf("--target-os value provided (%s) was not valid (valid: 'windows', 'linux', 'darwin', 'freebsd').", targetOS)
+	if simulator != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go simulator.Run(ctx)
 	}
 
-	for _, nsid := range namespaces {
-		ns, valid := parser.Namespaces[nsid]
-		if !valid {
-			log.Errorf("could not locate %s namespace within the parser", nsid)
-			continue
+	if resultsLog != "" || fixturesDir != "" {
+		fixtures, err := serverFixtures(db, resultsLog, fixturesDir)
+		if err != nil {
+			return err
+		}
+		if err := db.LoadFixtures(fixtures); err != nil {
+			return err
 		}
+	}
 
-		for tblname, table := range ns.Tables {
-			err := db.AddTable(table, []string{targetOS})
-			if err != nil {
-				log.Errorf("Error encountered adding a table to the database: %v", err)
-				continue
-			}
-			log.Debugf("Added table %s to the database...", tblname)
+	db.SetSocketMode(os.FileMode(mode))
+	if err := db.SetLimits(serverLimits); err != nil {
+		return err
+	}
+
+	if policy != nil {
+		db.SetQueryPolicy(policy)
+		log.Infof("Enforcing %s query policy (%d queries, %d fingerprints).", policy.Mode, len(policy.Queries), len(policy.Fingerprints))
+	}
+
+	if auditLogPath != "" {
+		auditLog, err := virtual.OpenAuditLog(auditLogPath)
+		if err != nil {
+			return err
 		}
+		defer auditLog.Close()
+		db.SetAuditLog(auditLog)
+		log.Infof("Writing the statement audit log to %s.", auditLogPath)
 	}
 
-	err = db.Initialize()
+	if httpAddr != "" {
+		go func() {
+			log.Infof("Starting HTTP API listener at: %s", httpAddr)
+			if err := db.StartHTTP(httpAddr); err != nil {
+				log.Errorf("HTTP API listener failed: %v", err)
+			}
+		}()
+	}
+
+	if grpcAddr != "" {
+		go func() {
+			log.Infof("Starting gRPC listener at: %s", grpcAddr)
+			if err := db.StartGRPC("tcp", grpcAddr); err != nil {
+				log.Errorf("gRPC listener failed: %v", err)
+			}
+		}()
+	}
+
+	stopped := handleShutdownSignals(db)
+	handleReloadSignal(db)
+
+	log.Infof("Starting %s server listener at: %s", protocol, listenAddr)
+	if protocol == "postgres" {
+		err = db.StartPostgres(listenProto, listenAddr)
+	} else {
+		err = db.Start(listenProto, listenAddr)
+	}
 	if err != nil {
 		return err
 	}
 
-	log.Infof("Starting server listener at: %s", listenAddr)
-	err = db.Start("tcp", listenAddr)
+	// the listener only returns cleanly once a shutdown has begun, so wait for it to finish before the deferred
+	// store and audit log are closed.
+	return <-stopped
+}
+
+// handleShutdownSignals stops db when the process receives SIGINT or SIGTERM. The returned channel receives the
+// result of the shutdown once it completes.
+func handleShutdownSignals(db *virtual.Database) <-chan error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	stopped := make(chan error, 1)
+	go func() {
+		sig := <-sigs
+		signal.Stop(sigs)
+		log.Infof("Received %s, draining connections (timeout %s)...", sig, drainTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		stopped <- db.Stop(ctx)
+	}()
+	return stopped
+}
+
+// handleReloadSignal re-parses the table specs whenever the process receives SIGHUP, and swaps the schemas of
+// tables that changed into db. Tables added to the specs are not served until the server is restarted.
+func handleReloadSignal(db *virtual.Database) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for range sigs {
+			log.Info("Received SIGHUP, reloading table specs...")
+			if err := reloadTables(db); err != nil {
+				log.Errorf("Error reloading table specs: %v", err)
+			}
+		}
+	}()
+}
+
+// reloadTables parses the table specs again and reloads every table applicable to the served platforms.
+func reloadTables(db *virtual.Database) error {
+	parser, err := loadParser()
 	if err != nil {
 		return err
 	}
 
+	tables := map[string]*osqt.Table{}
+	for _, platform := range strings.Split(targetOS, ",") {
+		for name, tbl := range parser.TablesForBuild(strings.TrimSpace(platform), buildConfig()) {
+			tables[name] = tbl
+		}
+	}
+
+	reloaded := 0
+	for name, tbl := range tables {
+		changed, err := db.ReloadTable(tbl)
+		if xerrors.Is(err, virtual.ErrTableNotFound) {
+			log.Warnw("Table is new, restart the server to serve it", "table", name)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if changed {
+			reloaded++
+		}
+	}
+
+	log.Infof("Reloaded %d of %d tables.", reloaded, len(tables))
 	return nil
 }
+
+// simulateEvents has simulator generate the rows of the evented tables in the primary database.
+func simulateEvents(db *virtual.Database, parser *osqt.Parser, simulator *virtual.EventSimulator) error {
+	platform := strings.TrimSpace(strings.Split(targetOS, ",")[0])
+	names := []string{}
+	for name, tbl := range parser.TablesForBuild(platform, buildConfig()) {
+		if !tbl.IsEvented() {
+			continue
+		}
+		if err := simulator.Simulate(db, tbl, platform); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Infof("Simulating %v events per second in %d evented tables: %s", eventRate, len(names), strings.Join(names, ", "))
+	return nil
+}
+
+// serverFixtures returns the fixtures of fixturesDir, with the tables the queries of resultsLog matched holding the
+// rows osqueryd logged instead, so a results log takes precedence over fixture files for the same table. Either
+// may be empty.
+func serverFixtures(db *virtual.Database, resultsLog, fixturesDir string) (virtual.Fixtures, error) {
+	fixtures := virtual.Fixtures{}
+	if fixturesDir != "" {
+		loaded, err := virtual.LoadFixtures(fixturesDir)
+		if err != nil {
+			return nil, err
+		}
+		for tname, rows := range loaded {
+			fixtures[tname] = rows
+		}
+		log.Infof("Loaded fixtures for %d tables from %s.", len(loaded), fixturesDir)
+	}
+
+	if resultsLog != "" {
+		results, err := virtual.ParseResultsLog(resultsLog)
+		if err != nil {
+			return nil, err
+		}
+		logged := db.ResultsFixtures(results)
+		for tname, rows := range logged {
+			if _, ok := fixtures[tname]; ok {
+				log.Debugf("Using the results log rather than the fixture file for table %s...", tname)
+			}
+			fixtures[tname] = rows
+		}
+		log.Infof("Loaded results of %d queries into %d tables from %s.", len(results), len(logged), resultsLog)
+	}
+
+	return fixtures, nil
+}
+
+// buildConfig returns the build and configuration of the osquery deployment being emulated.
+func buildConfig() *osqt.BuildConfig {
+	return &osqt.BuildConfig{
+		Without:        osqt.SplitTableList(buildWithout),
+		DisabledTables: osqt.SplitTableList(disableTables),
+		EnabledTables:  osqt.SplitTableList(enableTables),
+	}
+}
+
+// buildDatabase creates and initializes a virtual database containing every table applicable to goos, less those
+// excluded by --build-without, --disable-tables and --enable-tables. goos may
+// be a comma separated list of platforms, in which case each gets its own database named osquery_<platform>, with
+// the first being the default. Each setup function is called on the database before it is initialized.
+func buildDatabase(parser *osqt.Parser, goos string, setup ...func(*virtual.Database) error) (*virtual.Database, error) {
+	platforms := []string{}
+	for _, platform := range strings.Split(goos, ",") {
+		platform = strings.TrimSpace(platform)
+		if _, found := osqt.GOOSToApplicableNamespaces[platform]; !found {
+			return nil, xerrors.Errorf("--target-os value provided (%s) was not valid (valid: 'windows', 'linux', 'darwin', 'freebsd').", platform)
+		}
+		platforms = append(platforms, platform)
+	}
+
+	dbname := func(platform string) string {
+		if len(platforms) == 1 {
+			return "vosqt"
+		}
+		return "osquery_" + platform
+	}
+
+	db, err := virtual.NewDatabase(dbname(platforms[0]), parser, log.Named("db"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fn := range setup {
+		if err := fn(db); err != nil {
+			return nil, err
+		}
+	}
+
+	build := buildConfig()
+	for _, platform := range platforms {
+		for _, nsid := range osqt.GOOSToApplicableNamespaces[platform] {
+			ns, valid := parser.Namespaces[nsid]
+			if !valid {
+				log.Errorf("could not locate %s namespace within the parser", nsid)
+				continue
+			}
+
+			for tblname, table := range ns.Tables {
+				if !build.Includes(nsid, tblname) {
+					log.Debugf("Skipped table %s, which the target build does not include...", tblname)
+					continue
+				}
+				err := db.AddTableTo(dbname(platform), table, []string{platform})
+				if err != nil {
+					log.Errorf("Skipped table %s, which could not be added to the database: %v", tblname, err)
+					continue
+				}
+				log.Debugf("Added table %s to the %s database...", tblname, dbname(platform))
+			}
+		}
+	}
+
+	err = db.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(platforms) > 1 {
+		log.Infof("Serving databases %s (switch with USE).", strings.Join(db.Databases(), ", "))
+	}
+	return db, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gen0cide/osqt"
+	"go.uber.org/zap"
+)
+
+// TestServerFixturesResultsLogPrecedence loads a results log and a fixtures directory that both hold rows for
+// groups, and checks the table ends up with only the logged rows while the other fixtures are still loaded.
+func TestServerFixturesResultsLogPrecedence(t *testing.T) {
+	log = zap.NewNop().Sugar()
+
+	dir, err := ioutil.TempDir("", "osqt-fixtures-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixturesDir := filepath.Join(dir, "fixtures")
+	if err := os.Mkdir(fixturesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"groups.json": `[{"gid": "0", "groupname": "fixture_root"}, {"gid": "20", "groupname": "fixture_staff"}]`,
+		"users.json":  `[{"uid": "0", "username": "root"}]`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(fixturesDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resultsLog := filepath.Join(dir, "osqueryd.results.log")
+	entry := `{"name":"pack_test_groups","hostIdentifier":"host1","action":"snapshot","snapshot":[{"gid":"1000","groupname":"logged"}]}` + "\n"
+	if err := ioutil.WriteFile(resultsLog, []byte(entry), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := osqt.NewParser(nil)
+	if err := parser.ParseJSONSchemaFile(filepath.Join("testdir", "schema.json")); err != nil {
+		t.Fatal(err)
+	}
+	db, err := buildDatabase(parser, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures, err := serverFixtures(db, resultsLog, fixturesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []map[string]string{{"gid": "1000", "groupname": "logged"}}; !reflect.DeepEqual(fixtures["groups"], want) {
+		t.Errorf("groups fixture = %v, want the logged rows %v", fixtures["groups"], want)
+	}
+	if len(fixtures["users"]) != 1 {
+		t.Errorf("users fixture = %v, want the row of users.json", fixtures["users"])
+	}
+
+	if err := db.LoadFixtures(fixtures); err != nil {
+		t.Fatal(err)
+	}
+	_, rows, err := db.Query(context.Background(), "SELECT groupname FROM groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, row := range rows {
+		got = append(got, row[0].(string))
+	}
+	if want := []string{"logged"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groups rows = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/zaplog"
+)
+
+var (
+	repoPath      string
+	staleYears    int
+	statsCommands = []cli.Command{
+		{
+			Name:  "authors",
+			Usage: "Reports the ownership and age of each table's spec file using git blame, flagging stale tables.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "repo",
+					Destination: &repoPath,
+					Usage:       "Path to a git checkout of the osquery repository (required).",
+					EnvVar:      "OSQT_REPO_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the specs directory, relative to --repo.",
+					Value:       "specs",
+				},
+				cli.IntFlag{
+					Name:        "stale-years",
+					Destination: &staleYears,
+					Usage:       "Flag tables whose spec file has not been modified in this many years.",
+					Value:       3,
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the report in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			},
+			Action: statsAuthors,
+		},
+		qualityCommand,
+	}
+)
+
+// tableAuthorship is the git blame summary for a single table's spec file.
+type tableAuthorship struct {
+	Table        string         `json:"table"`
+	Namespace    string         `json:"namespace"`
+	File         string         `json:"file"`
+	Owner        string         `json:"owner"`
+	Authors      map[string]int `json:"authors"`
+	Created      time.Time      `json:"created"`
+	LastModified time.Time      `json:"last_modified"`
+	Examples     int            `json:"examples"`
+	Flags        []string       `json:"flags,omitempty"`
+}
+
+func statsAuthors(c *cli.Context) error {
+	if repoPath == "" {
+		return xerrors.New("--repo PATH was not provided")
+	}
+	if err := isValidDirectory(repoPath); err != nil {
+		return xerrors.Errorf("--repo value was invalid: %v", err)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return xerrors.New("git must be installed and in the PATH")
+	}
+
+	root := filepath.Join(repoPath, specsDir)
+	if err := isValidDirectory(root); err != nil {
+		return xerrors.Errorf("--specs-dir value was invalid: %v", err)
+	}
+
+	parser := osqt.NewParserWithOptions(zaplog.New(log.Named("parser")), parserOptions())
+	cutoff := time.Now().AddDate(-staleYears, 0, 0)
+	report := []*tableAuthorship{}
+	err := filepath.Walk(root, func(fileloc string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(fileloc) != ".table" {
+			return nil
+		}
+
+		tbl, err := parser.ParseTableDef(fileloc)
+		if err != nil {
+			log.Warnw("Error parsing spec file.", "file", fileloc, "error", err)
+			return nil
+		}
+
+		rel, err := filepath.Rel(repoPath, fileloc)
+		if err != nil {
+			return err
+		}
+		entry, err := blameSpec(rel)
+		if err != nil {
+			return err
+		}
+
+		entry.Table = tbl.Name
+		entry.Namespace = filepath.Base(filepath.Dir(fileloc))
+		entry.Examples = len(tbl.Examples)
+		if entry.LastModified.Before(cutoff) {
+			entry.Flags = append(entry.Flags, fmt.Sprintf("untouched %d+ years", staleYears))
+		}
+		if entry.Examples == 0 {
+			entry.Flags = append(entry.Flags, "no examples")
+		}
+		report = append(report, entry)
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("error walking specs directory: %v", err)
+	}
+
+	// stalest tables first, as they are the most likely to need attention
+	sort.Slice(report, func(i, j int) bool {
+		if !report[i].LastModified.Equal(report[j].LastModified) {
+			return report[i].LastModified.Before(report[j].LastModified)
+		}
+		return report[i].Table < report[j].Table
+	})
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render authorship report as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+		return nil
+	case "text":
+		return printAuthorship(report)
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+}
+
+// blameSpec summarizes `git blame` for the spec file at rel, a path relative to --repo.
+func blameSpec(rel string) (*tableAuthorship, error) {
+	cmd := exec.Command("git", "-C", repoPath, "blame", "--line-porcelain", "--", filepath.ToSlash(rel))
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, xerrors.Errorf("error running git blame on %s: %v: %s", rel, err, strings.TrimSpace(stderr.String()))
+	}
+
+	entry := &tableAuthorship{
+		File:    filepath.ToSlash(rel),
+		Authors: map[string]int{},
+	}
+	author := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "author "):
+			author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			sec, err := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64)
+			if err != nil {
+				continue
+			}
+			t := time.Unix(sec, 0).UTC()
+			if entry.Created.IsZero() || t.Before(entry.Created) {
+				entry.Created = t
+			}
+			if t.After(entry.LastModified) {
+				entry.LastModified = t
+			}
+		case strings.HasPrefix(line, "\t"):
+			// the content line closes each blamed line's header
+			entry.Authors[author]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	most := 0
+	for name, lines := range entry.Authors {
+		if lines > most || (lines == most && name < entry.Owner) {
+			entry.Owner, most = name, lines
+		}
+	}
+	return entry, nil
+}
+
+func printAuthorship(report []*tableAuthorship) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tNAMESPACE\tOWNER\tAUTHORS\tCREATED\tLAST MODIFIED\tEXAMPLES\tFLAGS")
+	stale := 0
+	for _, entry := range report {
+		if len(entry.Flags) > 0 {
+			stale++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%d\t%s\n", entry.Table, entry.Namespace, entry.Owner, len(entry.Authors),
+			entry.Created.Format("2006-01-02"), entry.LastModified.Format("2006-01-02"), entry.Examples, strings.Join(entry.Flags, ", "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d of %d tables flagged.\n", stale, len(report))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+)
+
+var (
+	suggestLimit    int
+	suggestCommands = []cli.Command{
+		{
+			Name:      "tables",
+			Usage:     "Ranks the tables most relevant to a plain English description of what you are looking for.",
+			ArgsUsage: "\"DESCRIPTION\"",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.IntFlag{
+					Name:        "limit",
+					Destination: &suggestLimit,
+					Value:       10,
+					Usage:       "Maximum number of tables to suggest.",
+				},
+				cli.StringFlag{
+					Name:        "output-format",
+					Destination: &outputFormat,
+					Usage:       "Format to write the suggestions in (options: 'text' or 'json').",
+					Value:       "text",
+				},
+			}, schemaOverlayFlags...),
+			Action: suggestTables,
+		},
+	}
+)
+
+func suggestTables(c *cli.Context) error {
+	query := strings.Join(c.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		return xerrors.New("a description of the data you are looking for is required")
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+
+	suggestions := parser.SuggestTables(query, suggestLimit)
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(suggestions, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render suggestions as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		for idx, s := range suggestions {
+			fmt.Printf("%2d. %s (%s) score=%.2f\n", idx+1, s.Name, s.NSID, s.Score)
+			if s.Table.Description != "" {
+				fmt.Printf("    %s\n", s.Table.Description)
+			}
+			fmt.Printf("    matched: %s\n", strings.Join(s.Reasons, "; "))
+		}
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	if len(suggestions) == 0 {
+		log.Warnf("No tables matched %q.", query)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+var summaryFormat string
+
+// runSummary records what a command did, so CI logs show at a glance what was parsed and where the time went.
+type runSummary struct {
+	sync.Mutex
+
+	Command  string          `json:"command"`
+	Files    int             `json:"files_parsed"`
+	Tables   int             `json:"tables_loaded"`
+	Warnings int64           `json:"warnings"`
+	Error    string          `json:"error,omitempty"`
+	Phases   []*phaseSummary `json:"phases"`
+	Elapsed  string          `json:"elapsed"`
+
+	started  time.Time
+	warnings *atomic.Int64
+}
+
+// phaseSummary is the time spent in one phase of a run.
+type phaseSummary struct {
+	Name    string `json:"name"`
+	Elapsed string `json:"elapsed"`
+
+	elapsed time.Duration
+}
+
+var summary = &runSummary{started: time.Now(), warnings: atomic.NewInt64(0)}
+
+// countWarnings is a zap hook counting the warnings logged during the run.
+func countWarnings(e zapcore.Entry) error {
+	if e.Level == zapcore.WarnLevel {
+		summary.warnings.Inc()
+	}
+	return nil
+}
+
+// phase starts timing a phase of the run. The returned function ends it:
+//
+//	defer phase("parse")()
+func phase(name string) func() {
+	start := time.Now()
+	return func() {
+		summary.Lock()
+		defer summary.Unlock()
+
+		summary.Phases = append(summary.Phases, &phaseSummary{Name: name, elapsed: time.Since(start)})
+	}
+}
+
+// recordParser adds the files and tables a parser loaded to the summary. files is the number of files read, or
+// -1 to count one spec file per table.
+func recordParser(parser *osqt.Parser, files int) {
+	tables := 0
+	for _, ns := range parser.Namespaces {
+		tables += len(ns.Tables)
+	}
+	if files < 0 {
+		files = tables
+	}
+
+	summary.Lock()
+	defer summary.Unlock()
+
+	summary.Files += files
+	summary.Tables += tables
+}
+
+// commandName returns the command and subcommand being run, given the arguments following the global flags.
+func commandName(args []string) string {
+	words := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") || len(words) == 2 {
+			break
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// printSummary reports the run according to --summary. Both forms are written to stderr so they do not mix with
+// output commands write to stdout.
+func printSummary(runErr error) error {
+	if summary.Command == "" || summary.Command == "help" || summary.Command == "h" {
+		return nil
+	}
+
+	summary.Lock()
+	defer summary.Unlock()
+
+	elapsed := time.Since(summary.started)
+	summary.Elapsed = elapsed.Round(time.Millisecond).String()
+	summary.Warnings = summary.warnings.Load()
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+
+	accounted := time.Duration(0)
+	for _, p := range summary.Phases {
+		accounted += p.elapsed
+		p.Elapsed = p.elapsed.Round(time.Millisecond).String()
+	}
+	if rest := elapsed - accounted; rest > 0 {
+		summary.Phases = append(summary.Phases, &phaseSummary{Name: "command", Elapsed: rest.Round(time.Millisecond).String(), elapsed: rest})
+	}
+
+	switch summaryFormat {
+	case "none":
+	case "json":
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return xerrors.Errorf("error rendering summary as JSON: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", data)
+	default:
+		phases := make([]string, 0, len(summary.Phases))
+		for _, p := range summary.Phases {
+			phases = append(phases, fmt.Sprintf("%s=%s", p.Name, p.Elapsed))
+		}
+		fmt.Fprintf(os.Stderr, "Run summary: command=%q files_parsed=%d tables_loaded=%d warnings=%d elapsed=%s phases=%q\n",
+			summary.Command, summary.Files, summary.Tables, summary.Warnings, summary.Elapsed, strings.Join(phases, " "))
+	}
+	return nil
+}
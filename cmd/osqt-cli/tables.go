@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+var (
+	filterPlatform   string
+	filterNamespace  string
+	filterEvented    bool
+	filterAttributes cli.StringSlice
+	tableCommands    = []cli.Command{
+		{
+			Name:  "list",
+			Usage: "Lists tables from a schema file or specs directory, optionally filtered.",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "platform",
+					Destination: &filterPlatform,
+					Usage:       "Only list tables available on this platform (options: 'windows', 'linux', 'darwin', 'freebsd').",
+				},
+				cli.StringFlag{
+					Name:        "namespace",
+					Destination: &filterNamespace,
+					Usage:       "Only list tables within this namespace (e.g. 'utility').",
+				},
+				cli.BoolFlag{
+					Name:        "evented",
+					Destination: &filterEvented,
+					Usage:       "Only list evented (event_subscriber) tables.",
+				},
+				cli.StringSliceFlag{
+					Name:  "attribute",
+					Value: &filterAttributes,
+					Usage: "Only list tables with this attribute set (may be repeated, e.g. --attribute cacheable).",
+				},
+			}, schemaOverlayFlags...),
+			Action: listTables,
+		},
+	}
+)
+
+func listTables(c *cli.Context) error {
+	if filterPlatform != "" {
+		if _, ok := osqt.GOOSToApplicableNamespaces[filterPlatform]; !ok {
+			return xerrors.Errorf("--platform value provided (%s) was not valid (valid: 'windows', 'linux', 'darwin', 'freebsd').", filterPlatform)
+		}
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+
+	tables := []*osqt.Table{}
+	for nsid, ns := range parser.Namespaces {
+		if filterNamespace != "" && nsid != filterNamespace {
+			continue
+		}
+		if filterPlatform != "" && !osqt.NamespaceAppliesTo(nsid, filterPlatform) {
+			continue
+		}
+		for _, table := range ns.Tables {
+			if filterEvented && !table.IsEvented() {
+				continue
+			}
+			matched := true
+			for _, attr := range filterAttributes {
+				if !table.HasAttribute(attr) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				tables = append(tables, table)
+			}
+		}
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Name == tables[j].Name {
+			return tables[i].NamespaceID < tables[j].NamespaceID
+		}
+		return tables[i].Name < tables[j].Name
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tNAMESPACE\tDESCRIPTION")
+	for _, table := range tables {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", table.Name, table.NamespaceID, table.Description)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	log.Debugf("%d tables matched the provided filters.", len(tables))
+	return nil
+}
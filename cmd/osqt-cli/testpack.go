@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt/generator"
+	"github.com/gen0cide/osqt/pack"
+	"github.com/gen0cide/osqt/virtual"
+)
+
+var (
+	goldenDir    string
+	updateGolden = false
+	testCommands = []cli.Command{
+		{
+			Name:      "pack",
+			Usage:     "Runs every query in a pack against fixture rows in the virtual database and compares the results with golden files, failing with a diff when they change.",
+			ArgsUsage: "PACK",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "schema",
+					Destination: &schemaPath,
+					Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+					EnvVar:      "OSQT_SCHEMA_PATH",
+				},
+				cli.StringFlag{
+					Name:        "specs-dir",
+					Destination: &specsDir,
+					Usage:       "Path to the OSQuery specs directory to parse.",
+					EnvVar:      "OSQT_SPECS_DIR",
+				},
+				cli.StringFlag{
+					Name:        "target-os",
+					Value:       runtime.GOOS,
+					Destination: &targetOS,
+					Usage:       "Runtime whose tables the queries run against. Queries of the pack for other platforms are skipped.",
+					EnvVar:      "OSQT_TARGET_OS",
+				},
+				cli.StringFlag{
+					Name:        "fixtures-dir",
+					Destination: &fixturesDir,
+					Usage:       "Directory of <table>.json or <table>.yaml files whose rows are loaded into the tables before the queries run.",
+					EnvVar:      "OSQT_FIXTURES_DIR",
+				},
+				cli.StringFlag{
+					Name:        "golden-dir",
+					Destination: &goldenDir,
+					Usage:       "Directory of the <query>.json files holding the expected results of each query (required).",
+					EnvVar:      "OSQT_GOLDEN_DIR",
+				},
+				cli.BoolFlag{
+					Name:        "update",
+					Destination: &updateGolden,
+					Usage:       "Write the current results to the golden files instead of comparing against them.",
+				},
+			}, schemaOverlayFlags...),
+			Action: testPack,
+		},
+	}
+)
+
+// goldenResult is the content of a golden file: the result columns of a query and its rows, each holding a value
+// for every column in order, rendered as a string the way osquery logs it or null for NULL. Rows are sorted, as
+// osquery does not order results unless the query does.
+type goldenResult struct {
+	Columns []string    `json:"columns"`
+	Rows    [][]*string `json:"rows"`
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// goldenPath returns the golden file of the pack query name.
+func goldenPath(name string) string {
+	return filepath.Join(goldenDir, unsafeFileChars.ReplaceAllString(name, "_")+".json")
+}
+
+// resultValue renders a non-NULL value of a result row as a string, the way osquery logs it.
+func resultValue(val interface{}) string {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// loadFixturesDir loads the fixtures of the fixturesDir directory, if set, into db.
+func loadFixturesDir(db *virtual.Database) error {
+	if fixturesDir == "" {
+		return nil
+	}
+	fixtures, err := virtual.LoadFixtures(fixturesDir)
+	if err != nil {
+		return err
+	}
+	if err := db.LoadFixtures(fixtures); err != nil {
+		return err
+	}
+	log.Debugf("Loaded fixtures for %d tables from %s.", len(fixtures), fixturesDir)
+	return nil
+}
+
+// runGolden runs sql against db and returns its result in golden file form.
+func runGolden(db *virtual.Database, sql string) ([]byte, error) {
+	schema, rows, err := db.Query(context.Background(), strings.TrimRight(strings.TrimSpace(sql), ";"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &goldenResult{Columns: make([]string, 0, len(schema)), Rows: make([][]*string, 0, len(rows))}
+	for _, col := range schema {
+		result.Columns = append(result.Columns, col.Name)
+	}
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		cells := resultRow(row, len(schema))
+		key, err := json.Marshal(cells)
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, cells)
+		keys = append(keys, string(key))
+	}
+	sort.Sort(byKey{keys: keys, rows: result.Rows})
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// byKey sorts rows by their JSON encoding.
+type byKey struct {
+	keys []string
+	rows [][]*string
+}
+
+func (b byKey) Len() int           { return len(b.keys) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.rows[i], b.rows[j] = b.rows[j], b.rows[i]
+}
+
+func testPack(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("the path to a single pack is required")
+	}
+	if goldenDir == "" {
+		return xerrors.New("--golden-dir DIR was not provided")
+	}
+
+	p, err := pack.Load(c.Args().First())
+	if err != nil {
+		return err
+	}
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	db, err := buildDatabase(parser, targetOS)
+	if err != nil {
+		return err
+	}
+	if err := loadFixturesDir(db); err != nil {
+		return err
+	}
+	if updateGolden && !dryRun {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			return xerrors.Errorf("error creating --golden-dir: %v", err)
+		}
+	}
+
+	passed, failed, skipped := 0, 0, 0
+	for _, q := range p.SortedQueries() {
+		if !pack.PlatformIncludes(p.Platform, targetOS) {
+			fmt.Printf("SKIP  %s (pack platform %s)\n", q.Name, p.Platform)
+			skipped++
+			continue
+		}
+		if !pack.PlatformIncludes(q.Platform, targetOS) {
+			fmt.Printf("SKIP  %s (platform %s)\n", q.Name, q.Platform)
+			skipped++
+			continue
+		}
+
+		actual, err := runGolden(db, q.SQL)
+		if err != nil {
+			fmt.Printf("FAIL  %s: %v\n", q.Name, err)
+			failed++
+			continue
+		}
+
+		fileloc := goldenPath(q.Name)
+		if updateGolden {
+			if err := writeOutputFile(fileloc, actual); err != nil {
+				return err
+			}
+			fmt.Printf("WROTE %s -> %s\n", q.Name, fileloc)
+			passed++
+			continue
+		}
+
+		expected, err := ioutil.ReadFile(fileloc)
+		if err != nil {
+			fmt.Printf("FAIL  %s: %v (run with --update to create it)\n", q.Name, err)
+			failed++
+			continue
+		}
+		if string(expected) == string(actual) {
+			fmt.Printf("PASS  %s\n", q.Name)
+			passed++
+			continue
+		}
+
+		fmt.Printf("FAIL  %s: results differ from %s\n", q.Name, fileloc)
+		for _, line := range strings.Split(strings.TrimRight(generator.LineDiff(string(expected), string(actual)), "\n"), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+		failed++
+	}
+
+	log.Infof("%d queries passed, %d failed, %d skipped.", passed, failed, skipped)
+	if failed > 0 {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+var (
+	otelExporter   string
+	otelEndpoint   string
+	tracerProvider *sdktrace.TracerProvider
+)
+
+// setupTracing configures the global OpenTelemetry TracerProvider based on --otel-exporter.
+func setupTracing() error {
+	var exp sdktrace.SpanExporter
+	var err error
+
+	switch otelExporter {
+	case "", "none":
+		return nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		opts := []otlptracehttp.Option{}
+		if otelEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(otelEndpoint), otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return xerrors.Errorf("unsupported --otel-exporter %q (options: 'none', 'stdout', 'otlp')", otelExporter)
+	}
+	if err != nil {
+		return xerrors.Errorf("error creating %s trace exporter: %v", otelExporter, err)
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "osqt-cli"),
+			attribute.String("service.version", osqt.Version),
+		)),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	log.Debugf("OpenTelemetry tracing enabled (exporter=%s).", otelExporter)
+	return nil
+}
+
+// shutdownTracing flushes any buffered spans.
+func shutdownTracing() {
+	if tracerProvider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		log.Warnf("Error flushing traces: %v", err)
+	}
+}
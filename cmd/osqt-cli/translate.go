@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/query"
+)
+
+var (
+	translateTo      string
+	translateCommand = cli.Command{
+		Name:  "translate",
+		Usage: "Rewrites a query for another platform by substituting platform-equivalent tables and columns (e.g. launchd for systemd_units), reporting what has no equivalent.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "schema",
+				Destination: &schemaPath,
+				Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+				EnvVar:      "OSQT_SCHEMA_PATH",
+			},
+			cli.StringFlag{
+				Name:        "specs-dir",
+				Destination: &specsDir,
+				Usage:       "Path to the OSQuery specs directory to parse.",
+				EnvVar:      "OSQT_SPECS_DIR",
+			},
+			cli.StringFlag{
+				Name:        "query",
+				Destination: &inputQuery,
+				Usage:       "Query to translate.",
+				EnvVar:      "OSQT_INPUT_QUERY",
+			},
+			cli.StringFlag{
+				Name:        "file",
+				Destination: &queryFile,
+				Usage:       "File containing the SQL to translate (instead of --query).",
+			},
+			cli.StringFlag{
+				Name:        "to",
+				Destination: &translateTo,
+				Usage:       "Runtime (GOOS) to translate the query for (required).",
+			},
+			cli.StringFlag{
+				Name:        "output-format",
+				Destination: &outputFormat,
+				Usage:       "Format to write the translation in (options: 'text' or 'json').",
+				Value:       "text",
+			},
+		}, schemaOverlayFlags...),
+		Action: translateQuery,
+	}
+)
+
+func translateQuery(c *cli.Context) error {
+	sql := inputQuery
+	if queryFile != "" {
+		data, err := ioutil.ReadFile(queryFile)
+		if err != nil {
+			return xerrors.Errorf("error reading --file: %v", err)
+		}
+		sql = string(data)
+	}
+	if sql == "" {
+		return xerrors.New("--query QUERY or --file PATH is required")
+	}
+	if _, ok := osqt.GOOSToApplicableNamespaces[translateTo]; !ok {
+		return xerrors.Errorf("unsupported --to %q (options: %s)", translateTo, strings.Join(supportedPlatforms(), ", "))
+	}
+
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	tr, err := query.Translate(parser, sql, translateTo)
+	if err != nil {
+		return xerrors.Errorf("error scanning query: %v", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(tr, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render translation as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		fmt.Println(strings.TrimSpace(tr.SQL))
+		for _, sub := range tr.Substitutions {
+			note := ""
+			if len(sub.Alternatives) > 0 {
+				note = fmt.Sprintf(" (also available: %s)", strings.Join(sub.Alternatives, ", "))
+			}
+			fmt.Fprintf(os.Stderr, "%d:%d: replaced %s with %s%s\n", sub.Line, sub.Column, sub.From, sub.To, note)
+		}
+		for _, f := range tr.Untranslatable {
+			fmt.Fprintf(os.Stderr, "%d:%d: %s: %s\n", f.Line, f.Column, f.Severity, f.Message)
+		}
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	if len(tr.Untranslatable) > 0 {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/urfave/cli"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/pack"
+	"github.com/gen0cide/osqt/query"
+)
+
+// configRule is the rule name reported for mistakes in the sections of an osquery config that do not hold queries.
+const configRule = "config"
+
+var validateCommands = []cli.Command{
+	{
+		Name:      "config",
+		Usage:     "Validates an osquery config, checking every query of its schedule, packs, decorators and file_paths_query against the schema for the target platform.",
+		ArgsUsage: "CONFIG",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "schema",
+				Destination: &schemaPath,
+				Usage:       "Path, or https://, s3:// or gs:// URL, of a previously exported OSQuery schema JSON or YAML file.",
+				EnvVar:      "OSQT_SCHEMA_PATH",
+			},
+			cli.StringFlag{
+				Name:        "specs-dir",
+				Destination: &specsDir,
+				Usage:       "Path to the OSQuery specs directory to parse.",
+				EnvVar:      "OSQT_SPECS_DIR",
+			},
+			cli.StringFlag{
+				Name:        "target-os",
+				Value:       runtime.GOOS,
+				Destination: &targetOS,
+				Usage:       "Platform the config is deployed to. Queries restricted to other platforms are skipped.",
+				EnvVar:      "OSQT_TARGET_OS",
+			},
+			cli.StringFlag{
+				Name:        "vars",
+				Destination: &varsPath,
+				Usage:       "YAML or JSON file of values for templated queries ({{ .Var }} or @var placeholders).",
+				EnvVar:      "OSQT_VARS",
+			},
+			cli.StringFlag{
+				Name:        "flagfile",
+				Destination: &flagFile,
+				Usage:       "osquery flag file of the target deployment. Queries of tables its --disable_tables and --enable_tables flags disable are warned about.",
+				EnvVar:      "OSQT_FLAGFILE",
+			},
+			cli.StringFlag{
+				Name:        "output-format",
+				Destination: &outputFormat,
+				Usage:       "Format to write the findings in (options: 'text' or 'json').",
+				Value:       "text",
+			},
+		}, schemaOverlayFlags...),
+		Action: validateConfig,
+	},
+}
+
+func validateConfig(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("the path to a single osquery config is required")
+	}
+	if _, ok := osqt.GOOSToApplicableNamespaces[targetOS]; !ok {
+		return xerrors.Errorf("--target-os value provided (%s) was not valid (valid: 'windows', 'linux', 'darwin', 'freebsd').", targetOS)
+	}
+
+	config, err := pack.LoadConfig(c.Args().First())
+	if err != nil {
+		return err
+	}
+	parser, err := loadParser()
+	if err != nil {
+		return err
+	}
+	vars, err := loadVariables()
+	if err != nil {
+		return err
+	}
+	build, err := loadFlagFile()
+	if err != nil {
+		return err
+	}
+
+	results := []*packFindings{}
+	for _, problem := range config.Problems() {
+		results = append(results, &packFindings{Query: configRule, Findings: []*query.Finding{{
+			Rule:     configRule,
+			Severity: query.SeverityError,
+			Message:  problem,
+		}}})
+	}
+
+	// ATC tables are registered first, so the queries of them validate like any other
+	atcNames := make([]string, 0, len(config.ATC))
+	for name := range config.ATC {
+		atcNames = append(atcNames, name)
+	}
+	sort.Strings(atcNames)
+	for _, name := range atcNames {
+		if err := parser.RegisterATCTable(config.ATC[name]); err != nil {
+			results = append(results, &packFindings{Query: "auto_table_construction/" + name, Findings: []*query.Finding{{
+				Rule:     configRule,
+				Severity: query.SeverityError,
+				Message:  err.Error(),
+			}}})
+		}
+	}
+
+	checked, skipped := 0, 0
+	for _, q := range config.Queries() {
+		if !q.RunsOn(targetOS) {
+			log.Debugf("Skipping %s, which does not run on %s.", q.Source, targetOS)
+			skipped++
+			continue
+		}
+		checked++
+
+		findings, err := lintTemplated(parser, q.SQL, vars, build)
+		if err != nil {
+			return xerrors.Errorf("%s: %v", q.Source, err)
+		}
+		if !hasErrors(findings) {
+			sql := q.SQL
+			if pack.IsTemplated(sql) {
+				if sql, err = pack.Expand(sql, vars); err != nil {
+					return xerrors.Errorf("%s: %v", q.Source, err)
+				}
+			}
+			unavailable, err := query.CheckPlatform(parser, sql, targetOS)
+			if err != nil {
+				return xerrors.Errorf("%s: %v", q.Source, err)
+			}
+			findings = append(findings, unavailable...)
+			sort.SliceStable(findings, func(i, j int) bool { return findings[i].Pos < findings[j].Pos })
+		}
+		if len(findings) > 0 {
+			results = append(results, &packFindings{Query: q.Source, Findings: findings})
+		}
+	}
+
+	failed := false
+	for _, r := range results {
+		failed = failed || hasErrors(r.Findings)
+	}
+
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("error attempting to render findings as JSON: %v", err)
+		}
+		fmt.Printf("%s\n", string(data))
+	case "text":
+		for _, r := range results {
+			for _, f := range r.Findings {
+				if f.Line == 0 {
+					fmt.Printf("%s: %s: %s [%s]\n", r.Query, f.Severity, f.Message, f.Rule)
+					continue
+				}
+				fmt.Printf("%s:%s: %s: %s [%s]\n", r.Query, findingLocation(f), f.Severity, f.Message, f.Rule)
+				printSuggestion(f)
+			}
+		}
+		if len(results) == 0 {
+			log.Infof("No problems found in %d queries (%d skipped as they do not run on %s).", checked, skipped, targetOS)
+		}
+	default:
+		return xerrors.Errorf("unsupported --output-format %q (options: 'text' or 'json')", outputFormat)
+	}
+
+	if failed {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
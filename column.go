@@ -1,6 +1,9 @@
 package osqt
 
 import (
+	"fmt"
+	"strings"
+
 	"golang.org/x/xerrors"
 	"gopkg.in/src-d/go-mysql-server.v0/sql"
 )
@@ -11,8 +14,11 @@ type Column struct {
 	Name        string                 `json:"name,omitempty" yaml:"name,omitempty"`
 	Type        string                 `json:"type,omitempty" yaml:"type,omitempty"`
 	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Notes       string                 `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Deprecated  string                 `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
 	Aliases     []string               `json:"aliases,omitempty" yaml:"aliases,omitempty"`
 	Options     map[string]interface{} `json:"options,omitempty" yaml:"options,omitempty"`
+	JSONSchema  []*JSONField           `json:"json_schema,omitempty" yaml:"json_schema,omitempty"`
 }
 
 // NewEmptyColumn creates a new empty Column object.
@@ -23,34 +29,61 @@ func NewEmptyColumn() *Column {
 	}
 }
 
-// ToSQLSchema creates a virtual sql.Column definition to be used in construction of the virtual database.
-func (c *Column) ToSQLSchema(tablename string) *sql.Column {
+// ColumnType returns the registered type of the column. TEXT columns given a JSON sub-schema by a JSON overlay are
+// of JSONColumnType, though their Type remains the TEXT osquery declares them as.
+func (c *Column) ColumnType() (*ColumnType, bool) {
+	if c.Type == "TEXT" && len(c.JSONSchema) > 0 {
+		return LookupColumnType(JSONColumnType)
+	}
+	return LookupColumnType(c.Type)
+}
+
+// Hidden returns true if the column is declared hidden=True, leaving it out of SELECT * so it must be selected by
+// name.
+func (c *Column) Hidden() bool {
+	val, ok := c.Options["hidden"]
+	return ok && strings.EqualFold(fmt.Sprintf("%v", val), "true")
+}
+
+// ToSQLSchema creates a virtual sql.Column definition to be used in construction of the virtual database. It
+// returns an error if the column's type is not a registered column type.
+func (c *Column) ToSQLSchema(tablename string) (*sql.Column, error) {
 	col := &sql.Column{}
 	col.Name = c.Name
 	col.Source = tablename
 	col.Nullable = true
 
-	switch c.Type {
-	case "TEXT":
-		col.Type = sql.Text
-	case "DATE":
-		col.Type = sql.Date
-	case "DATETIME":
-		col.Type = sql.Timestamp
-	case "INTEGER":
-		col.Type = sql.Int32
-	case "BIGINT":
-		col.Type = sql.Int64
-	case "UNSIGNED_BIGINT":
-		col.Type = sql.Uint64
-	case "DOUBLE":
-		col.Type = sql.Float64
-	case "BLOB":
-		col.Type = sql.Blob
-	default:
-		err := xerrors.Errorf("unsupported type %s for column %s", c.Type, c.Name)
-		panic(err)
+	ct, ok := c.ColumnType()
+	if !ok {
+		return nil, xerrors.Errorf("unsupported type %s for column %s", c.Type, c.Name)
 	}
+	col.Type = ct.SQL.Type
 
-	return col
+	return col, nil
+}
+
+// Clone returns a deep copy of the column. Option values are copied by value, so options holding slices or maps
+// share them with the original.
+func (c *Column) Clone() *Column {
+	col := *c
+	col.Aliases = append([]string{}, c.Aliases...)
+	col.Options = make(map[string]interface{}, len(c.Options))
+	for key, val := range c.Options {
+		col.Options[key] = val
+	}
+	col.JSONSchema = copyJSONFields(c.JSONSchema)
+	return &col
+}
+
+func copyJSONFields(fields []*JSONField) []*JSONField {
+	if fields == nil {
+		return nil
+	}
+	ret := make([]*JSONField, 0, len(fields))
+	for _, f := range fields {
+		field := *f
+		field.Fields = copyJSONFields(f.Fields)
+		ret = append(ret, &field)
+	}
+	return ret
 }
@@ -0,0 +1,169 @@
+package osqt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDeprecationReason is the reason given to tables and columns an overlay deprecates without one.
+const DefaultDeprecationReason = "Deprecated."
+
+// deprecatedDescription matches the descriptions of tables and columns that say they are deprecated, such as
+// "(Deprecated) Use the new_table table instead".
+var deprecatedDescription = regexp.MustCompile(`(?i)\bdeprecated\b`)
+
+// DeprecationOverlay marks tables and columns deprecated, keyed by table name. The Deprecated field of tables and
+// columns holds why they should no longer be queried, and what to use instead; osquery's specs have no such
+// declaration, so overlays live alongside them as JSON overlays do.
+type DeprecationOverlay struct {
+	Tables map[string]*TableDeprecation `json:"tables" yaml:"tables"`
+}
+
+// TableDeprecation is the deprecation of a table, or of some of its columns. The table itself is deprecated if
+// Deprecated is set, and Columns maps the names of its deprecated columns to why they are.
+type TableDeprecation struct {
+	Deprecated string            `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Columns    map[string]string `json:"columns,omitempty" yaml:"columns,omitempty"`
+}
+
+// LoadDeprecationOverlay reads a YAML or JSON deprecation overlay file.
+func LoadDeprecationOverlay(fileloc string) (*DeprecationOverlay, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay := &DeprecationOverlay{}
+	switch filepath.Ext(fileloc) {
+	case ".json":
+		err = json.Unmarshal(data, overlay)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, overlay)
+	default:
+		return nil, xerrors.Errorf("unsupported deprecation overlay file extension for %s (expected .json or .yaml)", fileloc)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing deprecation overlay %s: %v", fileloc, err)
+	}
+	return overlay, nil
+}
+
+// ApplyDeprecationOverlay marks every table and column named in overlay deprecated. Columns are matched in every
+// namespace and extended schema of the table, and those given no reason get DefaultDeprecationReason. It returns
+// the number of tables and columns updated, and an error if the overlay names a table or column that does not
+// exist in the parser, in which case nothing is updated. Tables and columns are checked in name order, so the same
+// overlay always fails on the same entry.
+func (p *Parser) ApplyDeprecationOverlay(overlay *DeprecationOverlay) (int, error) {
+	type match struct {
+		tbl    *Table
+		col    *Column
+		reason string
+	}
+	matches := []match{}
+
+	tnames := make([]string, 0, len(overlay.Tables))
+	for tname := range overlay.Tables {
+		tnames = append(tnames, tname)
+	}
+	sort.Strings(tnames)
+
+	for _, tname := range tnames {
+		td := overlay.Tables[tname]
+		if td == nil {
+			continue
+		}
+		tables := []*Table{}
+		for _, ns := range p.SortedNamespaces() {
+			if tbl, ok := ns.Tables[tname]; ok {
+				tables = append(tables, tbl)
+			}
+		}
+		if len(tables) == 0 {
+			return 0, xerrors.Errorf("deprecation overlay references unknown table %s", tname)
+		}
+
+		if td.Deprecated != "" {
+			for _, tbl := range tables {
+				matches = append(matches, match{tbl: tbl, reason: td.Deprecated})
+			}
+		}
+		cnames := make([]string, 0, len(td.Columns))
+		for cname := range td.Columns {
+			cnames = append(cnames, cname)
+		}
+		sort.Strings(cnames)
+		for _, cname := range cnames {
+			reason := td.Columns[cname]
+			if reason == "" {
+				reason = DefaultDeprecationReason
+			}
+			found := false
+			for _, tbl := range tables {
+				for _, s := range tableSchemas(tbl) {
+					for _, col := range s.Columns {
+						if col.Name != cname {
+							continue
+						}
+						matches = append(matches, match{col: col, reason: reason})
+						found = true
+					}
+				}
+			}
+			if !found {
+				return 0, xerrors.Errorf("deprecation overlay references unknown column %s.%s", tname, cname)
+			}
+		}
+	}
+
+	for _, m := range matches {
+		if m.col != nil {
+			m.col.Deprecated = m.reason
+		} else {
+			m.tbl.Deprecated = m.reason
+		}
+	}
+	return len(matches), nil
+}
+
+// DetectDeprecations marks the tables and columns whose descriptions say they are deprecated, giving their
+// descriptions as the reason. Tables and columns already deprecated, such as by an overlay, keep their reason. It
+// returns the number of tables and columns marked.
+func (p *Parser) DetectDeprecations() int {
+	marked := 0
+	for _, ns := range p.Namespaces {
+		for _, tbl := range ns.Tables {
+			if tbl.Deprecated == "" && deprecatedDescription.MatchString(tbl.Description) {
+				tbl.Deprecated = strings.TrimSpace(tbl.Description)
+				marked++
+			}
+			for _, s := range tableSchemas(tbl) {
+				for _, col := range s.Columns {
+					if col.Deprecated == "" && deprecatedDescription.MatchString(col.Description) {
+						col.Deprecated = strings.TrimSpace(col.Description)
+						marked++
+					}
+				}
+			}
+		}
+	}
+	return marked
+}
+
+// tableSchemas returns the schema and extended schemas of tbl.
+func tableSchemas(tbl *Table) []*Schema {
+	schemas := []*Schema{}
+	if tbl.Schema != nil {
+		schemas = append(schemas, tbl.Schema)
+	}
+	for _, platform := range sortedSchemaPlatforms(tbl.ExtendedSchemas) {
+		schemas = append(schemas, tbl.ExtendedSchemas[platform])
+	}
+	return schemas
+}
@@ -0,0 +1,315 @@
+package osqt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeKind describes the type of difference between two schema sets.
+type ChangeKind string
+
+const (
+	// TableAdded is recorded when a table only exists in the new schema set.
+	TableAdded ChangeKind = "table_added"
+
+	// TableRemoved is recorded when a table only exists in the old schema set.
+	TableRemoved ChangeKind = "table_removed"
+
+	// ColumnAdded is recorded when a column only exists in the new version of a table.
+	ColumnAdded ChangeKind = "column_added"
+
+	// ColumnRemoved is recorded when a column only exists in the old version of a table.
+	ColumnRemoved ChangeKind = "column_removed"
+
+	// ColumnRetyped is recorded when a column's type differs between versions of a table.
+	ColumnRetyped ChangeKind = "column_retyped"
+
+	// TableMoved is recorded when a table only exists in another namespace of the new schema set, such as when
+	// osquery moves a table from linux to posix. A move is breaking when it leaves the table on fewer platforms.
+	TableMoved ChangeKind = "table_moved"
+)
+
+// SchemaChange is a single difference found between two schema sets.
+type SchemaChange struct {
+	Kind         ChangeKind `json:"kind" yaml:"kind"`
+	Namespace    string     `json:"namespace" yaml:"namespace"`
+	OldNamespace string     `json:"old_namespace,omitempty" yaml:"old_namespace,omitempty"`
+	Table        string     `json:"table" yaml:"table"`
+	Platform     string     `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Column       string     `json:"column,omitempty" yaml:"column,omitempty"`
+	OldType      string     `json:"old_type,omitempty" yaml:"old_type,omitempty"`
+	NewType      string     `json:"new_type,omitempty" yaml:"new_type,omitempty"`
+
+	// LostPlatforms lists the platforms a moved table was available on that no namespace holding it in the new
+	// schema set covers.
+	LostPlatforms []string `json:"lost_platforms,omitempty" yaml:"lost_platforms,omitempty"`
+}
+
+// Breaking returns true if the change could break existing queries (removed tables and columns, retyped columns,
+// or tables moved off of a platform).
+func (c *SchemaChange) Breaking() bool {
+	switch c.Kind {
+	case TableRemoved, ColumnRemoved, ColumnRetyped:
+		return true
+	case TableMoved:
+		return len(c.LostPlatforms) > 0
+	default:
+		return false
+	}
+}
+
+// String implements the fmt.Stringer interface.
+func (c *SchemaChange) String() string {
+	target := fmt.Sprintf("%s.%s", c.Namespace, c.Table)
+	if c.Column != "" {
+		target = fmt.Sprintf("%s.%s", target, c.Column)
+	}
+	if c.Platform != "" {
+		target = fmt.Sprintf("%s (%s)", target, c.Platform)
+	}
+	switch c.Kind {
+	case ColumnRetyped:
+		return fmt.Sprintf("%s %s: %s -> %s", c.Kind, target, c.OldType, c.NewType)
+	case TableMoved:
+		if len(c.LostPlatforms) > 0 {
+			return fmt.Sprintf("%s %s: %s -> %s (no longer on %s)", c.Kind, target, c.OldNamespace, c.Namespace, strings.Join(c.LostPlatforms, ", "))
+		}
+		return fmt.Sprintf("%s %s: %s -> %s", c.Kind, target, c.OldNamespace, c.Namespace)
+	}
+	return fmt.Sprintf("%s %s", c.Kind, target)
+}
+
+// SchemaDiff is the set of changes between two parsed schema sets.
+type SchemaDiff struct {
+	Changes []*SchemaChange `json:"changes" yaml:"changes"`
+}
+
+// Breaking returns only the changes that could break existing queries.
+func (d *SchemaDiff) Breaking() []*SchemaChange {
+	ret := []*SchemaChange{}
+	for _, c := range d.Changes {
+		if c.Breaking() {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// DiffParsers compares the tables of two parsers, returning the changes required to go from old to new. Tables are
+// matched by name, so a table moved to another namespace is reported as moved rather than removed and added, along
+// with the platforms the move loses it. Their columns are compared as each platform sees them, so a column moved
+// between the schema and an extended schema is only reported on the platforms that lose it.
+func DiffParsers(old, new *Parser) *SchemaDiff {
+	d := &SchemaDiff{Changes: []*SchemaChange{}}
+
+	oldTables, newTables := tablesByName(old), tablesByName(new)
+	tnames := map[string]bool{}
+	for tname := range oldTables {
+		tnames[tname] = true
+	}
+	for tname := range newTables {
+		tnames[tname] = true
+	}
+
+	for tname := range tnames {
+		oldNS, newNS := oldTables[tname], newTables[tname]
+
+		// pair the namespaces holding the table in both, then report the rest of the old ones as moved to what is
+		// left of the new ones, such as when osquery merges a table of linux and darwin into posix
+		unmatchedOld := []string{}
+		for _, nsid := range oldNS {
+			if newTable := tableIn(new, nsid, tname); newTable != nil {
+				d.Changes = append(d.Changes, diffTables(nsid, nsid, tname, tableIn(old, nsid, tname), newTable)...)
+				continue
+			}
+			unmatchedOld = append(unmatchedOld, nsid)
+		}
+		unmatchedNew := []string{}
+		for _, nsid := range newNS {
+			if tableIn(old, nsid, tname) == nil {
+				unmatchedNew = append(unmatchedNew, nsid)
+			}
+		}
+
+		targets := unmatchedNew
+		if len(targets) == 0 {
+			targets = newNS
+		}
+		covered := []string{}
+		for _, nsid := range newNS {
+			covered = mergePlatforms(covered, namespacePlatforms(nsid))
+		}
+		for idx, oldID := range unmatchedOld {
+			if len(targets) == 0 {
+				d.Changes = append(d.Changes, &SchemaChange{Kind: TableRemoved, Namespace: oldID, Table: tname})
+				continue
+			}
+			newID := targets[len(targets)-1]
+			if idx < len(targets) {
+				newID = targets[idx]
+			}
+			d.Changes = append(d.Changes, &SchemaChange{
+				Kind:          TableMoved,
+				Namespace:     newID,
+				OldNamespace:  oldID,
+				Table:         tname,
+				LostPlatforms: missingPlatforms(namespacePlatforms(oldID), covered),
+			})
+			d.Changes = append(d.Changes, diffTables(oldID, newID, tname, tableIn(old, oldID, tname), tableIn(new, newID, tname))...)
+		}
+		for idx, nsid := range unmatchedNew {
+			if idx >= len(unmatchedOld) {
+				d.Changes = append(d.Changes, &SchemaChange{Kind: TableAdded, Namespace: nsid, Table: tname})
+			}
+		}
+	}
+
+	sort.Slice(d.Changes, func(i, j int) bool {
+		a, b := d.Changes[i], d.Changes[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Kind < b.Kind
+	})
+
+	return d
+}
+
+// tablesByName returns the namespaces holding each table of parser, in sorted order.
+func tablesByName(parser *Parser) map[string][]string {
+	tables := map[string][]string{}
+	for _, ns := range parser.SortedNamespaces() {
+		for tname := range ns.Tables {
+			tables[tname] = append(tables[tname], ns.Key)
+		}
+	}
+	return tables
+}
+
+// tableIn returns the table named tname in the namespace nsid of parser, or nil if there is none.
+func tableIn(parser *Parser, nsid, tname string) *Table {
+	ns, ok := parser.Namespaces[nsid]
+	if !ok {
+		return nil
+	}
+	return ns.Tables[tname]
+}
+
+// namespacePlatforms returns the GOOS runtimes the tables of namespace nsid are available on, in sorted order. It
+// returns none for namespaces that are not among GOOSToApplicableNamespaces.
+func namespacePlatforms(nsid string) []string {
+	platforms := []string{}
+	for goos := range GOOSToApplicableNamespaces {
+		if NamespaceAppliesTo(nsid, goos) {
+			platforms = append(platforms, goos)
+		}
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// missingPlatforms returns the platforms of a that are not in b, in sorted order.
+func missingPlatforms(a, b []string) []string {
+	set := map[string]bool{}
+	for _, platform := range b {
+		set[platform] = true
+	}
+	ret := []string{}
+	for _, platform := range mergePlatforms(nil, a) {
+		if !set[platform] {
+			ret = append(ret, platform)
+		}
+	}
+	return ret
+}
+
+// columnChange identifies a column change regardless of the platform it was found on.
+type columnChange struct {
+	kind    ChangeKind
+	column  string
+	oldType string
+	newType string
+}
+
+// diffTables compares the columns of two versions of a table, held by the namespaces oldNS and newNS, as each
+// platform both namespaces are available on sees them. A change found on every such platform is reported once,
+// without a platform, and any other once for each platform it was found on. Tables of namespaces whose platforms
+// are unknown are compared by all of their columns together. Changes are reported under newNS.
+func diffTables(oldNS, newNS, tname string, old, new *Table) []*SchemaChange {
+	platforms := intersectPlatforms(namespacePlatforms(oldNS), namespacePlatforms(newNS))
+	if len(platforms) == 0 {
+		return diffColumns(newNS, tname, "", old.AllColumns(""), new.AllColumns(""))
+	}
+
+	found := map[columnChange][]string{}
+	order := []columnChange{}
+	for _, platform := range platforms {
+		for _, c := range diffColumns(newNS, tname, platform, old.AllColumns(platform), new.AllColumns(platform)) {
+			key := columnChange{kind: c.Kind, column: c.Column, oldType: c.OldType, newType: c.NewType}
+			if _, ok := found[key]; !ok {
+				order = append(order, key)
+			}
+			found[key] = append(found[key], platform)
+		}
+	}
+
+	changes := []*SchemaChange{}
+	for _, key := range order {
+		on := found[key]
+		if len(on) == len(platforms) {
+			on = []string{""}
+		}
+		for _, platform := range on {
+			changes = append(changes, &SchemaChange{
+				Kind:      key.kind,
+				Namespace: newNS,
+				Table:     tname,
+				Platform:  platform,
+				Column:    key.column,
+				OldType:   key.oldType,
+				NewType:   key.newType,
+			})
+		}
+	}
+	return changes
+}
+
+func diffColumns(nsid, tname, platform string, old, new []*Column) []*SchemaChange {
+	changes := []*SchemaChange{}
+	oldCols := map[string]*Column{}
+	for _, col := range old {
+		oldCols[col.Name] = col
+	}
+	newCols := map[string]*Column{}
+	for _, col := range new {
+		newCols[col.Name] = col
+	}
+
+	for cname, oldCol := range oldCols {
+		newCol, ok := newCols[cname]
+		if !ok {
+			changes = append(changes, &SchemaChange{Kind: ColumnRemoved, Namespace: nsid, Table: tname, Platform: platform, Column: cname, OldType: oldCol.Type})
+			continue
+		}
+		if oldCol.Type != newCol.Type {
+			changes = append(changes, &SchemaChange{Kind: ColumnRetyped, Namespace: nsid, Table: tname, Platform: platform, Column: cname, OldType: oldCol.Type, NewType: newCol.Type})
+		}
+	}
+	for cname, newCol := range newCols {
+		if _, ok := oldCols[cname]; !ok {
+			changes = append(changes, &SchemaChange{Kind: ColumnAdded, Namespace: nsid, Table: tname, Platform: platform, Column: cname, NewType: newCol.Type})
+		}
+	}
+
+	return changes
+}
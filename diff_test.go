@@ -0,0 +1,65 @@
+package osqt
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// diffTable returns a widgets table with the columns of its schema, and of a windows extended schema if any.
+func diffTable(columns []string, windows []string) *Table {
+	tbl := NewEmptyTable()
+	tbl.Name = "widgets"
+	tbl.Schema = &Schema{}
+	for idx, name := range columns {
+		tbl.Schema.Columns = append(tbl.Schema.Columns, &Column{Index: idx, Name: name, Type: "TEXT"})
+	}
+	if len(windows) > 0 {
+		ext := &Schema{Extended: true, Platforms: []string{"windows"}}
+		for idx, name := range windows {
+			ext.Columns = append(ext.Columns, &Column{Index: idx, Name: name, Type: "TEXT"})
+		}
+		tbl.ExtendedSchemas["windows"] = ext
+	}
+	return tbl
+}
+
+func TestDiffMoveToFewerPlatformsIsBreaking(t *testing.T) {
+	old := injectedParser(t, map[string]*Table{"posix": diffTable([]string{"name"}, nil)})
+	new := injectedParser(t, map[string]*Table{"linux": diffTable([]string{"name"}, nil)})
+
+	d := DiffParsers(old, new)
+	if len(d.Changes) != 1 || d.Changes[0].Kind != TableMoved {
+		t.Fatalf("expected a single move, got %v", d.Changes)
+	}
+	if want := []string{"darwin", "freebsd"}; !reflect.DeepEqual(d.Changes[0].LostPlatforms, want) {
+		t.Errorf("lost platforms = %v, want %v", d.Changes[0].LostPlatforms, want)
+	}
+	if len(d.Breaking()) != 1 {
+		t.Errorf("a move losing platforms should be breaking: %v", d.Changes)
+	}
+
+	d = DiffParsers(new, old)
+	if len(d.Changes) != 1 || d.Changes[0].Kind != TableMoved || len(d.Breaking()) != 0 {
+		t.Errorf("a move to more platforms should be a single non-breaking move, got %v", d.Changes)
+	}
+}
+
+func TestDiffColumnMovedToExtendedSchema(t *testing.T) {
+	old := injectedParser(t, map[string]*Table{"specs": diffTable([]string{"name", "sid"}, nil)})
+	new := injectedParser(t, map[string]*Table{"specs": diffTable([]string{"name"}, []string{"sid"})})
+
+	got := []string{}
+	for _, c := range DiffParsers(old, new).Changes {
+		got = append(got, c.String())
+	}
+	sort.Strings(got)
+	want := []string{
+		"column_removed specs.widgets.sid (darwin)",
+		"column_removed specs.widgets.sid (freebsd)",
+		"column_removed specs.widgets.sid (linux)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+}
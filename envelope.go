@@ -0,0 +1,279 @@
+package osqt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// SchemaFormatVersion is the version of the layout of versioned schema exports, raised when it changes in ways
+// older readers cannot handle.
+const SchemaFormatVersion = 1
+
+// SchemaMetadataKey is the top level key holding the SchemaMetadata of a versioned schema export. Unversioned
+// exports hold namespaces at the top level, so the key tells the two apart.
+const SchemaMetadataKey = "osqt_metadata"
+
+// ErrSchemaChecksum is returned when the namespaces of a versioned schema export do not match its checksum.
+var ErrSchemaChecksum = xerrors.New("schema does not match the checksum of its metadata")
+
+// SchemaMetadata describes where a schema export came from: the osqt that wrote it, the osquery release its specs
+// belong to when known, when it was generated, and the SHA-256 of its namespaces as returned by SchemaChecksum.
+type SchemaMetadata struct {
+	FormatVersion  int       `json:"format_version" yaml:"format_version"`
+	OSQTVersion    string    `json:"osqt_version" yaml:"osqt_version"`
+	OSQueryVersion string    `json:"osquery_version,omitempty" yaml:"osquery_version,omitempty"`
+	OSQueryCommit  string    `json:"osquery_commit,omitempty" yaml:"osquery_commit,omitempty"`
+	GeneratedAt    time.Time `json:"generated_at" yaml:"generated_at"`
+	SHA256         string    `json:"sha256" yaml:"sha256"`
+}
+
+// SchemaEnvelope is the top level document of a versioned schema export.
+type SchemaEnvelope struct {
+	Metadata   *SchemaMetadata       `json:"osqt_metadata" yaml:"osqt_metadata"`
+	Namespaces map[string]*Namespace `json:"namespaces" yaml:"namespaces"`
+}
+
+// SchemaChecksum returns the SHA-256 of the canonical JSON encoding of namespaces, json.Marshal(namespaces). The
+// same tables have the same checksum no matter the format they were exported in or loaded from. The encoding is
+// hashed one namespace at a time rather than built in memory.
+func SchemaChecksum(namespaces map[string]*Namespace) (string, error) {
+	nsids := make([]string, 0, len(namespaces))
+	for nsid := range namespaces {
+		nsids = append(nsids, nsid)
+	}
+	sort.Strings(nsids)
+
+	h := sha256.New()
+	if namespaces == nil {
+		h.Write([]byte("null"))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	h.Write([]byte("{"))
+	for idx, nsid := range nsids {
+		if idx > 0 {
+			h.Write([]byte(","))
+		}
+		key, err := json.Marshal(nsid)
+		if err != nil {
+			return "", xerrors.Errorf("error encoding schema: %v", err)
+		}
+		data, err := json.Marshal(namespaces[nsid])
+		if err != nil {
+			return "", xerrors.Errorf("error encoding namespace %s: %v", nsid, err)
+		}
+		h.Write(key)
+		h.Write([]byte(":"))
+		h.Write(data)
+	}
+	h.Write([]byte("}"))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewSchemaMetadata returns the metadata of an export of namespaces generated now, from the specs of the given
+// osquery release. version and commit may be empty when unknown.
+func NewSchemaMetadata(namespaces map[string]*Namespace, version, commit string) (*SchemaMetadata, error) {
+	sum, err := SchemaChecksum(namespaces)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaMetadata{
+		FormatVersion:  SchemaFormatVersion,
+		OSQTVersion:    Version,
+		OSQueryVersion: version,
+		OSQueryCommit:  commit,
+		GeneratedAt:    time.Now().UTC().Truncate(time.Second),
+		SHA256:         sum,
+	}, nil
+}
+
+// Verify returns ErrSchemaChecksum if namespaces do not match the checksum of the metadata, or an error if the
+// export uses a newer format than this version of osqt reads.
+func (m *SchemaMetadata) Verify(namespaces map[string]*Namespace) error {
+	if m.FormatVersion > SchemaFormatVersion {
+		return xerrors.Errorf("schema format version %d is newer than the %d osqt %s reads", m.FormatVersion, SchemaFormatVersion, Version)
+	}
+	sum, err := SchemaChecksum(namespaces)
+	if err != nil {
+		return err
+	}
+	if sum != m.SHA256 {
+		return xerrors.Errorf("expected sha256 %s, got %s: %w", m.SHA256, sum, ErrSchemaChecksum)
+	}
+	return nil
+}
+
+// DetectOSQueryRelease returns the osquery release of the specs directory dir from the git checkout of the
+// osquery repository holding it: the tag pointing at the checked out commit and the commit itself. Either is
+// empty when it cannot be determined. It returns an error if dir is not within a checkout of the osquery
+// repository, whose release would not be osquery's.
+func DetectOSQueryRelease(dir string) (version string, commit string, err error) {
+	worktree, gitdir, err := findGitDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	if !isOSQueryCheckout(worktree) {
+		return "", "", xerrors.Errorf("%s is not within a checkout of the osquery repository", dir)
+	}
+
+	// only a tag on the checked out commit itself names its release; a commit past one has no version
+	if out, err := exec.Command("git", "-C", dir, "describe", "--tags", "--exact-match").Output(); err == nil {
+		version = strings.TrimSpace(string(out))
+	}
+	if out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output(); err == nil {
+		commit = strings.TrimSpace(string(out))
+	}
+	if commit != "" {
+		return version, commit, nil
+	}
+
+	// without git, read the checkout's refs directly
+	commit, err = resolveGitRef(gitdir, "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	if version == "" {
+		version = gitTagOf(gitdir, commit)
+	}
+	return version, commit, nil
+}
+
+// findGitDir returns the top directory of the git checkout holding dir and its git directory, following the
+// "gitdir:" file of worktrees and submodules.
+func findGitDir(dir string) (string, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		candidate := filepath.Join(abs, ".git")
+		if info, err := os.Stat(candidate); err == nil {
+			if info.IsDir() {
+				return abs, candidate, nil
+			}
+			data, err := ioutil.ReadFile(candidate)
+			if err != nil {
+				return "", "", err
+			}
+			link := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "gitdir:"))
+			if !filepath.IsAbs(link) {
+				link = filepath.Join(abs, link)
+			}
+			return abs, link, nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", "", xerrors.Errorf("%s is not within a git checkout", dir)
+		}
+		abs = parent
+	}
+}
+
+// isOSQueryCheckout returns true if worktree is the top of a checkout of the osquery repository, which holds the
+// specs directory next to the osquery sources and declares the osquery project to CMake.
+func isOSQueryCheckout(worktree string) bool {
+	for _, sub := range []string{"specs", "osquery"} {
+		if info, err := os.Stat(filepath.Join(worktree, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(worktree, "CMakeLists.txt"))
+	if err != nil {
+		return false
+	}
+	return osqueryProjectRegexp.Match(data)
+}
+
+// osqueryProjectRegexp matches the project() declaration of osquery's top level CMakeLists.txt.
+var osqueryProjectRegexp = regexp.MustCompile(`(?i)project\s*\(\s*osquery\b`)
+
+// resolveGitRef returns the commit ref points to, following symbolic refs.
+func resolveGitRef(gitdir, ref string) (string, error) {
+	for depth := 0; depth < 8; depth++ {
+		data, err := ioutil.ReadFile(filepath.Join(gitdir, filepath.FromSlash(ref)))
+		if err != nil {
+			packed, ok := packedGitRefs(gitdir)[ref]
+			if !ok {
+				return "", xerrors.Errorf("could not resolve git ref %s: %v", ref, err)
+			}
+			return packed, nil
+		}
+		val := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(val, "ref:") {
+			return val, nil
+		}
+		ref = strings.TrimSpace(strings.TrimPrefix(val, "ref:"))
+	}
+	return "", xerrors.Errorf("git ref %s nests too deeply", ref)
+}
+
+// packedGitRefs returns the refs of the packed-refs file of gitdir, with annotated tags resolved to the commit
+// they tag.
+func packedGitRefs(gitdir string) map[string]string {
+	refs := map[string]string{}
+	f, err := os.Open(filepath.Join(gitdir, "packed-refs"))
+	if err != nil {
+		return refs
+	}
+	defer f.Close()
+
+	last := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "^"):
+			if last != "" {
+				refs[last] = strings.TrimPrefix(line, "^")
+			}
+		default:
+			fields := strings.Fields(line)
+			if len(fields) == 2 {
+				refs[fields[1]] = fields[0]
+				last = fields[1]
+			}
+		}
+	}
+	return refs
+}
+
+// gitTagOf returns the name of a tag pointing at commit, or an empty string if there is none. Annotated tags are
+// only recognized when packed, as loose ones would need their objects decompressed.
+func gitTagOf(gitdir, commit string) string {
+	tags := []string{}
+	for ref, target := range packedGitRefs(gitdir) {
+		if target == commit && strings.HasPrefix(ref, "refs/tags/") {
+			tags = append(tags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	tagdir := filepath.Join(gitdir, "refs", "tags")
+	filepath.Walk(tagdir, func(fileloc string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if data, err := ioutil.ReadFile(fileloc); err == nil && bytes.Equal(bytes.TrimSpace(data), []byte(commit)) {
+			if rel, err := filepath.Rel(tagdir, fileloc); err == nil {
+				tags = append(tags, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.Strings(tags)
+	return tags[len(tags)-1]
+}
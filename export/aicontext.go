@@ -0,0 +1,184 @@
+// Package export converts parsed osquery schemas into formats consumed by other tools.
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// DefaultMaxTokens is the default upper bound on the estimated size of a single context record.
+const DefaultMaxTokens = 512
+
+// ContextRecord is a single retrievable chunk of schema documentation, intended to be embedded and indexed
+// by retrieval-augmented query assistants.
+type ContextRecord struct {
+	ID        string   `json:"id"`
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace"`
+	Table     string   `json:"table"`
+	Column    string   `json:"column,omitempty"`
+	Platforms []string `json:"platforms,omitempty"`
+	Chunk     int      `json:"chunk"`
+	Chunks    int      `json:"chunks"`
+	Tokens    int      `json:"tokens"`
+	Text      string   `json:"text"`
+}
+
+// EstimateTokens approximates the number of model tokens in s using the common four characters per token heuristic.
+func EstimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// NamespacePlatforms returns the operating systems the tables of a namespace are available on, in sorted order.
+func NamespacePlatforms(nsid string) []string {
+	platforms := []string{}
+	for goos, namespaces := range osqt.GOOSToApplicableNamespaces {
+		for _, applicable := range namespaces {
+			if applicable == nsid {
+				platforms = append(platforms, goos)
+				break
+			}
+		}
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// AIContext builds a corpus of context records from parser: one record for every table, one for every column,
+// and one for every table's examples. Records whose text is estimated to exceed maxTokens are split into chunks,
+// each of which repeats the record's heading so it can be understood on its own.
+func AIContext(parser *osqt.Parser, maxTokens int) []*ContextRecord {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+
+	records := []*ContextRecord{}
+	for _, ns := range parser.SortedNamespaces() {
+		platforms := NamespacePlatforms(ns.Key)
+		for _, table := range ns.SortedTables() {
+			base := ContextRecord{Namespace: ns.Key, Table: table.Name, Platforms: platforms}
+
+			colnames := []string{}
+			if table.Schema != nil {
+				for _, col := range table.Schema.Columns {
+					colnames = append(colnames, fmt.Sprintf("%s (%s)", col.Name, col.Type))
+				}
+			}
+			trec := base
+			trec.ID, trec.Kind = "table:"+table.Name, "table"
+			heading := fmt.Sprintf("osquery table %s\nPlatforms: %s", table.Name, strings.Join(platforms, ", "))
+			if osqt.AvailabilityOf(ns.Key) == osqt.AvailableOptional {
+				heading += fmt.Sprintf("\nAvailability: only in osquery builds including %s", ns.Key)
+			}
+			body := fmt.Sprintf("Description: %s\nColumns: %s", table.Description, strings.Join(colnames, ", "))
+			if table.Notes != "" {
+				body += "\nNotes: " + table.Notes
+			}
+			records = append(records, chunkRecord(&trec, heading, body, maxTokens)...)
+
+			if table.Schema != nil {
+				for _, col := range table.Schema.Columns {
+					records = append(records, columnRecords(base, table, col, "", platforms, maxTokens)...)
+				}
+			}
+			extplatforms := make([]string, 0, len(table.ExtendedSchemas))
+			for platform := range table.ExtendedSchemas {
+				extplatforms = append(extplatforms, platform)
+			}
+			sort.Strings(extplatforms)
+			for _, platform := range extplatforms {
+				for _, col := range table.ExtendedSchemas[platform].Columns {
+					records = append(records, columnRecords(base, table, col, platform, []string{platform}, maxTokens)...)
+				}
+			}
+
+			if len(table.Examples) > 0 {
+				erec := base
+				erec.ID, erec.Kind = "examples:"+table.Name, "examples"
+				records = append(records, chunkRecord(&erec, fmt.Sprintf("Example queries for osquery table %s", table.Name),
+					strings.Join(table.Examples, "\n"), maxTokens)...)
+			}
+		}
+	}
+
+	return records
+}
+
+func columnRecords(base ContextRecord, table *osqt.Table, col *osqt.Column, platform string, platforms []string, maxTokens int) []*ContextRecord {
+	rec := base
+	rec.Kind, rec.Column, rec.Platforms = "column", col.Name, platforms
+	rec.ID = fmt.Sprintf("column:%s.%s", table.Name, col.Name)
+	if platform != "" {
+		rec.ID = fmt.Sprintf("%s@%s", rec.ID, platform)
+	}
+
+	heading := fmt.Sprintf("Column %s.%s (%s)\nPlatforms: %s", table.Name, col.Name, col.Type, strings.Join(platforms, ", "))
+	body := "Description: " + col.Description
+	if col.Notes != "" {
+		body += "\nNotes: " + col.Notes
+	}
+	opts := []string{}
+	for key, val := range col.Options {
+		if strings.EqualFold(fmt.Sprintf("%v", val), "true") {
+			opts = append(opts, key)
+		}
+	}
+	if len(opts) > 0 {
+		sort.Strings(opts)
+		body += "\nOptions: " + strings.Join(opts, ", ")
+	}
+
+	return chunkRecord(&rec, heading, body, maxTokens)
+}
+
+// chunkRecord splits body into as many records as needed to keep each one within maxTokens.
+func chunkRecord(rec *ContextRecord, heading, body string, maxTokens int) []*ContextRecord {
+	budget := maxTokens - EstimateTokens(heading+"\n")
+	chunks := []string{}
+	current := ""
+	for _, line := range strings.Split(body, "\n") {
+		sep := "\n"
+		for _, word := range strings.Fields(line) {
+			candidate := word
+			if current != "" {
+				candidate = current + sep + word
+			}
+			if current != "" && EstimateTokens(candidate) > budget {
+				chunks = append(chunks, current)
+				candidate = word
+			}
+			current, sep = candidate, " "
+		}
+	}
+	chunks = append(chunks, current)
+
+	ret := make([]*ContextRecord, 0, len(chunks))
+	for idx, chunk := range chunks {
+		r := *rec
+		r.Chunk, r.Chunks = idx+1, len(chunks)
+		if len(chunks) > 1 {
+			r.ID = fmt.Sprintf("%s#%d", rec.ID, idx+1)
+		}
+		r.Text = heading + "\n" + chunk
+		r.Tokens = EstimateTokens(r.Text)
+		ret = append(ret, &r)
+	}
+	return ret
+}
+
+// MarshalJSONL encodes records as newline delimited JSON.
+func MarshalJSONL(records []*ContextRecord) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// CatalogHeader is the header row of the CSV column catalog.
+var CatalogHeader = []string{
+	"namespace", "table", "column", "type", "description", "platforms", "extended", "aliases", "options",
+}
+
+// CatalogRow is one column of one table in the flattened column catalog.
+type CatalogRow struct {
+	Namespace   string
+	Table       string
+	Column      string
+	Type        string
+	Description string
+	// Platforms are the operating systems the column is available on: those of the table's namespace, or of the
+	// extended schemas declaring it.
+	Platforms []string
+	// Extended is set for columns only declared by extended schemas.
+	Extended bool
+	Aliases  []string
+	Options  map[string]interface{}
+}
+
+// Record returns the row as the fields of a CSV record, in the order of CatalogHeader. Lists are joined with ";"
+// and options written as sorted key=value pairs.
+func (r *CatalogRow) Record() []string {
+	opts := make([]string, 0, len(r.Options))
+	for key, val := range r.Options {
+		opts = append(opts, fmt.Sprintf("%s=%v", key, val))
+	}
+	sort.Strings(opts)
+
+	return []string{
+		r.Namespace,
+		r.Table,
+		r.Column,
+		r.Type,
+		r.Description,
+		strings.Join(r.Platforms, ";"),
+		strconv.FormatBool(r.Extended),
+		strings.Join(r.Aliases, ";"),
+		strings.Join(opts, ";"),
+	}
+}
+
+// ColumnCatalog flattens the tables of parser into one row per table and column, ordered by namespace, table and
+// then column index. A column declared by the extended schemas of several platforms gets one row listing them all.
+func ColumnCatalog(parser *osqt.Parser) []*CatalogRow {
+	parser.RLock()
+	defer parser.RUnlock()
+
+	rows := []*CatalogRow{}
+	for _, ns := range parser.SortedNamespaces() {
+		platforms := NamespacePlatforms(ns.Key)
+		for _, table := range ns.SortedTables() {
+			if table.Schema != nil {
+				for _, col := range sortedColumns(table.Schema.Columns) {
+					rows = append(rows, catalogRow(ns.Key, table.Name, col, platforms, false))
+				}
+			}
+
+			extended := map[string]*CatalogRow{}
+			extrows := []*CatalogRow{}
+			for _, platform := range table.SortedPlatforms() {
+				for _, col := range sortedColumns(table.ExtendedSchemas[platform].Columns) {
+					if row, ok := extended[col.Name]; ok {
+						row.Platforms = append(row.Platforms, platform)
+						continue
+					}
+					row := catalogRow(ns.Key, table.Name, col, []string{platform}, true)
+					extended[col.Name] = row
+					extrows = append(extrows, row)
+				}
+			}
+			rows = append(rows, extrows...)
+		}
+	}
+	return rows
+}
+
+// WriteCatalogCSV writes rows to w as CSV, preceded by CatalogHeader.
+func WriteCatalogCSV(w io.Writer, rows []*CatalogRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CatalogHeader); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := cw.Write(row.Record()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func catalogRow(nsid, table string, col *osqt.Column, platforms []string, extended bool) *CatalogRow {
+	return &CatalogRow{
+		Namespace:   nsid,
+		Table:       table,
+		Column:      col.Name,
+		Type:        col.Type,
+		Description: col.Description,
+		Platforms:   append([]string{}, platforms...),
+		Extended:    extended,
+		Aliases:     col.Aliases,
+		Options:     col.Options,
+	}
+}
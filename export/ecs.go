@@ -0,0 +1,247 @@
+package export
+
+import (
+	"github.com/gen0cide/osqt"
+)
+
+// ECSMapping maps osquery columns to Elastic Common Schema field names. Tables maps table names to the fields of
+// their columns, which take precedence over Columns, the fields of columns of that name in any table. An empty
+// field leaves the column unmapped, so mapping files can drop the mappings of the defaults.
+type ECSMapping struct {
+	Columns map[string]string            `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Tables  map[string]map[string]string `json:"tables,omitempty" yaml:"tables,omitempty"`
+}
+
+// defaultECSColumns are the ECS fields of columns that mean the same thing in every table that has them.
+var defaultECSColumns = map[string]string{
+	"pid":            "process.pid",
+	"parent":         "process.parent.pid",
+	"ppid":           "process.parent.pid",
+	"cmdline":        "process.command_line",
+	"cwd":            "process.working_directory",
+	"uid":            "user.id",
+	"username":       "user.name",
+	"user":           "user.name",
+	"gid":            "group.id",
+	"groupname":      "group.name",
+	"path":           "file.path",
+	"directory":      "file.directory",
+	"filename":       "file.name",
+	"md5":            "file.hash.md5",
+	"sha1":           "file.hash.sha1",
+	"sha256":         "file.hash.sha256",
+	"local_address":  "source.ip",
+	"local_port":     "source.port",
+	"remote_address": "destination.ip",
+	"remote_port":    "destination.port",
+	"protocol":       "network.iana_number",
+	"hostname":       "host.hostname",
+}
+
+// defaultECSTables are the ECS fields of columns whose meaning depends on their table, such as the path of a
+// process being its executable.
+var defaultECSTables = map[string]map[string]string{
+	"processes": {
+		"name":       "process.name",
+		"path":       "process.executable",
+		"uid":        "process.real_user.id",
+		"gid":        "process.real_group.id",
+		"euid":       "process.user.id",
+		"egid":       "process.group.id",
+		"pgroup":     "process.pgid",
+		"start_time": "process.start",
+	},
+	"process_events": {
+		"path":  "process.executable",
+		"uid":   "process.real_user.id",
+		"gid":   "process.real_group.id",
+		"euid":  "process.user.id",
+		"egid":  "process.group.id",
+		"ctime": "process.start",
+	},
+	"file": {
+		"uid":   "file.uid",
+		"gid":   "file.gid",
+		"mode":  "file.mode",
+		"size":  "file.size",
+		"inode": "file.inode",
+		"type":  "file.type",
+		"atime": "file.accessed",
+		"mtime": "file.mtime",
+		"ctime": "file.ctime",
+	},
+	"file_events": {
+		"target_path": "file.path",
+		"uid":         "file.uid",
+		"gid":         "file.gid",
+		"mode":        "file.mode",
+		"size":        "file.size",
+		"inode":       "file.inode",
+		"action":      "event.action",
+	},
+	"users": {
+		"description": "user.full_name",
+	},
+	"logged_in_users": {
+		"host": "source.address",
+	},
+	"shell_history": {
+		"command": "process.command_line",
+	},
+	"crontab": {
+		"command": "process.command_line",
+	},
+	"listening_ports": {
+		"address": "server.ip",
+		"port":    "server.port",
+		"path":    "",
+	},
+	"process_open_sockets": {
+		"path": "process.executable",
+	},
+	"system_info": {
+		"uuid":           "host.id",
+		"cpu_type":       "host.architecture",
+		"hardware_model": "host.type",
+	},
+	"os_version": {
+		"name":     "host.os.name",
+		"version":  "host.os.version",
+		"platform": "host.os.platform",
+	},
+	"kernel_info": {
+		"version": "host.os.kernel",
+		"path":    "",
+	},
+	"interface_addresses": {
+		"address": "host.ip",
+	},
+	"interface_details": {
+		"mac": "host.mac",
+	},
+	"deb_packages": {
+		"name":    "package.name",
+		"version": "package.version",
+		"arch":    "package.architecture",
+		"size":    "package.size",
+	},
+	"rpm_packages": {
+		"name":    "package.name",
+		"version": "package.version",
+		"arch":    "package.architecture",
+		"size":    "package.size",
+	},
+	"programs": {
+		"name":             "package.name",
+		"version":          "package.version",
+		"install_location": "package.path",
+	},
+	"apps": {
+		"name":                 "package.name",
+		"bundle_short_version": "package.version",
+		"path":                 "package.path",
+	},
+	"certificates": {
+		"common_name":      "x509.subject.common_name",
+		"subject":          "x509.subject.distinguished_name",
+		"issuer":           "x509.issuer.distinguished_name",
+		"not_valid_before": "x509.not_before",
+		"not_valid_after":  "x509.not_after",
+		"serial":           "x509.serial_number",
+		"sha1":             "",
+	},
+}
+
+// DefaultECSMapping returns a copy of the bundled ECS mapping of the common osquery tables.
+func DefaultECSMapping() *ECSMapping {
+	m := &ECSMapping{Columns: map[string]string{}, Tables: map[string]map[string]string{}}
+	m.Merge(&ECSMapping{Columns: defaultECSColumns, Tables: defaultECSTables})
+	return m
+}
+
+// LoadECSMapping returns the bundled ECS mapping overridden by the JSON or YAML mapping file fileloc.
+func LoadECSMapping(fileloc string) (*ECSMapping, error) {
+	override := &ECSMapping{}
+	if err := loadMappingFile("ECS", fileloc, override); err != nil {
+		return nil, err
+	}
+
+	m := DefaultECSMapping()
+	m.Merge(override)
+	return m, nil
+}
+
+// Merge copies the mappings of other into m, replacing those of the same columns.
+func (m *ECSMapping) Merge(other *ECSMapping) {
+	if m.Columns == nil {
+		m.Columns = map[string]string{}
+	}
+	if m.Tables == nil {
+		m.Tables = map[string]map[string]string{}
+	}
+	for col, field := range other.Columns {
+		m.Columns[col] = field
+	}
+	for table, cols := range other.Tables {
+		if m.Tables[table] == nil {
+			m.Tables[table] = map[string]string{}
+		}
+		for col, field := range cols {
+			m.Tables[table][col] = field
+		}
+	}
+}
+
+// Field returns the ECS field the column of table maps to, and whether it has one.
+func (m *ECSMapping) Field(table, column string) (string, bool) {
+	if field, ok := m.Tables[table][column]; ok {
+		return field, field != ""
+	}
+	field, ok := m.Columns[column]
+	return field, ok && field != ""
+}
+
+// ECSColumn is a column of the ECS mapping report, with the ECS field it maps to if it has one.
+type ECSColumn struct {
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Table     string `json:"table" yaml:"table"`
+	Column    string `json:"column" yaml:"column"`
+	Type      string `json:"type" yaml:"type"`
+	Field     string `json:"ecs_field,omitempty" yaml:"ecs_field,omitempty"`
+}
+
+// ECSReport is the ECS mapping of every column of a schema: the columns mapping to an ECS field, and those with
+// no known mapping left for SIEM integrations to handle.
+type ECSReport struct {
+	Columns  int          `json:"columns" yaml:"columns"`
+	Mapped   []*ECSColumn `json:"mapped" yaml:"mapped"`
+	Unmapped []*ECSColumn `json:"unmapped" yaml:"unmapped"`
+}
+
+// ECSFields maps every column of parser to ECS with mapping, or the bundled mapping if it is nil. Columns are
+// ordered by namespace, table and column, with a table's platform specific columns after its others.
+func ECSFields(parser *osqt.Parser, mapping *ECSMapping) *ECSReport {
+	if mapping == nil {
+		mapping = DefaultECSMapping()
+	}
+
+	parser.RLock()
+	defer parser.RUnlock()
+
+	report := &ECSReport{Mapped: []*ECSColumn{}, Unmapped: []*ECSColumn{}}
+	for _, ns := range parser.SortedNamespaces() {
+		for _, table := range ns.SortedTables() {
+			for _, col := range table.AllColumns("") {
+				ec := &ECSColumn{Namespace: ns.Key, Table: table.Name, Column: col.Name, Type: col.Type}
+				report.Columns++
+				if field, ok := mapping.Field(table.Name, col.Name); ok {
+					ec.Field = field
+					report.Mapped = append(report.Mapped, ec)
+					continue
+				}
+				report.Unmapped = append(report.Unmapped, ec)
+			}
+		}
+	}
+	return report
+}
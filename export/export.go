@@ -0,0 +1,14 @@
+package export
+
+import (
+	"sort"
+
+	"github.com/gen0cide/osqt"
+)
+
+// sortedColumns returns a copy of cols ordered by column index.
+func sortedColumns(cols []*osqt.Column) []*osqt.Column {
+	ret := append([]*osqt.Column{}, cols...)
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Index < ret[j].Index })
+	return ret
+}
@@ -0,0 +1,42 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/gen0cide/osqt"
+)
+
+// MarshalTOML encodes v as TOML, using the key names of its JSON encoding so TOML exports read like the JSON and
+// YAML ones. Null values, which TOML cannot represent, are left out.
+func MarshalTOML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalTablesJSONL encodes the tables of namespaces as newline delimited JSON, one table per line, ordered by
+// namespace and then table name. Each table carries its namespace_id.
+func MarshalTablesJSONL(namespaces map[string]*osqt.Namespace) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := WriteTablesJSONL(buf, namespaces); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,147 @@
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/generator"
+)
+
+// Manifest describes a schema and the artifacts generated from it, so that release pipelines can record
+// exactly what was built and verify artifacts across environments.
+type Manifest struct {
+	ToolVersion       string            `json:"tool_version" yaml:"tool_version"`
+	GeneratedAt       time.Time         `json:"generated_at" yaml:"generated_at"`
+	Source            string            `json:"source,omitempty" yaml:"source,omitempty"`
+	SchemaFingerprint string            `json:"schema_fingerprint" yaml:"schema_fingerprint"`
+	Tables            int               `json:"tables" yaml:"tables"`
+	Namespaces        map[string]int    `json:"namespaces" yaml:"namespaces"`
+	Platforms         map[string]int    `json:"platforms" yaml:"platforms"`
+	Targets           []*ManifestTarget `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+// ManifestTarget is the output of one generator. Hash is computed over the paths and hashes of its files,
+// so it changes if any file is added, removed, or modified.
+type ManifestTarget struct {
+	Generator string          `json:"generator" yaml:"generator"`
+	Hash      string          `json:"sha256" yaml:"sha256"`
+	Files     []*ManifestFile `json:"files" yaml:"files"`
+}
+
+// ManifestFile is a single file written by a generator.
+type ManifestFile struct {
+	Path string `json:"path" yaml:"path"`
+	Size int64  `json:"size" yaml:"size"`
+	Hash string `json:"sha256" yaml:"sha256"`
+}
+
+// SchemaFingerprint returns the SHA-256 of the parser's canonical JSON encoding. Two parsers holding the same
+// tables have the same fingerprint regardless of where their schema was loaded from. It is the checksum recorded
+// in the metadata of versioned schema exports.
+func SchemaFingerprint(parser *osqt.Parser) (string, error) {
+	return osqt.SchemaChecksum(parser.Namespaces)
+}
+
+// BuildManifest describes parser, running each of the named generators into a scratch directory to hash its output.
+func BuildManifest(ctx context.Context, parser *osqt.Parser, targets []string, logger *zap.SugaredLogger) (*Manifest, error) {
+	fingerprint, err := SchemaFingerprint(parser)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		ToolVersion:       osqt.Version,
+		GeneratedAt:       time.Now().UTC(),
+		SchemaFingerprint: fingerprint,
+		Namespaces:        map[string]int{},
+		Platforms:         map[string]int{},
+		Targets:           []*ManifestTarget{},
+	}
+
+	names := map[string]bool{}
+	for _, ns := range parser.SortedNamespaces() {
+		m.Namespaces[ns.Key] = len(ns.Tables)
+		for name := range ns.Tables {
+			names[name] = true
+		}
+	}
+	m.Tables = len(names)
+	for goos := range osqt.GOOSToApplicableNamespaces {
+		m.Platforms[goos] = len(parser.TablesFor(goos))
+	}
+
+	for _, name := range targets {
+		g, ok := generator.Lookup(name)
+		if !ok {
+			return nil, xerrors.Errorf("no generator registered as %s", name)
+		}
+		target, err := hashTarget(ctx, g, parser, logger)
+		if err != nil {
+			return nil, err
+		}
+		m.Targets = append(m.Targets, target)
+	}
+
+	return m, nil
+}
+
+func hashTarget(ctx context.Context, g generator.Generator, parser *osqt.Parser, logger *zap.SugaredLogger) (*ManifestTarget, error) {
+	tmp, err := ioutil.TempDir("", "osqt-manifest-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	dest := filepath.Join(tmp, g.Name())
+	if err := generator.Run(ctx, g, parser, dest, nil, logger); err != nil {
+		return nil, err
+	}
+
+	target := &ManifestTarget{Generator: g.Name(), Files: []*ManifestFile{}}
+	err = filepath.Walk(dest, func(fileloc string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dest, fileloc)
+		if err != nil {
+			return err
+		}
+		// the list of files a run wrote is bookkeeping of the output directory rather than generated output
+		if rel == generator.OutputManifest {
+			return nil
+		}
+		data, err := ioutil.ReadFile(fileloc)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		target.Files = append(target.Files, &ManifestFile{
+			Path: filepath.ToSlash(rel),
+			Size: info.Size(),
+			Hash: hex.EncodeToString(sum[:]),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("error hashing %s output: %v", g.Name(), err)
+	}
+
+	sort.Slice(target.Files, func(i, j int) bool { return target.Files[i].Path < target.Files[j].Path })
+	h := sha256.New()
+	for _, f := range target.Files {
+		fmt.Fprintf(h, "%s\x00%s\n", f.Path, f.Hash)
+	}
+	target.Hash = hex.EncodeToString(h.Sum(nil))
+	return target, nil
+}
@@ -0,0 +1,32 @@
+package export
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// loadMappingFile decodes the JSON or YAML mapping file fileloc into v, by the file's extension. kind names the
+// mapping in errors.
+func loadMappingFile(kind, fileloc string, v interface{}) error {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(fileloc) {
+	case ".json":
+		err = json.Unmarshal(data, v)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, v)
+	default:
+		return xerrors.Errorf("unsupported %s mapping file extension for %s (expected .json or .yaml)", kind, fileloc)
+	}
+	if err != nil {
+		return xerrors.Errorf("error parsing %s mapping %s: %v", kind, fileloc, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package export
+
+import (
+	"bytes"
+	"path"
+	"sort"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/attack"
+)
+
+// OSSEMEntry is the OSSEM data dictionary entry of a table on one platform, in the layout of the OSSEM-DD
+// project's YAML files. The table is the entry's event, and its columns the event's fields.
+type OSSEMEntry struct {
+	Title             string        `yaml:"title"`
+	Description       string        `yaml:"description"`
+	Platform          string        `yaml:"platform"`
+	LogSource         string        `yaml:"log_source"`
+	EventCode         string        `yaml:"event_code"`
+	AttackDataSources []string      `yaml:"attack_data_sources"`
+	EventFields       []*OSSEMField `yaml:"event_fields"`
+	References        []string      `yaml:"references"`
+	Tags              []string      `yaml:"tags"`
+}
+
+// OSSEMField is a column of a table in an OSSEM data dictionary entry. StandardName is the field of the OSSEM
+// common data model the column holds, if known.
+type OSSEMField struct {
+	StandardName string `yaml:"standard_name"`
+	Name         string `yaml:"name"`
+	Type         string `yaml:"type"`
+	Description  string `yaml:"description"`
+	SampleValue  string `yaml:"sample_value"`
+}
+
+// ossemPlatforms are the OSSEM names of the GOOS runtimes whose names differ.
+var ossemPlatforms = map[string]string{
+	"darwin": "macos",
+}
+
+// ossemTypes maps the osquery extension API column kinds to the field types of OSSEM data dictionaries.
+var ossemTypes = map[string]string{
+	"TEXT":            "string",
+	"INTEGER":         "integer",
+	"BIGINT":          "integer",
+	"UNSIGNED_BIGINT": "integer",
+	"DOUBLE":          "float",
+}
+
+// ossemColumns are the OSSEM common data model fields of columns that mean the same thing in every table that
+// has them.
+var ossemColumns = map[string]string{
+	"pid":            "process_id",
+	"parent":         "process_parent_id",
+	"ppid":           "process_parent_id",
+	"cmdline":        "process_command_line",
+	"cwd":            "process_current_directory",
+	"uid":            "user_id",
+	"username":       "user_name",
+	"md5":            "hash_md5",
+	"sha1":           "hash_sha1",
+	"sha256":         "hash_sha256",
+	"local_address":  "src_ip_addr",
+	"local_port":     "src_port",
+	"remote_address": "dst_ip_addr",
+	"remote_port":    "dst_port",
+	"protocol":       "network_protocol",
+	"hostname":       "host_name",
+}
+
+// ossemTables are the OSSEM common data model fields of columns whose meaning depends on their table.
+var ossemTables = map[string]map[string]string{
+	"processes": {
+		"name": "process_name",
+		"path": "process_path",
+	},
+	"process_events": {
+		"path": "process_path",
+	},
+	"file": {
+		"path":      "file_path",
+		"filename":  "file_name",
+		"directory": "file_directory",
+		"size":      "file_size",
+	},
+	"file_events": {
+		"target_path": "file_path",
+		"size":        "file_size",
+	},
+	"hash": {
+		"path": "file_path",
+	},
+	"listening_ports": {
+		"address": "dst_ip_addr",
+		"port":    "dst_port",
+		"path":    "",
+	},
+}
+
+// OSSEMDictionary renders every table of parser as an OSSEM data dictionary entry for each platform it is
+// available on, keyed by the path of the entry's YAML file: <platform>/osquery/<table>.yml, with platforms named
+// as OSSEM names them. The ATT&CK data sources of a table are those of the data components mapping collects it
+// for, or the bundled mapping's if mapping is nil.
+func OSSEMDictionary(parser *osqt.Parser, mapping *attack.Mapping) (map[string][]byte, error) {
+	if mapping == nil {
+		mapping = attack.DefaultMapping()
+	}
+	sources := map[string][]string{}
+	for name, dc := range mapping.DataComponents {
+		for _, table := range dc.Tables {
+			sources[table] = appendUnique(sources[table], attack.DataSource(name))
+		}
+	}
+
+	parser.RLock()
+	defer parser.RUnlock()
+
+	files := map[string][]byte{}
+	for _, ns := range parser.SortedNamespaces() {
+		for _, table := range ns.SortedTables() {
+			for _, goos := range NamespacePlatforms(ns.Key) {
+				entry, err := ossemEntry(ns.Key, table, goos, sources[table.Name])
+				if err != nil {
+					return nil, xerrors.Errorf("error building OSSEM entry of %s: %v", table.Name, err)
+				}
+				buf := &bytes.Buffer{}
+				enc := yaml.NewEncoder(buf)
+				enc.SetIndent(2)
+				if err := enc.Encode(entry); err != nil {
+					return nil, xerrors.Errorf("error rendering OSSEM entry of %s: %v", table.Name, err)
+				}
+				if err := enc.Close(); err != nil {
+					return nil, xerrors.Errorf("error rendering OSSEM entry of %s: %v", table.Name, err)
+				}
+				files[path.Join(entry.Platform, "osquery", table.Name+".yml")] = buf.Bytes()
+			}
+		}
+	}
+	return files, nil
+}
+
+// ossemEntry builds the OSSEM data dictionary entry of table, of the namespace nsid, on goos.
+func ossemEntry(nsid string, table *osqt.Table, goos string, sources []string) (*OSSEMEntry, error) {
+	platform := goos
+	if name, ok := ossemPlatforms[goos]; ok {
+		platform = name
+	}
+
+	entry := &OSSEMEntry{
+		Title:             table.Name,
+		Description:       table.Description,
+		Platform:          platform,
+		LogSource:         "osquery",
+		EventCode:         table.Name,
+		AttackDataSources: append([]string{}, sources...),
+		EventFields:       []*OSSEMField{},
+		References:        []string{},
+		Tags:              []string{"osquery", nsid},
+	}
+	sort.Strings(entry.AttackDataSources)
+	if table.IsEvented() {
+		entry.Tags = append(entry.Tags, "evented")
+	}
+
+	for _, col := range table.AllColumns(goos) {
+		ct, ok := col.ColumnType()
+		if !ok {
+			return nil, xerrors.Errorf("column %s has unregistered type %s", col.Name, col.Type)
+		}
+		typ, ok := ossemTypes[ct.Name]
+		if !ok {
+			typ = ossemTypes[ct.Base]
+		}
+		entry.EventFields = append(entry.EventFields, &OSSEMField{
+			StandardName: ossemStandardName(table.Name, col.Name),
+			Name:         col.Name,
+			Type:         typ,
+			Description:  col.Description,
+		})
+	}
+	return entry, nil
+}
+
+// ossemStandardName returns the OSSEM common data model field of the column of table, or "" if it has none.
+func ossemStandardName(table, column string) string {
+	if name, ok := ossemTables[table][column]; ok {
+		return name
+	}
+	return ossemColumns[column]
+}
+
+// appendUnique appends value to values unless values has it.
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,325 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// specIndent is the indentation of the entries of the lists of a spec.
+const specIndent = "    "
+
+// pythonName matches the option values written as Python names rather than strings, such as the NONE of
+// default=NONE or the EVENTS of kind=EVENTS. The parser keeps both as strings, so the upper case convention of
+// spec constants tells them apart.
+var pythonName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// Specs renders every table of parser as a .table spec file, keyed by the path of the file relative to the
+// directory holding the specs directory: specs/<table>.table for the tables of the specs namespace and
+// specs/<namespace>/<table>.table for the others, so the specs directory written can be parsed back.
+func Specs(parser *osqt.Parser) (map[string][]byte, error) {
+	parser.RLock()
+	defer parser.RUnlock()
+
+	files := map[string][]byte{}
+	for _, ns := range parser.SortedNamespaces() {
+		dir := "specs"
+		if ns.Key != "specs" {
+			dir = path.Join("specs", ns.Key)
+		}
+		for _, table := range ns.SortedTables() {
+			data, err := TableSpec(table)
+			if err != nil {
+				return nil, xerrors.Errorf("error rendering spec of %s: %v", table.Name, err)
+			}
+			files[path.Join(dir, table.Name+".table")] = data
+		}
+	}
+	return files, nil
+}
+
+// TableSpec renders table in the spec syntax of osquery's .table files. The output is canonical: declarations
+// appear in a fixed order, keyword arguments are sorted, and platform specific columns are grouped into one
+// extended_schema() per set of platforms sharing them. Parsing the result of a table parsed from a spec yields the
+// same table.
+func TableSpec(table *osqt.Table) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "table_name(%s", pyString(table.Name))
+	if len(table.Aliases) > 0 {
+		fmt.Fprintf(buf, ", aliases=%s", pyStrings(table.Aliases))
+	}
+	buf.WriteString(")\n")
+	if table.Description != "" {
+		fmt.Fprintf(buf, "description(%s)\n", pyString(table.Description))
+	}
+
+	if table.Schema != nil {
+		buf.WriteString("schema([\n")
+		if err := writeSchemaEntries(buf, table.Schema); err != nil {
+			return nil, err
+		}
+		buf.WriteString("])\n")
+	}
+
+	groups, err := extendedSchemaGroups(table)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		fmt.Fprintf(buf, "extended_schema(%s, [\n", g.expr)
+		if err := writeSchemaEntries(buf, g.schema); err != nil {
+			return nil, err
+		}
+		buf.WriteString("])\n")
+	}
+
+	if len(table.Attributes) > 0 {
+		fmt.Fprintf(buf, "attributes(%s)\n", pyKeywords(table.Attributes))
+	}
+	if table.Implementation != "" {
+		fmt.Fprintf(buf, "implementation(%s", pyString(table.Implementation))
+		if table.Generator {
+			buf.WriteString(", generator=True")
+		}
+		buf.WriteString(")\n")
+	}
+	writeStringList(buf, "fuzz_paths", table.FuzzPaths)
+	writeStringList(buf, "examples", table.Examples)
+
+	return buf.Bytes(), nil
+}
+
+// writeSchemaEntries writes the Column() and ForeignKey() entries of the list of a schema() or extended_schema().
+func writeSchemaEntries(buf *bytes.Buffer, schema *osqt.Schema) error {
+	cols := append([]*osqt.Column{}, schema.Columns...)
+	sort.SliceStable(cols, func(i, j int) bool { return cols[i].Index < cols[j].Index })
+	for _, col := range cols {
+		if col.Type == "" {
+			return xerrors.Errorf("column %s has no type", col.Name)
+		}
+		fmt.Fprintf(buf, "%sColumn(%s, %s", specIndent, pyString(col.Name), col.Type)
+		if col.Description != "" {
+			fmt.Fprintf(buf, ", %s", pyString(col.Description))
+		}
+		if len(col.Aliases) > 0 {
+			fmt.Fprintf(buf, ", aliases=%s", pyStrings(col.Aliases))
+		}
+		if len(col.Options) > 0 {
+			fmt.Fprintf(buf, ", %s", pyKeywords(col.Options))
+		}
+		buf.WriteString("),\n")
+	}
+	for _, fkey := range schema.ForeignKeys {
+		fmt.Fprintf(buf, "%sForeignKey(%s),\n", specIndent, pyKeywords(fkey))
+	}
+	return nil
+}
+
+// writeStringList writes a declaration taking a list of strings, such as examples([...]), unless values is empty.
+func writeStringList(buf *bytes.Buffer, name string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "%s([\n", name)
+	for _, val := range values {
+		fmt.Fprintf(buf, "%s%s,\n", specIndent, pyString(val))
+	}
+	buf.WriteString("])\n")
+}
+
+// extendedSchemaGroup is one extended_schema() declaration: the platform expression and the schema it applies to.
+type extendedSchemaGroup struct {
+	expr   string
+	schema *osqt.Schema
+}
+
+// extendedSchemaGroups groups the platforms of the extended schemas of table by identical columns and foreign
+// keys, as the parser gives every platform of a declaration its own copy.
+func extendedSchemaGroups(table *osqt.Table) ([]*extendedSchemaGroup, error) {
+	platforms := make([]string, 0, len(table.ExtendedSchemas))
+	for platform := range table.ExtendedSchemas {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	order := []string{}
+	members := map[string][]string{}
+	schemas := map[string]*osqt.Schema{}
+	for _, platform := range platforms {
+		schema := table.ExtendedSchemas[platform]
+		key, err := schemaKey(schema)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := members[key]; !ok {
+			order = append(order, key)
+			schemas[key] = schema
+		}
+		members[key] = append(members[key], platform)
+	}
+
+	groups := make([]*extendedSchemaGroup, 0, len(order))
+	for _, key := range order {
+		expr, err := platformExpr(members[key])
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, &extendedSchemaGroup{expr: expr, schema: schemas[key]})
+	}
+	return groups, nil
+}
+
+// schemaKey identifies the columns and foreign keys of schema, ignoring the platforms it belongs to.
+func schemaKey(schema *osqt.Schema) (string, error) {
+	data, err := json.Marshal(struct {
+		Columns     []*osqt.Column
+		ForeignKeys []map[string]interface{}
+	}{schema.Columns, schema.ForeignKeys})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// platformExpr returns the platform expression of extended_schema() covering platforms: the name of a platform
+// category, or a lambda combining the helpers of several.
+func platformExpr(platforms []string) (string, error) {
+	want := map[string]bool{}
+	for _, platform := range platforms {
+		want[platform] = true
+	}
+
+	// larger categories first, so POSIX is preferred over LINUX() or DARWIN() or FREEBSD()
+	names := make([]string, 0, len(osqt.TableCategories))
+	for name := range osqt.TableCategories {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		li, lj := len(osqt.TableCategories[names[i]]), len(osqt.TableCategories[names[j]])
+		if li != lj {
+			return li > lj
+		}
+		return names[i] < names[j]
+	})
+
+	chosen := []string{}
+	covered := map[string]bool{}
+	for _, name := range names {
+		contained, adds := true, false
+		for _, platform := range osqt.TableCategories[name] {
+			if !want[platform] {
+				contained = false
+				break
+			}
+			if !covered[platform] {
+				adds = true
+			}
+		}
+		if !contained || !adds {
+			continue
+		}
+		chosen = append(chosen, name)
+		for _, platform := range osqt.TableCategories[name] {
+			covered[platform] = true
+		}
+	}
+	// schemas not parsed from specs may name a platform without the rest of its category (windows without win32),
+	// which the smallest category holding it stands for
+	for _, platform := range platforms {
+		if covered[platform] {
+			continue
+		}
+		best := ""
+		for _, name := range names {
+			for _, p := range osqt.TableCategories[name] {
+				if p == platform && (best == "" || len(osqt.TableCategories[name]) <= len(osqt.TableCategories[best])) {
+					best = name
+				}
+			}
+		}
+		if best == "" {
+			return "", xerrors.Errorf("platform %s does not belong to any platform category", platform)
+		}
+		chosen = append(chosen, best)
+		for _, p := range osqt.TableCategories[best] {
+			covered[p] = true
+		}
+	}
+
+	if len(chosen) == 1 {
+		return chosen[0], nil
+	}
+	sort.Strings(chosen)
+	return "lambda: " + strings.Join(chosen, "() or ") + "()", nil
+}
+
+// pyKeywords renders opts as keyword arguments, sorted by name.
+func pyKeywords(opts map[string]interface{}) string {
+	keys := make([]string, 0, len(opts))
+	for key := range opts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key+"="+pyValue(opts[key]))
+	}
+	return strings.Join(args, ", ")
+}
+
+// pyValue renders an option value of a spec as a Python expression.
+func pyValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		if pythonName.MatchString(v) {
+			return v
+		}
+		return pyString(v)
+	case int, int64, float64:
+		return fmt.Sprintf("%v", v)
+	}
+
+	// constants of the Python runtime, such as the True of index=True
+	switch s := fmt.Sprintf("%v", val); strings.ToLower(s) {
+	case "true":
+		return "True"
+	case "false":
+		return "False"
+	case "none":
+		return "None"
+	default:
+		return pyString(s)
+	}
+}
+
+// pyStrings renders values as a Python list of strings.
+func pyStrings(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, val := range values {
+		quoted = append(quoted, pyString(val))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// pyString renders s as a double quoted Python string literal. The escapes of Go's quoting are all valid Python.
+func pyString(s string) string {
+	return strconv.Quote(s)
+}
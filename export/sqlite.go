@@ -0,0 +1,163 @@
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	// registers the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// sqliteColumn is a column of an exported SQLite table, along with where it came from.
+type sqliteColumn struct {
+	col      *osqt.Column
+	platform string
+}
+
+// WriteSQLite creates a SQLite database at fileloc containing an empty table for every osquery table in parser,
+// plus osqt_tables and osqt_columns metadata tables describing them. When the same table name appears in more
+// than one namespace its columns are merged. Rows in fixtures (keyed by table name, mapping column names to
+// values) are inserted into their tables.
+func WriteSQLite(parser *osqt.Parser, fileloc string, fixtures map[string][]map[string]string) error {
+	db, err := sql.Open("sqlite3", fileloc)
+	if err != nil {
+		return xerrors.Errorf("error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := writeSQLiteTables(tx, parser, fixtures); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeSQLiteTables(tx *sql.Tx, parser *osqt.Parser, fixtures map[string][]map[string]string) error {
+	metadata := []string{
+		`CREATE TABLE osqt_tables (name TEXT NOT NULL, namespace TEXT NOT NULL, description TEXT, examples TEXT)`,
+		`CREATE TABLE osqt_columns (table_name TEXT NOT NULL, name TEXT NOT NULL, type TEXT, description TEXT, platform TEXT, hidden INTEGER, indexed INTEGER)`,
+	}
+	for _, stmt := range metadata {
+		if _, err := tx.Exec(stmt); err != nil {
+			return xerrors.Errorf("error creating metadata table: %v", err)
+		}
+	}
+
+	tables := map[string][]*sqliteColumn{}
+	names := []string{}
+	for _, ns := range parser.SortedNamespaces() {
+		for _, table := range ns.SortedTables() {
+			if _, err := tx.Exec(`INSERT INTO osqt_tables VALUES (?, ?, ?, ?)`, table.Name, ns.Key, table.Description, strings.Join(table.Examples, "\n")); err != nil {
+				return err
+			}
+			if _, seen := tables[table.Name]; !seen {
+				names = append(names, table.Name)
+			}
+
+			cols := []*sqliteColumn{}
+			if table.Schema != nil {
+				for _, col := range table.Schema.Columns {
+					cols = append(cols, &sqliteColumn{col: col})
+				}
+			}
+			platforms := make([]string, 0, len(table.ExtendedSchemas))
+			for platform := range table.ExtendedSchemas {
+				platforms = append(platforms, platform)
+			}
+			sort.Strings(platforms)
+			for _, platform := range platforms {
+				for _, col := range table.ExtendedSchemas[platform].Columns {
+					cols = append(cols, &sqliteColumn{col: col, platform: platform})
+				}
+			}
+
+			for _, c := range cols {
+				if _, err := tx.Exec(`INSERT INTO osqt_columns VALUES (?, ?, ?, ?, ?, ?, ?)`, table.Name, c.col.Name, c.col.Type,
+					c.col.Description, c.platform, c.col.Hidden(), optionSet(c.col, "index")); err != nil {
+					return err
+				}
+				tables[table.Name] = appendUniqueColumn(tables[table.Name], c)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		cols := tables[name]
+		if len(cols) == 0 {
+			continue
+		}
+
+		defs := make([]string, 0, len(cols))
+		colnames := make([]string, 0, len(cols))
+		for _, c := range cols {
+			declared := strings.Replace(c.col.Type, "_", " ", -1)
+			if ct, ok := c.col.ColumnType(); ok {
+				declared = ct.SQL.Declared
+			}
+			defs = append(defs, fmt.Sprintf("%s %s", quoteIdent(c.col.Name), declared))
+			colnames = append(colnames, c.col.Name)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(name), strings.Join(defs, ", "))); err != nil {
+			return xerrors.Errorf("error creating table %s: %v", name, err)
+		}
+
+		rows, ok := fixtures[name]
+		if !ok {
+			continue
+		}
+		quoted := make([]string, 0, len(colnames))
+		for _, cname := range colnames {
+			quoted = append(quoted, quoteIdent(cname))
+		}
+		stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(name), strings.Join(quoted, ", "),
+			strings.TrimSuffix(strings.Repeat("?, ", len(colnames)), ", ")))
+		if err != nil {
+			return err
+		}
+		for idx, row := range rows {
+			vals := make([]interface{}, 0, len(colnames))
+			for _, cname := range colnames {
+				if val, ok := row[cname]; ok {
+					vals = append(vals, val)
+				} else {
+					vals = append(vals, nil)
+				}
+			}
+			if _, err := stmt.Exec(vals...); err != nil {
+				stmt.Close()
+				return xerrors.Errorf("error inserting fixture %s row %d: %v", name, idx, err)
+			}
+		}
+		stmt.Close()
+	}
+
+	return nil
+}
+
+func appendUniqueColumn(cols []*sqliteColumn, c *sqliteColumn) []*sqliteColumn {
+	for _, existing := range cols {
+		if existing.col.Name == c.col.Name {
+			return cols
+		}
+	}
+	return append(cols, c)
+}
+
+func optionSet(col *osqt.Column, opt string) bool {
+	val, ok := col.Options[opt]
+	return ok && strings.EqualFold(fmt.Sprintf("%v", val), "true")
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,173 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/gen0cide/osqt"
+)
+
+// jsonIndent is the indentation of each level of the schema JSON written by WriteSchemaJSON.
+const jsonIndent = "  "
+
+// namespaceHeader holds the fields of a Namespace other than its tables, encoded as Namespace encodes them.
+type namespaceHeader struct {
+	Key          string            `json:"key,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Availability osqt.Availability `json:"availability,omitempty"`
+}
+
+// WriteSchemaJSON writes namespaces to w as indented JSON, one table at a time, so memory use depends on the
+// largest table rather than the whole schema. The output is the same as json.MarshalIndent(namespaces, "", "  ").
+func WriteSchemaJSON(w io.Writer, namespaces map[string]*osqt.Namespace) error {
+	bw := bufio.NewWriter(w)
+	if err := writeNamespacesJSON(bw, namespaces, 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteEnvelopeJSON writes namespaces to w as a versioned schema export described by meta, streamed like
+// WriteSchemaJSON. The output is the same as json.MarshalIndent of the osqt.SchemaEnvelope holding both.
+func WriteEnvelopeJSON(w io.Writer, meta *osqt.SchemaMetadata, namespaces map[string]*osqt.Namespace) error {
+	header, err := json.MarshalIndent(meta, jsonIndent, jsonIndent)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("{")
+	if err := writeKey(bw, 1, osqt.SchemaMetadataKey); err != nil {
+		return err
+	}
+	bw.Write(header)
+	bw.WriteString(",")
+	if err := writeKey(bw, 1, "namespaces"); err != nil {
+		return err
+	}
+	if err := writeNamespacesJSON(bw, namespaces, 1); err != nil {
+		return err
+	}
+	bw.WriteString("\n}")
+	return bw.Flush()
+}
+
+// writeNamespacesJSON writes namespaces as the indented JSON value of a member nested depth levels deep.
+func writeNamespacesJSON(bw *bufio.Writer, namespaces map[string]*osqt.Namespace, depth int) error {
+	if namespaces == nil {
+		bw.WriteString("null")
+		return nil
+	}
+	nsids := namespaceKeys(namespaces)
+	if len(nsids) == 0 {
+		bw.WriteString("{}")
+		return nil
+	}
+
+	bw.WriteString("{")
+	for idx, nsid := range nsids {
+		ns := namespaces[nsid]
+		if idx > 0 {
+			bw.WriteString(",")
+		}
+		if err := writeKey(bw, depth+1, nsid); err != nil {
+			return err
+		}
+		if ns == nil {
+			bw.WriteString("null")
+			continue
+		}
+
+		header, err := json.MarshalIndent(&namespaceHeader{Key: ns.Key, Name: ns.Name, Availability: ns.Availability}, indentFor(depth+1), jsonIndent)
+		if err != nil {
+			return err
+		}
+		if len(ns.Tables) == 0 {
+			bw.Write(header)
+			continue
+		}
+
+		// reopen the header object to append the tables to it
+		header = bytes.TrimRight(bytes.TrimSuffix(bytes.TrimRight(header, " \n"), []byte("}")), " \n")
+		bw.Write(header)
+		if len(header) > 1 {
+			bw.WriteString(",")
+		}
+		if err := writeKey(bw, depth+2, "tables"); err != nil {
+			return err
+		}
+
+		bw.WriteString("{")
+		for tidx, tname := range tableKeys(ns.Tables) {
+			if tidx > 0 {
+				bw.WriteString(",")
+			}
+			if err := writeKey(bw, depth+3, tname); err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(ns.Tables[tname], indentFor(depth+3), jsonIndent)
+			if err != nil {
+				return err
+			}
+			bw.Write(data)
+		}
+		bw.WriteString("\n" + indentFor(depth+2) + "}")
+		bw.WriteString("\n" + indentFor(depth+1) + "}")
+	}
+	bw.WriteString("\n" + indentFor(depth) + "}")
+	return nil
+}
+
+// WriteTablesJSONL writes the tables of namespaces to w as newline delimited JSON, one table per line, ordered by
+// namespace and then table name. Each table carries its namespace_id.
+func WriteTablesJSONL(w io.Writer, namespaces map[string]*osqt.Namespace) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, nsid := range namespaceKeys(namespaces) {
+		for _, table := range namespaces[nsid].SortedTables() {
+			if err := enc.Encode(table); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// writeKey starts the member key of an object nested depth levels deep, on a new line.
+func writeKey(bw *bufio.Writer, depth int, key string) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	bw.WriteString("\n" + indentFor(depth))
+	bw.Write(data)
+	bw.WriteString(": ")
+	return nil
+}
+
+func indentFor(depth int) string {
+	return string(bytes.Repeat([]byte(jsonIndent), depth))
+}
+
+// namespaceKeys returns the keys of namespaces in sorted order, as encoding/json writes them.
+func namespaceKeys(namespaces map[string]*osqt.Namespace) []string {
+	keys := make([]string, 0, len(namespaces))
+	for key := range namespaces {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tableKeys returns the keys of tables in sorted order, as encoding/json writes them.
+func tableKeys(tables map[string]*osqt.Table) []string {
+	keys := make([]string, 0, len(tables))
+	for key := range tables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
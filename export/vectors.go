@@ -0,0 +1,290 @@
+package export
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// TestVector pairs a table spec snippet with the table osqt parses it into.
+type TestVector struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Spec        string      `json:"spec"`
+	Expected    *osqt.Table `json:"expected"`
+}
+
+// TestVectorSuite is the set of test vectors for one version of osqt.
+type TestVectorSuite struct {
+	Version string        `json:"osqt_version"`
+	Notes   string        `json:"notes"`
+	Vectors []*TestVector `json:"vectors"`
+}
+
+// testVectorNotes explains how implementations should compare their output against the vectors.
+const testVectorNotes = "Each spec is the content of a file named <name>.table. Expected holds the table osqt parses it " +
+	"into, in the same form as the schema export. Platform lists are sorted, as their order is not significant."
+
+// testVectorSpecs are the spec snippets covering each feature of the table spec syntax osqt understands.
+var testVectorSpecs = []struct {
+	name        string
+	description string
+	spec        string
+}{
+	{
+		name:        "minimal_table",
+		description: "A table name, description, single column schema and implementation.",
+		spec: `table_name("minimal_table")
+description("The smallest useful table.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+implementation("minimal@genMinimal")
+`,
+	},
+	{
+		name:        "file_named_table",
+		description: "A spec without table_name() is named after its file.",
+		spec: `description("Named after its spec file.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+`,
+	},
+	{
+		name:        "table_aliases",
+		description: "Alternative table names given with the aliases keyword of table_name().",
+		spec: `table_name("table_aliases", aliases=["table_alias_one", "table_alias_two"])
+description("A table with aliases.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+`,
+	},
+	{
+		name:        "table_aliases_positional",
+		description: "Alternative table names given as the second argument of table_name().",
+		spec: `table_name("table_aliases_positional", ["table_alias_positional"])
+description("A table with positional aliases.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+`,
+	},
+	{
+		name:        "column_types",
+		description: "A column of each built in column type.",
+		spec: `table_name("column_types")
+description("Every column type.")
+schema([
+    Column("text_col", TEXT, "A TEXT column"),
+    Column("date_col", DATE, "A DATE column"),
+    Column("datetime_col", DATETIME, "A DATETIME column"),
+    Column("integer_col", INTEGER, "An INTEGER column"),
+    Column("bigint_col", BIGINT, "A BIGINT column"),
+    Column("unsigned_bigint_col", UNSIGNED_BIGINT, "An UNSIGNED_BIGINT column"),
+    Column("double_col", DOUBLE, "A DOUBLE column"),
+    Column("blob_col", BLOB, "A BLOB column"),
+])
+`,
+	},
+	{
+		name:        "column_options",
+		description: "Boolean, string and name valued column keyword options.",
+		spec: `table_name("column_options")
+description("Columns with options.")
+schema([
+    Column("path", TEXT, "An indexed path", index=True, required=True),
+    Column("directory", TEXT, "An optimized directory", optimized=True),
+    Column("pattern", TEXT, "An additional pattern", additional=True),
+    Column("secret", TEXT, "A hidden column", hidden=True),
+    Column("label", TEXT, "A case insensitive column", collate="nocase"),
+    Column("flag", INTEGER, "A column with a name valued option", default=NONE),
+    Column("plain", TEXT, "An option explicitly disabled", index=False),
+])
+`,
+	},
+	{
+		name:        "description_concatenation",
+		description: "Adjacent string literals are concatenated, as in Python.",
+		spec: `table_name("description_concatenation")
+description("A description split "
+            "across several "
+            "lines.")
+schema([
+    Column("name", TEXT, "A column description "
+                         "split in two"),
+])
+`,
+	},
+	{
+		name:        "foreign_keys",
+		description: "ForeignKey() entries in a schema are kept apart from its columns.",
+		spec: `table_name("foreign_keys")
+description("A table referencing another.")
+schema([
+    Column("pid", BIGINT, "Process ID"),
+    Column("name", TEXT, "Process name"),
+    ForeignKey(column="pid", table="processes"),
+])
+`,
+	},
+	{
+		name:        "extended_schema_platform",
+		description: "Platform specific columns for a single platform category.",
+		spec: `table_name("extended_schema_platform")
+description("A table with Windows only columns.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+extended_schema(WINDOWS, [
+    Column("sid", TEXT, "A Windows security identifier"),
+])
+`,
+	},
+	{
+		name:        "extended_schema_lambda",
+		description: "Platform specific columns for several platform categories, given as a lambda.",
+		spec: `table_name("extended_schema_lambda")
+description("A table with Linux and macOS only columns.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+extended_schema(lambda: LINUX() or DARWIN(), [
+    Column("inode", BIGINT, "An inode number"),
+])
+`,
+	},
+	{
+		name:        "extended_schema_posix",
+		description: "The POSIX category expands to every POSIX platform.",
+		spec: `table_name("extended_schema_posix")
+description("A table with POSIX only columns.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+extended_schema(POSIX, [
+    Column("mode", TEXT, "Permission bits"),
+])
+`,
+	},
+	{
+		name:        "multiple_extended_schemas",
+		description: "Several extended_schema() declarations in one table.",
+		spec: `table_name("multiple_extended_schemas")
+description("A table with columns for different platforms.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+extended_schema(WINDOWS, [
+    Column("sid", TEXT, "A Windows security identifier"),
+])
+extended_schema(DARWIN, [
+    Column("uuid", TEXT, "A macOS user UUID"),
+])
+`,
+	},
+	{
+		name:        "attributes",
+		description: "Table attributes with boolean, string and name values.",
+		spec: `table_name("attributes")
+description("An evented table.")
+schema([
+    Column("time", BIGINT, "Time of the event"),
+    Column("eid", TEXT, "Event ID", hidden=True),
+])
+attributes(event_subscriber=True, cacheable=False, owner="security", kind=EVENTS)
+implementation("attributes@attribute_events::genTable")
+`,
+	},
+	{
+		name:        "generator_implementation",
+		description: "An implementation yielding its rows, marked with the generator keyword of implementation().",
+		spec: `table_name("generator_implementation")
+description("A table generating rows as they are found.")
+schema([
+    Column("path", TEXT, "A file path"),
+])
+implementation("generator@genGenerator", generator=True)
+`,
+	},
+	{
+		name:        "fuzz_paths",
+		description: "Paths the table reads, declared for fuzzing.",
+		spec: `table_name("fuzz_paths")
+description("A table reading files.")
+schema([
+    Column("path", TEXT, "A file path", required=True),
+])
+implementation("fuzz@genFuzz")
+fuzz_paths([
+    "/etc/passwd",
+    "/etc/group",
+])
+`,
+	},
+	{
+		name:        "examples",
+		description: "Example queries for the table.",
+		spec: `table_name("examples")
+description("A table with example queries.")
+schema([
+    Column("name", TEXT, "A name"),
+])
+examples([
+    "select * from examples",
+    "select name from examples where name = 'osqt'",
+])
+`,
+	},
+	{
+		name:        "comments",
+		description: "Python comments are ignored.",
+		spec: `# Copyright notices and other comments appear at the top of specs.
+table_name("comments")  # trailing comment
+description("A table with comments.")
+schema([
+    # a comment between columns
+    Column("name", TEXT, "A name"),
+])
+`,
+	},
+}
+
+// TestVectors parses a spec snippet for each feature of the table spec syntax and returns the pairs of snippet and
+// parsed table, so other implementations of spec parsing can be checked against osqt.
+func TestVectors(parser *osqt.Parser) (*TestVectorSuite, error) {
+	suite := &TestVectorSuite{
+		Version: osqt.Version,
+		Notes:   testVectorNotes,
+		Vectors: make([]*TestVector, 0, len(testVectorSpecs)),
+	}
+	for _, v := range testVectorSpecs {
+		table, err := parser.ParseTableSource(v.name+".table", strings.NewReader(v.spec))
+		if err != nil {
+			return nil, xerrors.Errorf("error parsing test vector %s: %v", v.name, err)
+		}
+		sortPlatforms(table.Schema)
+		for _, ext := range table.ExtendedSchemas {
+			sortPlatforms(ext)
+		}
+
+		suite.Vectors = append(suite.Vectors, &TestVector{
+			Name:        v.name,
+			Description: v.description,
+			Spec:        v.spec,
+			Expected:    table,
+		})
+	}
+	return suite, nil
+}
+
+// sortPlatforms sorts the platforms of s, which the parser collects in no particular order.
+func sortPlatforms(s *osqt.Schema) {
+	if s != nil {
+		sort.Strings(s.Platforms)
+	}
+}
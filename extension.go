@@ -0,0 +1,335 @@
+package osqt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// tableNameRegexp matches the names osquery accepts for tables and columns.
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate returns an error if the table could not be served by osquery: a missing or invalid name, a column
+// without a valid name or a registered type, or a column declared twice in the same schema or by both the schema
+// and an extended schema.
+func (t *Table) Validate() error {
+	t.RLock()
+	defer t.RUnlock()
+
+	if !tableNameRegexp.MatchString(t.Name) {
+		return xerrors.Errorf("table name %q is not a valid table name", t.Name)
+	}
+	if t.Schema == nil || len(t.Schema.Columns) == 0 {
+		return xerrors.Errorf("table %s has no columns", t.Name)
+	}
+	if err := t.Schema.validate(nil); err != nil {
+		return xerrors.Errorf("table %s: %v", t.Name, err)
+	}
+	for _, platform := range sortedSchemaPlatforms(t.ExtendedSchemas) {
+		if err := t.ExtendedSchemas[platform].validate(t.Schema); err != nil {
+			return xerrors.Errorf("table %s (%s): %v", t.Name, platform, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the columns of the schema, which may not redeclare the columns of base.
+func (s *Schema) validate(base *Schema) error {
+	seen := map[string]bool{}
+	for _, col := range s.Columns {
+		if !tableNameRegexp.MatchString(col.Name) {
+			return xerrors.Errorf("column name %q is not a valid column name", col.Name)
+		}
+		if seen[col.Name] {
+			return xerrors.Errorf("column %s is declared more than once", col.Name)
+		}
+		seen[col.Name] = true
+		if base != nil && base.column(col.Name) != nil {
+			return xerrors.Errorf("column %s is declared by both the schema and an extended schema", col.Name)
+		}
+		if _, ok := col.ColumnType(); !ok {
+			return xerrors.Errorf("column %s has unregistered type %s", col.Name, col.Type)
+		}
+	}
+	return nil
+}
+
+// AddTable adds table to the namespace, wiring it to the namespace as parsed tables are. It returns an error if
+// the namespace already has a table of that name. AddTable does not lock the namespace's parser, so callers
+// adding tables to a parser in use should use Parser.RegisterTable instead.
+func (n *Namespace) AddTable(table *Table) error {
+	if table == nil {
+		return xerrors.New("cannot add a nil table")
+	}
+	if _, exists := n.Tables[table.Name]; exists {
+		return xerrors.Errorf("namespace %s already has a table named %s", n.Key, table.Name)
+	}
+
+	table.Lock()
+	defer table.Unlock()
+
+	table.Namespace = n
+	table.NamespaceID = n.Key
+	table.logger = n.Logger().Named(table.Name)
+	if table.Schema != nil {
+		table.Schema.Table = table
+		table.Schema.logger = table.logger.Named("schema")
+	}
+	for _, ext := range table.ExtendedSchemas {
+		ext.Table = table
+		ext.logger = table.logger.Named("schema")
+	}
+	if n.Tables == nil {
+		n.Tables = map[string]*Table{}
+	}
+	n.Tables[table.Name] = table
+	return nil
+}
+
+// RegisterTable adds a table declared in Go code, such as that of a proprietary osquery extension, to the parser
+// so it is exported, validated against and served like the tables parsed from specs. The table goes into the
+// namespace named by its NamespaceID, or the specs namespace (every platform) if it has none. It returns an error
+// if the table is invalid (see Table.Validate), or if the parser already has a table of that name, as osquery
+// does not let extensions replace built in tables.
+func (p *Parser) RegisterTable(table *Table) error {
+	if table == nil {
+		return xerrors.New("cannot register a nil table")
+	}
+	if table.NamespaceID == "" {
+		table.NamespaceID = "specs"
+	}
+	return p.registerTables([]*Table{table})
+}
+
+// registerTables adds tables, copies of one table for the namespaces named by their NamespaceIDs, to the parser.
+// Nothing is added unless every table is valid and the parser has no table of their name.
+func (p *Parser) registerTables(tables []*Table) error {
+	nsids := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if err := table.Validate(); err != nil {
+			return err
+		}
+		if _, ok := CanonicalPlatforms[table.NamespaceID]; !ok {
+			return xerrors.Errorf("table %s is in an unknown namespace %s", table.Name, table.NamespaceID)
+		}
+		nsids = append(nsids, table.NamespaceID)
+	}
+	name := tables[0].Name
+
+	p.Lock()
+	defer p.Unlock()
+
+	for _, ns := range p.Namespaces {
+		if _, exists := ns.Tables[name]; exists {
+			return xerrors.Errorf("table %s conflicts with the %s table of the %s namespace", name, name, ns.Key)
+		}
+	}
+
+	for _, table := range tables {
+		ns, ok := p.Namespaces[table.NamespaceID]
+		if !ok {
+			ns = NewNamespace(table.NamespaceID, CanonicalPlatforms[table.NamespaceID], p, nil)
+			p.Namespaces[table.NamespaceID] = ns
+		}
+		if err := ns.AddTable(table); err != nil {
+			return err
+		}
+	}
+
+	p.Logger.Debugw("Registered table", "table", name, "namespaces", nsids, "columns", len(tables[0].Schema.Columns))
+	return nil
+}
+
+// ColumnOption sets an option of a column declared with a TableBuilder, as the keyword arguments of Column() do
+// in a spec.
+type ColumnOption func(*Column)
+
+// WithIndex marks the column as an index of the table (index=True).
+func WithIndex() ColumnOption {
+	return WithColumnOption("index", true)
+}
+
+// WithRequired marks the column as one queries must constrain (required=True).
+func WithRequired() ColumnOption {
+	return WithColumnOption("required", true)
+}
+
+// WithAdditional marks the column as one that changes the rows generated when constrained (additional=True).
+func WithAdditional() ColumnOption {
+	return WithColumnOption("additional", true)
+}
+
+// WithOptimized marks the column as one the table generates rows for efficiently when constrained
+// (optimized=True).
+func WithOptimized() ColumnOption {
+	return WithColumnOption("optimized", true)
+}
+
+// WithHidden hides the column from SELECT * (hidden=True).
+func WithHidden() ColumnOption {
+	return WithColumnOption("hidden", true)
+}
+
+// WithColumnAliases sets the other names the column may be queried by.
+func WithColumnAliases(aliases ...string) ColumnOption {
+	return func(c *Column) {
+		c.Aliases = append(c.Aliases, aliases...)
+	}
+}
+
+// WithColumnOption sets an arbitrary option of the column.
+func WithColumnOption(key string, value interface{}) ColumnOption {
+	return func(c *Column) {
+		c.Options[key] = value
+	}
+}
+
+// TableBuilder declares a table in Go code, for tables that have no spec file such as those of proprietary
+// osquery extensions:
+//
+//	table, err := osqt.NewTableBuilder("my_table").
+//		Description("Widgets installed on the host.").
+//		Column("id", "BIGINT", "Widget ID.", osqt.WithIndex()).
+//		Column("name", "TEXT", "Widget name.").
+//		ExtendedColumn("WINDOWS", "sid", "TEXT", "SID of the widget's owner.").
+//		Build()
+//
+// The table is then added to a parser with Parser.RegisterTable. Errors are collected as the table is declared
+// and returned by Build.
+type TableBuilder struct {
+	table *Table
+	errs  []string
+}
+
+// NewTableBuilder returns a TableBuilder declaring a table of the given name, available on every platform.
+func NewTableBuilder(name string) *TableBuilder {
+	t := NewEmptyTable()
+	t.Name = name
+	t.Schema = NewEmptySchema(t)
+	return &TableBuilder{table: t}
+}
+
+// Namespace sets the namespace the table belongs to, one of the keys of CanonicalPlatforms such as linux or
+// windows, which determines the platforms it is available on.
+func (b *TableBuilder) Namespace(nsid string) *TableBuilder {
+	if _, ok := CanonicalPlatforms[nsid]; !ok {
+		b.errorf("unknown namespace %s", nsid)
+	}
+	b.table.NamespaceID = nsid
+	return b
+}
+
+// Description sets the description of the table.
+func (b *TableBuilder) Description(desc string) *TableBuilder {
+	b.table.Description = desc
+	return b
+}
+
+// Aliases adds other names the table may be queried by.
+func (b *TableBuilder) Aliases(aliases ...string) *TableBuilder {
+	b.table.Aliases = append(b.table.Aliases, aliases...)
+	return b
+}
+
+// Column adds a column available on every platform of the table. typ is the name of a registered column type
+// such as TEXT or BIGINT.
+func (b *TableBuilder) Column(name, typ, desc string, opts ...ColumnOption) *TableBuilder {
+	b.table.Schema.Columns = append(b.table.Schema.Columns, newBuiltColumn(len(b.table.Schema.Columns), name, typ, desc, opts))
+	return b
+}
+
+// ExtendedColumn adds a column only available on some platforms, as extended_schema() does in a spec. platform is
+// either a platform (windows) or a platform category of TableCategories (WINDOWS), which adds the column to each
+// of its platforms.
+func (b *TableBuilder) ExtendedColumn(platform, name, typ, desc string, opts ...ColumnOption) *TableBuilder {
+	platforms, ok := TableCategories[platform]
+	if !ok {
+		platforms = []string{}
+		for _, members := range TableCategories {
+			if containsName(members, platform) {
+				platforms = []string{platform}
+				break
+			}
+		}
+	}
+	if len(platforms) == 0 {
+		b.errorf("unknown platform %s of extended column %s", platform, name)
+		return b
+	}
+
+	for _, p := range platforms {
+		ext, ok := b.table.ExtendedSchemas[p]
+		if !ok {
+			ext = NewEmptySchema(b.table)
+			ext.Extended = true
+			b.table.ExtendedSchemas[p] = ext
+		}
+		ext.Platforms = mergePlatforms(ext.Platforms, platforms)
+		ext.Columns = append(ext.Columns, newBuiltColumn(len(ext.Columns), name, typ, desc, opts))
+	}
+	return b
+}
+
+// ForeignKey adds a foreign key to the schema of the table, as ForeignKey(column=..., table=...) does in a spec.
+func (b *TableBuilder) ForeignKey(column, table string) *TableBuilder {
+	b.table.Schema.ForeignKeys = append(b.table.Schema.ForeignKeys, map[string]interface{}{"column": column, "table": table})
+	return b
+}
+
+// Attribute sets an attribute of the table, such as event_subscriber or cacheable.
+func (b *TableBuilder) Attribute(key string, value interface{}) *TableBuilder {
+	b.table.Attributes[key] = value
+	return b
+}
+
+// Implementation sets the implementation of the table, as implementation() does in a spec.
+func (b *TableBuilder) Implementation(impl string) *TableBuilder {
+	b.table.Implementation = impl
+	return b
+}
+
+// Examples adds example queries of the table.
+func (b *TableBuilder) Examples(examples ...string) *TableBuilder {
+	b.table.Examples = append(b.table.Examples, examples...)
+	return b
+}
+
+// Build returns the declared table, or an error if the declaration was invalid (see Table.Validate). The builder
+// should not be used after Build.
+func (b *TableBuilder) Build() (*Table, error) {
+	if len(b.errs) > 0 {
+		return nil, xerrors.Errorf("table %s: %s", b.table.Name, strings.Join(b.errs, "; "))
+	}
+	if err := b.table.Validate(); err != nil {
+		return nil, err
+	}
+	return b.table, nil
+}
+
+// MustBuild is like Build, but panics if the declaration was invalid. It is meant for tables declared in package
+// level variables.
+func (b *TableBuilder) MustBuild() *Table {
+	t, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (b *TableBuilder) errorf(format string, args ...interface{}) {
+	b.errs = append(b.errs, fmt.Sprintf(format, args...))
+}
+
+func newBuiltColumn(idx int, name, typ, desc string, opts []ColumnOption) *Column {
+	col := NewEmptyColumn()
+	col.Index = idx
+	col.Name = name
+	col.Type = typ
+	col.Description = desc
+	for _, opt := range opts {
+		opt(col)
+	}
+	return col
+}
@@ -0,0 +1,248 @@
+package osqt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/xerrors"
+)
+
+// ErrUnsupportedScheme is returned when loading a schema from a URL whose scheme has no registered SchemaFetcher.
+var ErrUnsupportedScheme = xerrors.New("unsupported schema URL scheme")
+
+// SchemaFetcher retrieves the bytes of an exported schema from a URL, such as an HTTP server or an object store
+// holding the canonical schema of a CI pipeline. The caller closes the returned reader.
+type SchemaFetcher interface {
+	Fetch(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+}
+
+// SchemaFetcherFunc adapts a function to the SchemaFetcher interface.
+type SchemaFetcherFunc func(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+
+// Fetch implements the SchemaFetcher interface.
+func (f SchemaFetcherFunc) Fetch(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	return f(ctx, u)
+}
+
+var (
+	schemaFetchersMu sync.RWMutex
+	schemaFetchers   = map[string]SchemaFetcher{
+		"http":  &HTTPSchemaFetcher{},
+		"https": &HTTPSchemaFetcher{},
+		"s3":    &S3SchemaFetcher{},
+		"gs":    &GCSSchemaFetcher{},
+	}
+)
+
+// RegisterSchemaFetcher sets the fetcher of schema URLs with the given scheme, replacing the built in fetcher of
+// the scheme if it has one. Programs needing authenticated object store access, such as through the AWS or Google
+// Cloud SDKs, register a fetcher of their own for s3 or gs. A nil fetcher unregisters the scheme.
+func RegisterSchemaFetcher(scheme string, f SchemaFetcher) {
+	schemaFetchersMu.Lock()
+	defer schemaFetchersMu.Unlock()
+
+	scheme = strings.ToLower(scheme)
+	if f == nil {
+		delete(schemaFetchers, scheme)
+		return
+	}
+	schemaFetchers[scheme] = f
+}
+
+// schemaFetcher returns the fetcher registered for scheme.
+func schemaFetcher(scheme string) (SchemaFetcher, bool) {
+	schemaFetchersMu.RLock()
+	defer schemaFetchersMu.RUnlock()
+
+	f, ok := schemaFetchers[strings.ToLower(scheme)]
+	return f, ok
+}
+
+// IsSchemaURL returns true if location is a URL with a registered SchemaFetcher, rather than a path to a file.
+func IsSchemaURL(location string) bool {
+	i := strings.Index(location, "://")
+	if i <= 0 {
+		return false
+	}
+	_, ok := schemaFetcher(location[:i])
+	return ok
+}
+
+// HTTPSchemaFetcher fetches http:// and https:// schema URLs.
+type HTTPSchemaFetcher struct {
+	// Client sends the requests. http.DefaultClient is used if it is nil.
+	Client *http.Client
+	// Header is added to every request, such as an Authorization header for a private artifact store.
+	Header http.Header
+}
+
+// Fetch implements the SchemaFetcher interface.
+func (f *HTTPSchemaFetcher) Fetch(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, redactFetchError(u, err)
+	}
+	for key, values := range f.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, redactFetchError(u, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, xerrors.Errorf("fetching %s: %s", redactSchemaURL(u), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// S3SchemaFetcher fetches s3://bucket/key schema URLs through the bucket's HTTPS endpoint. Requests are not
+// signed, so the object must be publicly readable, or fetched through a presigned https:// URL instead.
+type S3SchemaFetcher struct {
+	// Region of the bucket, used to pick the regional endpoint. AWS_REGION or AWS_DEFAULT_REGION is used if it
+	// is empty, and the global endpoint if neither is set.
+	Region string
+	// HTTP fetches the object once its URL is resolved.
+	HTTP HTTPSchemaFetcher
+}
+
+// Fetch implements the SchemaFetcher interface.
+func (f *S3SchemaFetcher) Fetch(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	bucket, key, err := objectStoreLocation(u)
+	if err != nil {
+		return nil, err
+	}
+
+	region := f.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	host := bucket + ".s3.amazonaws.com"
+	if region != "" {
+		host = bucket + ".s3." + region + ".amazonaws.com"
+	}
+
+	return f.HTTP.Fetch(ctx, &url.URL{Scheme: "https", Host: host, Path: "/" + key})
+}
+
+// GCSSchemaFetcher fetches gs://bucket/object schema URLs through the Cloud Storage HTTPS endpoint.
+type GCSSchemaFetcher struct {
+	// Token is an OAuth 2.0 access token sent as a bearer token, such as the output of
+	// "gcloud auth print-access-token". GOOGLE_OAUTH_ACCESS_TOKEN is used if it is empty, and the object must be
+	// publicly readable if neither is set.
+	Token string
+	// HTTP fetches the object once its URL is resolved.
+	HTTP HTTPSchemaFetcher
+}
+
+// Fetch implements the SchemaFetcher interface.
+func (f *GCSSchemaFetcher) Fetch(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	bucket, object, err := objectStoreLocation(u)
+	if err != nil {
+		return nil, err
+	}
+
+	fetcher := f.HTTP
+	token := f.Token
+	if token == "" {
+		token = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	if token != "" {
+		fetcher.Header = fetcher.Header.Clone()
+		if fetcher.Header == nil {
+			fetcher.Header = http.Header{}
+		}
+		fetcher.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return fetcher.Fetch(ctx, &url.URL{Scheme: "https", Host: "storage.googleapis.com", Path: "/" + bucket + "/" + object})
+}
+
+// objectStoreLocation splits a scheme://bucket/key URL into its bucket and key.
+func objectStoreLocation(u *url.URL) (string, string, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return "", "", xerrors.Errorf("%s URL %s must be of the form %s://bucket/key", u.Scheme, u.String(), u.Scheme)
+	}
+	return u.Host, key, nil
+}
+
+// redactSchemaURL returns u without its password and query, which may hold credentials such as the signature of
+// a presigned URL, for logs and errors.
+func redactSchemaURL(u *url.URL) string {
+	r := *u
+	r.RawQuery = ""
+	r.ForceQuery = false
+	return r.Redacted()
+}
+
+// redactFetchError returns err, an error requesting u, with u redacted. The *url.Error the HTTP client returns
+// quotes the URL whole, presigned query included, so its cause is wrapped with the redacted URL instead.
+func redactFetchError(u *url.URL, err error) error {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	return xerrors.Errorf("fetching %s: %w", redactSchemaURL(u), err)
+}
+
+// ParseSchemaURL loads a previously exported schema from a URL, fetched by the SchemaFetcher registered for its
+// scheme (http, https, s3 and gs are built in). The schema is decoded as YAML if the path of the URL ends in .yaml
+// or .yml, and as JSON otherwise. Versioned exports are verified against their checksum, as they are by
+// ParseJSONSchemaFile.
+func (p *Parser) ParseSchemaURL(ctx context.Context, location string) (err error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	redacted := redactSchemaURL(u)
+
+	ctx, span := Tracer().Start(ctx, "osqt.ParseSchemaURL", trace.WithAttributes(attribute.String("osqt.schema_url", redacted)))
+	defer func() { EndSpan(span, err) }()
+
+	fetcher, ok := schemaFetcher(u.Scheme)
+	if !ok {
+		return xerrors.Errorf("%s: %w", redacted, ErrUnsupportedScheme)
+	}
+
+	rc, err := fetcher.Fetch(ctx, u)
+	if err != nil {
+		return xerrors.Errorf("fetching schema: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return xerrors.Errorf("reading schema from %s: %w", redacted, err)
+	}
+	p.Logger.Debugw("Fetched schema", "url", redacted, "bytes", len(data))
+
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".yaml", ".yml":
+		return p.parseYAMLSchema(redacted, data)
+	default:
+		if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			return xerrors.Errorf("schema at %s is not JSON (name YAML schemas .yaml or .yml)", redacted)
+		}
+		return p.parseJSONSchema(ctx, data)
+	}
+}
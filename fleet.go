@@ -0,0 +1,173 @@
+package osqt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// FleetTable is a table as documented in Fleet's schema YAML (schema/tables/<table>.yml in the fleetdm/fleet
+// repository), which adds notes and examples to the descriptions osquery ships.
+type FleetTable struct {
+	Name        string         `json:"name" yaml:"name"`
+	Description string         `json:"description" yaml:"description"`
+	Platforms   []string       `json:"platforms" yaml:"platforms"`
+	Evented     bool           `json:"evented" yaml:"evented"`
+	Examples    string         `json:"examples" yaml:"examples"`
+	Notes       string         `json:"notes" yaml:"notes"`
+	Columns     []*FleetColumn `json:"columns" yaml:"columns"`
+}
+
+// FleetColumn is a column of a FleetTable.
+type FleetColumn struct {
+	Name        string   `json:"name" yaml:"name"`
+	Type        string   `json:"type" yaml:"type"`
+	Description string   `json:"description" yaml:"description"`
+	Notes       string   `json:"notes" yaml:"notes"`
+	Required    bool     `json:"required" yaml:"required"`
+	Hidden      bool     `json:"hidden" yaml:"hidden"`
+	Platforms   []string `json:"platforms" yaml:"platforms"`
+}
+
+// LoadFleetSchema reads Fleet's schema from fileloc, which is either a directory of per-table YAML files or a
+// single YAML or JSON file holding one table or a list of them (such as Fleet's generated osquery_fleet_schema.json).
+func LoadFleetSchema(fileloc string) ([]*FleetTable, error) {
+	info, err := os.Stat(fileloc)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading Fleet schema: %v", err)
+	}
+	if !info.IsDir() {
+		return loadFleetSchemaFile(fileloc)
+	}
+
+	entries, err := ioutil.ReadDir(fileloc)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading Fleet schema directory: %v", err)
+	}
+	tables := []*FleetTable{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		ftables, err := loadFleetSchemaFile(filepath.Join(fileloc, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, ftables...)
+	}
+	return tables, nil
+}
+
+func loadFleetSchemaFile(fileloc string) ([]*FleetTable, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading Fleet schema: %v", err)
+	}
+
+	// YAML is a superset of JSON, so both forms decode the same way
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, xerrors.Errorf("error parsing Fleet schema %s: %v", fileloc, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	tables := []*FleetTable{}
+	if doc.Content[0].Kind == yaml.SequenceNode {
+		err = doc.Content[0].Decode(&tables)
+	} else {
+		table := &FleetTable{}
+		err = doc.Content[0].Decode(table)
+		tables = append(tables, table)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing Fleet schema %s: %v", fileloc, err)
+	}
+
+	for _, table := range tables {
+		if table.Name == "" {
+			return nil, xerrors.Errorf("Fleet schema %s has a table without a name", fileloc)
+		}
+	}
+	return tables, nil
+}
+
+// ParseFleetSchema merges the notes and examples of Fleet's schema at fileloc (see LoadFleetSchema) into the
+// parser's tables. Fleet's notes are added to the tables and columns they document, its examples are added to the
+// table's examples, and its descriptions are used only where the specs have none. Fleet documents tables that
+// osquery does not ship (such as those of its fleetd extension), which are skipped.
+func (p *Parser) ParseFleetSchema(fileloc string) error {
+	ftables, err := LoadFleetSchema(fileloc)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	merged := 0
+	for _, ftable := range ftables {
+		found := false
+		for _, ns := range p.Namespaces {
+			tbl, ok := ns.Tables[ftable.Name]
+			if !ok {
+				continue
+			}
+			found = true
+			tbl.mergeFleet(ftable)
+		}
+		if !found {
+			p.Logger.Debugw("Fleet documents a table the parser does not have, skipping it", "table", ftable.Name)
+			continue
+		}
+		merged++
+	}
+
+	p.Logger.Debugw("Merged Fleet schema", "path", fileloc, "tables", merged, "skipped", len(ftables)-merged)
+	return nil
+}
+
+// mergeFleet adds the metadata ftable documents to the table.
+func (t *Table) mergeFleet(ftable *FleetTable) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.Description == "" {
+		t.Description = strings.TrimSpace(ftable.Description)
+	}
+	if notes := strings.TrimSpace(ftable.Notes); notes != "" {
+		t.Notes = notes
+	}
+	if example := strings.TrimSpace(ftable.Examples); example != "" && !containsName(t.Examples, example) {
+		t.Examples = append(t.Examples, example)
+	}
+
+	schemas := []*Schema{t.Schema}
+	for _, ext := range t.ExtendedSchemas {
+		schemas = append(schemas, ext)
+	}
+	for _, fcol := range ftable.Columns {
+		for _, s := range schemas {
+			if s == nil {
+				continue
+			}
+			for _, col := range s.Columns {
+				if col.Name != fcol.Name {
+					continue
+				}
+				if col.Description == "" {
+					col.Description = strings.TrimSpace(fcol.Description)
+				}
+				if notes := strings.TrimSpace(fcol.Notes); notes != "" {
+					col.Notes = notes
+				}
+			}
+		}
+	}
+}
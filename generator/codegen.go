@@ -0,0 +1,296 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegister(&typesGenerator{})
+}
+
+// codegenInitialisms are rendered in upper case when they appear as a word of a generated identifier.
+var codegenInitialisms = map[string]bool{
+	"api": true, "cpu": true, "dns": true, "gid": true, "guid": true, "http": true, "id": true, "ip": true,
+	"json": true, "md5": true, "os": true, "pid": true, "sha1": true, "sha256": true, "ssh": true, "tls": true,
+	"uid": true, "uri": true, "url": true, "uuid": true,
+}
+
+// typesGenerator renders a Go struct and a TypeScript interface for the rows of every table, using the Go and
+// TypeScript types of each column's registered ColumnType. Columns with a JSON sub-schema also get nested types
+// describing their decoded document. The "lang" parameter selects "go", "ts" or "all" (the default), and
+// "package" sets the Go package name (default "osquery").
+type typesGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *typesGenerator) Name() string {
+	return "types"
+}
+
+// Description implements the Generator interface.
+func (g *typesGenerator) Description() string {
+	return "Go structs and TypeScript interfaces for the rows of every table."
+}
+
+// codegenTable is a table with its columns merged across namespaces and extended schemas.
+type codegenTable struct {
+	Name    string
+	Columns []*osqt.Column
+}
+
+// Generate implements the Generator interface.
+func (g *typesGenerator) Generate(ctx context.Context, job *Job) error {
+	tables := []*codegenTable{}
+	byName := map[string]*codegenTable{}
+	for _, ns := range job.Parser.SortedNamespaces() {
+		for _, table := range ns.SortedTables() {
+			ct, ok := byName[table.Name]
+			if !ok {
+				ct = &codegenTable{Name: table.Name}
+				byName[table.Name] = ct
+				tables = append(tables, ct)
+			}
+			schemas := []*osqt.Schema{table.Schema}
+			for _, platform := range table.SortedPlatforms() {
+				schemas = append(schemas, table.ExtendedSchemas[platform])
+			}
+			for _, s := range schemas {
+				if s == nil {
+					continue
+				}
+				for _, col := range s.Columns {
+					if !hasColumn(ct.Columns, col.Name) {
+						ct.Columns = append(ct.Columns, col)
+					}
+				}
+			}
+		}
+	}
+
+	lang := job.Param("lang", "all")
+	if lang != "go" && lang != "ts" && lang != "all" {
+		return xerrors.Errorf("unsupported lang %q (options: 'go', 'ts' or 'all')", lang)
+	}
+
+	if lang == "go" || lang == "all" {
+		data, err := renderGoTypes(job.Param("package", "osquery"), tables)
+		if err != nil {
+			return err
+		}
+		if err := job.Output.WriteFile(ctx, "types.go", data); err != nil {
+			return err
+		}
+	}
+	if lang == "ts" || lang == "all" {
+		if err := job.Output.WriteFile(ctx, "types.ts", renderTSTypes(tables)); err != nil {
+			return err
+		}
+	}
+
+	job.Logger.Debugf("Rendered types for %d tables.", len(tables))
+	return nil
+}
+
+func hasColumn(cols []*osqt.Column, name string) bool {
+	for _, col := range cols {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exportedName converts a snake_case name into an exported CamelCase identifier.
+func exportedName(parts ...string) string {
+	var b strings.Builder
+	for _, part := range parts {
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			if codegenInitialisms[strings.ToLower(word)] {
+				b.WriteString(strings.ToUpper(word))
+				continue
+			}
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "T" + name
+	}
+	return name
+}
+
+func columnCodegenTypes(col *osqt.Column) (string, string) {
+	if ct, ok := col.ColumnType(); ok {
+		return ct.GoType, ct.TSType
+	}
+	return "string", "string"
+}
+
+func jsonGoType(f *osqt.JSONField, nested string) string {
+	scalar := map[string]string{"string": "string", "integer": "int64", "number": "float64", "boolean": "bool"}
+	switch f.Type {
+	case "object":
+		if len(f.Fields) == 0 {
+			return "map[string]interface{}"
+		}
+		return "*" + nested
+	case "array":
+		if len(f.Fields) > 0 || f.Items == "object" {
+			if len(f.Fields) == 0 {
+				return "[]map[string]interface{}"
+			}
+			return "[]*" + nested
+		}
+		if t, ok := scalar[f.Items]; ok {
+			return "[]" + t
+		}
+		return "[]interface{}"
+	default:
+		return scalar[f.Type]
+	}
+}
+
+func jsonTSType(f *osqt.JSONField, nested string) string {
+	scalar := map[string]string{"string": "string", "integer": "number", "number": "number", "boolean": "boolean"}
+	switch f.Type {
+	case "object":
+		if len(f.Fields) == 0 {
+			return "Record<string, unknown>"
+		}
+		return nested
+	case "array":
+		if len(f.Fields) > 0 {
+			return nested + "[]"
+		}
+		if t, ok := scalar[f.Items]; ok {
+			return t + "[]"
+		}
+		return "unknown[]"
+	default:
+		return scalar[f.Type]
+	}
+}
+
+func renderGoTypes(pkg string, tables []*codegenTable) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by osqt. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+
+	usesJSON := false
+	for _, t := range tables {
+		for _, col := range t.Columns {
+			if gotype, _ := columnCodegenTypes(col); strings.Contains(gotype, "json.") || len(col.JSONSchema) > 0 {
+				usesJSON = true
+			}
+		}
+	}
+	if usesJSON {
+		buf.WriteString("import \"encoding/json\"\n\n")
+	}
+
+	for _, t := range tables {
+		name := exportedName(t.Name)
+		nested := new(bytes.Buffer)
+		fmt.Fprintf(buf, "// %s is a row of the %s table.\ntype %s struct {\n", name, t.Name, name)
+		for _, col := range t.Columns {
+			gotype, _ := columnCodegenTypes(col)
+			if len(col.JSONSchema) > 0 {
+				// the column holds the document as text, Decode<Column> unmarshals it into the nested type
+				gotype = "string"
+			}
+			fmt.Fprintf(buf, "\t%s %s `json:\"%s\"`\n", exportedName(col.Name), gotype, col.Name)
+		}
+		buf.WriteString("}\n\n")
+
+		for _, col := range t.Columns {
+			if len(col.JSONSchema) == 0 {
+				continue
+			}
+			docname := exportedName(t.Name, col.Name)
+			writeGoJSONStruct(nested, docname, fmt.Sprintf("the JSON document in %s.%s", t.Name, col.Name), col.JSONSchema)
+			fmt.Fprintf(nested, "// Decode%s unmarshals the JSON document in the %s column.\n", exportedName(col.Name), col.Name)
+			fmt.Fprintf(nested, "func (r *%s) Decode%s() (*%s, error) {\n\tdoc := &%s{}\n\tif err := json.Unmarshal([]byte(r.%s), doc); err != nil {\n\t\treturn nil, err\n\t}\n\treturn doc, nil\n}\n\n",
+				name, exportedName(col.Name), docname, docname, exportedName(col.Name))
+		}
+		buf.Write(nested.Bytes())
+	}
+
+	data, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, xerrors.Errorf("error formatting generated Go types: %v", err)
+	}
+	return data, nil
+}
+
+func writeGoJSONStruct(buf *bytes.Buffer, name, doc string, fields []*osqt.JSONField) {
+	children := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// %s is %s.\ntype %s struct {\n", name, doc, name)
+	for _, f := range fields {
+		nested := name + exportedName(f.Name)
+		if f.Description != "" {
+			fmt.Fprintf(buf, "\t// %s\n", strings.Join(strings.Fields(f.Description), " "))
+		}
+		fmt.Fprintf(buf, "\t%s %s `json:\"%s,omitempty\"`\n", exportedName(f.Name), jsonGoType(f, nested), f.Name)
+		if len(f.Fields) > 0 {
+			writeGoJSONStruct(children, nested, "the "+f.Name+" field of "+name, f.Fields)
+		}
+	}
+	buf.WriteString("}\n\n")
+	buf.Write(children.Bytes())
+}
+
+func renderTSTypes(tables []*codegenTable) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("// Code generated by osqt. DO NOT EDIT.\n\n")
+	for _, t := range tables {
+		name := exportedName(t.Name)
+		nested := new(bytes.Buffer)
+		fmt.Fprintf(buf, "/** A row of the %s table. */\nexport interface %s {\n", t.Name, name)
+		for _, col := range t.Columns {
+			_, tstype := columnCodegenTypes(col)
+			if len(col.JSONSchema) > 0 {
+				docname := exportedName(t.Name, col.Name)
+				fmt.Fprintf(buf, "  /** JSON text, parses to {@link %s}. */\n", docname)
+				tstype = "string"
+				writeTSJSONInterface(nested, docname, col.JSONSchema)
+			}
+			fmt.Fprintf(buf, "  %s: %s;\n", tsPropertyName(col.Name), tstype)
+		}
+		buf.WriteString("}\n\n")
+		buf.Write(nested.Bytes())
+	}
+	return buf.Bytes()
+}
+
+func writeTSJSONInterface(buf *bytes.Buffer, name string, fields []*osqt.JSONField) {
+	children := new(bytes.Buffer)
+	fmt.Fprintf(buf, "export interface %s {\n", name)
+	for _, f := range fields {
+		nested := name + exportedName(f.Name)
+		if f.Description != "" {
+			fmt.Fprintf(buf, "  /** %s */\n", strings.Join(strings.Fields(f.Description), " "))
+		}
+		fmt.Fprintf(buf, "  %s?: %s;\n", tsPropertyName(f.Name), jsonTSType(f, nested))
+		if len(f.Fields) > 0 {
+			writeTSJSONInterface(children, nested, f.Fields)
+		}
+	}
+	buf.WriteString("}\n\n")
+	buf.Write(children.Bytes())
+}
+
+func tsPropertyName(name string) string {
+	for idx, r := range name {
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || (idx > 0 && unicode.IsDigit(r))) {
+			return fmt.Sprintf("%q", name)
+		}
+	}
+	return name
+}
@@ -0,0 +1,184 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegister(&docsGenerator{})
+}
+
+var docsFuncs = template.FuncMap{
+	"cell":        markdownCell,
+	"label":       (*Translation)(nil).Label,
+	"jsonfields":  JSONFieldPaths,
+	"jsoncolumns": jsonColumns,
+	"tablepath":   tablePath,
+}
+
+var docsIndexTemplate = template.Must(template.New("index").Funcs(docsFuncs).Parse(`# {{label "tables"}}
+{{range $ns := .}}
+## {{.Name}} ({{.Key}})
+
+{{range .Tables}}- [{{.Name}}]({{tablepath $ns.Key .Name ".md"}}) - {{cell .Description}}
+{{end}}{{end}}`))
+
+var docsTableTemplate = template.Must(template.New("table").Funcs(docsFuncs).Parse(`# {{.Name}}
+
+{{.Description}}
+{{if .Notes}}
+{{.Notes}}
+{{end}}{{if .Schema}}
+| {{label "column"}} | {{label "type"}} | {{label "description"}} |
+|--------|------|-------------|
+{{range .Schema.Columns}}| {{.Name}} | {{.Type}} | {{cell .Description}} |
+{{end}}{{end}}{{range $platform, $schema := .ExtendedSchemas}}
+## {{$platform}} {{label "platform_columns"}}
+
+| {{label "column"}} | {{label "type"}} | {{label "description"}} |
+|--------|------|-------------|
+{{range $schema.Columns}}| {{.Name}} | {{.Type}} | {{cell .Description}} |
+{{end}}{{end}}{{range jsoncolumns .}}
+### {{.Name}} {{label "json_fields"}}
+
+| {{label "path"}} | {{label "type"}} | {{label "description"}} |
+|------|------|-------------|
+{{range jsonfields .JSONSchema}}| {{.Path}} | {{.Type}} | {{cell .Description}} |
+{{end}}{{end}}{{if .Examples}}
+## {{label "examples"}}
+{{range .Examples}}
+` + "```sql\n{{.}}\n```" + `
+{{end}}{{end}}`))
+
+// JSONFieldPath is a field of a JSON column flattened into a dotted path, with array elements written as [].
+type JSONFieldPath struct {
+	Path        string
+	Type        string
+	Description string
+}
+
+// JSONFieldPaths flattens a JSON sub-schema into the paths of each of its fields, depth first.
+func JSONFieldPaths(fields []*osqt.JSONField) []*JSONFieldPath {
+	ret := []*JSONFieldPath{}
+	var walk func(prefix string, fields []*osqt.JSONField)
+	walk = func(prefix string, fields []*osqt.JSONField) {
+		for _, f := range fields {
+			p := f.Name
+			if prefix != "" {
+				p = prefix + "." + f.Name
+			}
+			typ := f.Type
+			if f.Type == "array" && f.Items != "" {
+				typ = "array of " + f.Items
+			}
+			ret = append(ret, &JSONFieldPath{Path: p, Type: typ, Description: f.Description})
+			if f.Type == "array" {
+				p += "[]"
+			}
+			walk(p, f.Fields)
+		}
+	}
+	walk("", fields)
+	return ret
+}
+
+// jsonColumns returns the columns of table, across its base and extended schemas, that declare a JSON sub-schema.
+func jsonColumns(table *osqt.Table) []*osqt.Column {
+	ret := []*osqt.Column{}
+	seen := map[string]bool{}
+	schemas := []*osqt.Schema{table.Schema}
+	for _, platform := range table.SortedPlatforms() {
+		schemas = append(schemas, table.ExtendedSchemas[platform])
+	}
+	for _, s := range schemas {
+		if s == nil {
+			continue
+		}
+		for _, col := range s.Columns {
+			if len(col.JSONSchema) > 0 && !seen[col.Name] {
+				seen[col.Name] = true
+				ret = append(ret, col)
+			}
+		}
+	}
+	return ret
+}
+
+// markdownCell makes a string safe for use inside a markdown table cell.
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", "\\|", -1)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// docsGenerator renders markdown documentation with an index and one page per table. The generated content is
+// wrapped in managed regions so the pages can live in an existing wiki or docs repository alongside
+// human-authored content. Setting the "locale" and "translations-dir" parameters renders the docs using
+// that locale's translation overlay, falling back to English for anything untranslated.
+type docsGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *docsGenerator) Name() string {
+	return "docs"
+}
+
+// Description implements the Generator interface.
+func (g *docsGenerator) Description() string {
+	return "Markdown documentation with osqt-managed regions that can be regenerated in place."
+}
+
+// Generate implements the Generator interface.
+func (g *docsGenerator) Generate(ctx context.Context, job *Job) error {
+	var tr *Translation
+	if locale := job.Param("locale", ""); locale != "" {
+		var err error
+		tr, err = LoadTranslation(job.Param("translations-dir", "."), locale)
+		if err != nil {
+			return err
+		}
+	}
+
+	funcs := template.FuncMap{"label": tr.Label}
+	indexTemplate := template.Must(docsIndexTemplate.Clone()).Funcs(funcs)
+	tableTemplate := template.Must(docsTableTemplate.Clone()).Funcs(funcs)
+
+	missing := 0
+	index := []*siteIndexEntry{}
+	for _, ns := range job.Parser.SortedNamespaces() {
+		entry := &siteIndexEntry{Key: ns.Key, Name: ns.Name}
+		for _, table := range ns.SortedTables() {
+			localized, untranslated := tr.Localize(table)
+			missing += untranslated
+			if err := g.writeTable(ctx, job, tableTemplate, ns.Key, localized); err != nil {
+				return err
+			}
+			entry.Tables = append(entry.Tables, localized)
+		}
+		index = append(index, entry)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := indexTemplate.Execute(buf, index); err != nil {
+		return err
+	}
+
+	if tr != nil {
+		job.Logger.Infof("%d descriptions had no %s translation and fell back to English.", missing, tr.Locale)
+	}
+	job.Logger.Debugf("Rendered %d namespaces.", len(index))
+	return job.Output.WriteManagedFile(ctx, "README.md", []byte(ManagedRegion("index", buf.String())))
+}
+
+func (g *docsGenerator) writeTable(ctx context.Context, job *Job, tmpl *template.Template, nsKey string, table *osqt.Table) error {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, table); err != nil {
+		return err
+	}
+
+	rel := tablePath(nsKey, table.Name, ".md")
+	return job.Output.WriteManagedFile(ctx, rel, []byte(ManagedRegion("table:"+table.Name, buf.String())))
+}
@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// ExecProtocolVersion is the version of the protocol spoken with generator plugins, sent as ExecRequest.Protocol.
+const ExecProtocolVersion = 1
+
+// ExecRequest is the JSON document a generator plugin reads from its stdin: the parameters of the run and a
+// snapshot of the schema, keyed by namespace like an exported schema file.
+type ExecRequest struct {
+	Protocol    int                        `json:"protocol"`
+	OSQTVersion string                     `json:"osqt_version"`
+	Params      map[string]string          `json:"params"`
+	Namespaces  map[string]*osqt.Namespace `json:"namespaces"`
+}
+
+// ExecResponse is the JSON document a generator plugin writes to its stdout once it is done. A plugin that fails
+// sets Error (or exits non-zero), and no files are written.
+type ExecResponse struct {
+	Files []*ExecFile `json:"files"`
+	Error string      `json:"error,omitempty"`
+}
+
+// ExecFile is a file a generator plugin produced. Path is slash separated and relative to the output directory.
+// Content is the file's text, or its bytes in standard base64 when Encoding is "base64".
+type ExecFile struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// execGenerator runs an external program as a generator. The program is sent an ExecRequest on stdin and must
+// reply with an ExecResponse on stdout; anything it writes to stderr is logged.
+type execGenerator struct {
+	path string
+	args []string
+}
+
+// NewExecGenerator returns a generator that runs the plugin at path with args, speaking the protocol of
+// ExecRequest and ExecResponse. It is not registered, so plugins can be written in any language and run without
+// building them into osqt.
+func NewExecGenerator(path string, args ...string) Generator {
+	return &execGenerator{path: path, args: args}
+}
+
+// Name implements the Generator interface.
+func (g *execGenerator) Name() string {
+	return "exec:" + strings.TrimSuffix(filepath.Base(g.path), filepath.Ext(g.path))
+}
+
+// Description implements the Generator interface.
+func (g *execGenerator) Description() string {
+	return "Files produced by the external generator plugin " + g.path + "."
+}
+
+// Generate implements the Generator interface.
+func (g *execGenerator) Generate(ctx context.Context, job *Job) error {
+	job.Parser.RLock()
+	req, err := json.Marshal(&ExecRequest{
+		Protocol:    ExecProtocolVersion,
+		OSQTVersion: osqt.Version,
+		Params:      job.Params,
+		Namespaces:  job.Parser.Namespaces,
+	})
+	job.Parser.RUnlock()
+	if err != nil {
+		return xerrors.Errorf("error rendering plugin request: %v", err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, g.path, g.args...)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	job.Logger.Debugw("Running generator plugin", "plugin", g.path, "args", g.args, "request_bytes", len(req))
+	runErr := cmd.Run()
+
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		job.Logger.Infow(scanner.Text(), "plugin", g.path)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return xerrors.Errorf("plugin %s failed: %v", g.path, runErr)
+	}
+
+	resp := &ExecResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return xerrors.Errorf("plugin %s wrote an invalid response: %v", g.path, err)
+	}
+	if resp.Error != "" {
+		return xerrors.Errorf("plugin %s failed: %s", g.path, resp.Error)
+	}
+
+	for _, file := range resp.Files {
+		data := []byte(file.Content)
+		switch file.Encoding {
+		case "":
+		case "base64":
+			if data, err = base64.StdEncoding.DecodeString(file.Content); err != nil {
+				return xerrors.Errorf("plugin %s file %s is not valid base64: %v", g.path, file.Path, err)
+			}
+		default:
+			return xerrors.Errorf("plugin %s file %s has unsupported encoding %q (options: 'base64')", g.path, file.Path, file.Encoding)
+		}
+		if err := job.Output.WriteFile(ctx, file.Path, data); err != nil {
+			return err
+		}
+	}
+
+	job.Logger.Debugf("Plugin %s produced %d files.", g.path, len(resp.Files))
+	return nil
+}
@@ -0,0 +1,190 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/pack"
+	"github.com/gen0cide/osqt/query"
+)
+
+func init() {
+	MustRegister(&fleetPackGenerator{})
+}
+
+// fleetPackGenerator renders a query pack for Fleet (or Kolide), or for osquery itself, from the queries of an
+// existing pack or, when none is given, from the example queries of every table. Every query is linted against the
+// schema, and is restricted to the platforms that have all of the tables it queries. The "queries" parameter is
+// the path of the pack to read, "name" names the pack (default "osqt"), "format" selects "yaml" (Fleet YAML, the
+// default) or "json" (an osquery JSON pack), and "interval" is the interval of queries that do not set one (default
+// 3600 seconds).
+type fleetPackGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *fleetPackGenerator) Name() string {
+	return "fleet-pack"
+}
+
+// Description implements the Generator interface.
+func (g *fleetPackGenerator) Description() string {
+	return "Fleet YAML or osquery JSON query pack with platforms derived from the tables each query uses."
+}
+
+// Generate implements the Generator interface.
+func (g *fleetPackGenerator) Generate(ctx context.Context, job *Job) error {
+	format := job.Param("format", "yaml")
+	if format != "yaml" && format != "json" {
+		return xerrors.Errorf("unsupported fleet-pack format %q (options: 'yaml' or 'json')", format)
+	}
+	interval, err := strconv.Atoi(job.Param("interval", "3600"))
+	if err != nil || interval <= 0 {
+		return xerrors.Errorf("fleet-pack interval %q is not a positive number of seconds", job.Param("interval", "3600"))
+	}
+
+	var p *pack.Pack
+	if path := job.Param("queries", ""); path != "" {
+		if p, err = pack.Load(path); err != nil {
+			return err
+		}
+	} else {
+		p = examplePack(job.Parser)
+	}
+	if name := job.Param("name", ""); name != "" {
+		p.Name = name
+	} else if p.Name == "" {
+		p.Name = "osqt"
+	}
+
+	invalid := []string{}
+	for _, q := range p.SortedQueries() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		findings, err := query.Lint(job.Parser, q.SQL)
+		if err != nil {
+			return xerrors.Errorf("query %s: %v", q.Name, err)
+		}
+		if errs := lintErrors(findings); len(errs) > 0 {
+			job.Logger.Warnw("Query failed validation", "query", q.Name, "errors", errs)
+			invalid = append(invalid, q.Name)
+			continue
+		}
+
+		if q.Interval == 0 {
+			q.Interval = interval
+		}
+		if q.Platform == "" {
+			platforms, err := queryPlatforms(job.Parser, q.SQL)
+			if err != nil {
+				return xerrors.Errorf("query %s: %v", q.Name, err)
+			}
+			if len(platforms) == 0 {
+				job.Logger.Warnw("No platform has every table the query uses", "query", q.Name)
+				invalid = append(invalid, q.Name)
+				continue
+			}
+			if len(platforms) < len(osqt.GOOSToApplicableNamespaces) {
+				q.Platform = strings.Join(platforms, ",")
+			}
+		}
+	}
+
+	// queries from an existing pack were chosen deliberately, so any that fail validation fail the pack, while
+	// table examples that fail are simply left out
+	if len(invalid) > 0 && job.Param("queries", "") != "" {
+		return xerrors.Errorf("%d queries failed validation: %s", len(invalid), strings.Join(invalid, ", "))
+	}
+	for _, name := range invalid {
+		delete(p.Queries, name)
+	}
+
+	var data []byte
+	file := p.Name + ".yml"
+	if format == "json" {
+		file = p.Name + ".json"
+		data, err = json.MarshalIndent(p, "", "  ")
+	} else {
+		data, err = pack.MarshalFleetYAML(p)
+	}
+	if err != nil {
+		return xerrors.Errorf("error rendering pack: %v", err)
+	}
+
+	job.Logger.Debugf("Rendered pack %s with %d queries.", p.Name, len(p.Queries))
+	return job.Output.WriteFile(ctx, job.Param("file", file), data)
+}
+
+// examplePack returns a pack of every table's example queries. A table's first example is named after the table,
+// and any others after the table and their position.
+func examplePack(parser *osqt.Parser) *pack.Pack {
+	p := &pack.Pack{Queries: map[string]*pack.Query{}}
+	for _, ns := range parser.SortedNamespaces() {
+		for _, table := range ns.SortedTables() {
+			for idx, example := range table.Examples {
+				name := table.Name
+				if idx > 0 {
+					name = fmt.Sprintf("%s_%d", table.Name, idx+1)
+				}
+				if _, exists := p.Queries[name]; exists {
+					continue
+				}
+				p.Queries[name] = &pack.Query{
+					Name:        name,
+					SQL:         example,
+					Description: fmt.Sprintf("Example query of the %s table.", table.Name),
+				}
+			}
+		}
+	}
+	return p
+}
+
+// lintErrors returns the messages of the error severity findings.
+func lintErrors(findings []*query.Finding) []string {
+	errs := []string{}
+	for _, f := range findings {
+		if f.Severity == query.SeverityError {
+			errs = append(errs, fmt.Sprintf("%d:%d: %s", f.Line, f.Column, f.Message))
+		}
+	}
+	return errs
+}
+
+// queryPlatforms returns the platforms that have every osquery table sql queries, in sorted order. A table is
+// available on a platform when any namespace defining it applies to that platform.
+func queryPlatforms(parser *osqt.Parser, sql string) ([]string, error) {
+	stmt, err := query.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms := []string{}
+	tables := map[string]map[string]*osqt.Table{}
+	for goos := range osqt.GOOSToApplicableNamespaces {
+		platforms = append(platforms, goos)
+		tables[goos] = parser.TablesFor(goos)
+	}
+	sort.Strings(platforms)
+
+	for _, ref := range stmt.Tables {
+		if ref.Derived || ref.CTE {
+			continue
+		}
+		available := []string{}
+		for _, goos := range platforms {
+			if _, ok := tables[goos][strings.ToLower(ref.Name)]; ok {
+				available = append(available, goos)
+			}
+		}
+		platforms = available
+	}
+	return platforms, nil
+}
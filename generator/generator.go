@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"context"
+	"path"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Generator produces a set of output files from a parsed schema.
+type Generator interface {
+	// Name is the unique identifier the generator is registered under.
+	Name() string
+
+	// Description is a short, human readable summary of what the generator produces.
+	Description() string
+
+	// Generate writes the generator's artifacts to job.Output. Implementations must return promptly
+	// with ctx.Err() once the context is cancelled.
+	Generate(ctx context.Context, job *Job) error
+}
+
+// Job carries the inputs and output destination of a single generator run.
+type Job struct {
+	Parser *osqt.Parser
+	Output *Output
+	Params map[string]string
+	Logger *zap.SugaredLogger
+}
+
+// Param returns the named generator parameter, or def if it was not provided.
+func (j *Job) Param(name, def string) string {
+	if val, ok := j.Params[name]; ok && val != "" {
+		return val
+	}
+	return def
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Generator{}
+)
+
+// Register adds a generator to the registry. It returns an error if the name is already taken.
+func Register(g Generator) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[g.Name()]; exists {
+		return xerrors.Errorf("a generator named %s is already registered", g.Name())
+	}
+	registry[g.Name()] = g
+	return nil
+}
+
+// MustRegister is Register, but panics on error.
+func MustRegister(g Generator) {
+	if err := Register(g); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the generator registered under name.
+func Lookup(name string) (Generator, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	g, ok := registry[name]
+	return g, ok
+}
+
+// Names returns the names of all registered generators in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run executes a generator against parser, writing into dest. Output is staged in a temporary directory and only
+// moved into dest once the generator succeeds, so a cancelled or failed run never leaves a half-written tree behind.
+func Run(ctx context.Context, g Generator, parser *osqt.Parser, dest string, params map[string]string, logger *zap.SugaredLogger) (err error) {
+	ctx, span := osqt.Tracer().Start(ctx, "generator.Run", trace.WithAttributes(
+		attribute.String("osqt.generator", g.Name()),
+		attribute.String("osqt.output_dir", dest),
+	))
+	defer func() { osqt.EndSpan(span, err) }()
+
+	if logger == nil {
+		logger = zap.L().Sugar().Named("generator")
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	out, err := NewOutput(dest)
+	if err != nil {
+		return err
+	}
+
+	job := &Job{
+		Parser: parser,
+		Output: out,
+		Params: params,
+		Logger: logger.Named(g.Name()),
+	}
+
+	if err := g.Generate(ctx, job); err != nil {
+		if aerr := out.Abort(); aerr != nil {
+			logger.Warnw("Error cleaning up staged output", "dir", out.staging, "error", aerr)
+		}
+		return xerrors.Errorf("%s generator failed: %w", g.Name(), err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.Abort()
+		return err
+	}
+
+	return out.Commit()
+}
+
+// tablePath returns the slash-separated path of the page of a table in the namespace with key nsKey, relative to
+// the directory a generator writes its per-table pages under. Generators write pages and link to them with it.
+func tablePath(nsKey, table, ext string) string {
+	return path.Join(nsKey, table+ext)
+}
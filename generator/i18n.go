@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt"
+)
+
+// defaultLabels are the English strings used for headings in generated documentation.
+var defaultLabels = map[string]string{
+	"tables":           "OSQuery Tables",
+	"column":           "Column",
+	"type":             "Type",
+	"description":      "Description",
+	"platform_columns": "columns",
+	"examples":         "Examples",
+	"json_fields":      "JSON fields",
+	"path":             "Path",
+}
+
+// Translation is a per-locale overlay of table and column descriptions, plus the headings used by generated
+// documentation. Anything not present in the overlay falls back to the English text from the specs.
+type Translation struct {
+	Locale string                       `json:"locale,omitempty" yaml:"locale,omitempty"`
+	Labels map[string]string            `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Tables map[string]*TableTranslation `json:"tables,omitempty" yaml:"tables,omitempty"`
+}
+
+// TableTranslation holds the translated descriptions for a single table and its columns.
+type TableTranslation struct {
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Columns     map[string]string `json:"columns,omitempty" yaml:"columns,omitempty"`
+}
+
+// LoadTranslation reads the overlay for locale from dir, which must contain a <locale>.yaml or <locale>.yml file.
+func LoadTranslation(dir, locale string) (*Translation, error) {
+	for _, ext := range []string{".yaml", ".yml"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, locale+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t := &Translation{}
+		if err := yaml.Unmarshal(data, t); err != nil {
+			return nil, xerrors.Errorf("error parsing %s translations: %v", locale, err)
+		}
+		if t.Locale == "" {
+			t.Locale = locale
+		}
+		return t, nil
+	}
+
+	return nil, xerrors.Errorf("no translations for locale %s found in %s", locale, dir)
+}
+
+// Label returns the translated heading for key, falling back to English. It is safe to call on a nil Translation.
+func (t *Translation) Label(key string) string {
+	if t != nil {
+		if val, ok := t.Labels[key]; ok && val != "" {
+			return val
+		}
+	}
+	return defaultLabels[key]
+}
+
+// Localize returns a copy of tbl with its descriptions replaced by their translations, and the number of
+// descriptions that had no translation. tbl itself is not modified. It is safe to call on a nil Translation.
+func (t *Translation) Localize(tbl *osqt.Table) (*osqt.Table, int) {
+	var tt *TableTranslation
+	if t != nil {
+		tt = t.Tables[tbl.Name]
+	}
+
+	missing := 0
+	localized := osqt.NewEmptyTable()
+	localized.Namespace = tbl.Namespace
+	localized.NamespaceID = tbl.NamespaceID
+	localized.Name = tbl.Name
+	localized.Aliases = tbl.Aliases
+	localized.Description = tbl.Description
+	localized.Deprecated = tbl.Deprecated
+	localized.Attributes = tbl.Attributes
+	localized.Implementation = tbl.Implementation
+	localized.Generator = tbl.Generator
+	localized.FuzzPaths = tbl.FuzzPaths
+	localized.Examples = tbl.Examples
+	if tt != nil && tt.Description != "" {
+		localized.Description = tt.Description
+	} else if tbl.Description != "" {
+		missing++
+	}
+
+	localizeSchema := func(s *osqt.Schema) *osqt.Schema {
+		if s == nil {
+			return nil
+		}
+		copied := osqt.NewEmptySchema(localized)
+		copied.Platforms = s.Platforms
+		copied.Extended = s.Extended
+		copied.ForeignKeys = s.ForeignKeys
+		for _, col := range s.Columns {
+			c := *col
+			if tt != nil && tt.Columns[col.Name] != "" {
+				c.Description = tt.Columns[col.Name]
+			} else if col.Description != "" {
+				missing++
+			}
+			copied.Columns = append(copied.Columns, &c)
+		}
+		return copied
+	}
+
+	localized.Schema = localizeSchema(tbl.Schema)
+	for platform, s := range tbl.ExtendedSchemas {
+		localized.ExtendedSchemas[platform] = localizeSchema(s)
+	}
+
+	return localized, missing
+}
@@ -0,0 +1,183 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Output stages the files written by a generator and moves them into their destination on Commit.
+type Output struct {
+	dest    string
+	staging string
+	files   map[string]bool
+}
+
+// NewOutput creates a staging directory alongside dest so that committed files can be renamed into place.
+func NewOutput(dest string) (*Output, error) {
+	dest = filepath.Clean(dest)
+	parent := filepath.Dir(dest)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, xerrors.Errorf("error creating output parent directory: %v", err)
+	}
+
+	staging, err := ioutil.TempDir(parent, ".osqt-staging-")
+	if err != nil {
+		return nil, xerrors.Errorf("error creating staging directory: %v", err)
+	}
+
+	return &Output{
+		dest:    dest,
+		staging: staging,
+		files:   map[string]bool{},
+	}, nil
+}
+
+// Dest returns the directory the output will be committed to.
+func (o *Output) Dest() string {
+	return o.dest
+}
+
+// WriteFile stages a file at the given slash-separated path relative to the output directory.
+func (o *Output) WriteFile(ctx context.Context, rel string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return xerrors.Errorf("output path %s escapes the output directory", rel)
+	}
+
+	fileloc := filepath.Join(o.staging, clean)
+	if err := os.MkdirAll(filepath.Dir(fileloc), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fileloc, data, 0644); err != nil {
+		return err
+	}
+
+	o.files[filepath.ToSlash(clean)] = true
+	return nil
+}
+
+// Files returns the staged file paths in sorted order.
+func (o *Output) Files() []string {
+	files := make([]string, 0, len(o.files))
+	for rel := range o.files {
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// OutputManifest is the file, within the destination directory, listing the files the last committed run wrote.
+// Commit reads it to remove the files a previous run wrote that the current one did not.
+const OutputManifest = ".osqt-output"
+
+// Commit moves every staged file into the destination directory and removes the staging directory. Files the
+// previous run listed in its OutputManifest that this run did not write are removed, along with any directories
+// that leaves empty; every other file in dest, such as human-authored pages, is left alone.
+func (o *Output) Commit() error {
+	defer os.RemoveAll(o.staging)
+
+	files := o.Files()
+	manifest := []byte(strings.Join(files, "\n") + "\n")
+	if len(files) == 0 {
+		manifest = []byte{}
+	}
+	if err := ioutil.WriteFile(filepath.Join(o.staging, OutputManifest), manifest, 0644); err != nil {
+		return xerrors.Errorf("error writing output manifest: %v", err)
+	}
+
+	// when the destination does not exist yet, the whole tree can be moved in with one rename
+	info, err := os.Stat(o.dest)
+	if os.IsNotExist(err) {
+		// ioutil.TempDir creates the staging directory accessible only to its owner
+		if err := os.Chmod(o.staging, 0755); err != nil {
+			return err
+		}
+		return os.Rename(o.staging, o.dest)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return xerrors.Errorf("output destination %s is not a directory", o.dest)
+	}
+
+	previous, err := o.readManifest()
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range append(files, OutputManifest) {
+		target := filepath.Join(o.dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(o.staging, filepath.FromSlash(rel)), target); err != nil {
+			return xerrors.Errorf("error moving %s into place: %v", rel, err)
+		}
+	}
+
+	for _, rel := range previous {
+		if o.files[rel] {
+			continue
+		}
+		if err := o.removeStale(rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readManifest returns the files listed in the OutputManifest of the destination directory, if it has one. Entries
+// that do not name a file within the directory are ignored.
+func (o *Output) readManifest() ([]string, error) {
+	data, err := o.ReadExisting(OutputManifest)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading output manifest: %v", err)
+	}
+
+	files := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		rel := strings.TrimSpace(line)
+		if rel == "" {
+			continue
+		}
+		clean := filepath.Clean(filepath.FromSlash(rel))
+		if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			continue
+		}
+		files = append(files, filepath.ToSlash(clean))
+	}
+	return files, nil
+}
+
+// removeStale removes a file written by a previous run, and then each parent directory it leaves empty.
+func (o *Output) removeStale(rel string) error {
+	target := filepath.Join(o.dest, filepath.FromSlash(rel))
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("error removing stale output %s: %v", rel, err)
+	}
+
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		// Remove fails on a directory that still holds anything, which ends the walk up
+		if err := os.Remove(filepath.Join(o.dest, filepath.FromSlash(dir))); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Abort discards all staged files.
+func (o *Output) Abort() error {
+	return os.RemoveAll(o.staging)
+}
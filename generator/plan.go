@@ -0,0 +1,228 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// MaxDiffSize is the largest file (in bytes) that FileChange will compute a text diff for.
+const MaxDiffSize = 64 * 1024
+
+// FileAction describes what writing a file would do to the destination.
+type FileAction string
+
+const (
+	// FileCreate means the file does not exist yet.
+	FileCreate FileAction = "create"
+
+	// FileModify means the file exists with different contents.
+	FileModify FileAction = "modify"
+
+	// FileUnchanged means the file exists with identical contents.
+	FileUnchanged FileAction = "unchanged"
+
+	// FileDelete means the file exists but would not be written, so committing removes it.
+	FileDelete FileAction = "delete"
+)
+
+// FileChange is a planned write to a single file.
+type FileChange struct {
+	Path    string     `json:"path" yaml:"path"`
+	Action  FileAction `json:"action" yaml:"action"`
+	OldSize int64      `json:"old_size" yaml:"old_size"`
+	NewSize int64      `json:"new_size" yaml:"new_size"`
+	Diff    string     `json:"diff,omitempty" yaml:"diff,omitempty"`
+}
+
+// String implements the fmt.Stringer interface.
+func (f *FileChange) String() string {
+	switch f.Action {
+	case FileCreate:
+		return fmt.Sprintf("create    %s (%d bytes)", f.Path, f.NewSize)
+	case FileModify:
+		return fmt.Sprintf("modify    %s (%d -> %d bytes)", f.Path, f.OldSize, f.NewSize)
+	case FileDelete:
+		return fmt.Sprintf("delete    %s (%d bytes)", f.Path, f.OldSize)
+	default:
+		return fmt.Sprintf("unchanged %s", f.Path)
+	}
+}
+
+// PlanFile determines what writing data to fileloc would do without touching the filesystem.
+func PlanFile(fileloc string, data []byte) (*FileChange, error) {
+	change := &FileChange{
+		Path:    fileloc,
+		Action:  FileCreate,
+		NewSize: int64(len(data)),
+	}
+
+	existing, err := ioutil.ReadFile(fileloc)
+	if os.IsNotExist(err) {
+		return change, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	change.OldSize = int64(len(existing))
+	if bytes.Equal(existing, data) {
+		change.Action = FileUnchanged
+		return change, nil
+	}
+
+	change.Action = FileModify
+	if isSmallText(existing) && isSmallText(data) {
+		change.Diff = LineDiff(string(existing), string(data))
+	}
+	return change, nil
+}
+
+// Plan runs a generator into a staging directory and reports the changes committing it would make to dest,
+// ordered by path. Files the previous run listed in the OutputManifest of dest that the generator did not write
+// are reported as deleted, as Commit removes them. The staged output is always discarded.
+func Plan(ctx context.Context, g Generator, parser *osqt.Parser, dest string, params map[string]string, logger *zap.SugaredLogger) ([]*FileChange, error) {
+	if logger == nil {
+		logger = zap.L().Sugar().Named("generator")
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	// stage in the system temp directory so that planning never creates anything next to dest
+	staging, err := ioutil.TempDir("", ".osqt-plan-")
+	if err != nil {
+		return nil, xerrors.Errorf("error creating staging directory: %v", err)
+	}
+	out := &Output{
+		dest:    filepath.Clean(dest),
+		staging: staging,
+		files:   map[string]bool{},
+	}
+	defer out.Abort()
+
+	job := &Job{
+		Parser: parser,
+		Output: out,
+		Params: params,
+		Logger: logger.Named(g.Name()),
+	}
+	if err := g.Generate(ctx, job); err != nil {
+		return nil, err
+	}
+
+	changes := []*FileChange{}
+	for _, rel := range out.Files() {
+		data, err := ioutil.ReadFile(filepath.Join(out.staging, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		change, err := PlanFile(filepath.Join(dest, filepath.FromSlash(rel)), data)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	previous, err := out.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range previous {
+		if out.files[rel] {
+			continue
+		}
+		fileloc := filepath.Join(dest, filepath.FromSlash(rel))
+		info, err := os.Stat(fileloc)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &FileChange{Path: fileloc, Action: FileDelete, OldSize: info.Size()})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func isSmallText(data []byte) bool {
+	return len(data) <= MaxDiffSize && utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// LineDiff returns a minimal line-based diff of a and b, with removed lines prefixed by "-" and added lines by "+".
+// Runs of unchanged lines are elided down to a single line of context on either side.
+func LineDiff(a, b string) string {
+	al := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	bl := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] holds the length of the longest common subsequence of al[i:] and bl[j:]
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	lines := []line{}
+	i, j := 0, 0
+	for i < len(al) || j < len(bl) {
+		switch {
+		case i < len(al) && j < len(bl) && al[i] == bl[j]:
+			lines = append(lines, line{' ', al[i]})
+			i++
+			j++
+		case i < len(al) && (j == len(bl) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', al[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', bl[j]})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	skipped := false
+	for idx, l := range lines {
+		if l.op == ' ' {
+			near := (idx > 0 && lines[idx-1].op != ' ') || (idx+1 < len(lines) && lines[idx+1].op != ' ')
+			if !near {
+				if !skipped {
+					sb.WriteString("...\n")
+					skipped = true
+				}
+				continue
+			}
+		}
+		skipped = false
+		sb.WriteByte(l.op)
+		sb.WriteString(l.text)
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,145 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegister(&referenceGenerator{})
+}
+
+// referenceWidth is the column plain-text reference output is wrapped at.
+const referenceWidth = 78
+
+// referenceGenerator renders the schema as a single linear document. The text format avoids tables and box drawing
+// entirely and uses the same heading structure for every entry, so it reads well in a pager and with a screen reader.
+type referenceGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *referenceGenerator) Name() string {
+	return "reference"
+}
+
+// Description implements the Generator interface.
+func (g *referenceGenerator) Description() string {
+	return "Single-file schema reference in a screen reader and pager friendly plain-text format."
+}
+
+// Generate implements the Generator interface.
+func (g *referenceGenerator) Generate(ctx context.Context, job *Job) error {
+	format := job.Param("format", "text")
+	if format != "text" {
+		return xerrors.Errorf("unsupported reference format %q (options: 'text')", format)
+	}
+
+	buf := new(bytes.Buffer)
+	writeHeading(buf, "OSQuery Table Reference", "=")
+	count := 0
+	for _, ns := range job.Parser.SortedNamespaces() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tables := ns.SortedTables()
+		writeHeading(buf, fmt.Sprintf("Namespace %s: %s (%d tables)", ns.Key, ns.Name, len(tables)), "-")
+		for _, table := range tables {
+			writeReferenceTable(buf, table)
+			count++
+		}
+	}
+
+	job.Logger.Debugf("Rendered %d tables.", count)
+	return job.Output.WriteFile(ctx, job.Param("file", "reference.txt"), buf.Bytes())
+}
+
+func writeHeading(buf *bytes.Buffer, title, underline string) {
+	fmt.Fprintf(buf, "%s\n%s\n\n", title, strings.Repeat(underline, len([]rune(title))))
+}
+
+func writeReferenceTable(buf *bytes.Buffer, table *osqt.Table) {
+	fmt.Fprintf(buf, "Table %s\n\n", table.Name)
+	writeWrapped(buf, "  ", "Description: "+table.Description)
+	if table.Notes != "" {
+		writeWrapped(buf, "  ", "Notes: "+table.Notes)
+	}
+	if len(table.Aliases) > 0 {
+		writeWrapped(buf, "  ", "Aliases: "+strings.Join(table.Aliases, ", "))
+	}
+	buf.WriteString("\n")
+
+	if table.Schema != nil {
+		writeReferenceColumns(buf, "Columns", table.Schema.Columns)
+	}
+
+	for _, platform := range table.SortedPlatforms() {
+		writeReferenceColumns(buf, fmt.Sprintf("Additional columns on %s", platform), table.ExtendedSchemas[platform].Columns)
+	}
+
+	if len(table.Examples) > 0 {
+		fmt.Fprintf(buf, "  Examples (%d):\n\n", len(table.Examples))
+		for idx, example := range table.Examples {
+			writeWrapped(buf, "      ", fmt.Sprintf("Example %d: %s", idx+1, strings.Join(strings.Fields(example), " ")))
+		}
+		buf.WriteString("\n")
+	}
+
+	buf.WriteString("End of table " + table.Name + ".\n\n")
+}
+
+func writeReferenceColumns(buf *bytes.Buffer, title string, columns []*osqt.Column) {
+	fmt.Fprintf(buf, "  %s (%d):\n\n", title, len(columns))
+	for idx, col := range columns {
+		fmt.Fprintf(buf, "    %d. %s\n", idx+1, col.Name)
+		typ := "Type: " + col.Type
+		if ct, ok := col.ColumnType(); ok && ct.Description != "" {
+			typ += " (" + ct.Description + ")"
+		}
+		writeWrapped(buf, "      ", typ)
+		if col.Description != "" {
+			writeWrapped(buf, "      ", "Description: "+col.Description)
+		}
+		if col.Notes != "" {
+			writeWrapped(buf, "      ", "Notes: "+col.Notes)
+		}
+		if opts := columnFlags(col); len(opts) > 0 {
+			writeWrapped(buf, "      ", "Options: "+strings.Join(opts, ", "))
+		}
+		buf.WriteString("\n")
+	}
+}
+
+// columnFlags returns the names of the boolean options that are set on col, in sorted order.
+func columnFlags(col *osqt.Column) []string {
+	flags := []string{}
+	for key, val := range col.Options {
+		if strings.EqualFold(fmt.Sprintf("%v", val), "true") {
+			flags = append(flags, key)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// writeWrapped writes text word wrapped to referenceWidth, with every line prefixed by indent.
+func writeWrapped(buf *bytes.Buffer, indent, text string) {
+	line := indent
+	for _, word := range strings.Fields(text) {
+		if len(line) > len(indent) && len(line)+1+len(word) > referenceWidth {
+			buf.WriteString(line + "\n")
+			line = indent
+		}
+		if len(line) > len(indent) {
+			line += " "
+		}
+		line += word
+	}
+	buf.WriteString(line + "\n")
+}
@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	regionBeginRegexp = regexp.MustCompile(`<!-- osqt:begin (\S+) -->`)
+	regionEndRegexp   = regexp.MustCompile(`<!-- osqt:end (\S+) -->`)
+)
+
+// ManagedRegion wraps body in the markers that identify it as owned by osqt. When a file containing the region is
+// regenerated, only the content between the markers is replaced.
+func ManagedRegion(id, body string) string {
+	return fmt.Sprintf("<!-- osqt:begin %s -->\n%s\n<!-- osqt:end %s -->\n", id, strings.TrimRight(body, "\n"), id)
+}
+
+// region is the location of a managed region within a document, including its markers.
+type region struct {
+	id         string
+	start, end int
+}
+
+// findRegions locates every managed region in data, returning an error if the markers are unbalanced.
+func findRegions(data []byte) ([]*region, error) {
+	begins := regionBeginRegexp.FindAllSubmatchIndex(data, -1)
+	ends := regionEndRegexp.FindAllSubmatchIndex(data, -1)
+	if len(begins) != len(ends) {
+		return nil, xerrors.Errorf("found %d osqt:begin markers but %d osqt:end markers", len(begins), len(ends))
+	}
+
+	regions := []*region{}
+	seen := map[string]bool{}
+	for idx, begin := range begins {
+		end := ends[idx]
+		id := string(data[begin[2]:begin[3]])
+		if endID := string(data[end[2]:end[3]]); endID != id {
+			return nil, xerrors.Errorf("managed region %s is closed by an osqt:end marker for %s", id, endID)
+		}
+		if end[0] < begin[1] || (idx+1 < len(begins) && begins[idx+1][0] < end[1]) {
+			return nil, xerrors.Errorf("managed region %s is not properly closed", id)
+		}
+		if seen[id] {
+			return nil, xerrors.Errorf("managed region %s appears more than once", id)
+		}
+		seen[id] = true
+
+		stop := end[1]
+		if stop < len(data) && data[stop] == '\n' {
+			stop++
+		}
+		regions = append(regions, &region{id: id, start: begin[0], end: stop})
+	}
+
+	return regions, nil
+}
+
+// MergeManagedRegions replaces the managed regions in existing with the regions of the same name in generated,
+// leaving all other content untouched. Regions that do not exist in existing yet are appended to the end.
+func MergeManagedRegions(existing, generated []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(existing)) == 0 {
+		return generated, nil
+	}
+
+	current, err := findRegions(existing)
+	if err != nil {
+		return nil, xerrors.Errorf("existing document: %v", err)
+	}
+	updated, err := findRegions(generated)
+	if err != nil {
+		return nil, xerrors.Errorf("generated document: %v", err)
+	}
+
+	replacements := map[string][]byte{}
+	for _, r := range updated {
+		replacements[r.id] = generated[r.start:r.end]
+	}
+
+	out := new(bytes.Buffer)
+	last := 0
+	for _, r := range current {
+		out.Write(existing[last:r.start])
+		if block, ok := replacements[r.id]; ok {
+			out.Write(block)
+			delete(replacements, r.id)
+		} else {
+			out.Write(existing[r.start:r.end])
+		}
+		last = r.end
+	}
+	out.Write(existing[last:])
+
+	for _, r := range updated {
+		block, ok := replacements[r.id]
+		if !ok {
+			continue
+		}
+		if !bytes.HasSuffix(out.Bytes(), []byte("\n\n")) {
+			if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+				out.WriteByte('\n')
+			}
+			out.WriteByte('\n')
+		}
+		out.Write(block)
+	}
+
+	return out.Bytes(), nil
+}
+
+// ReadExisting returns the current contents of a file in the destination directory, or nil if it does not exist.
+func (o *Output) ReadExisting(rel string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(o.dest, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// WriteManagedFile stages data for rel after merging its managed regions into any existing file at that path,
+// so that content written by people around the regions survives regeneration.
+func (o *Output) WriteManagedFile(ctx context.Context, rel string, data []byte) error {
+	existing, err := o.ReadExisting(rel)
+	if err != nil {
+		return err
+	}
+
+	merged, err := MergeManagedRegions(existing, data)
+	if err != nil {
+		return xerrors.Errorf("error merging managed regions into %s: %v", rel, err)
+	}
+
+	return o.WriteFile(ctx, rel, merged)
+}
@@ -0,0 +1,111 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegister(&sigmaFieldsGenerator{})
+}
+
+// sigmaFields is the field list of a table, for the Sigma rules of the logsource querying it.
+type sigmaFields struct {
+	LogSource *sigmaLogSource `yaml:"logsource"`
+	// Fields are the columns the table has on every platform, and PlatformFields those it only has on some.
+	Fields         []string            `yaml:"fields"`
+	PlatformFields map[string][]string `yaml:"platform_fields,omitempty"`
+	// Aliases maps the column aliases rules may use as fields to the columns they name.
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+}
+
+// sigmaLogSource is the logsource of a Sigma rule.
+type sigmaLogSource struct {
+	Product string `yaml:"product"`
+	Service string `yaml:"service"`
+}
+
+// sigmaFieldsGenerator renders the fields rules may use for the logsource of each table. Sigma osquery backends
+// translate a rule's logsource to the table it queries, with product osquery and the table as the service, and
+// its fields to the table's columns by name, so the fields are the column names as the spec declares them.
+type sigmaFieldsGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *sigmaFieldsGenerator) Name() string {
+	return "sigma-fields"
+}
+
+// Description implements the Generator interface.
+func (g *sigmaFieldsGenerator) Description() string {
+	return "Sigma logsource field lists of the columns rules may use for each table."
+}
+
+// Generate implements the Generator interface.
+func (g *sigmaFieldsGenerator) Generate(ctx context.Context, job *Job) error {
+	product := job.Param("product", "osquery")
+
+	count := 0
+	for _, ns := range job.Parser.SortedNamespaces() {
+		for _, table := range ns.SortedTables() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			data, err := sigmaFieldList(table, product)
+			if err != nil {
+				return xerrors.Errorf("error rendering Sigma fields of %s: %v", table.Name, err)
+			}
+			if err := job.Output.WriteFile(ctx, table.Name+".yml", data); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+
+	job.Logger.Debugf("Rendered Sigma fields of %d tables.", count)
+	return nil
+}
+
+// sigmaFieldList renders the field list of table for the logsource of product.
+func sigmaFieldList(table *osqt.Table, product string) ([]byte, error) {
+	fields := &sigmaFields{
+		LogSource:      &sigmaLogSource{Product: product, Service: table.Name},
+		Fields:         []string{},
+		PlatformFields: map[string][]string{},
+		Aliases:        map[string]string{},
+	}
+
+	addAliases := func(col *osqt.Column) {
+		for _, alias := range col.Aliases {
+			fields.Aliases[alias] = col.Name
+		}
+	}
+	if table.Schema != nil {
+		for _, col := range table.Schema.Columns {
+			fields.Fields = append(fields.Fields, col.Name)
+			addAliases(col)
+		}
+	}
+	for _, platform := range table.SortedPlatforms() {
+		for _, col := range table.ExtendedSchemas[platform].Columns {
+			fields.PlatformFields[platform] = append(fields.PlatformFields[platform], col.Name)
+			addAliases(col)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("# Generated by osqt from the osquery schema.\n")
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(fields); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"path"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegister(&siteGenerator{})
+}
+
+var siteIndexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{"tablepath": tablePath}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>OSQuery Tables</title></head>
+<body>
+<h1>OSQuery Tables</h1>
+{{range $ns := .}}<h2>{{.Name}} ({{.Key}})</h2>
+<ul>
+{{range .Tables}}<li><a href="tables/{{tablepath $ns.Key .Name ".html"}}">{{.Name}}</a> - {{.Description}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+var siteTableTemplate = template.Must(template.New("table").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}}</title></head>
+<body>
+<p><a href="../../index.html">All tables</a></p>
+<h1>{{.Name}}</h1>
+<p>{{.Description}}</p>
+{{if .Schema}}<table>
+<tr><th>Column</th><th>Type</th><th>Description</th></tr>
+{{range .Schema.Columns}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{end}}{{range $platform, $schema := .ExtendedSchemas}}<h2>{{$platform}} columns</h2>
+<table>
+<tr><th>Column</th><th>Type</th><th>Description</th></tr>
+{{range $schema.Columns}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Examples}}<h2>Examples</h2>
+{{range .Examples}}<pre>{{.}}</pre>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// siteIndexEntry is a namespace as rendered on the site index.
+type siteIndexEntry struct {
+	Key    string
+	Name   string
+	Tables []*osqt.Table
+}
+
+// siteGenerator renders a static HTML site with an index and one page per table.
+type siteGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *siteGenerator) Name() string {
+	return "site"
+}
+
+// Description implements the Generator interface.
+func (g *siteGenerator) Description() string {
+	return "Static HTML documentation site with one page per table."
+}
+
+// Generate implements the Generator interface.
+func (g *siteGenerator) Generate(ctx context.Context, job *Job) error {
+	index := []*siteIndexEntry{}
+	for _, ns := range job.Parser.SortedNamespaces() {
+		entry := &siteIndexEntry{Key: ns.Key, Name: ns.Name, Tables: ns.SortedTables()}
+		for _, table := range entry.Tables {
+			buf := new(bytes.Buffer)
+			if err := siteTableTemplate.Execute(buf, table); err != nil {
+				return err
+			}
+			if err := job.Output.WriteFile(ctx, path.Join("tables", tablePath(ns.Key, table.Name, ".html")), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		index = append(index, entry)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := siteIndexTemplate.Execute(buf, index); err != nil {
+		return err
+	}
+
+	job.Logger.Debugf("Rendered %d namespaces.", len(index))
+	return job.Output.WriteFile(ctx, "index.html", buf.Bytes())
+}
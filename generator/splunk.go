@@ -0,0 +1,320 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt/query"
+)
+
+func init() {
+	MustRegister(&splunkGenerator{})
+}
+
+// SplunkMapping maps the results of osquery tables to the data models of the Splunk Common Information Model.
+type SplunkMapping struct {
+	Tables map[string]*SplunkTableMapping `json:"tables,omitempty" yaml:"tables,omitempty"`
+}
+
+// SplunkTableMapping maps the results of a table to a CIM data model. Fields maps the table's columns to the CIM
+// fields they are aliased as; an empty field leaves a column unaliased, so mapping files can drop the aliases of
+// the defaults. Tags are the tags the data model's constraints search for.
+type SplunkTableMapping struct {
+	DataModel string            `json:"datamodel,omitempty" yaml:"datamodel,omitempty"`
+	Tags      []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// defaultSplunkTables are the bundled CIM mappings of the osquery tables feeding the Endpoint and Network Traffic
+// data models.
+var defaultSplunkTables = map[string]*SplunkTableMapping{
+	"processes": {
+		DataModel: "Endpoint.Processes",
+		Tags:      []string{"process", "report"},
+		Fields: map[string]string{
+			"pid":     "process_id",
+			"parent":  "parent_process_id",
+			"name":    "process_name",
+			"path":    "process_path",
+			"cmdline": "process",
+			"cwd":     "process_current_directory",
+			"uid":     "user_id",
+		},
+	},
+	"process_events": {
+		DataModel: "Endpoint.Processes",
+		Tags:      []string{"process", "report"},
+		Fields: map[string]string{
+			"pid":     "process_id",
+			"parent":  "parent_process_id",
+			"path":    "process_path",
+			"cmdline": "process",
+			"cwd":     "process_current_directory",
+			"uid":     "user_id",
+		},
+	},
+	"listening_ports": {
+		DataModel: "Endpoint.Ports",
+		Tags:      []string{"listening", "port"},
+		Fields: map[string]string{
+			"pid":     "process_id",
+			"port":    "dest_port",
+			"address": "dest",
+		},
+	},
+	"process_open_sockets": {
+		DataModel: "Network_Traffic.All_Traffic",
+		Tags:      []string{"network", "communicate"},
+		Fields: map[string]string{
+			"pid":            "process_id",
+			"local_address":  "src_ip",
+			"local_port":     "src_port",
+			"remote_address": "dest_ip",
+			"remote_port":    "dest_port",
+		},
+	},
+	"socket_events": {
+		DataModel: "Network_Traffic.All_Traffic",
+		Tags:      []string{"network", "communicate"},
+		Fields: map[string]string{
+			"pid":            "process_id",
+			"local_address":  "src_ip",
+			"local_port":     "src_port",
+			"remote_address": "dest_ip",
+			"remote_port":    "dest_port",
+		},
+	},
+	"file": {
+		DataModel: "Endpoint.Filesystem",
+		Tags:      []string{"endpoint", "filesystem"},
+		Fields: map[string]string{
+			"path":     "file_path",
+			"filename": "file_name",
+			"size":     "file_size",
+			"atime":    "file_access_time",
+			"mtime":    "file_modify_time",
+			"btime":    "file_create_time",
+		},
+	},
+	"file_events": {
+		DataModel: "Endpoint.Filesystem",
+		Tags:      []string{"endpoint", "filesystem"},
+		Fields: map[string]string{
+			"target_path": "file_path",
+			"action":      "action",
+			"size":        "file_size",
+			"mtime":       "file_modify_time",
+			"sha256":      "file_hash",
+		},
+	},
+	"hash": {
+		DataModel: "Endpoint.Filesystem",
+		Tags:      []string{"endpoint", "filesystem"},
+		Fields: map[string]string{
+			"path":   "file_path",
+			"sha256": "file_hash",
+		},
+	},
+	"services": {
+		DataModel: "Endpoint.Services",
+		Tags:      []string{"service", "report"},
+		Fields: map[string]string{
+			"name":         "service_name",
+			"path":         "service_path",
+			"start_type":   "start_mode",
+			"status":       "status",
+			"user_account": "user",
+		},
+	},
+	"systemd_units": {
+		DataModel: "Endpoint.Services",
+		Tags:      []string{"service", "report"},
+		Fields: map[string]string{
+			"id":            "service_name",
+			"fragment_path": "service_path",
+			"active_state":  "status",
+			"user":          "user",
+		},
+	},
+	"launchd": {
+		DataModel: "Endpoint.Services",
+		Tags:      []string{"service", "report"},
+		Fields: map[string]string{
+			"label":    "service_name",
+			"program":  "service_path",
+			"username": "user",
+		},
+	},
+}
+
+// DefaultSplunkMapping returns a copy of the bundled CIM mapping of the common osquery tables.
+func DefaultSplunkMapping() *SplunkMapping {
+	m := &SplunkMapping{}
+	m.Merge(&SplunkMapping{Tables: defaultSplunkTables})
+	return m
+}
+
+// LoadSplunkMapping returns the bundled CIM mapping overridden by the JSON or YAML mapping file fileloc.
+func LoadSplunkMapping(fileloc string) (*SplunkMapping, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	override := &SplunkMapping{}
+	switch filepath.Ext(fileloc) {
+	case ".json":
+		err = json.Unmarshal(data, override)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, override)
+	default:
+		return nil, xerrors.Errorf("unsupported Splunk mapping file extension for %s (expected .json or .yaml)", fileloc)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing Splunk mapping %s: %v", fileloc, err)
+	}
+
+	m := DefaultSplunkMapping()
+	m.Merge(override)
+	return m, nil
+}
+
+// Merge copies the mappings of other into m. The data model and tags of a table are replaced when other sets
+// them, and its fields merged.
+func (m *SplunkMapping) Merge(other *SplunkMapping) {
+	if m.Tables == nil {
+		m.Tables = map[string]*SplunkTableMapping{}
+	}
+	for table, tm := range other.Tables {
+		if tm == nil {
+			continue
+		}
+		existing, ok := m.Tables[table]
+		if !ok {
+			existing = &SplunkTableMapping{Fields: map[string]string{}}
+			m.Tables[table] = existing
+		}
+		if tm.DataModel != "" {
+			existing.DataModel = tm.DataModel
+		}
+		if tm.Tags != nil {
+			existing.Tags = append([]string{}, tm.Tags...)
+		}
+		for col, field := range tm.Fields {
+			existing.Fields[col] = field
+		}
+	}
+}
+
+// splunkGenerator renders a Splunk app's props.conf, eventtypes.conf and tags.conf, aliasing the columns of
+// osquery results to the fields of CIM data models and tagging them so the data models' searches find them.
+type splunkGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *splunkGenerator) Name() string {
+	return "splunk"
+}
+
+// Description implements the Generator interface.
+func (g *splunkGenerator) Description() string {
+	return "Splunk props, eventtypes and tags mapping osquery results to CIM data models."
+}
+
+// Generate implements the Generator interface.
+func (g *splunkGenerator) Generate(ctx context.Context, job *Job) error {
+	mapping := DefaultSplunkMapping()
+	if path := job.Param("mapping", ""); path != "" {
+		var err error
+		if mapping, err = LoadSplunkMapping(path); err != nil {
+			return err
+		}
+	}
+	sourcetype := job.Param("sourcetype", "osquery:results")
+	queryName := job.Param("query-name", "{table}")
+	prefix := job.Param("field-prefix", "columns.")
+
+	props, eventtypes, tags := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	for _, buf := range []*bytes.Buffer{props, eventtypes, tags} {
+		buf.WriteString("# Generated by osqt from the osquery schema. Do not edit; override the mapping instead.\n")
+	}
+
+	names := make([]string, 0, len(mapping.Tables))
+	for name := range mapping.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	count, stanza := 0, ""
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tm := mapping.Tables[name]
+		table := query.LookupTable(job.Parser, name)
+		if table == nil {
+			job.Logger.Debugf("Skipping the Splunk mapping of %s, which the schema does not have.", name)
+			continue
+		}
+
+		aliases := []string{}
+		for _, col := range table.AllColumns("") {
+			if field := tm.Fields[col.Name]; field != "" {
+				aliases = append(aliases, fmt.Sprintf("%s%s AS %s", prefix, col.Name, field))
+			}
+		}
+		cols := make([]string, 0, len(tm.Fields))
+		for col := range tm.Fields {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		for _, col := range cols {
+			if tm.Fields[col] != "" && !table.HasColumn(col, "") {
+				job.Logger.Warnf("Splunk mapping of %s aliases column %s, which the table does not have.", name, col)
+			}
+		}
+
+		// osquery logs the results of every query under one sourcetype, so the results of a table are told
+		// apart by the name of the scheduled query reading it, on its own or in a pack.
+		st := strings.Replace(sourcetype, "{table}", name, -1)
+		qname := strings.Replace(queryName, "{table}", name, -1)
+		eventtype := "osquery_" + name
+		if st != stanza {
+			fmt.Fprintf(props, "\n[%s]\nKV_MODE = json\n", st)
+			stanza = st
+		}
+		if len(aliases) > 0 {
+			fmt.Fprintf(props, "FIELDALIAS-osqt_cim_%s = %s\n", name, strings.Join(aliases, " "))
+		}
+		if tm.DataModel != "" {
+			fmt.Fprintf(eventtypes, "\n# %s\n", tm.DataModel)
+		} else {
+			eventtypes.WriteString("\n")
+		}
+		fmt.Fprintf(eventtypes, "[%s]\nsearch = sourcetype=%q (name=%q OR name=%q)\n", eventtype, st, qname, "pack_*_"+qname)
+		if len(tm.Tags) > 0 {
+			fmt.Fprintf(tags, "\n[eventtype=%s]\n", eventtype)
+			for _, tag := range tm.Tags {
+				fmt.Fprintf(tags, "%s = enabled\n", tag)
+			}
+		}
+		count++
+	}
+
+	job.Logger.Debugf("Mapped %d tables to CIM data models.", count)
+	if err := job.Output.WriteFile(ctx, "default/props.conf", props.Bytes()); err != nil {
+		return err
+	}
+	if err := job.Output.WriteFile(ctx, "default/eventtypes.conf", eventtypes.Bytes()); err != nil {
+		return err
+	}
+	return job.Output.WriteFile(ctx, "default/tags.conf", tags.Bytes())
+}
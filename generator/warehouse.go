@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegister(&warehouseGenerator{})
+}
+
+// bigQueryDescriptionLimit is the longest description BigQuery accepts for a field.
+const bigQueryDescriptionLimit = 1024
+
+// warehouseGenerator renders the tables as the schemas of a cloud data warehouse, so osquery results can be loaded
+// into typed tables: a BigQuery JSON schema file or a Snowflake CREATE TABLE statement per table. Every column is
+// nullable, as a table's platform specific columns are missing from the results of the other platforms.
+type warehouseGenerator struct{}
+
+// Name implements the Generator interface.
+func (g *warehouseGenerator) Name() string {
+	return "warehouse"
+}
+
+// Description implements the Generator interface.
+func (g *warehouseGenerator) Description() string {
+	return "BigQuery JSON schemas or Snowflake DDL for loading query results into a data warehouse."
+}
+
+// Generate implements the Generator interface.
+func (g *warehouseGenerator) Generate(ctx context.Context, job *Job) error {
+	dialect := job.Param("dialect", "bigquery")
+	var render func(*osqt.Table) ([]byte, error)
+	var ext string
+	switch dialect {
+	case "bigquery":
+		render, ext = bigQuerySchema, ".json"
+	case "snowflake":
+		render, ext = snowflakeDDL, ".sql"
+	default:
+		return xerrors.Errorf("unsupported warehouse dialect %q (options: 'bigquery' or 'snowflake')", dialect)
+	}
+
+	count := 0
+	for _, ns := range job.Parser.SortedNamespaces() {
+		for _, table := range ns.SortedTables() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			data, err := render(table)
+			if err != nil {
+				return xerrors.Errorf("error rendering %s schema of %s: %v", dialect, table.Name, err)
+			}
+			if err := job.Output.WriteFile(ctx, table.Name+ext, data); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+
+	job.Logger.Debugf("Rendered %s schemas of %d tables.", dialect, count)
+	return nil
+}
+
+// bigQueryField is a field of a BigQuery JSON schema file, as read by bq mk and bq load.
+type bigQueryField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Mode        string `json:"mode"`
+	Description string `json:"description,omitempty"`
+}
+
+// bigQuerySchema renders the columns of table as a BigQuery JSON schema file.
+func bigQuerySchema(table *osqt.Table) ([]byte, error) {
+	fields := []*bigQueryField{}
+	for _, col := range table.AllColumns("") {
+		typ, err := warehouseType(col, bigQueryTypes)
+		if err != nil {
+			return nil, err
+		}
+		desc := []rune(col.Description)
+		if len(desc) > bigQueryDescriptionLimit {
+			desc = desc[:bigQueryDescriptionLimit]
+		}
+		fields = append(fields, &bigQueryField{Name: col.Name, Type: typ, Mode: "NULLABLE", Description: string(desc)})
+	}
+
+	data, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// snowflakeDDL renders table as a Snowflake CREATE TABLE statement.
+func snowflakeDDL(table *osqt.Table) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "CREATE TABLE IF NOT EXISTS %s (\n", snowflakeIdent(table.Name))
+	cols := table.AllColumns("")
+	for idx, col := range cols {
+		typ, err := warehouseType(col, snowflakeTypes)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(buf, "  %s %s", snowflakeIdent(col.Name), typ)
+		if col.Description != "" {
+			fmt.Fprintf(buf, " COMMENT %s", snowflakeString(col.Description))
+		}
+		if idx < len(cols)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString(")")
+	if table.Description != "" {
+		fmt.Fprintf(buf, "\nCOMMENT = %s", snowflakeString(table.Description))
+	}
+	buf.WriteString(";\n")
+	return buf.Bytes(), nil
+}
+
+// bigQueryTypes maps the osquery extension API column kinds to BigQuery types. Unsigned 64-bit integers do not fit
+// INT64, so UNSIGNED_BIGINT columns are NUMERIC instead.
+var bigQueryTypes = map[string]string{
+	"TEXT":            "STRING",
+	"INTEGER":         "INT64",
+	"BIGINT":          "INT64",
+	"UNSIGNED_BIGINT": "NUMERIC",
+	"DOUBLE":          "FLOAT64",
+}
+
+// snowflakeTypes maps the osquery extension API column kinds to Snowflake types. NUMBER(38,0) holds every 64-bit
+// integer, signed or not.
+var snowflakeTypes = map[string]string{
+	"TEXT":            "VARCHAR",
+	"INTEGER":         "NUMBER(38,0)",
+	"BIGINT":          "NUMBER(38,0)",
+	"UNSIGNED_BIGINT": "NUMBER(38,0)",
+	"DOUBLE":          "FLOAT",
+}
+
+// warehouseType returns the type of types col is stored as, by its column type's name if types has it and its
+// base kind otherwise, so registered custom types map onto the kind they are transmitted as.
+func warehouseType(col *osqt.Column, types map[string]string) (string, error) {
+	ct, ok := col.ColumnType()
+	if !ok {
+		return "", xerrors.Errorf("column %s has unregistered type %s", col.Name, col.Type)
+	}
+	if typ, ok := types[ct.Name]; ok {
+		return typ, nil
+	}
+	return types[ct.Base], nil
+}
+
+// snowflakeIdent quotes name as a Snowflake identifier, keeping its case and allowing reserved words such as the
+// group and from columns of osquery's tables.
+func snowflakeIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// snowflakeString quotes s as a Snowflake string literal.
+func snowflakeString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+// Package rusage reports the resources used by the running process.
+package rusage
+
+import "time"
+
+// ProcessCPUTime is not implemented on Windows and always returns zero.
+func ProcessCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,140 @@
+package osqt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/yaml.v3"
+)
+
+// JSONColumnType is the column type of TEXT columns whose contents are declared to be JSON documents. Such columns
+// keep TEXT as their Type, so specs and schemas written from them remain ones osquery can read; Column.ColumnType
+// resolves them to this type.
+const JSONColumnType = "JSON"
+
+func init() {
+	MustRegisterColumnType(JSONColumnType, TypeSpec{Type: sql.JSON, Declared: "TEXT"}, "json.RawMessage", "unknown",
+		WithTypeDescription("A JSON document, stored as TEXT. Query its fields with json_extract()."))
+}
+
+// JSONField describes a field within the JSON document stored in a column. Type is one of string, integer,
+// number, boolean, object or array. Fields lists the members of an object, or of each element of an array
+// of objects. Items is the type of the elements of an array.
+type JSONField struct {
+	Name        string       `json:"name" yaml:"name"`
+	Type        string       `json:"type" yaml:"type"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Items       string       `json:"items,omitempty" yaml:"items,omitempty"`
+	Fields      []*JSONField `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// JSONOverlay declares the JSON sub-schemas of columns that hold JSON documents, keyed by table name and then
+// column name. Overlays live alongside the specs since osquery itself only knows these columns as TEXT.
+type JSONOverlay struct {
+	Tables map[string]map[string][]*JSONField `json:"tables" yaml:"tables"`
+}
+
+// LoadJSONOverlay reads a YAML or JSON overlay file.
+func LoadJSONOverlay(fileloc string) (*JSONOverlay, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay := &JSONOverlay{}
+	switch filepath.Ext(fileloc) {
+	case ".json":
+		err = json.Unmarshal(data, overlay)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, overlay)
+	default:
+		return nil, xerrors.Errorf("unsupported JSON overlay file extension for %s (expected .json or .yaml)", fileloc)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing JSON overlay %s: %v", fileloc, err)
+	}
+
+	for tname, columns := range overlay.Tables {
+		for cname, fields := range columns {
+			if err := validateJSONFields(fields); err != nil {
+				return nil, xerrors.Errorf("%s.%s: %v", tname, cname, err)
+			}
+		}
+	}
+	return overlay, nil
+}
+
+func validateJSONFields(fields []*JSONField) error {
+	for _, f := range fields {
+		switch f.Type {
+		case "string", "integer", "number", "boolean":
+			if len(f.Fields) > 0 {
+				return xerrors.Errorf("field %s of type %s cannot have fields", f.Name, f.Type)
+			}
+		case "object":
+		case "array":
+			switch f.Items {
+			case "", "string", "integer", "number", "boolean", "object":
+			default:
+				return xerrors.Errorf("field %s has unsupported item type %s", f.Name, f.Items)
+			}
+		default:
+			return xerrors.Errorf("field %s has unsupported type %q", f.Name, f.Type)
+		}
+		if f.Name == "" {
+			return xerrors.New("fields must have a name")
+		}
+		if err := validateJSONFields(f.Fields); err != nil {
+			return xerrors.Errorf("%s.%v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// ApplyJSONOverlay attaches the sub-schema of every column named in overlay, marking it as holding JSON. Columns are matched
+// in every namespace and extended schema of the table. It returns the number of columns updated, and an error
+// if the overlay names a column that does not exist in the parser or is not a TEXT column, as only text can hold
+// a JSON document. No column is updated unless every column the overlay names can be.
+func (p *Parser) ApplyJSONOverlay(overlay *JSONOverlay) (int, error) {
+	type match struct {
+		col    *Column
+		fields []*JSONField
+	}
+	matches := []match{}
+	for tname, columns := range overlay.Tables {
+		for cname, fields := range columns {
+			found := false
+			for _, ns := range p.Namespaces {
+				tbl, ok := ns.Tables[tname]
+				if !ok {
+					continue
+				}
+				for _, s := range tableSchemas(tbl) {
+					for _, col := range s.Columns {
+						if col.Name != cname {
+							continue
+						}
+						if col.Type != "TEXT" && col.Type != JSONColumnType {
+							return 0, xerrors.Errorf("JSON overlay references %s column %s.%s (only TEXT columns can hold JSON)", col.Type, tname, cname)
+						}
+						matches = append(matches, match{col: col, fields: fields})
+						found = true
+					}
+				}
+			}
+			if !found {
+				return 0, xerrors.Errorf("JSON overlay references unknown column %s.%s", tname, cname)
+			}
+		}
+	}
+
+	for _, m := range matches {
+		// a column of a schema exported by an earlier osqt may already be typed JSON
+		m.col.Type = "TEXT"
+		m.col.JSONSchema = m.fields
+	}
+	return len(matches), nil
+}
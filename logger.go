@@ -0,0 +1,36 @@
+package osqt
+
+// Logger is the structured logger osqt writes to. The methods ending in f format their message like fmt.Sprintf,
+// and those ending in w take alternating keys and values of context, as zap's SugaredLogger does. Named returns
+// a logger for a component of the logger's own, such as the tables of a namespace.
+//
+// The zaplog package adapts a zap logger. Adapting another logging library (logrus, slog) takes a type with these
+// nine methods.
+type Logger interface {
+	Debugf(template string, args ...interface{})
+	Debugw(msg string, keysAndValues ...interface{})
+	Infof(template string, args ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnf(template string, args ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorf(template string, args ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+	Named(name string) Logger
+}
+
+// NopLogger returns a Logger that discards everything, used by parsers and tables created without a logger.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Debugw(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Infow(string, ...interface{})  {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Warnw(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+func (nopLogger) Errorw(string, ...interface{}) {}
+func (n nopLogger) Named(string) Logger         { return n }
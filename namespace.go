@@ -1,22 +1,26 @@
 package osqt
 
-import "go.uber.org/zap"
+import (
+	"sort"
+	"strings"
+)
 
 // Namespace is a container to hold compatibility information about an OSQuery table set.
 type Namespace struct {
-	logger *zap.SugaredLogger
+	logger Logger
 	parser *Parser
 
-	Key    string            `json:"key,omitempty" yaml:"key,omitempty"`
-	Name   string            `json:"name,omitempty" yaml:"name,omitempty"`
-	Tables map[string]*Table `json:"tables,omitempty" yaml:"tables,omitempty"`
+	Key          string            `json:"key,omitempty" yaml:"key,omitempty"`
+	Name         string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Availability Availability      `json:"availability,omitempty" yaml:"availability,omitempty"`
+	Tables       map[string]*Table `json:"tables,omitempty" yaml:"tables,omitempty"`
 }
 
-// Logger will return a zap Logger, creating one if the Namespace has no previous Logger defined.
-func (n *Namespace) Logger() *zap.SugaredLogger {
+// Logger will return the Logger of the namespace, deriving one from its parser's if it has none.
+func (n *Namespace) Logger() Logger {
 	if n.logger == nil {
 		if n.parser == nil || n.parser.Logger == nil {
-			n.logger = zap.L().Sugar().Named("parser").Named(n.Key)
+			n.logger = NopLogger()
 		} else {
 			n.logger = n.parser.Logger.Named(n.Key)
 		}
@@ -26,17 +30,62 @@ func (n *Namespace) Logger() *zap.SugaredLogger {
 }
 
 // NewNamespace is used to create a new namespace container to hold OSQuery tables.
-func NewNamespace(key, name string, parser *Parser, logger *zap.SugaredLogger) *Namespace {
+func NewNamespace(key, name string, parser *Parser, logger Logger) *Namespace {
 	if logger == nil && parser.Logger != nil {
 		logger = parser.Logger.Named(key)
 	} else if logger == nil && parser.Logger == nil {
-		logger = zap.L().Sugar().Named("parser").Named(key)
+		logger = NopLogger()
 	}
 	return &Namespace{
-		logger: logger,
-		parser: parser,
-		Key:    key,
-		Name:   name,
-		Tables: map[string]*Table{},
+		logger:       logger,
+		parser:       parser,
+		Key:          key,
+		Name:         name,
+		Availability: AvailabilityOf(key),
+		Tables:       map[string]*Table{},
 	}
 }
+
+// Clone returns a deep copy of the namespace and its tables, detached from its parser and logger, so it can be
+// modified without changing the parser's tables. The tables of the copy belong to it.
+func (n *Namespace) Clone() *Namespace {
+	c := &Namespace{
+		Key:          n.Key,
+		Name:         n.Name,
+		Availability: n.Availability,
+		Tables:       make(map[string]*Table, len(n.Tables)),
+	}
+	for tname, table := range n.Tables {
+		if table == nil {
+			c.Tables[tname] = nil
+			continue
+		}
+		tc := table.Clone()
+		tc.Namespace = c
+		c.Tables[tname] = tc
+	}
+	return c
+}
+
+// SortedTables returns the namespace's tables ordered by name.
+func (n *Namespace) SortedTables() []*Table {
+	ret := make([]*Table, 0, len(n.Tables))
+	for _, table := range n.Tables {
+		ret = append(ret, table)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// NamespaceAppliesTo returns true if the tables of the namespace nsid, one of the keys of CanonicalPlatforms,
+// are available on the given GOOS runtime. The namespace ID is matched regardless of case.
+func NamespaceAppliesTo(nsid, goos string) bool {
+	nsid = strings.ToLower(strings.TrimSpace(nsid))
+	for _, applicable := range GOOSToApplicableNamespaces[goos] {
+		if applicable == nsid {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,193 @@
+package osqt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// DeployedNamespace is the namespace key that tables reconstructed from a running osquery binary are stored under.
+const DeployedNamespace = "deployed"
+
+var createTableRegexp = regexp.MustCompile("(?is)CREATE\\s+(?:VIRTUAL\\s+)?TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?[`\"]?(\\w+)[`\"]?\\s*\\((.*?)\\)\\s*(?:WITHOUT\\s+ROWID\\s*)?;")
+
+// ParseOsqueryiSchema reconstructs tables from the schema of a deployed osquery binary. It accepts either the
+// CREATE TABLE statements printed by osqueryi's ".schema" command, or a JSON array of rows (e.g. from
+// osqueryi --json) describing one column per row or containing a "sql" CREATE TABLE statement per row.
+// The tables are stored under the DeployedNamespace namespace.
+func (p *Parser) ParseOsqueryiSchema(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	ns := NewNamespace(DeployedNamespace, "Deployed osquery binary", p, nil)
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		err = parseOsqueryiRows(ns, trimmed)
+	} else {
+		err = parseOsqueryiStatements(ns, string(data))
+	}
+	if err != nil {
+		return err
+	}
+	if len(ns.Tables) == 0 {
+		return xerrors.New("no table definitions found in osqueryi schema output")
+	}
+
+	return p.InjectTables(map[string]*Namespace{DeployedNamespace: ns})
+}
+
+func parseOsqueryiStatements(ns *Namespace, input string) error {
+	for _, match := range createTableRegexp.FindAllStringSubmatch(input, -1) {
+		table := osqueryiTable(ns, match[1])
+		for _, def := range splitColumnDefs(match[2]) {
+			addColumnDef(table, def)
+		}
+	}
+
+	return nil
+}
+
+func parseOsqueryiRows(ns *Namespace, data []byte) error {
+	rows := []map[string]interface{}{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return xerrors.Errorf("error parsing osqueryi JSON output: %v", err)
+	}
+
+	for idx, row := range rows {
+		if stmt := rowValue(row, "sql"); stmt != "" {
+			if err := parseOsqueryiStatements(ns, strings.TrimRight(stmt, "; ")+";"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tname := rowValue(row, "table_name", "table", "tbl_name")
+		cname := rowValue(row, "column_name", "column", "name")
+		if tname == "" || cname == "" {
+			return xerrors.Errorf("row %d does not describe a table column (expected table_name and name fields)", idx)
+		}
+
+		table := osqueryiTable(ns, tname)
+		col := NewEmptyColumn()
+		col.Index = len(table.Schema.Columns)
+		col.Name = cname
+		col.Type = normalizeSQLType(rowValue(row, "type", "column_type"))
+		if isTruthy(rowValue(row, "hidden")) {
+			col.Options["hidden"] = true
+		}
+		if isTruthy(rowValue(row, "pk", "index")) {
+			col.Options["index"] = true
+		}
+		table.Schema.Columns = append(table.Schema.Columns, col)
+	}
+
+	return nil
+}
+
+func osqueryiTable(ns *Namespace, name string) *Table {
+	table, ok := ns.Tables[name]
+	if !ok {
+		table = NewEmptyTable()
+		table.Name = name
+		table.NamespaceID = ns.Key
+		table.Namespace = ns
+		table.Schema = NewEmptySchema(table)
+		ns.Tables[name] = table
+	}
+	return table
+}
+
+// addColumnDef parses a single column definition (or table constraint) from a CREATE TABLE statement.
+func addColumnDef(table *Table, def string) {
+	fields := strings.Fields(def)
+	if len(fields) == 0 {
+		return
+	}
+
+	if strings.EqualFold(fields[0], "PRIMARY") {
+		open, close := strings.Index(def, "("), strings.LastIndex(def, ")")
+		if open < 0 || close < open {
+			return
+		}
+		for _, key := range strings.Split(def[open+1:close], ",") {
+			key = strings.Trim(strings.TrimSpace(key), "`\"")
+			for _, col := range table.Schema.Columns {
+				if col.Name == key {
+					col.Options["index"] = true
+				}
+			}
+		}
+		return
+	}
+
+	col := NewEmptyColumn()
+	col.Index = len(table.Schema.Columns)
+	col.Name = strings.Trim(fields[0], "`\"")
+
+	typeParts := []string{}
+	for _, field := range fields[1:] {
+		if strings.EqualFold(field, "HIDDEN") {
+			col.Options["hidden"] = true
+			continue
+		}
+		typeParts = append(typeParts, field)
+	}
+	col.Type = normalizeSQLType(strings.Join(typeParts, " "))
+
+	table.Schema.Columns = append(table.Schema.Columns, col)
+}
+
+// splitColumnDefs splits the body of a CREATE TABLE statement on commas that are not nested in parentheses.
+func splitColumnDefs(body string) []string {
+	defs := []string{}
+	depth, start := 0, 0
+	for idx, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, strings.TrimSpace(body[start:idx]))
+				start = idx + 1
+			}
+		}
+	}
+	return append(defs, strings.TrimSpace(body[start:]))
+}
+
+// normalizeSQLType converts a SQL type as rendered by osquery back into its spec file spelling.
+func normalizeSQLType(typ string) string {
+	typ = strings.ToUpper(strings.TrimSpace(typ))
+	if typ == "" {
+		return "TEXT"
+	}
+	return strings.Replace(typ, " ", "_", -1)
+}
+
+func rowValue(row map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if val, ok := row[key]; ok && val != nil {
+			return fmt.Sprintf("%v", val)
+		}
+	}
+	return ""
+}
+
+func isTruthy(val string) bool {
+	switch strings.ToLower(val) {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,251 @@
+package pack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Config is an osquery configuration file, as read by osqueryd with --config_path. Only the sections that contain
+// queries or name tables and files are kept; packs given as paths are loaded along with the config.
+type Config struct {
+	Options        map[string]interface{}    `json:"options,omitempty"`
+	Schedule       map[string]*Query         `json:"schedule,omitempty"`
+	Packs          map[string]*Pack          `json:"-"`
+	Decorators     *Decorators               `json:"decorators,omitempty"`
+	FilePaths      map[string][]string       `json:"file_paths,omitempty"`
+	FilePathsQuery map[string][]string       `json:"file_paths_query,omitempty"`
+	FileAccesses   []string                  `json:"file_accesses,omitempty"`
+	ExcludePaths   map[string][]string       `json:"exclude_paths,omitempty"`
+	ATC            map[string]*osqt.ATCTable `json:"auto_table_construction,omitempty"`
+}
+
+// Decorators are the queries whose results osquery adds to every logged result. Interval decorators are keyed by
+// their interval in seconds.
+type Decorators struct {
+	Load     []string            `json:"load,omitempty"`
+	Always   []string            `json:"always,omitempty"`
+	Interval map[string][]string `json:"interval,omitempty"`
+}
+
+// ConfigQuery is a query found somewhere in a Config. Source locates it in the config (e.g. "schedule/users" or
+// "decorators/load/1"), and Platform and PackPlatform are the platform restrictions of the query and of the pack
+// it belongs to.
+type ConfigQuery struct {
+	Source       string
+	SQL          string
+	Platform     string
+	PackPlatform string
+}
+
+// RunsOn returns true if osquery runs the query on the GOOS runtime goos.
+func (q *ConfigQuery) RunsOn(goos string) bool {
+	return PlatformIncludes(q.Platform, goos) && PlatformIncludes(q.PackPlatform, goos)
+}
+
+// PlatformIncludes returns true if a query or pack restricted to platform runs on the GOOS runtime goos. Like
+// osquery, the platform may be a comma separated list, and an empty platform, "all" or "any" runs everywhere.
+func PlatformIncludes(platform, goos string) bool {
+	for _, p := range strings.Split(platform, ",") {
+		switch p = strings.ToLower(strings.TrimSpace(p)); p {
+		case "", "all", "any", goos:
+			return true
+		case "posix":
+			if goos != "windows" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadConfig reads the osquery config at fileloc. Like osquery, it tolerates // and /* */ comments. Packs given as
+// a path are loaded with Load, relative to the config's directory unless absolute, and a path containing a glob
+// adds a pack for every file it matches, named after the file.
+func LoadConfig(fileloc string) (*Config, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading osquery config: %v", err)
+	}
+	data = stripJSONComments(data)
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, xerrors.Errorf("error parsing osquery config %s: %v", fileloc, err)
+	}
+	for name, q := range config.Schedule {
+		if q == nil {
+			return nil, xerrors.Errorf("scheduled query %s is empty", name)
+		}
+		q.Name = name
+	}
+	for name, atc := range config.ATC {
+		if atc == nil {
+			return nil, xerrors.Errorf("ATC table %s is empty", name)
+		}
+		atc.Name = name
+	}
+
+	raw := struct {
+		Packs map[string]json.RawMessage `json:"packs"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, xerrors.Errorf("error parsing osquery config %s: %v", fileloc, err)
+	}
+	config.Packs = map[string]*Pack{}
+	for name, body := range raw.Packs {
+		var path string
+		if err := json.Unmarshal(body, &path); err != nil {
+			p, err := ParseJSON(body)
+			if err != nil {
+				return nil, xerrors.Errorf("error parsing pack %s: %v", name, err)
+			}
+			p.Name = name
+			config.Packs[name] = p
+			continue
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(fileloc), path)
+		}
+		if !strings.ContainsAny(path, "*?[") {
+			p, err := Load(path)
+			if err != nil {
+				return nil, err
+			}
+			p.Name = name
+			config.Packs[name] = p
+			continue
+		}
+
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, xerrors.Errorf("pack %s has an invalid glob: %v", name, err)
+		}
+		for _, match := range matches {
+			p, err := Load(match)
+			if err != nil {
+				return nil, err
+			}
+			p.Name = strings.TrimSuffix(filepath.Base(match), filepath.Ext(match))
+			config.Packs[p.Name] = p
+		}
+	}
+
+	return config, nil
+}
+
+// Queries returns every query of the config, ordered by source: the schedule, packs (with their discovery
+// queries), decorators and file_paths_query.
+func (c *Config) Queries() []*ConfigQuery {
+	queries := []*ConfigQuery{}
+	for _, name := range sortedKeys(c.Schedule) {
+		q := c.Schedule[name]
+		queries = append(queries, &ConfigQuery{Source: "schedule/" + name, SQL: q.SQL, Platform: q.Platform})
+	}
+
+	packNames := make([]string, 0, len(c.Packs))
+	for name := range c.Packs {
+		packNames = append(packNames, name)
+	}
+	sort.Strings(packNames)
+	for _, name := range packNames {
+		p := c.Packs[name]
+		for idx, sql := range p.Discovery {
+			queries = append(queries, &ConfigQuery{Source: fmt.Sprintf("packs/%s/discovery/%d", name, idx+1), SQL: sql, PackPlatform: p.Platform})
+		}
+		for _, q := range p.SortedQueries() {
+			queries = append(queries, &ConfigQuery{Source: fmt.Sprintf("packs/%s/%s", name, q.Name), SQL: q.SQL, Platform: q.Platform, PackPlatform: p.Platform})
+		}
+	}
+
+	if c.Decorators != nil {
+		for idx, sql := range c.Decorators.Load {
+			queries = append(queries, &ConfigQuery{Source: fmt.Sprintf("decorators/load/%d", idx+1), SQL: sql})
+		}
+		for idx, sql := range c.Decorators.Always {
+			queries = append(queries, &ConfigQuery{Source: fmt.Sprintf("decorators/always/%d", idx+1), SQL: sql})
+		}
+		for _, interval := range sortedListKeys(c.Decorators.Interval) {
+			for idx, sql := range c.Decorators.Interval[interval] {
+				queries = append(queries, &ConfigQuery{Source: fmt.Sprintf("decorators/interval/%s/%d", interval, idx+1), SQL: sql})
+			}
+		}
+	}
+
+	for _, category := range sortedListKeys(c.FilePathsQuery) {
+		for idx, sql := range c.FilePathsQuery[category] {
+			queries = append(queries, &ConfigQuery{Source: fmt.Sprintf("file_paths_query/%s/%d", category, idx+1), SQL: sql})
+		}
+	}
+	return queries
+}
+
+// Problems returns the mistakes in the config's sections that do not hold queries: interval decorators that are
+// not a positive number of seconds, file paths that are not absolute or use the recursive %% wildcard anywhere but
+// at their end, and file_accesses or exclude_paths categories that file_paths does not define.
+func (c *Config) Problems() []string {
+	problems := []string{}
+	if c.Decorators != nil {
+		for _, interval := range sortedListKeys(c.Decorators.Interval) {
+			if secs, err := strconv.Atoi(interval); err != nil || secs <= 0 {
+				problems = append(problems, fmt.Sprintf("decorators/interval/%s: interval is not a positive number of seconds", interval))
+			}
+		}
+	}
+
+	for _, category := range sortedListKeys(c.FilePaths) {
+		for idx, path := range c.FilePaths[category] {
+			source := fmt.Sprintf("file_paths/%s/%d", category, idx+1)
+			switch {
+			case !strings.HasPrefix(path, "/") && !filepath.IsAbs(path) && !isWindowsPath(path):
+				problems = append(problems, fmt.Sprintf("%s: %q is not an absolute path", source, path))
+			case strings.Contains(strings.TrimSuffix(path, "%%"), "%%"):
+				problems = append(problems, fmt.Sprintf("%s: %q uses the recursive %%%% wildcard before its end", source, path))
+			}
+		}
+	}
+
+	for _, category := range c.FileAccesses {
+		if _, ok := c.FilePaths[category]; !ok {
+			problems = append(problems, fmt.Sprintf("file_accesses: category %s is not defined in file_paths", category))
+		}
+	}
+	for _, category := range sortedListKeys(c.ExcludePaths) {
+		if _, ok := c.FilePaths[category]; !ok {
+			problems = append(problems, fmt.Sprintf("exclude_paths/%s: category %s is not defined in file_paths", category, category))
+		}
+	}
+	return problems
+}
+
+// isWindowsPath returns true if path begins with a drive letter, such as C:\.
+func isWindowsPath(path string) bool {
+	return len(path) >= 3 && path[1] == ':' && (path[2] == '\\' || path[2] == '/')
+}
+
+func sortedKeys(queries map[string]*Query) []string {
+	keys := make([]string, 0, len(queries))
+	for key := range queries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedListKeys(lists map[string][]string) []string {
+	keys := make([]string, 0, len(lists))
+	for key := range lists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
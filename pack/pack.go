@@ -0,0 +1,366 @@
+// Package pack reads osquery query packs, in both osquery's own JSON format and Fleet's YAML format, so that the
+// queries they schedule can be checked against a schema.
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// Pack is a named set of scheduled queries. Platform and Version restrict the hosts the whole pack runs on.
+type Pack struct {
+	Name      string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Platform  string            `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Version   string            `json:"version,omitempty" yaml:"version,omitempty"`
+	Shard     int               `json:"shard,omitempty" yaml:"shard,omitempty"`
+	Discovery []string          `json:"discovery,omitempty" yaml:"discovery,omitempty"`
+	Queries   map[string]*Query `json:"queries" yaml:"queries"`
+}
+
+// Query is a single scheduled query in a pack.
+type Query struct {
+	Name        string `json:"-" yaml:"-"`
+	SQL         string `json:"query" yaml:"query"`
+	Interval    int    `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Platform    string `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Value       string `json:"value,omitempty" yaml:"value,omitempty"`
+	Snapshot    bool   `json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+	Removed     *bool  `json:"removed,omitempty" yaml:"removed,omitempty"`
+	Shard       int    `json:"shard,omitempty" yaml:"shard,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Packs in the wild frequently quote their numbers and booleans, so
+// interval, shard, snapshot and removed are accepted as strings as well.
+func (q *Query) UnmarshalJSON(data []byte) error {
+	raw := struct {
+		SQL         string      `json:"query"`
+		Interval    interface{} `json:"interval"`
+		Platform    string      `json:"platform"`
+		Version     string      `json:"version"`
+		Description string      `json:"description"`
+		Value       string      `json:"value"`
+		Snapshot    interface{} `json:"snapshot"`
+		Removed     interface{} `json:"removed"`
+		Shard       interface{} `json:"shard"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	q.SQL, q.Platform, q.Version, q.Description, q.Value = raw.SQL, raw.Platform, raw.Version, raw.Description, raw.Value
+	var err error
+	if q.Interval, err = looseInt(raw.Interval); err != nil {
+		return xerrors.Errorf("invalid interval: %v", err)
+	}
+	if q.Shard, err = looseInt(raw.Shard); err != nil {
+		return xerrors.Errorf("invalid shard: %v", err)
+	}
+	if q.Snapshot, err = looseBool(raw.Snapshot); err != nil {
+		return xerrors.Errorf("invalid snapshot: %v", err)
+	}
+	if raw.Removed != nil {
+		removed, err := looseBool(raw.Removed)
+		if err != nil {
+			return xerrors.Errorf("invalid removed: %v", err)
+		}
+		q.Removed = &removed
+	}
+	return nil
+}
+
+func looseInt(v interface{}) (int, error) {
+	switch val := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int(val), nil
+	case string:
+		return strconv.Atoi(strings.TrimSpace(val))
+	}
+	return 0, xerrors.Errorf("%v is not a number", v)
+}
+
+func looseBool(v interface{}) (bool, error) {
+	switch val := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return val, nil
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(val))
+	}
+	return false, xerrors.Errorf("%v is not a boolean", v)
+}
+
+// SortedQueries returns the pack's queries ordered by name.
+func (p *Pack) SortedQueries() []*Query {
+	ret := make([]*Query, 0, len(p.Queries))
+	for _, q := range p.Queries {
+		ret = append(ret, q)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Load reads the pack at fileloc. Files ending in .yaml or .yml are read as Fleet pack YAML, anything else
+// (typically .conf or .json) as an osquery JSON pack. The pack is named after the file unless it names itself.
+func Load(fileloc string) (*Pack, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	var p *Pack
+	switch filepath.Ext(fileloc) {
+	case ".yaml", ".yml":
+		p, err = ParseFleetYAML(data)
+	default:
+		p, err = ParseJSON(data)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing pack %s: %v", fileloc, err)
+	}
+
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(fileloc), filepath.Ext(fileloc))
+	}
+	return p, nil
+}
+
+// ParseJSON parses an osquery JSON pack. Like osquery, it tolerates // and /* */ comments.
+func ParseJSON(data []byte) (*Pack, error) {
+	p := &Pack{}
+	if err := json.Unmarshal(stripJSONComments(data), p); err != nil {
+		return nil, err
+	}
+	if p.Queries == nil {
+		p.Queries = map[string]*Query{}
+	}
+	for name, q := range p.Queries {
+		if q == nil {
+			return nil, xerrors.Errorf("query %s is empty", name)
+		}
+		q.Name = name
+	}
+	return p, nil
+}
+
+// stripJSONComments blanks out comments outside of string literals, preserving offsets for error messages.
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	inString := false
+	for i := 0; i < len(out); i++ {
+		switch {
+		case inString:
+			if out[i] == '\\' {
+				i++
+			} else if out[i] == '"' {
+				inString = false
+			}
+		case out[i] == '"':
+			inString = true
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(out) - i - 2
+			} else {
+				end += 2
+			}
+			for j := i; j < i+2+end && j < len(out); j++ {
+				if out[j] != '\n' {
+					out[j] = ' '
+				}
+			}
+			i += 1 + end
+		}
+	}
+	return out
+}
+
+// fleetDocument is a single document of a Fleet YAML file.
+type fleetDocument struct {
+	APIVersion string    `yaml:"apiVersion"`
+	Kind       string    `yaml:"kind"`
+	Spec       yaml.Node `yaml:"spec"`
+}
+
+type fleetQuerySpec struct {
+	Name        string `yaml:"name"`
+	Query       string `yaml:"query"`
+	Description string `yaml:"description,omitempty"`
+	Platform    string `yaml:"platform,omitempty"`
+	Interval    int    `yaml:"interval,omitempty"`
+}
+
+type fleetPackSpec struct {
+	Name    string            `yaml:"name"`
+	Queries []*fleetPackQuery `yaml:"queries"`
+}
+
+// fleetPackQuery schedules a query document in a pack.
+type fleetPackQuery struct {
+	Query       string `yaml:"query"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Interval    int    `yaml:"interval"`
+	Platform    string `yaml:"platform,omitempty"`
+	Version     string `yaml:"version,omitempty"`
+	Snapshot    bool   `yaml:"snapshot,omitempty"`
+	Removed     *bool  `yaml:"removed,omitempty"`
+	Shard       int    `yaml:"shard,omitempty"`
+}
+
+// ParseFleetYAML parses a Fleet (or Kolide) YAML file of `kind: query` and `kind: pack` documents. Pack entries
+// refer to query documents by name; when the file has no pack document, every query document is included.
+func ParseFleetYAML(data []byte) (*Pack, error) {
+	queries := map[string]*fleetQuerySpec{}
+	packs := []*fleetPackSpec{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for idx := 0; ; idx++ {
+		doc := &fleetDocument{}
+		err := dec.Decode(doc)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, xerrors.Errorf("document %d: %v", idx+1, err)
+		}
+
+		switch doc.Kind {
+		case "query":
+			spec := &fleetQuerySpec{}
+			if err := doc.Spec.Decode(spec); err != nil {
+				return nil, xerrors.Errorf("document %d: %v", idx+1, err)
+			}
+			if spec.Name == "" {
+				return nil, xerrors.Errorf("document %d: query has no name", idx+1)
+			}
+			queries[spec.Name] = spec
+		case "pack":
+			spec := &fleetPackSpec{}
+			if err := doc.Spec.Decode(spec); err != nil {
+				return nil, xerrors.Errorf("document %d: %v", idx+1, err)
+			}
+			packs = append(packs, spec)
+		case "":
+			return nil, xerrors.Errorf("document %d has no kind", idx+1)
+		default:
+			// labels, options and the like do not contain scheduled queries
+		}
+	}
+
+	p := &Pack{Queries: map[string]*Query{}}
+	if len(packs) == 0 {
+		for name, spec := range queries {
+			p.Queries[name] = &Query{
+				Name:        name,
+				SQL:         spec.Query,
+				Description: spec.Description,
+				Platform:    spec.Platform,
+				Interval:    spec.Interval,
+			}
+		}
+		return p, nil
+	}
+
+	if len(packs) == 1 {
+		p.Name = packs[0].Name
+	}
+	for _, spec := range packs {
+		for _, entry := range spec.Queries {
+			def, ok := queries[entry.Query]
+			if !ok {
+				return nil, xerrors.Errorf("pack %s refers to undefined query %q", spec.Name, entry.Query)
+			}
+			name := entry.Name
+			if name == "" {
+				name = entry.Query
+			}
+			if len(packs) > 1 {
+				name = fmt.Sprintf("%s/%s", spec.Name, name)
+			}
+			desc := entry.Description
+			if desc == "" {
+				desc = def.Description
+			}
+			p.Queries[name] = &Query{
+				Name:        name,
+				SQL:         def.Query,
+				Interval:    entry.Interval,
+				Platform:    entry.Platform,
+				Version:     entry.Version,
+				Description: desc,
+				Snapshot:    entry.Snapshot,
+				Removed:     entry.Removed,
+				Shard:       entry.Shard,
+			}
+		}
+	}
+	return p, nil
+}
+
+// MarshalFleetYAML renders p as Fleet YAML: a `kind: query` document for each query followed by a `kind: pack`
+// document scheduling them, which ParseFleetYAML reads back and fleetctl applies.
+func MarshalFleetYAML(p *Pack) ([]byte, error) {
+	if p.Name == "" {
+		return nil, xerrors.New("a pack must be named to render it as Fleet YAML")
+	}
+
+	docs := []*fleetDocument{}
+	spec := &fleetPackSpec{Name: p.Name, Queries: []*fleetPackQuery{}}
+	for _, q := range p.SortedQueries() {
+		doc := &fleetDocument{APIVersion: "v1", Kind: "query"}
+		if err := doc.Spec.Encode(&fleetQuerySpec{Name: q.Name, Query: q.SQL, Description: q.Description}); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+
+		spec.Queries = append(spec.Queries, &fleetPackQuery{
+			Query:       q.Name,
+			Name:        q.Name,
+			Description: q.Description,
+			Interval:    q.Interval,
+			Platform:    q.Platform,
+			Version:     q.Version,
+			Snapshot:    q.Snapshot,
+			Removed:     q.Removed,
+			Shard:       q.Shard,
+		})
+	}
+	doc := &fleetDocument{APIVersion: "v1", Kind: "pack"}
+	if err := doc.Spec.Encode(spec); err != nil {
+		return nil, err
+	}
+	docs = append(docs, doc)
+
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
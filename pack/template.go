@@ -0,0 +1,100 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// Variables are the values substituted into templated queries by Expand.
+type Variables map[string]interface{}
+
+// LoadVariables reads a YAML or JSON file mapping variable names to their values.
+func LoadVariables(fileloc string) (Variables, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := Variables{}
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		return nil, xerrors.Errorf("error parsing variables %s: %v", fileloc, err)
+	}
+	return vars, nil
+}
+
+// atVariable matches @name placeholders. The @ must not follow a word character so that e.g. email addresses in
+// string literals are left alone.
+var atVariable = regexp.MustCompile(`(^|[^\w@])@([A-Za-z_][A-Za-z0-9_]*)`)
+
+// IsTemplated returns true if sql contains {{ }} template actions or @name placeholders.
+func IsTemplated(sql string) bool {
+	return strings.Contains(sql, "{{") || atVariable.MatchString(sql)
+}
+
+// Expand substitutes vars into a templated query. Two styles of placeholder are supported, as used by Fleet and
+// by infrastructure tooling that renders packs:
+//
+//	{{ .Env }}   Go template actions, evaluated with vars as the data
+//	@some_var    replaced with the value of some_var
+//
+// Strings are substituted verbatim and lists become a comma separated list of SQL literals, suitable for an IN
+// clause. Every variable the query uses must be defined.
+func Expand(sql string, vars Variables) (string, error) {
+	if strings.Contains(sql, "{{") {
+		tmpl, err := template.New("query").Option("missingkey=error").Parse(sql)
+		if err != nil {
+			return "", xerrors.Errorf("invalid template: %v", err)
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, map[string]interface{}(vars)); err != nil {
+			return "", xerrors.Errorf("error expanding template: %v", err)
+		}
+		sql = buf.String()
+	}
+
+	missing := map[string]bool{}
+	sql = atVariable.ReplaceAllStringFunc(sql, func(match string) string {
+		sub := atVariable.FindStringSubmatch(match)
+		val, ok := vars[sub[2]]
+		if !ok {
+			missing[sub[2]] = true
+			return match
+		}
+		return sub[1] + formatVariable(val)
+	})
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, "@"+name)
+		}
+		sort.Strings(names)
+		return "", xerrors.Errorf("undefined variables: %s", strings.Join(names, ", "))
+	}
+
+	return sql, nil
+}
+
+func formatVariable(val interface{}) string {
+	list, ok := val.([]interface{})
+	if !ok {
+		return fmt.Sprintf("%v", val)
+	}
+
+	elems := make([]string, len(list))
+	for idx, elem := range list {
+		if s, ok := elem.(string); ok {
+			elems[idx] = "'" + strings.Replace(s, "'", "''", -1) + "'"
+			continue
+		}
+		elems[idx] = fmt.Sprintf("%v", elem)
+	}
+	return strings.Join(elems, ", ")
+}
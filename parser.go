@@ -1,18 +1,25 @@
 package osqt
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 
 	past "github.com/go-python/gpython/ast"
 	gparser "github.com/go-python/gpython/parser"
-	"github.com/karrick/godirwalk"
-	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
 )
 
 // Parser is a directory walking extraction of OSQuery table definitions. (usually specs/)
@@ -21,10 +28,23 @@ type Parser struct {
 
 	SchemaFile string
 	BaseDir    string
-	Logger     *zap.SugaredLogger
+	Logger     Logger
+	Options    ParserOptions
+	Metadata   *SchemaMetadata       `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 	Namespaces map[string]*Namespace `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
 }
 
+// ParserOptions controls how a Parser treats spec declarations it does not understand.
+type ParserOptions struct {
+	// Strict fails a .table file on the first unhandled AST node or unknown keyword argument. Otherwise they are
+	// skipped and recorded as warnings in the Diagnostics of the table and parser.
+	Strict bool
+
+	// Workers is the number of spec files ParseDirectory and ParseFS parse at once. It defaults to the number of
+	// CPUs.
+	Workers int
+}
+
 // SourceFile is used to define a file containing an OSQuery table definition.
 type SourceFile struct {
 	Path  string
@@ -32,42 +52,94 @@ type SourceFile struct {
 }
 
 // NewParser returns a new parser for extracting structured OSQuery
-// table definitions from within their .table declaration files.
-func NewParser(logger *zap.SugaredLogger) *Parser {
+// table definitions from within their .table declaration files. A nil logger discards the parser's logs.
+func NewParser(logger Logger) *Parser {
+	return NewParserWithOptions(logger, ParserOptions{})
+}
+
+// NewParserWithOptions returns a new parser like NewParser, configured by opts.
+func NewParserWithOptions(logger Logger, opts ParserOptions) *Parser {
 	if logger == nil {
-		logger = zap.L().Sugar().Named("parser")
+		logger = NopLogger()
 	}
 	return &Parser{
 		Logger:     logger,
+		Options:    opts,
 		Namespaces: map[string]*Namespace{},
 	}
 }
 
-// ParseYAMLSchemaFile attempts to recreate a table structure from a YAML schema definition.
-func (p *Parser) ParseYAMLSchemaFile(fileloc string) error {
+// ParseYAMLSchemaFile attempts to recreate a table structure from a YAML schema definition. Anchors, aliases and
+// merge keys are resolved, and top level keys beginning with "x-" or "." may hold shared definitions. Columns are
+// numbered by their position in each schema, so those reused through anchors keep the order of the file. Decoding
+// errors are returned as a *YAMLError. Versioned exports are verified against their checksum, and their metadata
+// kept as the Metadata of the parser.
+func (p *Parser) ParseYAMLSchemaFile(fileloc string) (err error) {
+	_, span := Tracer().Start(context.Background(), "osqt.ParseYAMLSchemaFile", trace.WithAttributes(attribute.String("osqt.schema_file", fileloc)))
+	defer func() { EndSpan(span, err) }()
+
 	filebytes, err := ioutil.ReadFile(fileloc)
 	if err != nil {
 		return err
 	}
 
-	tables := map[string]*Namespace{}
-	err = yaml.Unmarshal(filebytes, &tables)
+	return p.parseYAMLSchema(fileloc, filebytes)
+}
+
+// ParseYAMLSchema attempts to recreate a table structure from the bytes of a YAML schema definition, as
+// ParseYAMLSchemaFile does.
+func (p *Parser) ParseYAMLSchema(data []byte) error {
+	return p.parseYAMLSchema("<schema>", data)
+}
+
+func (p *Parser) parseYAMLSchema(file string, data []byte) error {
+	tables, meta, err := decodeYAMLSchema(file, data)
 	if err != nil {
 		return err
 	}
 
-	return p.InjectTables(tables)
+	return p.injectVersionedTables(tables, meta)
 }
 
-// ParseJSONSchemaFile attempts to parse a table structure from a JSON schema definition.
-func (p *Parser) ParseJSONSchemaFile(fileloc string) error {
+// ParseJSONSchemaFile attempts to parse a table structure from a JSON schema definition. Versioned exports are
+// verified against their checksum, and their metadata kept as the Metadata of the parser.
+func (p *Parser) ParseJSONSchemaFile(fileloc string) (err error) {
+	ctx, span := Tracer().Start(context.Background(), "osqt.ParseJSONSchemaFile", trace.WithAttributes(attribute.String("osqt.schema_file", fileloc)))
+	defer func() { EndSpan(span, err) }()
+
 	filebytes, err := ioutil.ReadFile(fileloc)
 	if err != nil {
 		return err
 	}
 
+	return p.parseJSONSchema(ctx, filebytes)
+}
+
+// ParseJSONSchema attempts to parse a table structure from the bytes of a JSON schema definition.
+func (p *Parser) ParseJSONSchema(data []byte) error {
+	return p.parseJSONSchema(context.Background(), data)
+}
+
+func (p *Parser) parseJSONSchema(ctx context.Context, data []byte) (err error) {
+	_, span := Tracer().Start(ctx, "osqt.ParseJSONSchema", trace.WithAttributes(attribute.Int("osqt.schema_bytes", len(data))))
+	defer func() { EndSpan(span, err) }()
+
+	top := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &top)
+	if err != nil {
+		return err
+	}
+	if _, ok := top[SchemaMetadataKey]; ok {
+		envelope := &SchemaEnvelope{}
+		err = json.Unmarshal(data, envelope)
+		if err != nil {
+			return err
+		}
+		return p.injectVersionedTables(envelope.Namespaces, envelope.Metadata)
+	}
+
 	tables := map[string]*Namespace{}
-	err = json.Unmarshal(filebytes, &tables)
+	err = json.Unmarshal(data, &tables)
 	if err != nil {
 		return err
 	}
@@ -75,12 +147,35 @@ func (p *Parser) ParseJSONSchemaFile(fileloc string) error {
 	return p.InjectTables(tables)
 }
 
+// injectVersionedTables injects tables after checking them against the checksum of meta, the metadata of the
+// versioned export they were read from, which becomes the Metadata of the parser. meta is nil for unversioned
+// exports.
+func (p *Parser) injectVersionedTables(tables map[string]*Namespace, meta *SchemaMetadata) error {
+	if meta != nil {
+		if err := meta.Verify(tables); err != nil {
+			return err
+		}
+	}
+	if err := p.InjectTables(tables); err != nil {
+		return err
+	}
+	if meta != nil {
+		p.Lock()
+		p.Metadata = meta
+		p.Unlock()
+	}
+	return nil
+}
+
 // InjectTables is used to "wire up" tables and their child types with the current Parser.
 func (p *Parser) InjectTables(raw map[string]*Namespace) error {
 	for nsid, ns := range raw {
 		if ns.parser == nil {
 			ns.parser = p
 		}
+		if ns.Availability == "" {
+			ns.Availability = AvailabilityOf(nsid)
+		}
 		for tname, table := range ns.Tables {
 			table.logger = ns.Logger().Named(tname)
 			table.Namespace = ns
@@ -92,7 +187,15 @@ func (p *Parser) InjectTables(raw map[string]*Namespace) error {
 				table.Schema.Table = table
 			}
 
-			for esname, es := range table.ExtendedSchemas {
+			shared := map[*Schema]string{}
+			for _, esname := range sortedSchemaPlatforms(table.ExtendedSchemas) {
+				es := table.ExtendedSchemas[esname]
+				if other, ok := shared[es]; ok {
+					table.logger.Warnw("Extended schema is shared with another platform, copying it", "platform", esname, "shared_with", other)
+					es = es.copy()
+					table.ExtendedSchemas[esname] = es
+				}
+				shared[es] = esname
 				es.logger = table.logger.Named("extended_schema").Named(esname)
 				es.Table = table
 			}
@@ -107,95 +210,287 @@ func (p *Parser) InjectTables(raw map[string]*Namespace) error {
 // ParseDirectory walks a directory structure for all .table files and attempts to parse
 // them as OSQuery table defintiions.
 func (p *Parser) ParseDirectory(location string) error {
-	errchan := make(chan error, 1)
-	reschan := make(chan *SourceFile, 1000)
-	finchan := make(chan bool, 1)
+	return p.ParseDirectoryContext(context.Background(), location)
+}
 
-	go func() {
-		p.Logger.Debug("Starting record keeping worker.")
-		p.Lock()
-		defer func() {
-			p.Logger.Debug("Shutting down record keeping worker.")
-			finchan <- true
-		}()
-		defer p.Unlock()
-		for src := range reschan {
-			namespaceID := filepath.Base(filepath.Dir(src.Path))
-			namespaceDescription, ok := CanonicalPlatforms[namespaceID]
-			if !ok {
-				p.Logger.Fatalw("Could not find namespace", "nsid", namespaceID, "path", src.Path, "dir", filepath.Dir(src.Path), "base", filepath.Base(filepath.Dir(src.Path)))
-			}
-			p.Logger.Debugw("Table recorded", "table", src.Table.Name, "nsid", namespaceID, "ns", namespaceDescription)
-			ns, ok := p.Namespaces[namespaceID]
-			if !ok {
-				ns = NewNamespace(namespaceID, namespaceDescription, p, nil)
-				p.Namespaces[namespaceID] = ns
-			}
-			src.Table.NamespaceID = namespaceID
-			src.Table.Namespace = ns
-			ns.Tables[src.Table.Name] = src.Table
-		}
-	}()
+// ParseDirectoryContext is ParseDirectory with a parent context used for tracing.
+func (p *Parser) ParseDirectoryContext(ctx context.Context, location string) (err error) {
+	ctx, span := Tracer().Start(ctx, "osqt.ParseDirectory", trace.WithAttributes(attribute.String("osqt.specs_dir", location)))
+	defer func() { EndSpan(span, err) }()
 
 	p.BaseDir = location
+	return p.parseFS(ctx, os.DirFS(location), ".", func(name string) string {
+		return filepath.Join(location, filepath.FromSlash(name))
+	})
+}
+
+// ParseFS walks the tree of fsys under root for all .table files and attempts to parse them as OSQuery table
+// definitions, like ParseDirectory does for a directory. Spec trees can so be parsed out of embedded filesystems,
+// zip archives (archive/zip.Reader) or test fixtures (testing/fstest.MapFS). root is a slash separated path as
+// fs.FS expects, "." for the whole filesystem. As with ParseDirectory, tables are recorded in the namespace named
+// by the directory holding their spec, so the specs directory itself should be or be within root.
+func (p *Parser) ParseFS(fsys fs.FS, root string) error {
+	return p.ParseFSContext(context.Background(), fsys, root)
+}
 
-	go func() {
-		defer close(reschan)
-		p.Logger.Debug("Walking base directory.")
-		err := godirwalk.Walk(p.BaseDir, &godirwalk.Options{
-			Callback: func(fileloc string, de *godirwalk.Dirent) error {
-				if !de.IsRegular() || filepath.Ext(fileloc) != ".table" {
+// ParseFSContext is ParseFS with a parent context used for tracing.
+func (p *Parser) ParseFSContext(ctx context.Context, fsys fs.FS, root string) (err error) {
+	ctx, span := Tracer().Start(ctx, "osqt.ParseFS", trace.WithAttributes(attribute.String("osqt.specs_dir", root)))
+	defer func() { EndSpan(span, err) }()
+
+	p.BaseDir = root
+	return p.parseFS(ctx, fsys, root, func(name string) string { return name })
+}
+
+// parseFS parses the spec files of fsys under root. display maps the path of a file within fsys to the path it is
+// reported and recorded as.
+func (p *Parser) parseFS(ctx context.Context, fsys fs.FS, root string, display func(string) string) error {
+	// the walk hands the spec files it finds to a bounded set of parse workers, which hand the parsed tables to the
+	// recorder. Both hand-offs go through bounded channels, so a slow stage holds back the ones before it rather
+	// than letting files or tables pile up. An error from any stage cancels the others.
+	g, gctx := errgroup.WithContext(ctx)
+	names := make(chan string, parseBuffer)
+	reschan := make(chan *SourceFile, parseBuffer)
+
+	g.Go(func() error {
+		defer close(names)
+		p.Logger.Debugw("Walking base directory.")
+		return fs.WalkDir(fsys, root, func(name string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path.Ext(name) != ".table" {
+				return nil
+			}
+			// specs linked into the tree are parsed like the files they point to. Directories are not followed,
+			// as WalkDir does not follow them.
+			if de.Type()&fs.ModeSymlink != 0 {
+				info, err := fs.Stat(fsys, name)
+				if err != nil {
+					p.Logger.Warnw("Skipping spec file link that cannot be followed.", "file", display(name), "error", err)
+					return nil
+				}
+				if !info.Mode().IsRegular() {
 					return nil
 				}
+			} else if !de.Type().IsRegular() {
+				return nil
+			}
 
-				tbl, err := p.ParseTableDef(fileloc)
+			select {
+			case names <- name:
+				return nil
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		})
+	})
+
+	workers := p.Options.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	var parsing sync.WaitGroup
+	parsing.Add(workers)
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			defer parsing.Done()
+			for name := range names {
+				fileloc := display(name)
+				tbl, err := p.parseFSTableDef(gctx, fsys, name, fileloc)
 				if err != nil {
 					p.Logger.Warnw("Error parsing spec file.", "file", fileloc, "error", err)
 					return err
 				}
 
-				reschan <- &SourceFile{
-					Path:  fileloc,
-					Table: tbl,
+				select {
+				case reschan <- &SourceFile{Path: fileloc, Table: tbl}:
+				case <-gctx.Done():
+					return gctx.Err()
 				}
-				return nil
-			},
-			Unsorted: true,
+			}
+			return nil
 		})
-		if err != nil {
-			errchan <- err
-		}
-	}()
+	}
+	g.Go(func() error {
+		parsing.Wait()
+		close(reschan)
+		return nil
+	})
 
-	select {
-	case err := <-errchan:
-		return err
-	case <-finchan:
+	g.Go(func() error {
+		p.Logger.Debugw("Starting record keeping worker.")
+		defer p.Logger.Debugw("Shutting down record keeping worker.")
+		for src := range reschan {
+			if err := p.recordTable(src); err != nil {
+				return err
+			}
+		}
 		return nil
+	})
+
+	return g.Wait()
+}
+
+// parseBuffer is the number of spec files ParseDirectory holds while they wait to be parsed, and of parsed tables
+// while they wait to be recorded.
+const parseBuffer = 64
+
+// recordTable adds a table parsed from a spec file to the namespace named by the file's directory.
+func (p *Parser) recordTable(src *SourceFile) error {
+	namespaceID := filepath.Base(filepath.Dir(src.Path))
+	namespaceDescription, ok := CanonicalPlatforms[namespaceID]
+	if !ok {
+		return xerrors.Errorf("spec file %s is in an unknown namespace directory %s", src.Path, namespaceID)
 	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.Logger.Debugw("Table recorded", "table", src.Table.Name, "nsid", namespaceID, "ns", namespaceDescription)
+	ns, ok := p.Namespaces[namespaceID]
+	if !ok {
+		ns = NewNamespace(namespaceID, namespaceDescription, p, nil)
+		p.Namespaces[namespaceID] = ns
+	}
+	src.Table.NamespaceID = namespaceID
+	src.Table.Namespace = ns
+	ns.Tables[src.Table.Name] = src.Table
+	return nil
 }
 
 // ParseTableDef takes an input of Python source and attempts to extract an OSQuery table
 // definition by extracting the information out of the Python AST that is generated
 // on the fly.
 func (p *Parser) ParseTableDef(fileloc string) (*Table, error) {
-	freader, err := os.Open(fileloc)
+	return p.parseTableDef(context.Background(), fileloc)
+}
+
+func (p *Parser) parseTableDef(ctx context.Context, fileloc string) (*Table, error) {
+	return p.parseFSTableDef(ctx, os.DirFS(filepath.Dir(fileloc)), filepath.Base(fileloc), fileloc)
+}
+
+// parseFSTableDef parses the spec file name of fsys, reported as fileloc.
+func (p *Parser) parseFSTableDef(ctx context.Context, fsys fs.FS, name, fileloc string) (_ *Table, err error) {
+	_, span := Tracer().Start(ctx, "osqt.ParseTableDef", trace.WithAttributes(attribute.String("osqt.spec_file", fileloc)))
+	defer func() { EndSpan(span, err) }()
+
+	freader, err := fsys.Open(name)
 	if err != nil {
+		if perr, ok := err.(*fs.PathError); ok {
+			perr.Path = fileloc
+		}
 		p.Logger.Debugw("Error encountered opening spec file.", "file", fileloc, "error", err)
 		return nil, err
 	}
+	defer freader.Close()
+
+	tbl, err := p.ParseTableSource(path.Base(name), freader)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range tbl.Diagnostics {
+		d.File = fileloc
+	}
+	return tbl, nil
+}
 
-	filename := strings.Replace(filepath.Base(fileloc), ".table", "", -1)
+// Diagnostics returns the problems found while parsing the spec files of the parser's tables in lenient mode, such
+// as declarations it did not understand and skipped, ordered by file and line. Tables loaded from exported schemas
+// have none.
+func (p *Parser) Diagnostics() []*Diagnostic {
+	p.RLock()
+	defer p.RUnlock()
+
+	diags := []*Diagnostic{}
+	for _, ns := range p.Namespaces {
+		for _, table := range ns.Tables {
+			if table == nil {
+				continue
+			}
+			table.RLock()
+			diags = append(diags, table.Diagnostics...)
+			table.RUnlock()
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Message < diags[j].Message
+	})
+	return diags
+}
+
+// ParseTableSource extracts an OSQuery table definition from the spec source read from r. filename is the name of
+// the spec file the source came from (e.g. groups.table), which names the table if the source does not.
+func (p *Parser) ParseTableSource(filename string, r io.Reader) (*Table, error) {
+	name := strings.Replace(filename, ".table", "", -1)
 
 	t := NewEmptyTable()
-	t.Name = filename
-	t.logger = p.Logger.Named(filename)
-	gpyast, err := gparser.Parse(freader, filepath.Base(fileloc), "exec")
+	t.Name = name
+	t.logger = p.Logger.Named(name)
+	t.strict = p.Options.Strict
+	gpyast, err := gparser.Parse(r, filename, "exec")
 	if err != nil {
 		return nil, err
 	}
 
 	past.Walk(gpyast, t.Visit)
+	if t.parseErr != nil {
+		return nil, xerrors.Errorf("%s: %v", filename, t.parseErr)
+	}
+	for _, d := range t.Diagnostics {
+		d.File = filename
+		d.Table = t.Name
+	}
 
 	return t, nil
 }
+
+// TablesFor returns every table available on the given GOOS runtime, keyed by table name.
+func (p *Parser) TablesFor(goos string) map[string]*Table {
+	return p.TablesForBuild(goos, nil)
+}
+
+// SortedNamespaces returns the parser's namespaces ordered by key, for callers that must visit them in a stable
+// order.
+func (p *Parser) SortedNamespaces() []*Namespace {
+	p.RLock()
+	defer p.RUnlock()
+
+	ret := make([]*Namespace, 0, len(p.Namespaces))
+	for _, ns := range p.Namespaces {
+		ret = append(ret, ns)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret
+}
+
+// NamespacesFor returns the namespaces applicable to the given GOOS runtime, keyed by namespace ID. Their tables
+// keep only the extended schema for goos, so exporting the result describes the tables as they exist on that
+// platform alone. The tables are copies, so they can be modified without changing the parser's tables.
+func (p *Parser) NamespacesFor(goos string) map[string]*Namespace {
+	p.RLock()
+	defer p.RUnlock()
+
+	namespaces := map[string]*Namespace{}
+	for _, nsid := range GOOSToApplicableNamespaces[goos] {
+		ns, ok := p.Namespaces[nsid]
+		if !ok {
+			continue
+		}
+
+		projected := NewNamespace(ns.Key, ns.Name, p, ns.Logger())
+		projected.Availability = ns.Availability
+		for tname, table := range ns.Tables {
+			projected.Tables[tname] = table.forPlatform(goos, projected)
+		}
+		namespaces[nsid] = projected
+	}
+
+	return namespaces
+}
@@ -0,0 +1,165 @@
+package osqt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// specNamespaces are the namespace directories writeSpecTree spreads its tables over.
+var specNamespaces = []string{"specs", "darwin", "linux", "windows", "posix", "utility"}
+
+// writeSpecTree writes a specs directory of n generated tables under dir, with a varying number of columns.
+func writeSpecTree(t *testing.T, dir string, n int) {
+	t.Helper()
+
+	for idx := 0; idx < n; idx++ {
+		nsdir := filepath.Join(dir, specNamespaces[idx%len(specNamespaces)])
+		if err := os.MkdirAll(nsdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		name := fmt.Sprintf("generated_%04d", idx)
+		src := fmt.Sprintf("table_name(%q)\ndescription(\"Generated table %d.\")\nschema([\n", name, idx)
+		for col := 0; col <= idx%7; col++ {
+			src += fmt.Sprintf("    Column(\"col_%d\", TEXT, \"Column %d.\"),\n", col, col)
+		}
+		src += "])\nimplementation(\"generated@genGenerated\")\n"
+		if err := ioutil.WriteFile(filepath.Join(nsdir, name+".table"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// parsedTables summarizes the tables of parser as namespace/table: columns, sorted.
+func parsedTables(parser *Parser) []string {
+	tables := []string{}
+	for nsid, ns := range parser.Namespaces {
+		for name, tbl := range ns.Tables {
+			cols := []string{}
+			if tbl.Schema != nil {
+				for _, col := range tbl.Schema.Columns {
+					cols = append(cols, col.Name+" "+col.Type)
+				}
+			}
+			tables = append(tables, fmt.Sprintf("%s/%s (%s): %v", nsid, name, tbl.NamespaceID, cols))
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// injectedParser returns a parser holding each of tables in the namespace it is keyed by, as an in-memory caller
+// of InjectTables might build it.
+func injectedParser(t *testing.T, tables map[string]*Table) *Parser {
+	t.Helper()
+
+	p := NewParser(nil)
+	namespaces := map[string]*Namespace{}
+	for nsid, tbl := range tables {
+		ns := NewNamespace(nsid, CanonicalPlatforms[nsid], p, nil)
+		tbl.NamespaceID = nsid
+		ns.Tables[tbl.Name] = tbl
+		namespaces[nsid] = ns
+	}
+	if err := p.InjectTables(namespaces); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// TestParseDirectoryWorkers parses a spec tree larger than the pipeline's buffers with several worker counts,
+// and checks every count records the same tables. Run it with -race to check the pipeline's synchronization.
+func TestParseDirectoryWorkers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osqt-specs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const tables = 20 * parseBuffer
+	writeSpecTree(t, dir, tables)
+
+	var want []string
+	for _, workers := range []int{1, 2, 8, 64} {
+		for run := 0; run < 3; run++ {
+			parser := NewParserWithOptions(nil, ParserOptions{Workers: workers})
+			if err := parser.ParseDirectory(dir); err != nil {
+				t.Fatalf("workers=%d: %v", workers, err)
+			}
+			got := parsedTables(parser)
+			if len(got) != tables {
+				t.Fatalf("workers=%d: parsed %d tables, want %d", workers, len(got), tables)
+			}
+			if want == nil {
+				want = got
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("workers=%d: parsed tables differ from workers=1", workers)
+			}
+		}
+	}
+}
+
+// TestParseDirectoryError checks a spec tree with a file the recorder rejects fails with an error, rather than
+// hanging or leaking the pipeline's goroutines, whatever the worker count.
+func TestParseDirectoryError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osqt-specs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeSpecTree(t, dir, 4*parseBuffer)
+	if err := os.MkdirAll(filepath.Join(dir, "unknown"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "unknown", "stray.table"), []byte("table_name(\"stray\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 2, 8, 64} {
+		parser := NewParserWithOptions(nil, ParserOptions{Workers: workers})
+		if err := parser.ParseDirectory(dir); err == nil {
+			t.Fatalf("workers=%d: expected an error for a spec in an unknown namespace directory", workers)
+		}
+	}
+}
+
+// TestParseDirectorySymlinks checks spec files linked into the specs directory are parsed like the files they
+// point to, and that links which cannot be followed are skipped.
+func TestParseDirectorySymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osqt-specs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	specs := filepath.Join(dir, "specs")
+	writeSpecTree(t, specs, 1)
+	target := filepath.Join(dir, "linked_table.table")
+	if err := ioutil.WriteFile(target, []byte("table_name(\"linked_table\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(specs, "specs", "linked_table.table")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing.table"), filepath.Join(specs, "specs", "dangling.table")); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewParser(nil)
+	if err := parser.ParseDirectory(specs); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parser.Namespaces["specs"].Tables["linked_table"]; !ok {
+		t.Errorf("symlinked spec was not parsed, got %v", parsedTables(parser))
+	}
+	if _, ok := parser.Namespaces["specs"].Tables["dangling"]; ok {
+		t.Error("dangling symlink was parsed")
+	}
+}
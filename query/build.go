@@ -0,0 +1,38 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/gen0cide/osqt"
+)
+
+// DisabledTableRule is the rule CheckBuild reports findings as.
+const DisabledTableRule = "disabled-table"
+
+// CheckBuild reports a warning for each table sql queries that an osquery deployment built and configured as
+// build does not serve, such as tables disabled with --disable_tables. Unlike the registered rules it depends on
+// a deployment, so it is run separately from Lint.
+func CheckBuild(parser *osqt.Parser, sql string, build *osqt.BuildConfig) ([]*Finding, error) {
+	rule := &Rule{
+		Name:     DisabledTableRule,
+		Severity: SeverityWarning,
+		Check: func(stmt *Statement, parser *osqt.Parser) []*Finding {
+			findings := []*Finding{}
+			for _, ref := range stmt.Tables {
+				if ref.Derived || ref.CTE {
+					continue
+				}
+				tbl := LookupTable(parser, ref.Name)
+				if tbl == nil || build.Includes(tbl.NamespaceID, tbl.Name) {
+					continue
+				}
+				findings = append(findings, &Finding{
+					Message: fmt.Sprintf("table %s is disabled in the target osquery configuration", tbl.Name),
+					Pos:     ref.Pos,
+				})
+			}
+			return findings
+		},
+	}
+	return lintWith(parser, sql, []*Rule{rule})
+}
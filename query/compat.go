@@ -0,0 +1,115 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Compatibility is whether a query can run on a platform. MissingTables are the osquery tables it queries that
+// the platform does not have, and MissingColumns the columns (as table.column) of the tables it does have that
+// only exist on other platforms, such as those of another platform's extended schema. Tables and columns missing
+// from the schema entirely are missing on every platform.
+type Compatibility struct {
+	Platform       string   `json:"platform"`
+	Compatible     bool     `json:"compatible"`
+	MissingTables  []string `json:"missing_tables,omitempty"`
+	MissingColumns []string `json:"missing_columns,omitempty"`
+}
+
+// CheckCompatibility reports the Compatibility of sql with every platform of osqt.GOOSToApplicableNamespaces, in
+// platform order.
+func CheckCompatibility(parser *osqt.Parser, sql string) ([]*Compatibility, error) {
+	segments, err := SplitStatements(sql)
+	if err != nil {
+		return nil, err
+	}
+	stmts := make([]*Statement, 0, len(segments))
+	for _, seg := range segments {
+		stmt, err := Parse(seg.SQL)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	platforms := []string{}
+	for goos := range osqt.GOOSToApplicableNamespaces {
+		platforms = append(platforms, goos)
+	}
+	sort.Strings(platforms)
+
+	report := []*Compatibility{}
+	for _, goos := range platforms {
+		available := parser.TablesFor(goos)
+		tables, columns := map[string]bool{}, map[string]bool{}
+		for _, stmt := range stmts {
+			for _, tref := range stmt.Tables {
+				if tref.Derived || tref.CTE {
+					continue
+				}
+				tbl := LookupTable(parser, tref.Name)
+				if tbl == nil {
+					tables[strings.ToLower(tref.Name)] = true
+				} else if _, ok := available[tbl.Name]; !ok {
+					tables[tbl.Name] = true
+				}
+			}
+
+			for _, ref := range stmt.Columns {
+				res, tbl, col := stmt.resolve(parser, ref, 0)
+				switch {
+				case res == ColumnUnknown:
+					columns[columnName(ref)] = true
+				case col == nil || tables[tbl.Name]:
+				case !hasPlatformColumn(tbl, col, goos):
+					columns[fmt.Sprintf("%s.%s", tbl.Name, col.Name)] = true
+				}
+			}
+		}
+
+		compat := &Compatibility{
+			Platform:       goos,
+			Compatible:     len(tables) == 0 && len(columns) == 0,
+			MissingTables:  sortedNames(tables),
+			MissingColumns: sortedNames(columns),
+		}
+		report = append(report, compat)
+	}
+	return report, nil
+}
+
+// hasPlatformColumn returns true if col is one of the columns tbl has on goos.
+func hasPlatformColumn(tbl *osqt.Table, col *osqt.Column, goos string) bool {
+	schemas := []*osqt.Schema{tbl.Schema, tbl.ExtendedSchemaFor(goos)}
+	for _, s := range schemas {
+		if s == nil {
+			continue
+		}
+		for _, c := range s.Columns {
+			if c == col || strings.EqualFold(c.Name, col.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// columnName is the name of ref as written.
+func columnName(ref *ColumnRef) string {
+	if ref.Qualifier != "" {
+		return ref.Qualifier + "." + ref.Name
+	}
+	return ref.Name
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
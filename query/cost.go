@@ -0,0 +1,231 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Cost factor kinds, the patterns EstimateCost scores.
+const (
+	CostFullScan      = "full-scan"
+	CostUnboundedJoin = "unbounded-join"
+	CostUnindexedLike = "unindexed-like"
+	CostPolledEvents  = "polled-events"
+	CostExpiredEvents = "expired-events"
+)
+
+// costWeights are the points each factor kind adds to a query's score.
+var costWeights = map[string]int{
+	CostFullScan:      40,
+	CostUnboundedJoin: 25,
+	CostPolledEvents:  15,
+	CostUnindexedLike: 10,
+	CostExpiredEvents: 10,
+}
+
+// ShortInterval is the interval in seconds below which polling a table that has an evented counterpart is scored,
+// and EventsExpiry the default --events_expiry of osquery, past which events are dropped before a query sees them.
+const (
+	ShortInterval = 300
+	EventsExpiry  = 3600
+)
+
+// eventedAlternatives maps tables that are commonly polled to the evented tables that record the same activity
+// as it happens.
+var eventedAlternatives = map[string][]string{
+	"processes":            {"process_events", "es_process_events"},
+	"process_open_sockets": {"socket_events"},
+	"listening_ports":      {"socket_events"},
+	"file":                 {"file_events", "ntfs_journal_events"},
+	"hash":                 {"file_events"},
+	"usb_devices":          {"hardware_events"},
+}
+
+// CostFactor is an expensive pattern found in a query. Pos, Line and Column are relative to the whole input, like
+// those of a Finding.
+type CostFactor struct {
+	Kind       string `json:"kind"`
+	Score      int    `json:"score"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Pos        int    `json:"pos"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+}
+
+// Cost is the estimated cost of a query: the sum of the scores of its Factors, rated low, medium or high.
+type Cost struct {
+	Score   int           `json:"score"`
+	Rating  string        `json:"rating"`
+	Factors []*CostFactor `json:"factors"`
+}
+
+// EstimateCost scores sql against known-expensive patterns: unconstrained scans of expensive tables, joins whose
+// tables are not constrained against each other, LIKE on columns osquery cannot use to narrow a table's work, and
+// evented tables that interval makes a poor fit for. An interval of 0 (unknown) skips the interval patterns.
+func EstimateCost(parser *osqt.Parser, sql string, interval int) (*Cost, error) {
+	segments, err := SplitStatements(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &Statement{SQL: sql}
+	cost := &Cost{Factors: []*CostFactor{}}
+	for _, seg := range segments {
+		stmt, err := Parse(seg.SQL)
+		if err != nil {
+			return nil, err
+		}
+
+		factors := costFullScans(stmt, parser)
+		factors = append(factors, costJoins(stmt, parser)...)
+		factors = append(factors, costLikes(stmt, parser)...)
+		factors = append(factors, costIntervals(stmt, parser, interval)...)
+		for _, f := range factors {
+			f.Score = costWeights[f.Kind]
+			f.Pos += seg.Pos
+			f.Line, f.Column = input.LineColumn(f.Pos)
+			cost.Score += f.Score
+			cost.Factors = append(cost.Factors, f)
+		}
+	}
+
+	sort.SliceStable(cost.Factors, func(i, j int) bool { return cost.Factors[i].Pos < cost.Factors[j].Pos })
+	switch {
+	case cost.Score >= 40:
+		cost.Rating = "high"
+	case cost.Score >= 20:
+		cost.Rating = "medium"
+	default:
+		cost.Rating = "low"
+	}
+	return cost, nil
+}
+
+// costFullScans reports the expensive tables the expensive-table rule would, which scan all of their work.
+func costFullScans(stmt *Statement, parser *osqt.Parser) []*CostFactor {
+	factors := []*CostFactor{}
+	for _, f := range checkExpensiveTables(stmt, parser) {
+		factors = append(factors, &CostFactor{Kind: CostFullScan, Message: f.Message, Suggestion: f.Suggestion, Pos: f.Pos})
+	}
+	return factors
+}
+
+// costJoins reports the tables joined to others of the same SELECT without any WHERE or ON constraint on them,
+// which multiplies the rows osquery generates by theirs.
+func costJoins(stmt *Statement, parser *osqt.Parser) []*CostFactor {
+	factors := []*CostFactor{}
+	seen := map[int]bool{}
+	for _, tref := range stmt.Tables {
+		if !seen[tref.Scope] {
+			seen[tref.Scope] = true
+			continue
+		}
+		if tref.Derived && tref.Name == "" || constrainsTable(stmt, parser, tref, nil) {
+			continue
+		}
+
+		name := strings.ToLower(tref.Name)
+		if name == "" {
+			name = "subquery"
+		}
+		factors = append(factors, &CostFactor{
+			Kind:       CostUnboundedJoin,
+			Message:    fmt.Sprintf("%s is joined without a constraint, producing every combination of its rows with the other tables'", name),
+			Suggestion: "join it ON a column shared with the other tables",
+			Pos:        tref.Pos,
+		})
+	}
+	return factors
+}
+
+// costLikes reports LIKE comparisons of columns that are not index, additional or required columns, which osquery
+// applies only after generating every row of the table.
+func costLikes(stmt *Statement, parser *osqt.Parser) []*CostFactor {
+	factors := []*CostFactor{}
+	if parser == nil {
+		return factors
+	}
+
+	for _, ref := range stmt.Columns {
+		if ref.Clause != "WHERE" && ref.Clause != "ON" {
+			continue
+		}
+		_, last := stmt.refTokens(ref)
+		if last < 0 {
+			continue
+		}
+		next := last + 1
+		if next < len(stmt.Tokens) && stmt.Tokens[next].Is("NOT") {
+			next++
+		}
+		if next >= len(stmt.Tokens) || !stmt.Tokens[next].Is("LIKE") {
+			continue
+		}
+
+		tbl, col := stmt.ResolveColumn(parser, ref)
+		if tbl == nil || columnOption(col, "index") || columnOption(col, "additional") || columnOption(col, "required") {
+			continue
+		}
+		factors = append(factors, &CostFactor{
+			Kind:       CostUnindexedLike,
+			Message:    fmt.Sprintf("%s.%s is not an indexed column, so LIKE filters it only after %s generates every row", tbl.Name, col.Name, tbl.Name),
+			Suggestion: "constrain an indexed column as well, or compare with = where possible",
+			Pos:        ref.Pos,
+		})
+	}
+	return factors
+}
+
+// costIntervals reports tables polled at a short interval that have evented counterparts, which see activity
+// between runs, and evented tables queried less often than their events expire.
+func costIntervals(stmt *Statement, parser *osqt.Parser, interval int) []*CostFactor {
+	factors := []*CostFactor{}
+	if interval <= 0 {
+		return factors
+	}
+
+	for _, tref := range stmt.Tables {
+		if tref.Derived || tref.CTE {
+			continue
+		}
+		name := strings.ToLower(tref.Name)
+		var tbl *osqt.Table
+		if parser != nil {
+			tbl = LookupTable(parser, name)
+		}
+
+		if tbl != nil && tbl.IsEvented() && interval > EventsExpiry {
+			factors = append(factors, &CostFactor{
+				Kind:       CostExpiredEvents,
+				Message:    fmt.Sprintf("%s is evented and its events expire after %d seconds by default, so a query every %d seconds misses some", name, EventsExpiry, interval),
+				Suggestion: fmt.Sprintf("query it at an interval of %d seconds or less", EventsExpiry),
+				Pos:        tref.Pos,
+			})
+			continue
+		}
+
+		if interval >= ShortInterval {
+			continue
+		}
+		alternatives := []string{}
+		for _, alt := range eventedAlternatives[name] {
+			if parser == nil || LookupTable(parser, alt) != nil {
+				alternatives = append(alternatives, alt)
+			}
+		}
+		if len(alternatives) == 0 {
+			continue
+		}
+		factors = append(factors, &CostFactor{
+			Kind:       CostPolledEvents,
+			Message:    fmt.Sprintf("%s is polled every %d seconds, yet still misses activity between runs", name, interval),
+			Suggestion: "query " + strings.Join(alternatives, " or ") + " instead",
+			Pos:        tref.Pos,
+		})
+	}
+	return factors
+}
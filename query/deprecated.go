@@ -0,0 +1,60 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/gen0cide/osqt"
+)
+
+// DeprecatedRule is the rule findings of deprecated tables and columns are reported as.
+const DeprecatedRule = "deprecated"
+
+var deprecatedRule = &Rule{
+	Name:        DeprecatedRule,
+	Description: "Deprecated tables and columns may be removed from osquery; query their replacements instead.",
+	Severity:    SeverityWarning,
+	Check:       checkDeprecated,
+}
+
+func init() {
+	MustRegisterRule(deprecatedRule)
+}
+
+// CheckDeprecations reports a warning for each table and column sql uses that is deprecated, as marked by a
+// deprecation overlay or osqt.Parser.DetectDeprecations.
+func CheckDeprecations(parser *osqt.Parser, sql string) ([]*Finding, error) {
+	return lintWith(parser, sql, []*Rule{deprecatedRule})
+}
+
+func checkDeprecated(stmt *Statement, parser *osqt.Parser) []*Finding {
+	findings := []*Finding{}
+	if parser == nil {
+		return findings
+	}
+
+	for _, tref := range stmt.Tables {
+		if tref.Derived || tref.CTE {
+			continue
+		}
+		tbl := LookupTable(parser, tref.Name)
+		if tbl == nil || tbl.Deprecated == "" {
+			continue
+		}
+		findings = append(findings, &Finding{
+			Message: fmt.Sprintf("table %s is deprecated: %s", tbl.Name, tbl.Deprecated),
+			Pos:     tref.Pos,
+		})
+	}
+
+	for _, ref := range stmt.Columns {
+		tbl, col := stmt.ResolveColumn(parser, ref)
+		if col == nil || col.Deprecated == "" {
+			continue
+		}
+		findings = append(findings, &Finding{
+			Message: fmt.Sprintf("column %s.%s is deprecated: %s", tbl.Name, col.Name, col.Deprecated),
+			Pos:     ref.Pos,
+		})
+	}
+	return findings
+}
@@ -0,0 +1,193 @@
+package query
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt"
+)
+
+// ExpensiveTableRule is the name of the rule reporting unconstrained queries of expensive tables.
+const ExpensiveTableRule = "expensive-table"
+
+func init() {
+	MustRegisterRule(&Rule{
+		Name:        ExpensiveTableRule,
+		Description: "Queries of expensive tables, such as file and hash, must constrain the columns that bound their work (or use LIMIT where that suffices).",
+		Severity:    SeverityWarning,
+		Check:       checkExpensiveTables,
+	})
+}
+
+// ExpensiveTable is a table that is slow or resource hungry to query without constraints. Queries of it must
+// constrain one of Columns in a WHERE or ON clause, or, when Limit is set, may use LIMIT instead. A table without
+// Columns may be bounded by any constraint on it or by LIMIT.
+type ExpensiveTable struct {
+	Columns []string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Limit   bool     `json:"limit,omitempty" yaml:"limit,omitempty"`
+	Reason  string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// DefaultExpensiveTables are the tables the expensive-table rule checks unless SetExpensiveTables replaces them.
+var DefaultExpensiveTables = map[string]*ExpensiveTable{
+	"file": {
+		Columns: []string{"path", "directory"},
+		Reason:  "walks the filesystem",
+	},
+	"hash": {
+		Columns: []string{"path", "directory"},
+		Reason:  "reads and hashes every file it walks",
+	},
+	"yara": {
+		Columns: []string{"path", "directory", "pid"},
+		Reason:  "scans every file or process it walks",
+	},
+	"deb_packages": {
+		Columns: []string{"name"},
+		Limit:   true,
+		Reason:  "lists every package, which is slow on servers with many installed",
+	},
+	"rpm_packages": {
+		Columns: []string{"name"},
+		Limit:   true,
+		Reason:  "lists every package, which is slow on servers with many installed",
+	},
+}
+
+var (
+	expensiveMu     sync.RWMutex
+	expensiveTables = DefaultExpensiveTables
+)
+
+// SetExpensiveTables replaces the tables the expensive-table rule checks, keyed by table name.
+func SetExpensiveTables(tables map[string]*ExpensiveTable) {
+	expensiveMu.Lock()
+	defer expensiveMu.Unlock()
+
+	expensiveTables = map[string]*ExpensiveTable{}
+	for name, t := range tables {
+		if t == nil {
+			t = &ExpensiveTable{Limit: true}
+		}
+		expensiveTables[strings.ToLower(name)] = t
+	}
+}
+
+// LoadExpensiveTables reads a YAML or JSON file mapping table names to their ExpensiveTable settings, for
+// SetExpensiveTables.
+func LoadExpensiveTables(fileloc string) (map[string]*ExpensiveTable, error) {
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading expensive tables: %v", err)
+	}
+
+	tables := map[string]*ExpensiveTable{}
+	if err := yaml.Unmarshal(data, &tables); err != nil {
+		return nil, xerrors.Errorf("error parsing expensive tables %s: %v", fileloc, err)
+	}
+	return tables, nil
+}
+
+func expensiveTable(name string) *ExpensiveTable {
+	expensiveMu.RLock()
+	defer expensiveMu.RUnlock()
+
+	return expensiveTables[strings.ToLower(name)]
+}
+
+func checkExpensiveTables(stmt *Statement, parser *osqt.Parser) []*Finding {
+	limited := false
+	for _, tok := range stmt.Tokens {
+		if tok.Is("LIMIT") {
+			limited = true
+			break
+		}
+	}
+
+	findings := []*Finding{}
+	for _, tref := range stmt.Tables {
+		if tref.Derived || tref.CTE {
+			continue
+		}
+		// tables with required columns left unconstrained are reported by the required-constraint rule instead
+		if parser != nil {
+			if tbl := LookupTable(parser, tref.Name); tbl != nil {
+				if required := requiredColumns(tbl); len(required) > 0 && !constrainsTable(stmt, parser, tref, required) {
+					continue
+				}
+			}
+		}
+		expensive := expensiveTable(tref.Name)
+		if expensive == nil || ((expensive.Limit || len(expensive.Columns) == 0) && limited) || constrainsTable(stmt, parser, tref, expensive.Columns) {
+			continue
+		}
+
+		name := strings.ToLower(tref.Name)
+		qualifier := name
+		if tref.Alias != "" {
+			qualifier = tref.Alias
+		}
+		message := fmt.Sprintf("%s is expensive to query without constraints", name)
+		if expensive.Reason != "" {
+			message = fmt.Sprintf("%s %s; constrain it so the query cannot hang the host", name, expensive.Reason)
+		}
+
+		suggestions := []string{}
+		for _, col := range expensive.Columns {
+			suggestions = append(suggestions, fmt.Sprintf("WHERE %s.%s = '...'", qualifier, col))
+		}
+		if expensive.Limit || len(expensive.Columns) == 0 {
+			suggestions = append(suggestions, "LIMIT 100")
+		}
+		findings = append(findings, &Finding{
+			Message:    message,
+			Suggestion: "add " + strings.Join(suggestions, " or "),
+			Pos:        tref.Pos,
+		})
+	}
+	return findings
+}
+
+// constrainsTable returns true if a WHERE or ON clause of stmt refers to a column of tref in columns, or to any of
+// its columns when columns is empty.
+func constrainsTable(stmt *Statement, parser *osqt.Parser, tref *TableRef, columns []string) bool {
+	wanted := func(name string) bool {
+		for _, col := range columns {
+			if strings.EqualFold(col, name) {
+				return true
+			}
+		}
+		return len(columns) == 0
+	}
+
+	for _, ref := range stmt.Columns {
+		if ref.Clause != "WHERE" && ref.Clause != "ON" {
+			continue
+		}
+		if parser != nil {
+			if tbl, col := stmt.ResolveColumn(parser, ref); tbl != nil {
+				if strings.EqualFold(tbl.Name, tref.Name) && wanted(col.Name) {
+					return true
+				}
+				continue
+			}
+		}
+
+		// tables missing from the schema are matched by qualifier, or by scope for unqualified references
+		if ref.Qualifier != "" && !tref.matches(ref.Qualifier) {
+			continue
+		}
+		if ref.Qualifier == "" && ref.Scope != tref.Scope {
+			continue
+		}
+		if wanted(ref.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package query
+
+import (
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Severity is how serious a lint finding is.
+type Severity string
+
+// The severities a Rule may report findings at.
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Finding is a problem a Rule found in a statement. Statement is the 1-based index of the statement it was found
+// in when the linted input contains several; Pos, Line and Column are relative to the whole input. Suggestion,
+// when set, describes how to fix the problem.
+type Finding struct {
+	Rule       string   `json:"rule"`
+	Severity   Severity `json:"severity"`
+	Message    string   `json:"message"`
+	Suggestion string   `json:"suggestion,omitempty"`
+	Statement  int      `json:"statement,omitempty"`
+	Pos        int      `json:"pos"`
+	Line       int      `json:"line"`
+	Column     int      `json:"column"`
+}
+
+// Rule is a check run against every linted statement. Findings returned by Check that do not set a Rule or
+// Severity inherit the rule's.
+type Rule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	Check       func(stmt *Statement, parser *osqt.Parser) []*Finding
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]*Rule{}
+)
+
+// RegisterRule adds a lint rule. It returns an error if the name is already taken.
+func RegisterRule(r *Rule) error {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if _, exists := rules[r.Name]; exists {
+		return xerrors.Errorf("a lint rule named %s is already registered", r.Name)
+	}
+	rules[r.Name] = r
+	return nil
+}
+
+// MustRegisterRule is RegisterRule, but panics on error.
+func MustRegisterRule(r *Rule) {
+	if err := RegisterRule(r); err != nil {
+		panic(err)
+	}
+}
+
+// Rules returns every registered rule, ordered by name.
+func Rules() []*Rule {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	ret := make([]*Rule, 0, len(rules))
+	for _, r := range rules {
+		ret = append(ret, r)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Lint scans sql and runs every registered rule against it, returning the findings in the order they occur.
+// Inputs containing several semicolon separated statements have each statement checked on its own.
+func Lint(parser *osqt.Parser, sql string) ([]*Finding, error) {
+	return lintWith(parser, sql, Rules())
+}
+
+// lintWith is Lint, running the given rules.
+func lintWith(parser *osqt.Parser, sql string, rules []*Rule) ([]*Finding, error) {
+	segments, err := SplitStatements(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &Statement{SQL: sql}
+	findings := []*Finding{}
+	for idx, seg := range segments {
+		stmt, err := Parse(seg.SQL)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range rules {
+			for _, f := range r.Check(stmt, parser) {
+				if f.Rule == "" {
+					f.Rule = r.Name
+				}
+				if f.Severity == "" {
+					f.Severity = r.Severity
+				}
+				if len(segments) > 1 {
+					f.Statement = idx + 1
+				}
+				f.Pos += seg.Pos
+				f.Line, f.Column = input.LineColumn(f.Pos)
+				findings = append(findings, f)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Pos < findings[j].Pos })
+	return findings, nil
+}
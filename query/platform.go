@@ -0,0 +1,41 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/gen0cide/osqt"
+)
+
+// UnavailableTableRule is the rule CheckPlatform reports findings as.
+const UnavailableTableRule = "unavailable-table"
+
+// CheckPlatform reports an error for each table sql queries that osquery does not have on the GOOS runtime goos.
+// Like CheckBuild, it depends on the deployment, so it is run separately from Lint.
+func CheckPlatform(parser *osqt.Parser, sql string, goos string) ([]*Finding, error) {
+	available := parser.TablesFor(goos)
+	rule := &Rule{
+		Name:     UnavailableTableRule,
+		Severity: SeverityError,
+		Check: func(stmt *Statement, parser *osqt.Parser) []*Finding {
+			findings := []*Finding{}
+			for _, ref := range stmt.Tables {
+				if ref.Derived || ref.CTE {
+					continue
+				}
+				tbl := LookupTable(parser, ref.Name)
+				if tbl == nil {
+					continue
+				}
+				if _, ok := available[tbl.Name]; ok {
+					continue
+				}
+				findings = append(findings, &Finding{
+					Message: fmt.Sprintf("table %s is not available on %s", tbl.Name, goos),
+					Pos:     ref.Pos,
+				})
+			}
+			return findings
+		},
+	}
+	return lintWith(parser, sql, []*Rule{rule})
+}
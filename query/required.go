@@ -0,0 +1,80 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegisterRule(&Rule{
+		Name:        "required-constraint",
+		Description: "Tables with required columns, such as file and curl, return nothing (or fail) unless one of them is constrained in a WHERE or ON clause.",
+		Severity:    SeverityError,
+		Check:       checkRequiredConstraints,
+	})
+}
+
+// columnOption returns true if the spec option opt of col is set, e.g. required=True.
+func columnOption(col *osqt.Column, opt string) bool {
+	val, ok := col.Options[opt]
+	return ok && strings.EqualFold(fmt.Sprintf("%v", val), "true")
+}
+
+// requiredColumns returns the names of the columns of tbl marked required in its spec. Columns marked index only
+// make constraining them cheaper, so they are not required.
+func requiredColumns(tbl *osqt.Table) []string {
+	names := []string{}
+	for _, col := range TableColumns(tbl) {
+		if columnOption(col, "required") && !containsFold(names, col.Name) {
+			names = append(names, col.Name)
+		}
+	}
+	return names
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRequiredConstraints(stmt *Statement, parser *osqt.Parser) []*Finding {
+	findings := []*Finding{}
+	if parser == nil {
+		return findings
+	}
+
+	for _, tref := range stmt.Tables {
+		if tref.Derived || tref.CTE {
+			continue
+		}
+		tbl := LookupTable(parser, tref.Name)
+		if tbl == nil {
+			continue
+		}
+		required := requiredColumns(tbl)
+		if len(required) == 0 || constrainsTable(stmt, parser, tref, required) {
+			continue
+		}
+
+		qualifier := tbl.Name
+		if tref.Alias != "" {
+			qualifier = tref.Alias
+		}
+		suggestions := make([]string, 0, len(required))
+		for _, name := range required {
+			suggestions = append(suggestions, fmt.Sprintf("WHERE %s.%s = '...'", qualifier, name))
+		}
+		findings = append(findings, &Finding{
+			Message:    fmt.Sprintf("%s requires a constraint on %s; without one osquery returns no rows", tbl.Name, strings.Join(required, " or ")),
+			Suggestion: "add " + strings.Join(suggestions, " or "),
+			Pos:        tref.Pos,
+		})
+	}
+	return findings
+}
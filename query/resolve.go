@@ -0,0 +1,212 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Resolution is the outcome of resolving a column reference against the tables in its scope.
+type Resolution int
+
+// The outcomes of Statement.Resolve.
+const (
+	// ColumnResolved means the reference names a column of a table, subquery or common table expression in scope,
+	// or the alias of a result column.
+	ColumnResolved Resolution = iota
+	// ColumnUnknown means the columns of everything in scope are known and none of them match the reference.
+	ColumnUnknown
+	// ColumnUnverifiable means the reference may name a column of something whose columns are not known, such as
+	// a table missing from the schema or a table valued function, so it cannot be checked.
+	ColumnUnverifiable
+)
+
+// maxResolveDepth bounds how many subqueries and common table expressions a reference is followed through, so
+// that self referencing expressions terminate.
+const maxResolveDepth = 32
+
+// tableFunctionColumns are the columns of the table valued functions built into osquery's SQLite.
+var tableFunctionColumns = map[string][]string{
+	"json_each": {"key", "value", "type", "atom", "id", "parent", "fullkey", "path", "json", "root"},
+	"json_tree": {"key", "value", "type", "atom", "id", "parent", "fullkey", "path", "json", "root"},
+}
+
+// rowidColumns are the names SQLite accepts for the implicit rowid of a table.
+var rowidColumns = map[string]bool{"rowid": true, "oid": true, "_rowid_": true}
+
+// Resolve determines whether ref names a column that exists. Unqualified references are looked up in the tables
+// of their own SELECT, then among its result column aliases, and then in the enclosing SELECTs, as SQLite does
+// for correlated subqueries. Columns of subqueries and common table expressions are their result columns.
+func (s *Statement) Resolve(parser *osqt.Parser, ref *ColumnRef) Resolution {
+	res, _, _ := s.resolve(parser, ref, 0)
+	return res
+}
+
+func (s *Statement) resolve(parser *osqt.Parser, ref *ColumnRef, depth int) (Resolution, *osqt.Table, *osqt.Column) {
+	if depth > maxResolveDepth {
+		return ColumnUnverifiable, nil, nil
+	}
+
+	unverifiable := false
+	for id := ref.Scope; ; {
+		matched := false
+		for _, tref := range s.Tables {
+			if tref.Scope != id || !tref.matches(ref.Qualifier) {
+				continue
+			}
+			matched = true
+			res, tbl, col := s.sourceColumn(parser, tref, ref.Name, depth)
+			switch res {
+			case ColumnResolved:
+				return res, tbl, col
+			case ColumnUnverifiable:
+				unverifiable = true
+			}
+		}
+		if ref.Qualifier == "" && s.isResultAlias(id, ref) {
+			return ColumnResolved, nil, nil
+		}
+
+		sc := s.Scope(id)
+		if sc == nil || matched && ref.Qualifier != "" {
+			break
+		}
+		id = sc.Parent
+	}
+
+	// outside of a SELECT there is nothing to resolve against
+	if unverifiable || ref.Scope == 0 {
+		return ColumnUnverifiable, nil, nil
+	}
+	return ColumnUnknown, nil, nil
+}
+
+// matches returns true if the table is the one qualifier refers to. An empty qualifier matches every table.
+func (t *TableRef) matches(qualifier string) bool {
+	return qualifier == "" || strings.EqualFold(qualifier, t.Alias) || strings.EqualFold(qualifier, t.Name)
+}
+
+// isResultAlias returns true if ref names a result column of the SELECT with the given ID, other than itself.
+// SQLite allows result column aliases to be used in the WHERE, GROUP BY, HAVING and ORDER BY clauses.
+func (s *Statement) isResultAlias(id int, ref *ColumnRef) bool {
+	sc := s.Scope(id)
+	if sc == nil {
+		return false
+	}
+	for _, col := range sc.Columns {
+		if col.Name != "*" && col.Source != ref && strings.EqualFold(col.Name, ref.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceColumn looks up the named column in what tref refers to.
+func (s *Statement) sourceColumn(parser *osqt.Parser, tref *TableRef, name string, depth int) (Resolution, *osqt.Table, *osqt.Column) {
+	switch {
+	case tref.Derived && tref.Subquery != 0:
+		return s.scopeColumn(parser, tref.Subquery, name, depth+1)
+	case tref.Derived:
+		cols, ok := tableFunctionColumns[strings.ToLower(tref.Name)]
+		if !ok {
+			return ColumnUnverifiable, nil, nil
+		}
+		for _, col := range cols {
+			if strings.EqualFold(col, name) {
+				return ColumnResolved, nil, nil
+			}
+		}
+		return ColumnUnknown, nil, nil
+	case tref.CTE:
+		return s.cteColumn(parser, tref.Name, name, depth+1)
+	}
+
+	if parser == nil {
+		return ColumnUnverifiable, nil, nil
+	}
+	tbl := LookupTable(parser, tref.Name)
+	if tbl == nil {
+		return ColumnUnverifiable, nil, nil
+	}
+	if col := tbl.Column(name); col != nil {
+		return ColumnResolved, tbl, col
+	}
+	if rowidColumns[strings.ToLower(name)] {
+		return ColumnResolved, nil, nil
+	}
+	return ColumnUnknown, nil, nil
+}
+
+// cteColumn looks up the named column in a common table expression. When the expression lists its columns,
+// e.g. WITH t(a, b) AS (...), they name its body's result columns by position.
+func (s *Statement) cteColumn(parser *osqt.Parser, cte, name string, depth int) (Resolution, *osqt.Table, *osqt.Column) {
+	var body *Scope
+	for _, sc := range s.Scopes {
+		if strings.EqualFold(sc.CTE, cte) {
+			body = sc
+			break
+		}
+	}
+
+	cols, listed := s.cteColumns[strings.ToLower(cte)]
+	if !listed {
+		if body == nil {
+			return ColumnUnverifiable, nil, nil
+		}
+		return s.scopeColumn(parser, body.ID, name, depth)
+	}
+	for idx, col := range cols {
+		if !strings.EqualFold(col, name) {
+			continue
+		}
+		if body != nil && idx < len(body.Columns) && body.Columns[idx].Source != nil {
+			if res, tbl, col := s.resolve(parser, body.Columns[idx].Source, depth+1); res == ColumnResolved {
+				return res, tbl, col
+			}
+		}
+		return ColumnResolved, nil, nil
+	}
+	return ColumnUnknown, nil, nil
+}
+
+// scopeColumn looks up the named column among the result columns of the SELECT with the given ID. Plain column
+// results are followed to the table they select from, so the schema column can be returned.
+func (s *Statement) scopeColumn(parser *osqt.Parser, id int, name string, depth int) (Resolution, *osqt.Table, *osqt.Column) {
+	sc := s.Scope(id)
+	if sc == nil || len(sc.Columns) == 0 || depth > maxResolveDepth {
+		return ColumnUnverifiable, nil, nil
+	}
+
+	unverifiable := false
+	for _, col := range sc.Columns {
+		if col.Name == "*" {
+			for _, tref := range s.Tables {
+				if tref.Scope != id || !tref.matches(col.Qualifier) {
+					continue
+				}
+				res, tbl, scol := s.sourceColumn(parser, tref, name, depth+1)
+				switch res {
+				case ColumnResolved:
+					return res, tbl, scol
+				case ColumnUnverifiable:
+					unverifiable = true
+				}
+			}
+			continue
+		}
+		if !strings.EqualFold(col.Name, name) {
+			continue
+		}
+		if col.Source != nil {
+			if res, tbl, scol := s.resolve(parser, col.Source, depth+1); res == ColumnResolved {
+				return res, tbl, scol
+			}
+		}
+		return ColumnResolved, nil, nil
+	}
+
+	if unverifiable {
+		return ColumnUnverifiable, nil, nil
+	}
+	return ColumnUnknown, nil, nil
+}
@@ -0,0 +1,127 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gen0cide/osqt"
+)
+
+// caseTables are the osquery tables read by testdata/resolution_cases.conf, with the columns the cases rely on.
+var caseTables = map[string][]string{
+	"authorized_keys":      {"uid", "algorithm", "key", "key_file"},
+	"chrome_extensions":    {"name", "identifier", "version", "path", "permissions", "permissions_json"},
+	"crontab":              {"event", "minute", "hour", "command", "path"},
+	"deb_packages":         {"name", "version", "source", "arch"},
+	"docker_containers":    {"id", "name", "image", "command", "pid", "privileged"},
+	"file":                 {"path", "directory", "filename", "size", "mtime"},
+	"hash":                 {"path", "directory", "md5", "sha1", "sha256"},
+	"kernel_modules":       {"name", "size", "used_by", "status", "address"},
+	"listening_ports":      {"pid", "port", "protocol", "family", "address"},
+	"logged_in_users":      {"type", "user", "tty", "host", "time", "pid"},
+	"os_version":           {"name", "version", "major", "minor", "platform"},
+	"process_envs":         {"pid", "key", "value"},
+	"process_open_files":   {"pid", "fd", "path"},
+	"process_open_sockets": {"pid", "fd", "family", "protocol", "local_address", "remote_address", "local_port", "remote_port"},
+	"processes":            {"pid", "name", "path", "cmdline", "on_disk", "parent", "uid", "resident_size"},
+	"shell_history":        {"uid", "time", "command", "history_file"},
+	"suid_bin":             {"path", "username", "groupname", "permissions"},
+	"system_info":          {"hostname", "uuid", "cpu_brand", "physical_memory"},
+	"time":                 {"unix_time", "datetime", "timestamp"},
+	"uptime":               {"days", "hours", "minutes", "seconds", "total_seconds"},
+	"users":                {"uid", "gid", "username", "description", "directory", "shell"},
+}
+
+// caseParser returns a parser holding caseTables.
+func caseParser(t *testing.T) *osqt.Parser {
+	t.Helper()
+
+	p := osqt.NewParser(nil)
+	for name, columns := range caseTables {
+		b := osqt.NewTableBuilder(name)
+		for _, col := range columns {
+			b.Column(col, "TEXT", "")
+		}
+		tbl, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.RegisterTable(tbl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+// loadCases returns the queries of the pack at fileloc by name, skipping the comment lines osquery allows.
+func loadCases(t *testing.T, fileloc string) map[string]string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if !strings.HasPrefix(strings.TrimSpace(scanner.Text()), "//") {
+			body.WriteString(scanner.Text() + "\n")
+		}
+	}
+
+	pack := struct {
+		Queries map[string]struct {
+			Query string `json:"query"`
+		} `json:"queries"`
+	}{}
+	if err := json.Unmarshal(body.Bytes(), &pack); err != nil {
+		t.Fatalf("error decoding %s: %v", fileloc, err)
+	}
+	queries := map[string]string{}
+	for name, q := range pack.Queries {
+		queries[name] = q.Query
+	}
+	return queries
+}
+
+// TestResolutionCases resolves every column referenced by the queries of testdata/resolution_cases.conf, which read
+// their columns through CTEs, derived tables and correlated subqueries, so none of them may be unknown or
+// unverifiable.
+func TestResolutionCases(t *testing.T) {
+	parser := caseParser(t)
+	queries := loadCases(t, "testdata/resolution_cases.conf")
+	if len(queries) == 0 {
+		t.Fatal("no resolution cases")
+	}
+
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			stmt, err := Parse(queries[name])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stmt.Columns) == 0 {
+				t.Fatal("no column references found")
+			}
+			for _, ref := range stmt.Columns {
+				if ref.Qualifier == "" && nonColumnWords[strings.ToLower(ref.Name)] {
+					continue
+				}
+				if res := stmt.Resolve(parser, ref); res != ColumnResolved {
+					t.Errorf("column %q (qualifier %q, offset %d) did not resolve: %v", ref.Name, ref.Qualifier, ref.Pos, res)
+				}
+			}
+		})
+	}
+}
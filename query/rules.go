@@ -0,0 +1,236 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+func init() {
+	MustRegisterRule(&Rule{
+		Name:        "json-column-without-extract",
+		Description: "JSON columns should be filtered, joined and sorted on their fields with json_extract(), not as raw text.",
+		Severity:    SeverityWarning,
+		Check:       checkJSONColumns,
+	})
+	MustRegisterRule(&Rule{
+		Name:        "ip-address-pattern",
+		Description: "Matching IP address columns with LIKE or GLOB prefixes is not CIDR aware; use in_cidr_block() instead.",
+		Severity:    SeverityWarning,
+		Check:       checkAddressPatterns,
+	})
+	MustRegisterRule(&Rule{
+		Name:        "ip-address-compare",
+		Description: "Comparing IP address columns as strings orders them lexically; compare inet_aton() values instead.",
+		Severity:    SeverityWarning,
+		Check:       checkAddressComparisons,
+	})
+	MustRegisterRule(&Rule{
+		Name:        "unknown-column",
+		Description: "Columns must belong to a table, subquery or common table expression the query selects from.",
+		Severity:    SeverityError,
+		Check:       checkUnknownColumns,
+	})
+}
+
+// jsonFunctions are the SQLite functions that interpret their argument as a JSON document.
+var jsonFunctions = map[string]bool{
+	"json":              true,
+	"json_array_length": true,
+	"json_each":         true,
+	"json_extract":      true,
+	"json_tree":         true,
+	"json_type":         true,
+	"json_valid":        true,
+}
+
+func checkJSONColumns(stmt *Statement, parser *osqt.Parser) []*Finding {
+	findings := []*Finding{}
+	for _, ref := range stmt.Columns {
+		// selecting the whole document is fine, it is comparing against it as text that is fragile
+		if ref.Clause == "SELECT" {
+			continue
+		}
+		tbl, col := stmt.ResolveColumn(parser, ref)
+		if col == nil {
+			continue
+		}
+		if ct, ok := col.ColumnType(); !ok || ct.Name != osqt.JSONColumnType {
+			continue
+		}
+		if len(ref.Funcs) > 0 && jsonFunctions[ref.Funcs[0]] {
+			continue
+		}
+		if usesJSONOperator(stmt, ref) {
+			continue
+		}
+		findings = append(findings, &Finding{
+			Pos: ref.Pos,
+			Message: fmt.Sprintf("%s.%s holds a JSON document; use json_extract(%s, '$.field') instead of treating it as text",
+				tbl.Name, col.Name, col.Name),
+		})
+	}
+	return findings
+}
+
+// usesJSONOperator returns true if the column is the left operand of SQLite's -> or ->> operators.
+func usesJSONOperator(stmt *Statement, ref *ColumnRef) bool {
+	next := stmt.tokenAfter(ref)
+	return next != nil && (next.Is("->") || next.Is("->>"))
+}
+
+// refTokens returns the indexes of the first and last tokens of ref (which differ for qualified references), or
+// -1 if the reference is not in the statement's tokens.
+func (s *Statement) refTokens(ref *ColumnRef) (int, int) {
+	for i, tok := range s.Tokens {
+		if tok.Pos != ref.Pos {
+			continue
+		}
+		if ref.Qualifier != "" {
+			return i, i + 2
+		}
+		return i, i
+	}
+	return -1, -1
+}
+
+// tokenAfter returns the token following ref, or nil if there is none.
+func (s *Statement) tokenAfter(ref *ColumnRef) *Token {
+	_, last := s.refTokens(ref)
+	if last < 0 || last+1 >= len(s.Tokens) {
+		return nil
+	}
+	return &s.Tokens[last+1]
+}
+
+// addressColumnNames are the names (and name suffixes) osquery uses for columns holding IP addresses.
+var addressColumnNames = []string{"address", "_ip", "gateway", "broadcast", "netmask", "point_to_point"}
+
+// isAddressColumn returns true if ref names a column that holds IP addresses. Columns are recognized by name so
+// that queries against tables missing from the schema are still checked.
+func isAddressColumn(stmt *Statement, parser *osqt.Parser, ref *ColumnRef) bool {
+	name := strings.ToLower(ref.Name)
+	if strings.Contains(name, "mac") || strings.Contains(name, "email") || strings.Contains(name, "hardware") {
+		return false
+	}
+	if parser != nil {
+		if _, col := stmt.ResolveColumn(parser, ref); col != nil && col.Type != "TEXT" {
+			return false
+		}
+	}
+	if name == "ip" {
+		return true
+	}
+	for _, suffix := range addressColumnNames {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addressOperand finds the operator applied to ref and the string literal on its other side, for expressions of
+// the form `col OP 'literal'` and `'literal' OP col`, returning the operator, the literal and the expression as
+// written. It returns false if ref is not used that way.
+func addressOperand(stmt *Statement, ref *ColumnRef) (op string, literal *Token, expr string, ok bool) {
+	first, last := stmt.refTokens(ref)
+	if first < 0 {
+		return "", nil, "", false
+	}
+	toks := stmt.Tokens
+
+	if last+2 < len(toks) {
+		opIdx := last + 1
+		op = strings.ToUpper(toks[opIdx].Text)
+		if toks[opIdx].Is("NOT") && last+3 < len(toks) {
+			opIdx++
+			op = "NOT " + strings.ToUpper(toks[opIdx].Text)
+		}
+		if opIdx+1 < len(toks) && toks[opIdx+1].Kind == TokenString {
+			return op, &toks[opIdx+1], fmt.Sprintf("%s %s %s", ref.Name, op, toks[opIdx+1].Text), true
+		}
+	}
+	if first >= 2 && toks[first-2].Kind == TokenString {
+		op = strings.ToUpper(toks[first-1].Text)
+		return op, &toks[first-2], fmt.Sprintf("%s %s %s", toks[first-2].Text, op, ref.Name), true
+	}
+	return "", nil, "", false
+}
+
+func checkAddressPatterns(stmt *Statement, parser *osqt.Parser) []*Finding {
+	findings := []*Finding{}
+	for _, ref := range stmt.Columns {
+		if len(ref.Funcs) > 0 || !isAddressColumn(stmt, parser, ref) {
+			continue
+		}
+		op, _, expr, ok := addressOperand(stmt, ref)
+		if !ok || !strings.HasSuffix(op, "LIKE") && !strings.HasSuffix(op, "GLOB") {
+			continue
+		}
+		findings = append(findings, &Finding{
+			Pos:     ref.Pos,
+			Message: fmt.Sprintf("%s matches addresses as text and is not CIDR aware; use in_cidr_block('<cidr>', %s)", expr, ref.Name),
+		})
+	}
+	return findings
+}
+
+func checkAddressComparisons(stmt *Statement, parser *osqt.Parser) []*Finding {
+	findings := []*Finding{}
+	for _, ref := range stmt.Columns {
+		if len(ref.Funcs) > 0 || !isAddressColumn(stmt, parser, ref) {
+			continue
+		}
+		op, literal, expr, ok := addressOperand(stmt, ref)
+		if !ok {
+			continue
+		}
+		switch op {
+		case "<", "<=", ">", ">=", "BETWEEN", "NOT BETWEEN":
+		default:
+			continue
+		}
+		findings = append(findings, &Finding{
+			Pos: ref.Pos,
+			Message: fmt.Sprintf("%s compares addresses as strings, where '10.0.0.9' sorts after '10.0.0.10'; compare inet_aton(%s) against inet_aton(%s)",
+				expr, ref.Name, literal.Text),
+		})
+	}
+	return findings
+}
+
+// nonColumnWords are words SQLite accepts where a column could appear that are not columns.
+var nonColumnWords = map[string]bool{
+	"current_date": true, "current_time": true, "current_timestamp": true, "isnull": true, "notnull": true,
+	"nulls": true, "first": true, "last": true, "over": true, "partition": true, "filter": true, "rows": true,
+	"range": true, "unbounded": true, "preceding": true, "following": true, "current": true, "row": true,
+}
+
+func checkUnknownColumns(stmt *Statement, parser *osqt.Parser) []*Finding {
+	findings := []*Finding{}
+	if parser == nil {
+		return findings
+	}
+	for _, ref := range stmt.Columns {
+		// bound parameters
+		if ref.Name == "" || strings.ContainsAny(ref.Name[:1], "$@:") {
+			continue
+		}
+		if ref.Qualifier == "" && nonColumnWords[strings.ToLower(ref.Name)] {
+			continue
+		}
+		if stmt.Resolve(parser, ref) != ColumnUnknown {
+			continue
+		}
+		name := ref.Name
+		if ref.Qualifier != "" {
+			name = ref.Qualifier + "." + ref.Name
+		}
+		findings = append(findings, &Finding{
+			Pos:     ref.Pos,
+			Message: fmt.Sprintf("no such column: %s", name),
+		})
+	}
+	return findings
+}
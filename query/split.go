@@ -0,0 +1,46 @@
+package query
+
+import (
+	"strings"
+)
+
+// Segment is one statement of a multi-statement input. Pos is the byte offset of the statement in the input.
+type Segment struct {
+	SQL string `json:"sql"`
+	Pos int    `json:"pos"`
+}
+
+// SplitStatements splits sql on the semicolons that separate its statements, ignoring any inside string
+// literals, quoted identifiers and comments. Empty statements are dropped, and the separating semicolons are not
+// included in the segments.
+func SplitStatements(sql string) ([]Segment, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []Segment{}
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		segments = append(segments, Segment{SQL: strings.TrimRightFunc(sql[start:end], isSpace), Pos: start})
+		start = -1
+	}
+	for _, tok := range tokens {
+		if tok.Is(";") {
+			flush(tok.Pos)
+			continue
+		}
+		if start < 0 {
+			start = tok.Pos
+		}
+	}
+	flush(len(sql))
+	return segments, nil
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == '\v'
+}
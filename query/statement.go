@@ -0,0 +1,407 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// TableRef is a table referenced in the FROM clause of a statement. Derived is set for subqueries and table
+// valued functions, in which case Name is the function name (or empty for a subquery) and Subquery is the ID of
+// the subquery's Scope. CTE is set when the name refers to a common table expression defined by the statement's
+// WITH clause. Scope is the ID of the SELECT whose FROM clause the table is in.
+type TableRef struct {
+	Name     string `json:"name,omitempty"`
+	Alias    string `json:"alias,omitempty"`
+	Pos      int    `json:"pos"`
+	Derived  bool   `json:"derived,omitempty"`
+	CTE      bool   `json:"cte,omitempty"`
+	Scope    int    `json:"scope"`
+	Subquery int    `json:"subquery,omitempty"`
+}
+
+// ColumnRef is a reference to a column. Clause is the clause it appears in (SELECT, WHERE, ON, GROUP, ORDER,
+// HAVING) and Funcs are the names of the functions it is an argument of, innermost first. Scope is the ID of the
+// SELECT the reference appears in.
+type ColumnRef struct {
+	Qualifier string   `json:"qualifier,omitempty"`
+	Name      string   `json:"name"`
+	Pos       int      `json:"pos"`
+	Clause    string   `json:"clause"`
+	Funcs     []string `json:"funcs,omitempty"`
+	Scope     int      `json:"scope"`
+}
+
+// FuncCall is a call to a SQL function.
+type FuncCall struct {
+	Name   string `json:"name"`
+	Pos    int    `json:"pos"`
+	Clause string `json:"clause"`
+}
+
+// Scope is a single SELECT within a statement: the statement itself, each member of a compound SELECT, every
+// subquery and the body of each common table expression. IDs start at 1; references outside of any SELECT
+// have scope 0. Parent is the ID of the enclosing SELECT, whose tables correlated subqueries may refer to.
+// Columns are the SELECT's result columns and CTE is set when it is the body of a common table expression.
+type Scope struct {
+	ID      int             `json:"id"`
+	Parent  int             `json:"parent"`
+	CTE     string          `json:"cte,omitempty"`
+	Columns []*ResultColumn `json:"columns,omitempty"`
+
+	depth     int
+	itemStart int
+}
+
+// ResultColumn is a column in the result of a SELECT. Name is its alias, the name of the column it selects, or
+// "*" for a wildcard, in which case Qualifier is set for table.* wildcards. Source is set when the result is a
+// plain column reference, aliased or not.
+type ResultColumn struct {
+	Name      string     `json:"name,omitempty"`
+	Qualifier string     `json:"qualifier,omitempty"`
+	Source    *ColumnRef `json:"source,omitempty"`
+}
+
+// Statement is the result of scanning one or more SQL statements for the tables, columns and functions they use.
+// Scanning is lexical, so it tolerates SQLite syntax that a full SQL parser for another dialect would reject.
+type Statement struct {
+	SQL       string       `json:"sql"`
+	Tokens    []Token      `json:"-"`
+	Tables    []*TableRef  `json:"tables"`
+	Columns   []*ColumnRef `json:"columns"`
+	Functions []*FuncCall  `json:"functions"`
+	CTEs      []string     `json:"ctes,omitempty"`
+	Scopes    []*Scope     `json:"scopes,omitempty"`
+
+	cteColumns map[string][]string
+}
+
+// scanFrame is the state saved when entering a parenthesized expression. sub is the first SELECT opened inside
+// the parentheses, cte the common table expression they are the body of and cteColumns the one whose column
+// list they hold.
+type scanFrame struct {
+	fn          string
+	clause      string
+	tableDepth  int
+	expectTable bool
+	withDepth   int
+	scope       int
+	sub         int
+	cte         string
+	cteColumns  string
+}
+
+// Parse scans sql into a Statement.
+func Parse(sql string) (*Statement, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Statement{
+		SQL:        sql,
+		Tokens:     tokens,
+		Tables:     []*TableRef{},
+		Columns:    []*ColumnRef{},
+		Functions:  []*FuncCall{},
+		cteColumns: map[string][]string{},
+	}
+
+	frames := []*scanFrame{}
+	clause, pendingFn, pendingCTE := "", "", ""
+	tableDepth, expectTable, withDepth := -1, false, -1
+	scope := 0
+
+	peek := func(i int) *Token {
+		if i >= 0 && i < len(tokens) {
+			return &tokens[i]
+		}
+		return nil
+	}
+	isIdent := func(t *Token) bool { return t != nil && t.Kind == TokenIdent }
+	// alias consumes an optional [AS] alias following index i, returning the alias and the index of its last token
+	alias := func(i int) (string, int) {
+		if next := peek(i + 1); next != nil && next.Is("AS") && isIdent(peek(i+2)) {
+			return tokens[i+2].Text, i + 2
+		}
+		if isIdent(peek(i + 1)) {
+			return tokens[i+1].Text, i + 1
+		}
+		return "", i
+	}
+	// inSelectList returns the current SELECT if the scanner is at the top level of its result column list
+	inSelectList := func() *Scope {
+		if scope == 0 || clause != "SELECT" || len(frames) != s.Scopes[scope-1].depth {
+			return nil
+		}
+		return s.Scopes[scope-1]
+	}
+	// endResultColumn records the result column of the current SELECT that ends before index i
+	endResultColumn := func(i int) {
+		if sc := inSelectList(); sc != nil && sc.itemStart >= 0 {
+			if col := s.resultColumn(sc.itemStart, i); col != nil {
+				sc.Columns = append(sc.Columns, col)
+			}
+			sc.itemStart = -1
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.Kind {
+		case TokenPunct:
+			switch tok.Text {
+			case "(":
+				frame := &scanFrame{fn: pendingFn, clause: clause, tableDepth: tableDepth, expectTable: expectTable, withDepth: withDepth, scope: scope}
+				if clause == "WITH" && len(frames) == withDepth && pendingCTE != "" {
+					if prev := peek(i - 1); isIdent(prev) && prev.Text == pendingCTE {
+						frame.cteColumns = pendingCTE
+					} else {
+						frame.cte, pendingCTE = pendingCTE, ""
+					}
+				}
+				frames = append(frames, frame)
+				pendingFn = ""
+			case ")":
+				if len(frames) == 0 {
+					continue
+				}
+				endResultColumn(i)
+				frame := frames[len(frames)-1]
+				frames = frames[:len(frames)-1]
+				clause, tableDepth, expectTable, withDepth, scope = frame.clause, frame.tableDepth, frame.expectTable, frame.withDepth, frame.scope
+				if frame.cte != "" && frame.sub != 0 {
+					s.Scopes[frame.sub-1].CTE = frame.cte
+				}
+				if clause == "FROM" && len(frames) == tableDepth && expectTable {
+					ref := &TableRef{Name: frame.fn, Pos: tok.Pos, Derived: true, Scope: scope}
+					if frame.fn == "" {
+						ref.Subquery = frame.sub
+					}
+					ref.Alias, i = alias(i)
+					s.Tables = append(s.Tables, ref)
+					expectTable = false
+				}
+			case ",":
+				if sc := inSelectList(); sc != nil {
+					endResultColumn(i)
+					sc.itemStart = i + 1
+				}
+				if clause == "FROM" && len(frames) == tableDepth {
+					expectTable = true
+				}
+			case ";":
+				endResultColumn(i)
+				frames, clause, tableDepth, expectTable, withDepth, scope = frames[:0], "", -1, false, -1, 0
+			}
+
+		case TokenKeyword:
+			upper := strings.ToUpper(tok.Text)
+			switch upper {
+			case "SELECT", "WHERE", "HAVING", "ON", "USING", "LIMIT", "OFFSET", "GROUP", "ORDER", "WITH", "FROM", "JOIN",
+				"UNION", "INTERSECT", "EXCEPT", "VALUES":
+				endResultColumn(i)
+			}
+			switch upper {
+			case "SELECT":
+				parent := 0
+				if len(frames) > 0 {
+					parent = frames[len(frames)-1].scope
+				}
+				sc := &Scope{ID: len(s.Scopes) + 1, Parent: parent, depth: len(frames), itemStart: i + 1}
+				s.Scopes = append(s.Scopes, sc)
+				if len(frames) > 0 && frames[len(frames)-1].sub == 0 {
+					frames[len(frames)-1].sub = sc.ID
+				}
+				clause, expectTable, scope = upper, false, sc.ID
+			case "WITH":
+				clause, expectTable, withDepth = upper, false, len(frames)
+			case "WHERE", "HAVING", "ON", "USING", "LIMIT", "OFFSET", "GROUP", "ORDER":
+				clause, expectTable = upper, false
+			case "FROM", "JOIN":
+				clause, tableDepth, expectTable = "FROM", len(frames), true
+			case "UNION", "INTERSECT", "EXCEPT":
+				clause = ""
+			case "AS", "COLLATE":
+				// column and table aliases and collation names are not references
+				if isIdent(peek(i + 1)) {
+					i++
+				}
+			}
+
+		case TokenIdent:
+			next, prev := peek(i+1), peek(i-1)
+			switch {
+			case clause == "WITH":
+				if len(frames) == withDepth && prev != nil && (prev.Is("WITH") || prev.Is("RECURSIVE") || prev.Is(",")) {
+					s.CTEs = append(s.CTEs, tok.Text)
+					pendingCTE = tok.Text
+				}
+				if top := len(frames) - 1; top >= 0 && top == withDepth && frames[top].cteColumns != "" {
+					key := strings.ToLower(frames[top].cteColumns)
+					s.cteColumns[key] = append(s.cteColumns[key], tok.Text)
+				}
+			case next != nil && next.Is("("):
+				pendingFn = strings.ToLower(tok.Text)
+				s.Functions = append(s.Functions, &FuncCall{Name: pendingFn, Pos: tok.Pos, Clause: clause})
+				if expectTable && len(frames) == tableDepth {
+					// table valued functions are recorded once their arguments are closed
+					continue
+				}
+			case inSelectList() != nil && endsExpression(prev) && (next == nil || !next.Is(".")):
+				// an alias without AS, e.g. SELECT count(*) total
+				continue
+			case expectTable && len(frames) == tableDepth:
+				ref := &TableRef{Name: tok.Text, Pos: tok.Pos, Scope: scope}
+				if next != nil && next.Is(".") && isIdent(peek(i+2)) {
+					// schema qualified, e.g. main.processes
+					ref.Name, i = tokens[i+2].Text, i+2
+				}
+				ref.Alias, i = alias(i)
+				s.Tables = append(s.Tables, ref)
+				expectTable = false
+			default:
+				ref := &ColumnRef{Name: tok.Text, Pos: tok.Pos, Clause: clause, Scope: scope}
+				if next != nil && next.Is(".") {
+					after := peek(i + 2)
+					if after != nil && after.Is("*") {
+						i += 2
+						continue
+					}
+					if isIdent(after) {
+						ref.Qualifier, ref.Name = tok.Text, after.Text
+						i += 2
+					}
+				}
+				for idx := len(frames) - 1; idx >= 0; idx-- {
+					if frames[idx].fn != "" {
+						ref.Funcs = append(ref.Funcs, frames[idx].fn)
+					}
+				}
+				s.Columns = append(s.Columns, ref)
+			}
+		}
+	}
+	endResultColumn(len(tokens))
+
+	for _, ref := range s.Tables {
+		for _, cte := range s.CTEs {
+			if !ref.Derived && strings.EqualFold(ref.Name, cte) {
+				ref.CTE = true
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// endsExpression returns true if t can be the last token of an expression, in which case an identifier following
+// it is an alias.
+func endsExpression(t *Token) bool {
+	if t == nil {
+		return false
+	}
+	switch t.Kind {
+	case TokenIdent, TokenString, TokenNumber:
+		return true
+	}
+	return t.Is(")") || t.Is("END") || t.Is("NULL") || t.Is("TRUE") || t.Is("FALSE")
+}
+
+// resultColumn describes the result column spanning tokens [start, end), returning nil for expressions that are
+// neither aliased nor a plain column, which SQLite names after their text.
+func (s *Statement) resultColumn(start, end int) *ResultColumn {
+	toks := s.Tokens[start:end]
+	for len(toks) > 0 && (toks[0].Is("DISTINCT") || toks[0].Is("ALL")) {
+		toks = toks[1:]
+	}
+	if len(toks) == 0 {
+		return nil
+	}
+
+	col := &ResultColumn{}
+	if n := len(toks); n > 1 && toks[n-1].Kind == TokenIdent && (toks[n-2].Is("AS") || endsExpression(&toks[n-2])) {
+		col.Name = toks[n-1].Text
+		toks = toks[:n-1]
+		if toks[n-2].Is("AS") {
+			toks = toks[:n-2]
+		}
+	}
+
+	switch {
+	case len(toks) == 1 && toks[0].Is("*"):
+		col.Name = "*"
+		return col
+	case len(toks) == 3 && toks[0].Kind == TokenIdent && toks[1].Is(".") && toks[2].Is("*"):
+		col.Name, col.Qualifier = "*", toks[0].Text
+		return col
+	case len(toks) == 1 && toks[0].Kind == TokenIdent, len(toks) == 3 && toks[0].Kind == TokenIdent && toks[1].Is(".") && toks[2].Kind == TokenIdent:
+		for idx := len(s.Columns) - 1; idx >= 0; idx-- {
+			if s.Columns[idx].Pos == toks[0].Pos {
+				col.Source = s.Columns[idx]
+				break
+			}
+		}
+		if col.Name == "" {
+			col.Name = toks[len(toks)-1].Text
+		}
+	}
+	if col.Name == "" {
+		return nil
+	}
+	return col
+}
+
+// Scope returns the Scope with the given ID, or nil if there is none.
+func (s *Statement) Scope(id int) *Scope {
+	if id < 1 || id > len(s.Scopes) {
+		return nil
+	}
+	return s.Scopes[id-1]
+}
+
+// LineColumn converts a byte offset in the statement into a 1-based line and column.
+func (s *Statement) LineColumn(pos int) (int, int) {
+	if pos > len(s.SQL) {
+		pos = len(s.SQL)
+	}
+	line := 1 + strings.Count(s.SQL[:pos], "\n")
+	return line, pos - strings.LastIndex(s.SQL[:pos], "\n")
+}
+
+// ResolveColumn finds the schema table and column a reference points at, following table aliases, subqueries
+// and common table expressions. It returns nils when the column does not belong to any osquery table in scope.
+func (s *Statement) ResolveColumn(parser *osqt.Parser, ref *ColumnRef) (*osqt.Table, *osqt.Column) {
+	_, tbl, col := s.resolve(parser, ref, 0)
+	return tbl, col
+}
+
+// LookupTable returns the table with the given name from any of the parser's namespaces. Namespaces are searched
+// in order of their keys, so a table declared in several is always found in the same one.
+func LookupTable(parser *osqt.Parser, name string) *osqt.Table {
+	nsids := make([]string, 0, len(parser.Namespaces))
+	for nsid := range parser.Namespaces {
+		nsids = append(nsids, nsid)
+	}
+	sort.Strings(nsids)
+
+	for _, nsid := range nsids {
+		if tbl, ok := parser.Namespaces[nsid].Tables[name]; ok {
+			return tbl
+		}
+	}
+	for _, nsid := range nsids {
+		for tname, tbl := range parser.Namespaces[nsid].Tables {
+			if strings.EqualFold(tname, name) {
+				return tbl
+			}
+		}
+	}
+	return nil
+}
+
+// TableColumns returns every column of tbl, including the columns of its extended schemas in order of platform.
+func TableColumns(tbl *osqt.Table) []*osqt.Column {
+	return tbl.AllColumns("")
+}
@@ -0,0 +1,144 @@
+// Package query analyzes osquery SQL statements against a parsed schema.
+package query
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// TokenKind classifies a Token.
+type TokenKind int
+
+// The kinds of tokens produced by Tokenize.
+const (
+	TokenIdent TokenKind = iota
+	TokenKeyword
+	TokenString
+	TokenNumber
+	TokenPunct
+)
+
+// Token is a lexical element of a SQL statement. Pos is the byte offset of the token in the statement, and End the
+// offset just past it. The Text of a quoted identifier has its quotes removed, the Text of a string literal keeps
+// them.
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  int
+	End  int
+}
+
+// Is returns true if the token is the given keyword or punctuation, ignoring case.
+func (t Token) Is(text string) bool {
+	return (t.Kind == TokenKeyword || t.Kind == TokenPunct) && strings.EqualFold(t.Text, text)
+}
+
+// keywords are the SQLite keywords that are significant when scanning osquery statements. Any other word is
+// treated as an identifier.
+var keywords = map[string]bool{
+	"ALL": true, "AND": true, "AS": true, "ASC": true, "BETWEEN": true, "BY": true, "CASE": true, "CAST": true,
+	"COLLATE": true, "CROSS": true, "DELETE": true, "DESC": true, "DISTINCT": true, "ELSE": true, "END": true,
+	"ESCAPE": true, "EXCEPT": true, "EXISTS": true, "FALSE": true, "FROM": true, "GLOB": true, "GROUP": true,
+	"HAVING": true, "IN": true, "INNER": true, "INSERT": true, "INTERSECT": true, "INTO": true, "IS": true,
+	"JOIN": true, "LEFT": true, "LIKE": true, "LIMIT": true, "MATCH": true, "NATURAL": true, "NOT": true,
+	"NULL": true, "OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true, "RECURSIVE": true,
+	"REGEXP": true, "RIGHT": true, "SELECT": true, "SET": true, "THEN": true, "TRUE": true, "UNION": true,
+	"UPDATE": true, "USING": true, "VALUES": true, "WHEN": true, "WHERE": true, "WITH": true,
+}
+
+// multiCharPunct are the operators longer than a single character, longest first.
+var multiCharPunct = []string{"->>", "->", "||", "<=", ">=", "<>", "!=", "==", "<<", ">>"}
+
+// Tokenize splits a SQL statement into tokens, discarding whitespace and comments.
+func Tokenize(sql string) ([]Token, error) {
+	tokens := []Token{}
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case unicode.IsSpace(rune(ch)):
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, xerrors.Errorf("unterminated comment at offset %d", i)
+			}
+			i += end + 4
+		case ch == '\'':
+			end, err := closingQuote(sql, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Text: sql[i : end+1], Pos: i, End: end + 1})
+			i = end + 1
+		case ch == '"' || ch == '`' || ch == '[':
+			closer := ch
+			if ch == '[' {
+				closer = ']'
+			}
+			end, err := closingQuote(sql, i, closer)
+			if err != nil {
+				return nil, err
+			}
+			text := strings.Replace(sql[i+1:end], string([]byte{closer, closer}), string(closer), -1)
+			tokens = append(tokens, Token{Kind: TokenIdent, Text: text, Pos: i, End: end + 1})
+			i = end + 1
+		case ch >= '0' && ch <= '9' || (ch == '.' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9'):
+			start := i
+			for i < len(sql) && (isIdentByte(sql[i]) || sql[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenNumber, Text: sql[start:i], Pos: start, End: i})
+		case isIdentByte(ch) || ch == '$' || ch == '@' || ch == ':':
+			start := i
+			i++
+			for i < len(sql) && (isIdentByte(sql[i]) || sql[i] == '$') {
+				i++
+			}
+			word := sql[start:i]
+			kind := TokenIdent
+			if keywords[strings.ToUpper(word)] {
+				kind = TokenKeyword
+			}
+			tokens = append(tokens, Token{Kind: kind, Text: word, Pos: start, End: i})
+		default:
+			text := string(ch)
+			for _, op := range multiCharPunct {
+				if strings.HasPrefix(sql[i:], op) {
+					text = op
+					break
+				}
+			}
+			tokens = append(tokens, Token{Kind: TokenPunct, Text: text, Pos: i, End: i + len(text)})
+			i += len(text)
+		}
+	}
+	return tokens, nil
+}
+
+// closingQuote returns the offset of the quote closing the string or identifier opened at start. Doubled
+// quotes are escapes.
+func closingQuote(sql string, start int, quote byte) (int, error) {
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote && quote != ']' {
+			i++
+			continue
+		}
+		return i, nil
+	}
+	return 0, xerrors.Errorf("unterminated quote at offset %d", start)
+}
+
+func isIdentByte(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch >= 0x80
+}
@@ -0,0 +1,273 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// UntranslatableRule is the rule of the findings Translate reports for tables and columns without an equivalent
+// on the target platform.
+const UntranslatableRule = "untranslatable"
+
+// equivalentTable is a table of a group of platform-equivalent tables. Columns maps the group's column names to
+// the table's own.
+type equivalentTable struct {
+	Table   string
+	Columns map[string]string
+}
+
+// equivalentTables are groups of tables that hold the same kind of data on different platforms, in order of
+// preference when several are available on a platform.
+var equivalentTables = [][]*equivalentTable{
+	{
+		{Table: "launchd", Columns: map[string]string{"name": "label", "file": "path", "program": "program", "user": "username"}},
+		{Table: "systemd_units", Columns: map[string]string{"name": "id", "file": "fragment_path", "user": "user", "description": "description", "state": "active_state"}},
+		{Table: "services", Columns: map[string]string{"name": "name", "program": "path", "user": "user_account", "description": "description", "state": "status"}},
+	},
+	{
+		{Table: "apps", Columns: map[string]string{"name": "name", "version": "bundle_short_version", "path": "path"}},
+		{Table: "deb_packages", Columns: map[string]string{"name": "name", "version": "version", "vendor": "maintainer", "arch": "arch"}},
+		{Table: "rpm_packages", Columns: map[string]string{"name": "name", "version": "version", "vendor": "vendor", "arch": "arch"}},
+		{Table: "programs", Columns: map[string]string{"name": "name", "version": "version", "vendor": "publisher", "path": "install_location"}},
+	},
+	{
+		{Table: "kernel_extensions", Columns: map[string]string{"name": "name", "version": "version", "path": "path", "size": "size"}},
+		{Table: "kernel_modules", Columns: map[string]string{"name": "name", "size": "size", "status": "status"}},
+		{Table: "drivers", Columns: map[string]string{"name": "service", "version": "version", "path": "image"}},
+	},
+	{
+		{Table: "crontab", Columns: map[string]string{"command": "command", "file": "path"}},
+		{Table: "scheduled_tasks", Columns: map[string]string{"name": "name", "command": "action", "file": "path", "enabled": "enabled"}},
+	},
+	{
+		{Table: "disk_encryption", Columns: map[string]string{"device": "name", "uuid": "uuid", "method": "type", "status": "encryption_status"}},
+		{Table: "bitlocker_info", Columns: map[string]string{"device": "device_id", "uuid": "persistent_volume_id", "method": "encryption_method", "status": "conversion_status"}},
+	},
+}
+
+// Substitution is a table Translate replaced with its equivalent on the target platform. Alternatives are the
+// other equivalent tables available there, such as rpm_packages for deb_packages.
+type Substitution struct {
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Alternatives []string `json:"alternatives,omitempty"`
+	Pos          int      `json:"pos"`
+	Line         int      `json:"line"`
+	Column       int      `json:"column"`
+}
+
+// Translation is a query rewritten for Platform. Untranslatable are the tables and columns it still uses that
+// have no equivalent there; their positions are relative to the original query.
+type Translation struct {
+	SQL            string          `json:"sql"`
+	Platform       string          `json:"platform"`
+	Substitutions  []*Substitution `json:"substitutions"`
+	Untranslatable []*Finding      `json:"untranslatable"`
+}
+
+// sourceEdit replaces the length bytes of a query at pos with text.
+type sourceEdit struct {
+	pos    int
+	length int
+	text   string
+}
+
+// Translate rewrites sql, written for any platform, to run on goos by substituting the platform-equivalent
+// tables and columns of equivalentTables for those goos does not have. Selected columns keep their original names
+// as aliases. Translation is best effort: whatever has no equivalent is left as written and reported.
+func Translate(parser *osqt.Parser, sql string, goos string) (*Translation, error) {
+	segments, err := SplitStatements(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &Statement{SQL: sql}
+	available := parser.TablesFor(goos)
+	tr := &Translation{Platform: goos, Substitutions: []*Substitution{}, Untranslatable: []*Finding{}}
+	edits := []*sourceEdit{}
+	report := func(pos int, format string, args ...interface{}) {
+		f := &Finding{Rule: UntranslatableRule, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...), Pos: pos}
+		f.Line, f.Column = input.LineColumn(f.Pos)
+		tr.Untranslatable = append(tr.Untranslatable, f)
+	}
+
+	for _, seg := range segments {
+		stmt, err := Parse(seg.SQL)
+		if err != nil {
+			return nil, err
+		}
+
+		// source table name -> the equivalents of it and its replacement
+		renamed := map[string][2]*equivalentTable{}
+		for _, tref := range stmt.Tables {
+			if tref.Derived || tref.CTE {
+				continue
+			}
+			tbl := LookupTable(parser, tref.Name)
+			if tbl == nil {
+				continue
+			}
+			if _, ok := available[tbl.Name]; ok {
+				continue
+			}
+
+			from, candidates := equivalentsOf(parser, tbl.Name, available)
+			if len(candidates) == 0 {
+				report(seg.Pos+tref.Pos, "%s has no equivalent on %s", tbl.Name, goos)
+				continue
+			}
+			renamed[tbl.Name] = [2]*equivalentTable{from, candidates[0]}
+			sub := &Substitution{From: tbl.Name, To: candidates[0].Table, Pos: seg.Pos + tref.Pos}
+			for _, alt := range candidates[1:] {
+				sub.Alternatives = append(sub.Alternatives, alt.Table)
+			}
+			sub.Line, sub.Column = input.LineColumn(sub.Pos)
+			tr.Substitutions = append(tr.Substitutions, sub)
+			edits = append(edits, tokenEdit(stmt, seg.Pos, tref.Pos, candidates[0].Table))
+		}
+
+		// qualifiers naming a replaced table rather than an alias of it
+		for i, tok := range stmt.Tokens {
+			if tok.Kind != TokenIdent || i+1 >= len(stmt.Tokens) || !stmt.Tokens[i+1].Is(".") {
+				continue
+			}
+			for name, eq := range renamed {
+				if strings.EqualFold(tok.Text, name) && !aliased(stmt, name) {
+					edits = append(edits, tokenEdit(stmt, seg.Pos, tok.Pos, eq[1].Table))
+				}
+			}
+		}
+
+		for _, ref := range stmt.Columns {
+			tbl, col := stmt.ResolveColumn(parser, ref)
+			if tbl == nil {
+				continue
+			}
+			eq, ok := renamed[tbl.Name]
+			if !ok {
+				if _, on := available[tbl.Name]; on && !hasPlatformColumn(tbl, col, goos) {
+					report(seg.Pos+ref.Pos, "%s.%s has no equivalent on %s", tbl.Name, col.Name, goos)
+				}
+				continue
+			}
+
+			target := ""
+			for name, own := range eq[0].Columns {
+				if strings.EqualFold(own, col.Name) {
+					target = eq[1].Columns[name]
+					break
+				}
+			}
+			if target == "" {
+				report(seg.Pos+ref.Pos, "%s.%s has no equivalent in %s", tbl.Name, col.Name, eq[1].Table)
+				continue
+			}
+			if strings.EqualFold(target, col.Name) {
+				continue
+			}
+			// USING names a column of both sides of the join, so renaming it on one side breaks the other
+			if ref.Clause == "USING" {
+				report(seg.Pos+ref.Pos, "%s.%s is %s.%s on %s, which USING cannot join on; use ON instead", tbl.Name, col.Name, eq[1].Table, target, goos)
+				continue
+			}
+			_, last := stmt.refTokens(ref)
+			if last < 0 {
+				continue
+			}
+			text := target
+			if selectsAsIs(stmt, ref) {
+				text = fmt.Sprintf("%s AS %s", target, ref.Name)
+			}
+			edits = append(edits, tokenEdit(stmt, seg.Pos, stmt.Tokens[last].Pos, text))
+		}
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].pos > edits[j].pos })
+	out := sql
+	for idx, e := range edits {
+		if idx > 0 && e.pos == edits[idx-1].pos {
+			continue
+		}
+		out = out[:e.pos] + e.text + out[e.pos+e.length:]
+	}
+	tr.SQL = out
+
+	sort.SliceStable(tr.Untranslatable, func(i, j int) bool { return tr.Untranslatable[i].Pos < tr.Untranslatable[j].Pos })
+	return tr, nil
+}
+
+// equivalentsOf returns the entry of equivalentTables for the table name and the tables equivalent to it that
+// are available on the target platform, in order of preference.
+func equivalentsOf(parser *osqt.Parser, name string, available map[string]*osqt.Table) (*equivalentTable, []*equivalentTable) {
+	for _, group := range equivalentTables {
+		var from *equivalentTable
+		for _, eq := range group {
+			if eq.Table == name {
+				from = eq
+			}
+		}
+		if from == nil {
+			continue
+		}
+
+		candidates := []*equivalentTable{}
+		for _, eq := range group {
+			if _, ok := available[eq.Table]; ok && eq != from && LookupTable(parser, eq.Table) != nil {
+				candidates = append(candidates, eq)
+			}
+		}
+		return from, candidates
+	}
+	return nil, nil
+}
+
+// tokenEdit returns the edit replacing the token of stmt at pos, where stmt starts at offset of the whole query.
+func tokenEdit(stmt *Statement, offset, pos int, text string) *sourceEdit {
+	length := 0
+	for _, tok := range stmt.Tokens {
+		if tok.Pos != pos {
+			continue
+		}
+		length = len(tok.Text)
+		if tok.Kind == TokenIdent && strings.ContainsAny(stmt.SQL[pos:pos+1], "\"`[") {
+			closer := stmt.SQL[pos]
+			if closer == '[' {
+				closer = ']'
+			}
+			if end, err := closingQuote(stmt.SQL, pos, closer); err == nil {
+				length = end + 1 - pos
+			}
+		}
+		break
+	}
+	return &sourceEdit{pos: offset + pos, length: length, text: text}
+}
+
+// aliased returns true if every reference of stmt to the table name gives it an alias.
+func aliased(stmt *Statement, name string) bool {
+	for _, tref := range stmt.Tables {
+		if strings.EqualFold(tref.Name, name) && !tref.Derived && tref.Alias == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// selectsAsIs returns true if ref is a result column of its SELECT without an alias, so renaming it would change
+// the name of the result column.
+func selectsAsIs(stmt *Statement, ref *ColumnRef) bool {
+	if ref.Clause != "SELECT" {
+		return false
+	}
+	for _, sc := range stmt.Scopes {
+		for _, col := range sc.Columns {
+			if col.Source == ref && strings.EqualFold(col.Name, ref.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
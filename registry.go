@@ -0,0 +1,398 @@
+package osqt
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrInvalidVersion is returned when an osquery version or version constraint cannot be parsed.
+var ErrInvalidVersion = xerrors.New("invalid osquery version")
+
+// ErrUnknownSchemaVersion is returned when the registry holds no schema for the requested osquery version.
+var ErrUnknownSchemaVersion = xerrors.New("no schema for the requested osquery version")
+
+// describeSuffix matches the commits since the last tag that git describe appends to a version (5.10.0-3-gabc123).
+var describeSuffix = regexp.MustCompile(`-[0-9]+-g[0-9a-f]+$`)
+
+// Semver is a semantic version of osquery, such as 5.9.1 or 5.10.0-rc1.
+type Semver struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// ParseSemver parses an osquery version. A leading "v" is ignored, missing minor and patch numbers are 0, and the
+// commit suffix of git describe (5.10.0-3-gabc123) and build metadata (+build) are dropped.
+func ParseSemver(s string) (Semver, error) {
+	v := Semver{}
+	raw := strings.TrimSpace(s)
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "v"), "V")
+	raw = describeSuffix.ReplaceAllString(raw, "")
+	if idx := strings.Index(raw, "+"); idx >= 0 {
+		raw = raw[:idx]
+	}
+	if idx := strings.Index(raw, "-"); idx >= 0 {
+		v.Prerelease = raw[idx+1:]
+		raw = raw[:idx]
+		if v.Prerelease == "" {
+			return v, xerrors.Errorf("%q has an empty prerelease: %w", s, ErrInvalidVersion)
+		}
+	}
+
+	parts := strings.Split(raw, ".")
+	if raw == "" || len(parts) > 3 {
+		return v, xerrors.Errorf("%q: %w", s, ErrInvalidVersion)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for idx, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, xerrors.Errorf("%q: %w", s, ErrInvalidVersion)
+		}
+		*nums[idx] = n
+	}
+	return v, nil
+}
+
+// String implements the fmt.Stringer interface.
+func (v Semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is older than, the same as, or newer than o. Prereleases are older than their
+// release, and compared by their dot separated identifiers otherwise.
+func (v Semver) Compare(o Semver) int {
+	for _, pair := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if pair[0] != pair[1] {
+			return compareInts(pair[0], pair[1])
+		}
+	}
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+
+	vids, oids := strings.Split(v.Prerelease, "."), strings.Split(o.Prerelease, ".")
+	for idx := 0; idx < len(vids) && idx < len(oids); idx++ {
+		if vids[idx] == oids[idx] {
+			continue
+		}
+		vn, verr := strconv.Atoi(vids[idx])
+		on, oerr := strconv.Atoi(oids[idx])
+		switch {
+		case verr == nil && oerr == nil:
+			return compareInts(vn, on)
+		case verr == nil:
+			return -1
+		case oerr == nil:
+			return 1
+		case vids[idx] < oids[idx]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return compareInts(len(vids), len(oids))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// VersionConstraint selects osquery versions. It is a list of alternatives separated by "||", each a list of
+// comparisons separated by commas or spaces that must all hold: =, !=, >, >=, <, <=, ~ (the same minor release,
+// at least the version given) and ^ (the same major release, at least the version given). A version without an
+// operator must match exactly, and an empty constraint or "*" matches every version.
+type VersionConstraint struct {
+	raw  string
+	alts [][]versionComparison
+}
+
+type versionComparison struct {
+	op      string
+	version Semver
+}
+
+// versionOperators are the operators of a comparison, longest first so ">=" is not read as ">".
+var versionOperators = []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"}
+
+// ParseVersionConstraint parses a constraint such as ">=5.9.0", ">=5.9, <5.11" or "~5.8.0 || >=5.10.0".
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	c := &VersionConstraint{raw: strings.TrimSpace(s)}
+	if c.raw == "" || c.raw == "*" {
+		return c, nil
+	}
+
+	for _, alt := range strings.Split(c.raw, "||") {
+		comparisons := []versionComparison{}
+		terms := strings.Fields(strings.Replace(alt, ",", " ", -1))
+		for idx := 0; idx < len(terms); idx++ {
+			term, op := terms[idx], "="
+			for _, candidate := range versionOperators {
+				if strings.HasPrefix(term, candidate) {
+					op, term = candidate, strings.TrimPrefix(term, candidate)
+					break
+				}
+			}
+			// allow a space between the operator and the version (">= 5.9.0")
+			if term == "" && idx+1 < len(terms) {
+				idx++
+				term = terms[idx]
+			}
+			if op == "==" {
+				op = "="
+			}
+			version, err := ParseSemver(term)
+			if err != nil {
+				return nil, xerrors.Errorf("constraint %q: %w", s, err)
+			}
+			comparisons = append(comparisons, versionComparison{op: op, version: version})
+		}
+		if len(comparisons) == 0 {
+			return nil, xerrors.Errorf("constraint %q has an empty alternative: %w", s, ErrInvalidVersion)
+		}
+		c.alts = append(c.alts, comparisons)
+	}
+	return c, nil
+}
+
+// String implements the fmt.Stringer interface.
+func (c *VersionConstraint) String() string {
+	return c.raw
+}
+
+// Check returns true if v satisfies the constraint.
+func (c *VersionConstraint) Check(v Semver) bool {
+	if len(c.alts) == 0 {
+		return true
+	}
+	for _, alt := range c.alts {
+		ok := true
+		for _, cmp := range alt {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c versionComparison) check(v Semver) bool {
+	diff := v.Compare(c.version)
+	switch c.op {
+	case "!=":
+		return diff != 0
+	case ">":
+		return diff > 0
+	case ">=":
+		return diff >= 0
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	case "~":
+		return diff >= 0 && v.Major == c.version.Major && v.Minor == c.version.Minor
+	case "^":
+		return diff >= 0 && v.Major == c.version.Major
+	default:
+		return diff == 0
+	}
+}
+
+// Registry holds the schemas of several osquery releases, keyed by version, so tools can reason about fleets whose
+// hosts run different versions of osquery.
+type Registry struct {
+	sync.RWMutex
+
+	versions []Semver
+	parsers  map[Semver]*Parser
+}
+
+// VersionedTable is a table as it exists in one osquery release held by a Registry.
+type VersionedTable struct {
+	Version string `json:"version" yaml:"version"`
+	Table   *Table `json:"table" yaml:"table"`
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		versions: []Semver{},
+		parsers:  map[Semver]*Parser{},
+	}
+}
+
+// Add registers the schema of parser as that of the osquery version. An empty version uses the osquery version
+// of the parser's Metadata, as read from a versioned schema export. The schema of a version already registered
+// is replaced.
+func (r *Registry) Add(version string, parser *Parser) error {
+	if parser == nil {
+		return xerrors.New("cannot register a nil parser")
+	}
+	if version == "" {
+		parser.RLock()
+		if parser.Metadata != nil {
+			version = parser.Metadata.OSQueryVersion
+		}
+		parser.RUnlock()
+		if version == "" {
+			return xerrors.Errorf("schema has no osquery version in its metadata: %w", ErrInvalidVersion)
+		}
+	}
+	v, err := ParseSemver(version)
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.parsers[v]; !ok {
+		r.versions = append(r.versions, v)
+		sort.Slice(r.versions, func(i, j int) bool { return r.versions[i].Compare(r.versions[j]) < 0 })
+	}
+	r.parsers[v] = parser
+	return nil
+}
+
+// Versions returns the osquery versions held by the registry, oldest first.
+func (r *Registry) Versions() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	versions := make([]string, 0, len(r.versions))
+	for _, v := range r.versions {
+		versions = append(versions, v.String())
+	}
+	return versions
+}
+
+// Parser returns the schema of an osquery version, or false if the registry does not hold it.
+func (r *Registry) Parser(version string) (*Parser, bool) {
+	v, err := ParseSemver(version)
+	if err != nil {
+		return nil, false
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+	p, ok := r.parsers[v]
+	return p, ok
+}
+
+// Latest returns the newest version held by the registry satisfying constraint, and its schema.
+func (r *Registry) Latest(constraint string) (string, *Parser, error) {
+	versions, err := r.matching(constraint)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(versions) == 0 {
+		return "", nil, xerrors.Errorf("no osquery version matches %q (available: %s): %w", constraint, strings.Join(r.Versions(), ", "), ErrUnknownSchemaVersion)
+	}
+
+	v := versions[len(versions)-1]
+	r.RLock()
+	defer r.RUnlock()
+	return v.String(), r.parsers[v], nil
+}
+
+// Table returns the table with the given name or alias in every version satisfying constraint, oldest first,
+// skipping versions that do not have it. For example Table("processes", ">=5.9.0") returns processes as it exists
+// in 5.9.0 and later.
+func (r *Registry) Table(name string, constraint string) ([]*VersionedTable, error) {
+	versions, err := r.matching(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+	tables := []*VersionedTable{}
+	for _, v := range versions {
+		if t := lookupRegistryTable(r.parsers[v], name); t != nil {
+			tables = append(tables, &VersionedTable{Version: v.String(), Table: t})
+		}
+	}
+	return tables, nil
+}
+
+// matching returns the versions held by the registry that satisfy constraint, oldest first.
+func (r *Registry) matching(constraint string) ([]Semver, error) {
+	c, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+	versions := []Semver{}
+	for _, v := range r.versions {
+		if c.Check(v) {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// lookupRegistryTable returns the table of parser named or aliased name. Namespaces are searched in sorted order,
+// and exact names are preferred over aliases.
+func lookupRegistryTable(parser *Parser, name string) *Table {
+	parser.RLock()
+	defer parser.RUnlock()
+
+	nsids := make([]string, 0, len(parser.Namespaces))
+	for nsid := range parser.Namespaces {
+		nsids = append(nsids, nsid)
+	}
+	sort.Strings(nsids)
+
+	for _, nsid := range nsids {
+		if t, ok := parser.Namespaces[nsid].Tables[name]; ok {
+			return t
+		}
+	}
+	for _, nsid := range nsids {
+		tnames := make([]string, 0, len(parser.Namespaces[nsid].Tables))
+		for tname := range parser.Namespaces[nsid].Tables {
+			tnames = append(tnames, tname)
+		}
+		sort.Strings(tnames)
+		for _, tname := range tnames {
+			t := parser.Namespaces[nsid].Tables[tname]
+			if strings.EqualFold(t.Name, name) {
+				return t
+			}
+			for _, alias := range t.Aliases {
+				if strings.EqualFold(alias, name) {
+					return t
+				}
+			}
+		}
+	}
+	return nil
+}
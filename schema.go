@@ -1,10 +1,12 @@
 package osqt
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	past "github.com/go-python/gpython/ast"
-	"go.uber.org/zap"
 	"golang.org/x/xerrors"
 )
 
@@ -95,7 +97,7 @@ var TableCategories = map[string][]string{
 
 // Schema outlines the structure of the columns within an OSQuery table.
 type Schema struct {
-	logger *zap.SugaredLogger
+	logger Logger
 
 	Table       *Table                   `json:"-" yaml:"-"`
 	Platforms   []string                 `json:"platforms,omitempty" yaml:"platforms,omitempty"`
@@ -123,10 +125,10 @@ func (s *Schema) TableName() string {
 }
 
 // Logger returns a logger for a given schema and tries to base it off it's parent table's logger if possible.
-func (s *Schema) Logger() *zap.SugaredLogger {
+func (s *Schema) Logger() Logger {
 	if s.logger == nil {
 		if s.Table == nil {
-			s.logger = zap.L().Sugar().Named("undefined_schema")
+			s.logger = NopLogger()
 		} else {
 			s.logger = s.Table.Logger().Named("schema")
 		}
@@ -135,55 +137,88 @@ func (s *Schema) Logger() *zap.SugaredLogger {
 	return s.logger
 }
 
-// ParseLambda attempts to extract the logical OR values out of the custom expression to identify applicable platforms.
+// ParseLambda attempts to extract the applicable platforms out of the custom expression of a lambda, e.g.
+// lambda: LINUX() or DARWIN(). Platform helpers combined with "or" apply to any of their platforms, and with "and"
+// to the platforms they share.
 func (s *Schema) ParseLambda(lambda *past.Lambda) error {
-	bodyOp, ok := lambda.Body.(*past.BoolOp)
-	if !ok {
-		err := xerrors.Errorf("lambda body type mismatch: expected *ast.BoolOp, got %T", lambda.Body)
-		s.Logger().Errorw("Schema parsing error", "error", err)
-		return err
-	}
-	if bodyOp.Op != past.Or {
-		err := xerrors.Errorf("lambda body operation mismatch: expected OR (2), got %v", bodyOp.Op.String())
+	platforms, err := platformsOf(lambda.Body)
+	if err != nil {
 		s.Logger().Errorw("Schema parsing error", "error", err)
 		return err
 	}
-	for _, valast := range bodyOp.Values {
-		bodycall, ok := valast.(*past.Call)
+	s.Platforms = mergePlatforms(s.Platforms, platforms)
+	return nil
+}
+
+// platformsOf evaluates a platform expression of an extended_schema declaration: a platform name (WINDOWS,
+// "WINDOWS"), a call of its helper (WINDOWS()), a lambda, or helpers combined with "or" and "and".
+func platformsOf(expr past.Expr) ([]string, error) {
+	category := func(name string) ([]string, error) {
+		platformList, ok := TableCategories[name]
 		if !ok {
-			err := xerrors.Errorf("lambda OR value mismatch: expected *ast.Call, got %T", valast)
-			s.Logger().Errorw("Schema parsing error", "error", err)
-			return err
+			return nil, xerrors.Errorf("No table category for provided function identifier: %s", name)
 		}
-		funcident, ok := bodycall.Func.(*past.Name)
+		return mergePlatforms(nil, platformList), nil
+	}
+
+	switch node := expr.(type) {
+	case *past.NameConstant:
+		return category(fmt.Sprintf("%v", node.Value))
+	case *past.Str:
+		return category(string(node.S))
+	case *past.Name:
+		return category(string(node.Id))
+	case *past.Call:
+		funcident, ok := node.Func.(*past.Name)
 		if !ok {
-			err := xerrors.Errorf("lambda OR value function mismatch: expected *ast.Name, got %T", bodycall.Func)
-			s.Logger().Errorw("Schema parsing error", "error", err)
-			return err
+			return nil, xerrors.Errorf("platform helper mismatch: expected *ast.Name, got %T", node.Func)
 		}
-		platformList, ok := TableCategories[string(funcident.Id)]
-		if !ok {
-			err := xerrors.Errorf("No table category for provided function identifier: %s", string(funcident.Id))
-			s.Logger().Errorw("Schema parsing error", "error", err)
-			return err
+		return category(string(funcident.Id))
+	case *past.Lambda:
+		return platformsOf(node.Body)
+	case *past.BoolOp:
+		var platforms []string
+		for idx, value := range node.Values {
+			operand, err := platformsOf(value)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case idx == 0 || node.Op == past.Or:
+				platforms = mergePlatforms(platforms, operand)
+			case node.Op == past.And:
+				platforms = intersectPlatforms(platforms, operand)
+			default:
+				return nil, xerrors.Errorf("platform expression operation mismatch: expected OR or AND, got %v", node.Op.String())
+			}
 		}
-		tmp := map[string]bool{}
-		for _, elm := range s.Platforms {
-			tmp[elm] = true
+		return platforms, nil
+	default:
+		return nil, xerrors.Errorf("could not determine type for extended_schema platform argument: %v (%T)", expr, expr)
+	}
+}
+
+// stringOf returns the value of a string expression of a spec: a literal, or literals joined with +.
+func stringOf(expr past.Expr) (string, bool) {
+	switch node := expr.(type) {
+	case *past.Str:
+		return string(node.S), true
+	case *past.BinOp:
+		if node.Op != past.Add {
+			return "", false
 		}
-		for _, elm := range platformList {
-			tmp[elm] = true
+		left, ok := stringOf(node.Left)
+		if !ok {
+			return "", false
 		}
-		res := make([]string, len(tmp))
-		idx := 0
-		for key := range tmp {
-			res[idx] = key
-			idx++
+		right, ok := stringOf(node.Right)
+		if !ok {
+			return "", false
 		}
-		s.Platforms = res
+		return left + right, true
+	default:
+		return "", false
 	}
-
-	return nil
 }
 
 // ExtractSchema attempts to extract the schema([]) declaraction.
@@ -199,80 +234,22 @@ func (s *Schema) ExtractSchema(node *past.Call) error {
 	if string(callerFuncName.Id) == "extended_schema" {
 		s.Extended = true
 		argsIndex = 1
-		switch platformArg := node.Args[0].(type) {
-		case *past.NameConstant:
-			platformList, ok := TableCategories[fmt.Sprintf("%v", platformArg.Value)]
-			if !ok {
-				err := xerrors.Errorf("No table category for provided function identifier: %s", fmt.Sprintf("%v", platformArg.Value))
-				s.Logger().Errorw("Schema parsing error", "error", err)
-				return err
-			}
-			tmp := map[string]bool{}
-			for _, elm := range s.Platforms {
-				tmp[elm] = true
-			}
-			for _, elm := range platformList {
-				tmp[elm] = true
-			}
-			res := make([]string, len(tmp))
-			idx := 0
-			for key := range tmp {
-				res[idx] = key
-				idx++
-			}
-			s.Platforms = res
-		case *past.Str:
-			platformList, ok := TableCategories[string(platformArg.S)]
-			if !ok {
-				err := xerrors.Errorf("No table category for provided function identifier: %s", string(platformArg.S))
-				s.Logger().Errorw("Schema parsing error", "error", err)
-				return err
-			}
-			tmp := map[string]bool{}
-			for _, elm := range s.Platforms {
-				tmp[elm] = true
-			}
-			for _, elm := range platformList {
-				tmp[elm] = true
-			}
-			res := make([]string, len(tmp))
-			idx := 0
-			for key := range tmp {
-				res[idx] = key
-				idx++
-			}
-			s.Platforms = res
-		case *past.Name:
-			platformList, ok := TableCategories[string(platformArg.Id)]
-			if !ok {
-				err := xerrors.Errorf("No table category for provided function identifier: %s", string(platformArg.Id))
-				s.Logger().Errorw("Schema parsing error", "error", err)
-				return err
-			}
-			tmp := map[string]bool{}
-			for _, elm := range s.Platforms {
-				tmp[elm] = true
-			}
-			for _, elm := range platformList {
-				tmp[elm] = true
-			}
-			res := make([]string, len(tmp))
-			idx := 0
-			for key := range tmp {
-				res[idx] = key
-				idx++
-			}
-			s.Platforms = res
-		case *past.Lambda:
-			err := s.ParseLambda(platformArg)
-			if err != nil {
-				return err
-			}
-		default:
-			err := xerrors.Errorf("could not determine type for extended_schema platform argument: %v (%T)", platformArg, platformArg)
+		if len(node.Args) < 2 {
+			err := xerrors.Errorf("extended_schema takes a platform and a list of columns, got %d arguments", len(node.Args))
 			s.Logger().Errorw("Schema parsing error", "error", err)
 			return err
 		}
+		platforms, err := platformsOf(node.Args[0])
+		if err != nil {
+			s.Logger().Errorw("Schema parsing error", "error", err)
+			return err
+		}
+		s.Platforms = mergePlatforms(s.Platforms, platforms)
+	}
+	if len(node.Args) <= argsIndex {
+		err := xerrors.Errorf("argument %d is missing (extended=%v)", argsIndex, s.Extended)
+		s.Logger().Errorw("Schema parsing error", "error", err)
+		return err
 	}
 
 	arglist, ok := node.Args[argsIndex].(*past.List)
@@ -317,31 +294,55 @@ func (s *Schema) ExtractSchema(node *past.Call) error {
 		col.Index = colidx
 
 		if len(coldefcaller.Args) < 1 {
-			s.Logger().Warnf("Non Column() definition detected! (function=%s) Skipping...", string(funcName.Id))
+			s.report(coldefcaller, "%s() in a schema is not a column definition", string(funcName.Id))
 			continue
 		}
 
-		if nameObj, ok := coldefcaller.Args[0].(*past.Str); ok {
-			col.Name = string(nameObj.S)
+		if name, ok := stringOf(coldefcaller.Args[0]); ok {
+			col.Name = name
 		}
 
-		if typeObj, ok := coldefcaller.Args[1].(*past.Name); ok {
-			col.Type = string(typeObj.Id)
+		if len(coldefcaller.Args) > 1 {
+			if typeObj, ok := coldefcaller.Args[1].(*past.Name); ok {
+				col.Type = string(typeObj.Id)
+			}
 		}
 
-		if descObj, ok := coldefcaller.Args[2].(*past.Str); ok {
-			col.Description = string(descObj.S)
+		if len(coldefcaller.Args) > 2 {
+			if desc, ok := stringOf(coldefcaller.Args[2]); ok {
+				col.Description = desc
+			}
 		}
 
 		for _, kw := range coldefcaller.Keywords {
 			optkey := string(kw.Arg)
+			if optkey == "aliases" {
+				s.extractColumnAliases(col, kw)
+				continue
+			}
 			switch v := kw.Value.(type) {
 			case *past.NameConstant:
-				col.Options[optkey] = v.Value
-			case *past.Str:
-				col.Options[optkey] = string(v.S)
+				val := constantOf(v)
+				if _, ok := val.(bool); !ok && optkey == "hidden" {
+					s.report(kw, "column %s hidden is not True or False", col.Name)
+					continue
+				}
+				col.Options[optkey] = val
 			case *past.Name:
+				if optkey == "hidden" {
+					s.report(kw, "column %s hidden is not True or False", col.Name)
+					continue
+				}
 				col.Options[optkey] = string(v.Id)
+			case *past.List:
+				s.report(kw, "column %s keyword argument %s is a list, which only aliases may be", col.Name, optkey)
+			default:
+				str, ok := stringOf(v)
+				if !ok {
+					s.report(kw, "column %s keyword argument %s has an unsupported value", col.Name, optkey)
+					continue
+				}
+				col.Options[optkey] = str
 			}
 		}
 
@@ -349,3 +350,167 @@ func (s *Schema) ExtractSchema(node *past.Call) error {
 	}
 	return nil
 }
+
+// extractColumnAliases adds the aliases of the aliases keyword argument kw to col: a list or tuple of names, as
+// in Column("...", TEXT, "...", aliases=["..."]), or a single name. Aliases repeating the column's name or another
+// alias are dropped.
+func (s *Schema) extractColumnAliases(col *Column, kw *past.Keyword) {
+	var elts []past.Expr
+	switch v := kw.Value.(type) {
+	case *past.List:
+		elts = v.Elts
+	case *past.Tuple:
+		elts = v.Elts
+	default:
+		if _, ok := stringOf(v); !ok {
+			s.report(kw, "column %s aliases is not a list of names", col.Name)
+			return
+		}
+		elts = []past.Expr{v}
+	}
+
+	for idx, elm := range elts {
+		alias, ok := stringOf(elm)
+		if !ok {
+			s.report(elm, "column %s alias %d is not a string", col.Name, idx)
+			continue
+		}
+		if alias == col.Name {
+			s.report(elm, "column %s is declared as an alias of itself", col.Name)
+			continue
+		}
+		if containsName(col.Aliases, alias) {
+			s.report(elm, "column %s alias %s is declared more than once", col.Name, alias)
+			continue
+		}
+		col.Aliases = append(col.Aliases, alias)
+	}
+}
+
+// constantOf returns the value of a constant of a spec, with True and False as Go booleans so options read the
+// same whether parsed from a spec or an exported schema.
+func constantOf(node *past.NameConstant) interface{} {
+	switch strings.ToLower(fmt.Sprintf("%v", node.Value)) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return node.Value
+}
+
+// report handles a declaration of the schema at node that the parser does not understand, as Table.report does.
+// Schemas parsed outside of a table only log it.
+func (s *Schema) report(node past.Ast, format string, args ...interface{}) {
+	if s.Table != nil {
+		s.Table.report(node, format, args...)
+		return
+	}
+	s.Logger().Warnf(format, args...)
+}
+
+// column returns the column named name, or nil if the schema has no such column.
+func (s *Schema) column(name string) *Column {
+	for _, col := range s.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the schema that belongs to no table.
+func (s *Schema) Clone() *Schema {
+	c := &Schema{
+		Platforms:   append([]string{}, s.Platforms...),
+		Extended:    s.Extended,
+		Columns:     make([]*Column, 0, len(s.Columns)),
+		ForeignKeys: copyForeignKeys(s.ForeignKeys),
+	}
+	for _, col := range s.Columns {
+		c.Columns = append(c.Columns, col.Clone())
+	}
+	return c
+}
+
+// copy returns a deep copy of the schema, belonging to the same table.
+func (s *Schema) copy() *Schema {
+	c := s.Clone()
+	c.logger = s.logger
+	c.Table = s.Table
+	return c
+}
+
+// orderedSchema is a Schema without its marshaling methods, so they can encode it after ordering it.
+type orderedSchema Schema
+
+// ordered returns a shallow copy of the schema with its platforms sorted and its columns in declaration order, the
+// order its exports are written in no matter how the schema was built.
+func (s *Schema) ordered() *orderedSchema {
+	o := orderedSchema(*s)
+	o.Platforms = mergePlatforms(nil, s.Platforms)
+	o.Columns = append([]*Column{}, s.Columns...)
+	sort.SliceStable(o.Columns, func(i, j int) bool { return o.Columns[i].Index < o.Columns[j].Index })
+	return &o
+}
+
+// MarshalJSON encodes the schema with its platforms sorted and its columns in declaration order.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.ordered())
+}
+
+// MarshalYAML encodes the schema with its platforms sorted and its columns in declaration order.
+func (s *Schema) MarshalYAML() (interface{}, error) {
+	return s.ordered(), nil
+}
+
+func copyForeignKeys(keys []map[string]interface{}) []map[string]interface{} {
+	ret := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		fkey := make(map[string]interface{}, len(key))
+		for k, v := range key {
+			fkey[k] = v
+		}
+		ret = append(ret, fkey)
+	}
+	return ret
+}
+
+// mergePlatforms returns the platforms in either list, in sorted order.
+func mergePlatforms(a, b []string) []string {
+	set := map[string]bool{}
+	for _, platform := range append(append([]string{}, a...), b...) {
+		set[platform] = true
+	}
+	ret := make([]string, 0, len(set))
+	for platform := range set {
+		ret = append(ret, platform)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// intersectPlatforms returns the platforms in both lists, in sorted order.
+func intersectPlatforms(a, b []string) []string {
+	set := map[string]bool{}
+	for _, platform := range b {
+		set[platform] = true
+	}
+	ret := []string{}
+	for _, platform := range mergePlatforms(nil, a) {
+		if set[platform] {
+			ret = append(ret, platform)
+		}
+	}
+	return ret
+}
+
+// sortedSchemaPlatforms returns the platforms of extended schemas, in sorted order.
+func sortedSchemaPlatforms(schemas map[string]*Schema) []string {
+	ret := make([]string, 0, len(schemas))
+	for platform := range schemas {
+		ret = append(ret, platform)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,195 @@
+package osqt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// suggestFieldWeights determines how much a term occurring in each part of a table contributes to its score.
+var suggestFieldWeights = map[string]float64{
+	"name":        4,
+	"column":      2,
+	"description": 1.5,
+	"column_desc": 1,
+	"example":     0.5,
+}
+
+var suggestStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true, "for": true,
+	"from": true, "has": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "which": true, "with": true, "all": true, "select": true,
+	"where": true, "what": true, "show": true, "list": true, "find": true, "me": true,
+}
+
+// TableSuggestion is a table ranked against a natural language query by SuggestTables.
+type TableSuggestion struct {
+	Table   *Table   `json:"-" yaml:"-"`
+	Name    string   `json:"name" yaml:"name"`
+	NSID    string   `json:"namespace" yaml:"namespace"`
+	Score   float64  `json:"score" yaml:"score"`
+	Reasons []string `json:"reasons" yaml:"reasons"`
+}
+
+// suggestDoc is a table's searchable text, tokenized per field.
+type suggestDoc struct {
+	table  *Table
+	fields map[string]map[string]int
+	length float64
+}
+
+// tokenize lowercases s, splits it on anything that is not a letter or digit (including underscores) and reduces
+// each remaining word to a crude stem so that e.g. "extensions" matches "extension".
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if suggestStopwords[word] || len(word) < 2 {
+			continue
+		}
+		tokens = append(tokens, stem(word))
+	}
+	return tokens
+}
+
+func stem(word string) string {
+	for _, suffix := range []string{"ies", "ing", "es", "ed", "s"} {
+		if len(word) > len(suffix)+2 && strings.HasSuffix(word, suffix) {
+			if suffix == "ies" {
+				return word[:len(word)-3] + "y"
+			}
+			return word[:len(word)-len(suffix)]
+		}
+	}
+	return word
+}
+
+func newSuggestDoc(table *Table) *suggestDoc {
+	doc := &suggestDoc{table: table, fields: map[string]map[string]int{}}
+	add := func(field, text string) {
+		if doc.fields[field] == nil {
+			doc.fields[field] = map[string]int{}
+		}
+		for _, tok := range tokenize(text) {
+			doc.fields[field][tok]++
+			doc.length += suggestFieldWeights[field]
+		}
+	}
+
+	add("name", table.Name)
+	for _, alias := range table.Aliases {
+		add("name", alias)
+	}
+	add("description", table.Description)
+	cols := []*Column{}
+	if table.Schema != nil {
+		cols = append(cols, table.Schema.Columns...)
+	}
+	for _, ext := range table.ExtendedSchemas {
+		cols = append(cols, ext.Columns...)
+	}
+	for _, col := range cols {
+		add("column", col.Name)
+		add("column_desc", col.Description)
+	}
+	for _, example := range table.Examples {
+		add("example", example)
+	}
+
+	return doc
+}
+
+// SuggestTables ranks the parser's tables against a natural language query using BM25 scoring over table names,
+// column names, descriptions and examples, returning at most limit suggestions (all matches if limit <= 0).
+// Matching runs entirely locally.
+func (p *Parser) SuggestTables(query string, limit int) []*TableSuggestion {
+	const k1, b = 1.2, 0.75
+
+	docs := []*suggestDoc{}
+	total := 0.0
+	for _, ns := range p.Namespaces {
+		for _, table := range ns.Tables {
+			doc := newSuggestDoc(table)
+			docs = append(docs, doc)
+			total += doc.length
+		}
+	}
+	if len(docs) == 0 {
+		return []*TableSuggestion{}
+	}
+	avglen := total / float64(len(docs))
+
+	terms := map[string]bool{}
+	for _, tok := range tokenize(query) {
+		terms[tok] = true
+	}
+
+	// document frequency of each query term
+	df := map[string]int{}
+	for _, doc := range docs {
+		for term := range terms {
+			for _, field := range doc.fields {
+				if field[term] > 0 {
+					df[term]++
+					break
+				}
+			}
+		}
+	}
+
+	ret := []*TableSuggestion{}
+	for _, doc := range docs {
+		score := 0.0
+		reasons := []string{}
+		for term := range terms {
+			if df[term] == 0 {
+				continue
+			}
+
+			tf := 0.0
+			matched := []string{}
+			for field, counts := range doc.fields {
+				if counts[term] > 0 {
+					tf += suggestFieldWeights[field] * float64(counts[term])
+					matched = append(matched, field)
+				}
+			}
+			if tf == 0 {
+				continue
+			}
+
+			idf := math.Log(1 + (float64(len(docs))-float64(df[term])+0.5)/(float64(df[term])+0.5))
+			score += idf * (tf * (k1 + 1)) / (tf + k1*(1-b+b*doc.length/avglen))
+			sort.Strings(matched)
+			reasons = append(reasons, fmt.Sprintf("%q in %s", term, strings.Join(matched, ", ")))
+		}
+		if score == 0 {
+			continue
+		}
+
+		sort.Strings(reasons)
+		ret = append(ret, &TableSuggestion{
+			Table:   doc.table,
+			Name:    doc.table.Name,
+			NSID:    doc.table.NamespaceID,
+			Score:   score,
+			Reasons: reasons,
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Score != ret[j].Score {
+			return ret[i].Score > ret[j].Score
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret
+}
@@ -2,11 +2,12 @@ package osqt
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	past "github.com/go-python/gpython/ast"
 	"github.com/k0kubun/pp"
-	"go.uber.org/zap"
 	"golang.org/x/xerrors"
 	"gopkg.in/src-d/go-mysql-server.v0/sql"
 )
@@ -15,25 +16,105 @@ import (
 type Table struct {
 	sync.RWMutex
 
-	logger *zap.SugaredLogger
+	logger Logger
 
 	Namespace       *Namespace             `json:"-" yaml:"-"`
 	NamespaceID     string                 `json:"namespace_id,omitempty" yaml:"namespace_id,omitempty"`
 	Name            string                 `json:"name,omitempty" yaml:"name,omitempty"`
 	Aliases         []string               `json:"aliases,omitempty" yaml:"aliases,omitempty"`
 	Description     string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Notes           string                 `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Deprecated      string                 `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
 	Schema          *Schema                `json:"schema,omitempty" yaml:"schema,omitempty"`
 	Attributes      map[string]interface{} `json:"attributes,omitempty" yaml:"attributes,omitempty"`
 	Implementation  string                 `json:"implementation,omitempty" yaml:"implementation,omitempty"`
+	Generator       bool                   `json:"generator,omitempty" yaml:"generator,omitempty"`
 	FuzzPaths       []string               `json:"fuzz_paths,omitempty" yaml:"fuzz_paths,omitempty"`
 	ExtendedSchemas map[string]*Schema     `json:"extended_schemas,omitempty" yaml:"extended_schemas,omitempty"`
 	Examples        []string               `json:"examples,omitempty" yaml:"examples,omitempty"`
+
+	// Diagnostics are the problems recorded while parsing the table's spec in lenient mode.
+	Diagnostics []*Diagnostic `json:"-" yaml:"-"`
+
+	strict   bool
+	parseErr error
+}
+
+// Severity is how serious a Diagnostic is.
+type Severity string
+
+// Severities of diagnostics.
+const (
+	// SeverityWarning marks a declaration the parser did not understand and skipped.
+	SeverityWarning Severity = "warning"
+	// SeverityInfo marks a declaration the parser understood but changed, such as a duplicate it dropped.
+	SeverityInfo Severity = "info"
+)
+
+// Diagnostic is a problem with a declaration of a spec found while parsing it, such as one the parser did not
+// understand and skipped. File is the spec file and Line the line of the declaration, or 0 if unknown.
+type Diagnostic struct {
+	Severity Severity `json:"severity" yaml:"severity"`
+	File     string   `json:"file,omitempty" yaml:"file,omitempty"`
+	Line     int      `json:"line,omitempty" yaml:"line,omitempty"`
+	Table    string   `json:"table,omitempty" yaml:"table,omitempty"`
+	Message  string   `json:"message" yaml:"message"`
+}
+
+// String formats the diagnostic as file:line: severity: message, as compilers do.
+func (d *Diagnostic) String() string {
+	loc := d.File
+	if loc == "" {
+		loc = d.Table
+	}
+	if d.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", loc, d.Line)
+	}
+	if loc == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, d.Severity, d.Message)
 }
 
-// Logger returns or creates a new table logger
-func (t *Table) Logger() *zap.SugaredLogger {
+// report handles a declaration of the spec at node that the parser does not understand. In strict mode it fails
+// the parse, otherwise it is recorded as a warning and skipped.
+func (t *Table) report(node past.Ast, format string, args ...interface{}) {
+	if t.strict {
+		line := 0
+		if node != nil {
+			line = node.GetLineno()
+		}
+		t.fail(xerrors.Errorf("line %d: %s", line, fmt.Sprintf(format, args...)))
+		return
+	}
+	t.diagnose(SeverityWarning, node, format, args...)
+}
+
+// diagnose records a diagnostic of the given severity for the declaration of the spec at node.
+func (t *Table) diagnose(severity Severity, node past.Ast, format string, args ...interface{}) {
+	d := &Diagnostic{Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		d.Line = node.GetLineno()
+	}
+	t.Diagnostics = append(t.Diagnostics, d)
+	if severity == SeverityInfo {
+		t.Logger().Infow(d.Message, "line", d.Line)
+	} else {
+		t.Logger().Warnw(d.Message, "line", d.Line)
+	}
+}
+
+// fail stops the parse of the table's spec with err, unless it already failed.
+func (t *Table) fail(err error) {
+	if t.parseErr == nil {
+		t.parseErr = err
+	}
+}
+
+// Logger returns the table's logger, which discards everything for tables created outside of a parser.
+func (t *Table) Logger() Logger {
 	if t.logger == nil {
-		t.logger = zap.L().Sugar().Named(t.Name)
+		t.logger = NopLogger()
 	}
 
 	return t.logger
@@ -52,6 +133,9 @@ func NewEmptyTable() *Table {
 
 // Visit is the AST walk implementation for the Python interpreter.
 func (t *Table) Visit(pyast past.Ast) bool {
+	if t.parseErr != nil {
+		return false
+	}
 	switch node := pyast.(type) {
 	case *past.Call:
 		return t.VisitorBranch(node)
@@ -66,7 +150,7 @@ func (t *Table) VisitorBranch(node *past.Call) bool {
 	if !ok {
 		astNode := pp.Sprint(node)
 		t.Logger().Debugf("Failed AST Node: \n%s\n", astNode)
-		t.Logger().Error("AST function node invalid")
+		t.report(node, "call of %T is not a declaration", node.Func)
 		return false
 	}
 
@@ -75,17 +159,20 @@ func (t *Table) VisitorBranch(node *past.Call) bool {
 	case "table_name":
 		err := t.ExtractNames(node)
 		if err != nil {
-			panic(err)
+			t.fail(xerrors.Errorf("line %d: %s: %v", node.GetLineno(), funcName, err))
+			return false
 		}
 	case "description":
 		err := t.ExtractDescription(node)
 		if err != nil {
-			panic(err)
+			t.fail(xerrors.Errorf("line %d: %s: %v", node.GetLineno(), funcName, err))
+			return false
 		}
 	case "schema":
 		err := t.ExtractSchema(node)
 		if err != nil {
-			panic(err)
+			t.fail(xerrors.Errorf("line %d: %s: %v", node.GetLineno(), funcName, err))
+			return false
 		}
 	case "Column":
 		return false
@@ -95,32 +182,40 @@ func (t *Table) VisitorBranch(node *past.Call) bool {
 	case "implementation":
 		err := t.ExtractImplementation(node)
 		if err != nil {
-			panic(err)
+			t.fail(xerrors.Errorf("line %d: %s: %v", node.GetLineno(), funcName, err))
+			return false
 		}
 	case "fuzz_paths":
 		err := t.ExtractFuzzPaths(node)
 		if err != nil {
-			panic(err)
+			t.fail(xerrors.Errorf("line %d: %s: %v", node.GetLineno(), funcName, err))
+			return false
 		}
 		return false
 	case "extended_schema":
 		err := t.ExtractExtendedSchema(node)
 		if err != nil {
-			panic(err)
+			t.fail(xerrors.Errorf("line %d: %s: %v", node.GetLineno(), funcName, err))
+			return false
 		}
 		return false
 	case "examples":
 		err := t.ExtractExamples(node)
 		if err != nil {
-			panic(err)
+			t.fail(xerrors.Errorf("line %d: %s: %v", node.GetLineno(), funcName, err))
+			return false
 		}
 		return false
 	case "ForeignKey":
 		return false
 	default:
+		// platform helpers, such as the WINDOWS() of extended_schema(lambda: WINDOWS(), [...]), declare nothing
+		if _, ok := TableCategories[funcName]; ok {
+			return false
+		}
 		astNode := pp.Sprint(node)
 		t.Logger().Debugf("AST Node: \n\n%s", astNode)
-		t.Logger().Errorw("Unhandled AST caller", "function", funcName)
+		t.report(node, "unhandled declaration %s()", funcName)
 		return false
 	}
 
@@ -129,6 +224,9 @@ func (t *Table) VisitorBranch(node *past.Call) bool {
 
 // ExtractFuzzPaths attempts to extract the fuzz_paths([]) declaration for compiler checking.
 func (t *Table) ExtractFuzzPaths(node *past.Call) error {
+	if len(node.Args) == 0 {
+		return xerrors.New("fuzz_paths takes 1 argument, got 0")
+	}
 	arglist, ok := node.Args[0].(*past.List)
 	if !ok {
 		err := xerrors.New("argument 0 was not of type *arg.List")
@@ -136,21 +234,24 @@ func (t *Table) ExtractFuzzPaths(node *past.Call) error {
 		return err
 	}
 	for elmidx, def := range arglist.Elts {
-		strval, ok := def.(*past.Str)
+		strval, ok := stringOf(def)
 		if !ok {
 			err := xerrors.Errorf("expected *past.Str field, got %T for argument list element %d", def, elmidx)
 			t.Logger().Errorw("spec parsing error", "error", err)
 			return err
 		}
-		t.FuzzPaths = append(t.FuzzPaths, string(strval.S))
+		t.FuzzPaths = append(t.FuzzPaths, strval)
 	}
 
-	t.Logger().Debug("Extracted table fuzz_paths")
+	t.Logger().Debugw("Extracted table fuzz_paths")
 	return nil
 }
 
 // ExtractExamples attempts to extract the examples([]) delaration of example queries.
 func (t *Table) ExtractExamples(node *past.Call) error {
+	if len(node.Args) == 0 {
+		return xerrors.New("examples takes 1 argument, got 0")
+	}
 	arglist, ok := node.Args[0].(*past.List)
 	if !ok {
 		err := xerrors.New("argument 0 was not of type *arg.List")
@@ -158,15 +259,15 @@ func (t *Table) ExtractExamples(node *past.Call) error {
 		return err
 	}
 	for elmidx, def := range arglist.Elts {
-		strval, ok := def.(*past.Str)
+		strval, ok := stringOf(def)
 		if !ok {
 			err := xerrors.Errorf("expected *past.Str field, got %T for argument list element %d", def, elmidx)
 			t.Logger().Errorw("spec parsing error", "error", err)
 			return err
 		}
-		t.Examples = append(t.Examples, string(strval.S))
+		t.Examples = append(t.Examples, strval)
 	}
-	t.Logger().Debug("Extracted table examples")
+	t.Logger().Debugw("Extracted table examples")
 	return nil
 }
 
@@ -180,13 +281,82 @@ func (t *Table) ExtractAttributes(node *past.Call) {
 		switch v := kw.Value.(type) {
 		case *past.NameConstant:
 			t.Attributes[optkey] = v.Value
-		case *past.Str:
-			t.Attributes[optkey] = string(v.S)
 		case *past.Name:
 			t.Attributes[optkey] = string(v.Id)
+		default:
+			if str, ok := stringOf(v); ok {
+				t.Attributes[optkey] = str
+			}
 		}
 	}
-	t.Logger().Debug("Extracted table attributes")
+	t.Logger().Debugw("Extracted table attributes")
+}
+
+// TableAttributes are the attributes() of a table osquery gives meaning to.
+type TableAttributes struct {
+	// EventSubscriber tables return the events buffered since they were last queried, rather than current state.
+	EventSubscriber bool `json:"event_subscriber,omitempty" yaml:"event_subscriber,omitempty"`
+
+	// UserData tables return data of every user of the host, or of the user constrained by a query.
+	UserData bool `json:"user_data,omitempty" yaml:"user_data,omitempty"`
+
+	// Cacheable tables may serve repeated queries in a scheduled interval from a cache.
+	Cacheable bool `json:"cacheable,omitempty" yaml:"cacheable,omitempty"`
+
+	// Utility tables describe osquery itself rather than the host.
+	Utility bool `json:"utility,omitempty" yaml:"utility,omitempty"`
+
+	// KernelRequired tables need osquery's kernel extension to be loaded.
+	KernelRequired bool `json:"kernel_required,omitempty" yaml:"kernel_required,omitempty"`
+}
+
+// TypedAttributes returns the attributes of the table osquery gives meaning to. Attributes are kept as declared
+// in Attributes, so they read the same whether the table was parsed from a spec or loaded from an export.
+func (t *Table) TypedAttributes() TableAttributes {
+	return TableAttributes{
+		EventSubscriber: t.HasAttribute("event_subscriber"),
+		UserData:        t.HasAttribute("user_data"),
+		Cacheable:       t.HasAttribute("cacheable"),
+		Utility:         t.HasAttribute("utility"),
+		KernelRequired:  t.HasAttribute("kernel_required"),
+	}
+}
+
+// HasAttribute returns true if the table sets the attribute name to a true value.
+func (t *Table) HasAttribute(name string) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	val, ok := t.Attributes[name]
+	if !ok {
+		return false
+	}
+	if b, isBool := val.(bool); isBool {
+		return b
+	}
+
+	// spec files parsed directly yield gpython objects rather than Go booleans
+	switch strings.ToLower(fmt.Sprintf("%v", val)) {
+	case "", "false", "0", "<nil>", "none":
+		return false
+	}
+	return true
+}
+
+// IsEvented returns true if the table is an event_subscriber table.
+func (t *Table) IsEvented() bool {
+	return t.HasAttribute("event_subscriber")
+}
+
+// IsCacheable returns true if osquery may cache the table's results.
+func (t *Table) IsCacheable() bool {
+	return t.HasAttribute("cacheable")
+}
+
+// IsUtility returns true if the table describes osquery itself, either by declaring utility=True or by being in
+// the utility namespace.
+func (t *Table) IsUtility() bool {
+	return t.HasAttribute("utility") || t.NamespaceID == "utility"
 }
 
 // ExtractSchema attempts to extract the primary schema for an OSQuery table's schema([]) declaration.
@@ -198,7 +368,7 @@ func (t *Table) ExtractSchema(node *past.Call) error {
 	}
 	t.Schema = NewEmptySchema(t)
 
-	t.Logger().Debug("Extracted table schema")
+	t.Logger().Debugw("Extracted table schema")
 	return t.Schema.ExtractSchema(node)
 
 }
@@ -212,89 +382,280 @@ func (t *Table) ExtractExtendedSchema(node *past.Call) error {
 		return err
 	}
 
+	sort.Strings(extSchema.Platforms)
+
 	t.Lock()
 	defer t.Unlock()
+	// every platform gets its own copy, so changes made to one platform's columns never show up on another
 	for _, platform := range extSchema.Platforms {
-		t.ExtendedSchemas[platform] = extSchema
-		t.Logger().Debugf("Extracted extended_schema for %s", platform)
+		existing, ok := t.ExtendedSchemas[platform]
+		if !ok {
+			t.ExtendedSchemas[platform] = extSchema.copy()
+			t.Logger().Debugf("Extracted extended_schema for %s", platform)
+			continue
+		}
+
+		// several declarations can apply to one platform (e.g. DARWIN and lambda: LINUX() or DARWIN())
+		for _, col := range extSchema.Columns {
+			if existing.column(col.Name) != nil {
+				t.diagnose(SeverityInfo, node, "column %s is declared by several extended schemas for %s, keeping the first", col.Name, platform)
+				continue
+			}
+			col = col.Clone()
+			col.Index = len(existing.Columns)
+			existing.Columns = append(existing.Columns, col)
+		}
+		existing.ForeignKeys = append(existing.ForeignKeys, copyForeignKeys(extSchema.ForeignKeys)...)
+		existing.Platforms = mergePlatforms(existing.Platforms, extSchema.Platforms)
+		t.Logger().Debugf("Merged extended_schema for %s", platform)
 	}
 
 	return nil
 }
 
-// ExtractImplementation attempts to extract the table implementation("...") declaration.
+// SortedPlatforms returns the platforms the table has extended schemas for, in sorted order.
+func (t *Table) SortedPlatforms() []string {
+	return sortedSchemaPlatforms(t.ExtendedSchemas)
+}
+
+// ExtendedSchemaFor returns the extended schema holding the columns the table only has on platform, or nil if it
+// has none. platform is either a GOOS runtime or one of the platforms of TableCategories, in any case.
+func (t *Table) ExtendedSchemaFor(platform string) *Schema {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.ExtendedSchemas[strings.ToLower(strings.TrimSpace(platform))]
+}
+
+// Column returns the column of the table named or aliased name, in any case, or nil if it has none. The columns
+// of its schema are searched before those of its extended schemas, in order of platform.
+func (t *Table) Column(name string) *Column {
+	return columnNamed(t.AllColumns(""), name)
+}
+
+// AllColumns returns the columns of the table on platform: those of its schema followed by those of its extended
+// schema for platform, as ToSQLSchema builds them. An empty platform includes the columns of every extended
+// schema in order of platform, each once, as the parser gives every platform of an extended_schema() its own copy.
+func (t *Table) AllColumns(platform string) []*Column {
+	t.RLock()
+	defer t.RUnlock()
+
+	cols := []*Column{}
+	if t.Schema != nil {
+		cols = append(cols, t.Schema.Columns...)
+	}
+	if platform != "" {
+		if ext, ok := t.ExtendedSchemas[strings.ToLower(strings.TrimSpace(platform))]; ok {
+			cols = append(cols, ext.Columns...)
+		}
+		return cols
+	}
+
+	seen := map[string]bool{}
+	for _, col := range cols {
+		seen[col.Name] = true
+	}
+	for _, esname := range sortedSchemaPlatforms(t.ExtendedSchemas) {
+		for _, col := range t.ExtendedSchemas[esname].Columns {
+			if seen[col.Name] {
+				continue
+			}
+			seen[col.Name] = true
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// HasColumn returns true if the table has a column named or aliased name, in any case, on platform. An empty
+// platform matches the columns of any of its extended schemas.
+func (t *Table) HasColumn(name string, platform string) bool {
+	return columnNamed(t.AllColumns(platform), name) != nil
+}
+
+// columnNamed returns the first of cols named or aliased name, in any case.
+func columnNamed(cols []*Column, name string) *Column {
+	for _, col := range cols {
+		if strings.EqualFold(col.Name, name) {
+			return col
+		}
+		for _, alias := range col.Aliases {
+			if strings.EqualFold(alias, name) {
+				return col
+			}
+		}
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the table, detached from its namespace and logger, so it can be modified without
+// changing the parser's tables. The schemas of the copy belong to it.
+func (t *Table) Clone() *Table {
+	t.RLock()
+	defer t.RUnlock()
+
+	c := &Table{
+		NamespaceID:     t.NamespaceID,
+		Name:            t.Name,
+		Aliases:         append([]string{}, t.Aliases...),
+		Description:     t.Description,
+		Notes:           t.Notes,
+		Deprecated:      t.Deprecated,
+		Attributes:      make(map[string]interface{}, len(t.Attributes)),
+		Implementation:  t.Implementation,
+		Generator:       t.Generator,
+		FuzzPaths:       append([]string{}, t.FuzzPaths...),
+		ExtendedSchemas: make(map[string]*Schema, len(t.ExtendedSchemas)),
+		Examples:        append([]string{}, t.Examples...),
+	}
+	for key, val := range t.Attributes {
+		c.Attributes[key] = val
+	}
+	if t.Schema != nil {
+		c.Schema = t.Schema.Clone()
+		c.Schema.Table = c
+	}
+	for platform, ext := range t.ExtendedSchemas {
+		c.ExtendedSchemas[platform] = ext.Clone()
+		c.ExtendedSchemas[platform].Table = c
+	}
+	for _, d := range t.Diagnostics {
+		diag := *d
+		c.Diagnostics = append(c.Diagnostics, &diag)
+	}
+	return c
+}
+
+// forPlatform returns a copy of t in ns keeping only the extended schema for goos. Like a Clone, the copy can be
+// modified without changing t.
+func (t *Table) forPlatform(goos string, ns *Namespace) *Table {
+	projected := t.Clone()
+	for platform := range projected.ExtendedSchemas {
+		if platform != goos {
+			delete(projected.ExtendedSchemas, platform)
+		}
+	}
+	projected.logger = t.logger
+	projected.Namespace = ns
+	return projected
+}
+
+// ExtractImplementation attempts to extract the table implementation("...") declaration, and its generator=True
+// keyword marking tables whose rows are yielded as they are generated.
 func (t *Table) ExtractImplementation(node *past.Call) error {
-	impl, ok := node.Args[0].(*past.Str)
+	if len(node.Args) == 0 {
+		return xerrors.New("implementation takes 1 argument, got 0")
+	}
+	impl, ok := stringOf(node.Args[0])
 	if !ok {
-		return fmt.Errorf("argument 0 was not of type string")
+		return xerrors.New("argument 0 was not of type string")
+	}
+	t.Implementation = impl
+
+	for _, kw := range node.Keywords {
+		if string(kw.Arg) != "generator" {
+			t.report(kw, "unknown implementation keyword argument %s", string(kw.Arg))
+			continue
+		}
+		generator, ok := kw.Value.(*past.NameConstant)
+		if !ok {
+			t.report(kw, "implementation generator is not True or False")
+			continue
+		}
+		t.Generator = strings.EqualFold(fmt.Sprintf("%v", generator.Value), "true")
 	}
-	t.Implementation = string(impl.S)
-	t.Logger().Debug("Extracted table implementation")
+	t.Logger().Debugw("Extracted table implementation")
 
 	return nil
 }
 
 // ExtractDescription attempts to extract the table description("...") declaration.
 func (t *Table) ExtractDescription(node *past.Call) error {
-	desc, ok := node.Args[0].(*past.Str)
+	if len(node.Args) == 0 {
+		return xerrors.New("description takes 1 argument, got 0")
+	}
+	desc, ok := stringOf(node.Args[0])
 	if !ok {
-		return fmt.Errorf("argument 0 was not of type string")
+		return xerrors.New("argument 0 was not of type string")
 	}
-	t.Description = string(desc.S)
-	t.Logger().Debug("Extracted table description")
+	t.Description = desc
+	t.Logger().Debugw("Extracted table description")
 
 	return nil
 }
 
-// ExtractNames attempts to parse the table_name("foo") declaration.
+// ExtractNames attempts to parse the table_name("foo") declaration, and the aliases of the table given either with
+// the aliases keyword or as its second argument.
 func (t *Table) ExtractNames(node *past.Call) error {
-	tblname, ok := node.Args[0].(*past.Str)
+	if len(node.Args) == 0 {
+		return xerrors.New("table_name takes 1 argument, got 0")
+	}
+	tblname, ok := stringOf(node.Args[0])
 	if !ok {
-		return fmt.Errorf("argument 0 was not of type string")
+		return xerrors.New("argument 0 was not of type string")
 	}
-	t.Name = string(tblname.S)
+	t.Name = tblname
 
-	if len(node.Keywords) > 0 {
-		for _, kw := range node.Keywords {
-			if string(kw.Arg) != "aliases" {
-				fmt.Printf("[!] Unhandled Keyword Argument: %s (%s)\n", string(kw.Arg), t.Name)
-				continue
-			}
-			aliasList, ok := kw.Value.(*past.List)
-			if !ok {
-				fmt.Printf("[!] aliases keyword argument is not of type *ast.List! (%s)\n", t.Name)
-				continue
-			}
-			for idx, elm := range aliasList.Elts {
-				aliasName, ok := elm.(*past.Str)
-				if !ok {
-					fmt.Printf("[!] aliases keyword argument index %d is not of type *ast.Str! (%s)\n", idx, t.Name)
-					continue
-				}
-				t.Aliases = append(t.Aliases, string(aliasName.S))
-			}
+	if len(node.Args) > 1 {
+		t.extractAliases(node.Args[1])
+	}
+	for _, kw := range node.Keywords {
+		if string(kw.Arg) != "aliases" {
+			t.report(kw, "unknown table_name keyword argument %s", string(kw.Arg))
+			continue
 		}
+		t.extractAliases(kw.Value)
 	}
-	t.Logger().Debug("Extracted table name and alias")
+	t.Logger().Debugw("Extracted table name and alias")
 	return nil
 }
 
-// ToSQLSchema creates a virtual sql.Schema definition to be used in construction of the virtual database.
-func (t *Table) ToSQLSchema(extendedSchemas []string) sql.Schema {
-	cols := []*sql.Column{}
-	for _, col := range t.Schema.Columns {
-		cols = append(cols, col.ToSQLSchema(t.Name))
+// extractAliases adds the aliases of the list expr to the table.
+func (t *Table) extractAliases(expr past.Expr) {
+	aliasList, ok := expr.(*past.List)
+	if !ok {
+		t.report(expr, "table_name aliases is not a list")
+		return
 	}
+	for idx, elm := range aliasList.Elts {
+		aliasName, ok := stringOf(elm)
+		if !ok {
+			t.report(elm, "table_name alias %d is not a string", idx)
+			continue
+		}
+		t.Aliases = append(t.Aliases, aliasName)
+	}
+}
 
+// ToSQLSchema creates a virtual sql.Schema definition to be used in construction of the virtual database, with
+// the columns AllColumns returns for each of extendedSchemas, each once. It returns an error if any of the columns
+// has a type that is not registered.
+func (t *Table) ToSQLSchema(extendedSchemas []string) (sql.Schema, error) {
+	columns := []*Column{}
+	if t.Schema != nil {
+		columns = append(columns, t.Schema.Columns...)
+	}
+	seen := map[string]bool{}
+	for _, col := range columns {
+		seen[col.Name] = true
+	}
 	for _, ext := range extendedSchemas {
-		extschema, found := t.ExtendedSchemas[ext]
-		if !found {
-			continue
+		for _, col := range t.AllColumns(ext) {
+			if !seen[col.Name] {
+				seen[col.Name] = true
+				columns = append(columns, col)
+			}
 		}
-		for _, col := range extschema.Columns {
-			cols = append(cols, col.ToSQLSchema(t.Name))
+	}
+
+	cols := make(sql.Schema, 0, len(columns))
+	for _, col := range columns {
+		sqlcol, err := col.ToSQLSchema(t.Name)
+		if err != nil {
+			return nil, xerrors.Errorf("table %s: %v", t.Name, err)
 		}
+		cols = append(cols, sqlcol)
 	}
 
-	return cols
+	return cols, nil
 }
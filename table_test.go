@@ -0,0 +1,149 @@
+package osqt
+
+import (
+	"reflect"
+	"testing"
+
+	past "github.com/go-python/gpython/ast"
+)
+
+// sharedExtendedParser returns a parser holding a widgets table whose darwin and linux extended schemas are one
+// shared *Schema, as an in-memory caller of InjectTables might build it.
+func sharedExtendedParser(t *testing.T) *Parser {
+	t.Helper()
+
+	shared := &Schema{
+		Extended:  true,
+		Platforms: []string{"darwin", "linux"},
+		Columns:   []*Column{{Index: 0, Name: "owner", Type: "TEXT", Description: "Owner of the widget."}},
+	}
+	tbl := NewEmptyTable()
+	tbl.Name = "widgets"
+	tbl.Schema = &Schema{Columns: []*Column{{Index: 0, Name: "name", Type: "TEXT", Description: "Widget name."}}}
+	tbl.ExtendedSchemas["darwin"] = shared
+	tbl.ExtendedSchemas["linux"] = shared
+
+	return injectedParser(t, map[string]*Table{"specs": tbl})
+}
+
+func sqlColumnNames(t *testing.T, tbl *Table, platforms ...string) []string {
+	t.Helper()
+
+	schema, err := tbl.ToSQLSchema(platforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, col := range schema {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
+func TestExtendedSchemaPlatformCopiesAreIndependent(t *testing.T) {
+	tbl := sharedExtendedParser(t).Namespaces["specs"].Tables["widgets"]
+
+	darwin, linux := tbl.ExtendedSchemaFor("darwin"), tbl.ExtendedSchemaFor("linux")
+	if darwin == nil || linux == nil {
+		t.Fatal("expected darwin and linux extended schemas")
+	}
+	if darwin == linux || darwin.Columns[0] == linux.Columns[0] {
+		t.Fatal("platforms share an extended schema")
+	}
+	if darwin.Table != tbl || linux.Table != tbl {
+		t.Error("extended schema copies do not belong to their table")
+	}
+
+	darwin.Columns[0].Description = "Changed on darwin."
+	darwin.Columns[0].Deprecated = "Use uid instead."
+	darwin.Columns = append(darwin.Columns, &Column{Index: 1, Name: "bundle", Type: "TEXT"})
+	if col := linux.Columns[0]; col.Description != "Owner of the widget." || col.Deprecated != "" {
+		t.Errorf("change to the darwin column showed up on linux: %+v", col)
+	}
+	if len(linux.Columns) != 1 {
+		t.Errorf("column added on darwin showed up on linux: %d columns", len(linux.Columns))
+	}
+}
+
+func TestExtendedSchemaFor(t *testing.T) {
+	tbl := sharedExtendedParser(t).Namespaces["specs"].Tables["widgets"]
+
+	if tbl.ExtendedSchemaFor(" DARWIN") != tbl.ExtendedSchemas["darwin"] {
+		t.Error("platform is not matched regardless of case and surrounding space")
+	}
+	if ext := tbl.ExtendedSchemaFor("windows"); ext != nil {
+		t.Errorf("expected no windows extended schema, got %+v", ext)
+	}
+}
+
+func TestExtendedColumnsAreProjected(t *testing.T) {
+	p := sharedExtendedParser(t)
+	tbl := p.Namespaces["specs"].Tables["widgets"]
+
+	for platform, want := range map[string][]string{
+		"darwin":  {"name", "owner"},
+		"Linux":   {"name", "owner"},
+		"windows": {"name"},
+	} {
+		if got := sqlColumnNames(t, tbl, platform); !reflect.DeepEqual(got, want) {
+			t.Errorf("ToSQLSchema(%s) = %v, want %v", platform, got, want)
+		}
+	}
+
+	projected := p.NamespacesFor("darwin")["specs"].Tables["widgets"]
+	if len(projected.ExtendedSchemas) != 1 || projected.ExtendedSchemas["darwin"] == nil {
+		t.Errorf("darwin projection kept extended schemas for %v", sortedSchemaPlatforms(projected.ExtendedSchemas))
+	}
+	got := []string{}
+	for _, col := range projected.AllColumns("") {
+		got = append(got, col.Name)
+	}
+	if want := []string{"name", "owner"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("darwin projection has columns %v, want %v", got, want)
+	}
+
+	projected = p.NamespacesFor("windows")["specs"].Tables["widgets"]
+	if len(projected.ExtendedSchemas) != 0 {
+		t.Errorf("windows projection kept extended schemas for %v", sortedSchemaPlatforms(projected.ExtendedSchemas))
+	}
+}
+
+func TestEmptyListDeclarationsFail(t *testing.T) {
+	for _, name := range []string{"examples", "fuzz_paths"} {
+		tbl := NewEmptyTable()
+		call := &past.Call{Func: &past.Name{Id: past.Identifier(name)}}
+		if tbl.VisitorBranch(call); tbl.parseErr == nil {
+			t.Errorf("%s() with no arguments did not fail the table", name)
+		}
+	}
+}
+
+func TestPlatformProjectionsAreIndependent(t *testing.T) {
+	p := sharedExtendedParser(t)
+	tbl := p.Namespaces["specs"].Tables["widgets"]
+	darwin := p.NamespacesFor("darwin")["specs"].Tables["widgets"]
+	linux := p.NamespacesFor("linux")["specs"].Tables["widgets"]
+
+	darwin.Schema.Columns[0].Description = "Changed on darwin."
+	darwin.Schema.Columns = append(darwin.Schema.Columns, &Column{Index: 1, Name: "bundle", Type: "TEXT"})
+	darwin.ExtendedSchemas["darwin"].Columns[0].Deprecated = "Use uid instead."
+	darwin.Attributes["cacheable"] = true
+
+	for name, other := range map[string]*Table{"parser": tbl, "linux projection": linux} {
+		if col := other.Schema.Columns[0]; col.Description != "Widget name." {
+			t.Errorf("change to the darwin projection's column showed up in the %s table: %+v", name, col)
+		}
+		if len(other.Schema.Columns) != 1 {
+			t.Errorf("column added to the darwin projection showed up in the %s table", name)
+		}
+		if col := other.ExtendedSchemaFor("linux").Columns[0]; col.Deprecated != "" {
+			t.Errorf("change to the darwin projection's extended column showed up in the %s table: %+v", name, col)
+		}
+		if _, ok := other.Attributes["cacheable"]; ok {
+			t.Errorf("attribute set on the darwin projection showed up in the %s table", name)
+		}
+	}
+	if col := tbl.ExtendedSchemaFor("darwin").Columns[0]; col.Deprecated != "" {
+		t.Errorf("change to the darwin projection's extended column showed up in the parser's: %+v", col)
+	}
+}
@@ -0,0 +1,25 @@
+package osqt
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name osqt registers its OpenTelemetry spans under.
+const TracerName = "github.com/gen0cide/osqt"
+
+// Tracer returns the OpenTelemetry tracer used by osqt. Spans are exported through the global TracerProvider,
+// so they are no-ops unless the embedding application configures one.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// EndSpan records err (if any) on the span before ending it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,143 @@
+package osqt
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// TypeSpec describes how values of a column type are represented in SQL.
+type TypeSpec struct {
+	// Type is the type of the column in the virtual database.
+	Type sql.Type
+
+	// Declared is the type used when declaring the column in SQL DDL (e.g. SQLite exports). It defaults to
+	// the column type name with underscores replaced by spaces.
+	Declared string
+}
+
+// ColumnType is a column type that may appear in spec files, along with how it maps onto other type systems.
+type ColumnType struct {
+	Name        string
+	SQL         TypeSpec
+	GoType      string
+	TSType      string
+	Description string
+
+	// Base is the osquery extension API column kind values of this type are transmitted as: TEXT, INTEGER,
+	// BIGINT or DOUBLE. It defaults to TEXT.
+	Base string
+}
+
+// ColumnTypeOption configures optional properties of a ColumnType.
+type ColumnTypeOption func(*ColumnType)
+
+// WithTypeDescription sets the description of a column type used in generated documentation.
+func WithTypeDescription(desc string) ColumnTypeOption {
+	return func(t *ColumnType) {
+		t.Description = desc
+	}
+}
+
+// WithBaseType sets the osquery extension API column kind a column type is transmitted as.
+func WithBaseType(base string) ColumnTypeOption {
+	return func(t *ColumnType) {
+		t.Base = base
+	}
+}
+
+var (
+	columnTypesMu sync.RWMutex
+	columnTypes   = map[string]*ColumnType{}
+)
+
+func init() {
+	MustRegisterColumnType("TEXT", TypeSpec{Type: sql.Text}, "string", "string",
+		WithTypeDescription("A UTF-8 string."))
+	MustRegisterColumnType("DATE", TypeSpec{Type: sql.Date}, "string", "string",
+		WithTypeDescription("A calendar date."))
+	MustRegisterColumnType("DATETIME", TypeSpec{Type: sql.Timestamp}, "int64", "number",
+		WithTypeDescription("A point in time, as seconds since the Unix epoch."), WithBaseType("BIGINT"))
+	MustRegisterColumnType("INTEGER", TypeSpec{Type: sql.Int32}, "int32", "number",
+		WithTypeDescription("A signed 32-bit integer."), WithBaseType("INTEGER"))
+	MustRegisterColumnType("BIGINT", TypeSpec{Type: sql.Int64}, "int64", "number",
+		WithTypeDescription("A signed 64-bit integer."), WithBaseType("BIGINT"))
+	MustRegisterColumnType("UNSIGNED_BIGINT", TypeSpec{Type: sql.Uint64}, "uint64", "number",
+		WithTypeDescription("An unsigned 64-bit integer."), WithBaseType("BIGINT"))
+	MustRegisterColumnType("DOUBLE", TypeSpec{Type: sql.Float64}, "float64", "number",
+		WithTypeDescription("A double precision floating point number."), WithBaseType("DOUBLE"))
+	MustRegisterColumnType("BLOB", TypeSpec{Type: sql.Blob}, "[]byte", "string",
+		WithTypeDescription("Arbitrary binary data."))
+}
+
+// RegisterColumnType adds a column type to the registry so that spec files using it can be converted into the
+// virtual database, code generation, documentation and lint output. goType and tsType are the Go and TypeScript
+// types generated code should use for the column. It returns an error if the name is already registered.
+func RegisterColumnType(name string, sqlType TypeSpec, goType, tsType string, opts ...ColumnTypeOption) error {
+	if name == "" {
+		return xerrors.New("column types must have a name")
+	}
+	if sqlType.Type == nil {
+		return xerrors.Errorf("column type %s must specify a SQL type", name)
+	}
+	if sqlType.Declared == "" {
+		sqlType.Declared = strings.Replace(name, "_", " ", -1)
+	}
+
+	t := &ColumnType{
+		Name:   name,
+		SQL:    sqlType,
+		GoType: goType,
+		TSType: tsType,
+		Base:   "TEXT",
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	columnTypesMu.Lock()
+	defer columnTypesMu.Unlock()
+
+	if _, exists := columnTypes[name]; exists {
+		return xerrors.Errorf("a column type named %s is already registered", name)
+	}
+	switch t.Base {
+	case "TEXT", "INTEGER", "BIGINT", "DOUBLE":
+	default:
+		return xerrors.Errorf("column type %s has unsupported base type %s", name, t.Base)
+	}
+	columnTypes[name] = t
+	return nil
+}
+
+// MustRegisterColumnType is RegisterColumnType, but panics on error.
+func MustRegisterColumnType(name string, sqlType TypeSpec, goType, tsType string, opts ...ColumnTypeOption) {
+	if err := RegisterColumnType(name, sqlType, goType, tsType, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// LookupColumnType returns the column type registered under name.
+func LookupColumnType(name string) (*ColumnType, bool) {
+	columnTypesMu.RLock()
+	defer columnTypesMu.RUnlock()
+
+	t, ok := columnTypes[name]
+	return t, ok
+}
+
+// ColumnTypes returns the names of all registered column types in sorted order.
+func ColumnTypes() []string {
+	columnTypesMu.RLock()
+	defer columnTypesMu.RUnlock()
+
+	names := make([]string, 0, len(columnTypes))
+	for name := range columnTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,147 @@
+package virtual
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// AuditEntry records a single statement executed against the Database.
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Protocol     string    `json:"protocol"`
+	Client       string    `json:"client,omitempty"`
+	User         string    `json:"user,omitempty"`
+	ConnectionID uint32    `json:"connection_id,omitempty"`
+	Query        string    `json:"query"`
+	Fingerprint  string    `json:"fingerprint"`
+	DurationMS   float64   `json:"duration_ms"`
+	Rows         int       `json:"rows"`
+	Rejected     bool      `json:"rejected,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// AuditLog appends AuditEntry records to a file as newline delimited JSON.
+type AuditLog struct {
+	sync.Mutex
+
+	f   *os.File
+	enc *json.Encoder
+}
+
+// OpenAuditLog opens fileloc for appending, creating it if it does not exist.
+func OpenAuditLog(fileloc string) (*AuditLog, error) {
+	f, err := os.OpenFile(fileloc, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("error opening audit log %s: %v", fileloc, err)
+	}
+
+	return &AuditLog{
+		f:   f,
+		enc: json.NewEncoder(f),
+	}, nil
+}
+
+// Write appends entry to the log.
+func (a *AuditLog) Write(entry *AuditEntry) error {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.enc.Encode(entry)
+}
+
+// Sync flushes the log to disk.
+func (a *AuditLog) Sync() error {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.f.Sync()
+}
+
+// Close flushes and closes the log.
+func (a *AuditLog) Close() error {
+	a.Lock()
+	defer a.Unlock()
+
+	if err := a.f.Sync(); err != nil {
+		a.f.Close()
+		return err
+	}
+	return a.f.Close()
+}
+
+// ClientInfo identifies the client a query was received from.
+type ClientInfo struct {
+	Protocol     string
+	Address      string
+	User         string
+	ConnectionID uint32
+}
+
+type clientInfoKey struct{}
+
+// WithClientInfo returns a context carrying info, which Database.Query records in its audit entries.
+func WithClientInfo(ctx context.Context, info *ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func clientInfoFrom(ctx context.Context) *ClientInfo {
+	if info, ok := ctx.Value(clientInfoKey{}).(*ClientInfo); ok {
+		return info
+	}
+	return &ClientInfo{Protocol: "api"}
+}
+
+// SetAuditLog records every statement executed against the Database in log, in addition to the structured
+// log line emitted for each one. A nil log disables the audit file.
+func (d *Database) SetAuditLog(log *AuditLog) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.auditLog = log
+}
+
+// audit logs a statement that was executed (or rejected) on behalf of client.
+func (d *Database) audit(client *ClientInfo, query string, start time.Time, rows int, err error) {
+	entry := &AuditEntry{
+		Time:         start.UTC(),
+		Protocol:     client.Protocol,
+		Client:       client.Address,
+		User:         client.User,
+		ConnectionID: client.ConnectionID,
+		Query:        query,
+		Fingerprint:  Fingerprint(query),
+		DurationMS:   float64(time.Since(start)) / float64(time.Millisecond),
+		Rows:         rows,
+		Rejected:     xerrors.Is(err, ErrQueryNotPermitted),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	d.logger.Named("audit").Infow("Statement executed",
+		"protocol", entry.Protocol,
+		"client", entry.Client,
+		"user", entry.User,
+		"conn", entry.ConnectionID,
+		"fingerprint", entry.Fingerprint,
+		"duration_ms", entry.DurationMS,
+		"rows", entry.Rows,
+		"rejected", entry.Rejected,
+		"error", entry.Error,
+	)
+
+	d.RLock()
+	log := d.auditLog
+	d.RUnlock()
+	if log == nil {
+		return
+	}
+	if werr := log.Write(entry); werr != nil {
+		d.logger.Warnw("Error writing audit log entry", "error", werr)
+	}
+}
@@ -0,0 +1,34 @@
+package virtual
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// threadID returns the ID of the calling thread.
+func threadID() int {
+	return syscall.Gettid()
+}
+
+// threadCPUTime returns the CPU time consumed by the thread of this process with the ID tid, as reported by its
+// schedstat. It returns zero if the thread has exited or its schedstat cannot be read.
+func threadCPUTime(tid int) time.Duration {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/self/task/%d/schedstat", tid))
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	ns, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(ns)
+}
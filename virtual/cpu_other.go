@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package virtual
+
+import "time"
+
+// threadID is not implemented outside Linux and always returns zero.
+func threadID() int {
+	return 0
+}
+
+// threadCPUTime is not implemented outside Linux and always returns zero.
+func threadCPUTime(tid int) time.Duration {
+	return 0
+}
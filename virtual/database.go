@@ -1,8 +1,12 @@
 package virtual
 
 import (
+	"context"
+	"os"
+	"sort"
 	"sync"
 
+	opentracing "github.com/opentracing/opentracing-go"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"golang.org/x/xerrors"
@@ -11,6 +15,7 @@ import (
 	"gopkg.in/src-d/go-mysql-server.v0/mem"
 	"gopkg.in/src-d/go-mysql-server.v0/server"
 	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/src-d/go-vitess.v1/mysql"
 
 	"github.com/gen0cide/osqt"
 )
@@ -22,6 +27,9 @@ var ErrDatabaseInitialized = xerrors.New("database has already been initialized
 type Database struct {
 	sync.RWMutex
 
+	// reloading is held for reading while statements execute, so ReloadTable only swaps tables between them.
+	reloading sync.RWMutex
+
 	initialized bool
 	name        string
 	logger      *zap.SugaredLogger
@@ -29,8 +37,23 @@ type Database struct {
 	instance    *mem.Database
 	memtables   map[string]*mem.Table
 	schemas     map[string]sql.Schema
+	extra       map[string]map[string]sql.Schema
+	extras      []*mem.Database
+	osexts      map[string][]string
 	pid         *atomic.Uint64
 	parser      *osqt.Parser
+	policy      *QueryPolicy
+	source      rowSource
+	providers   map[string]*providerSource
+	tableCalls  *tableCalls
+	store       *Store
+	recorder    *Recorder
+	auditLog    *AuditLog
+	conns       *connTracker
+	servers     []func(context.Context) error
+	stopped     bool
+	socketMode  os.FileMode
+	limits      Limits
 }
 
 // NewDatabase creates an uninitialized, base Database object with some basic settings pre-configured.
@@ -50,12 +73,18 @@ func NewDatabase(name string, parser *osqt.Parser, logger *zap.SugaredLogger) (*
 	}
 
 	return &Database{
-		name:      name,
-		parser:    parser,
-		logger:    logger,
-		pid:       atomic.NewUint64(uint64(10)),
-		memtables: map[string]*mem.Table{},
-		schemas:   map[string]sql.Schema{},
+		name:       name,
+		parser:     parser,
+		logger:     logger,
+		pid:        atomic.NewUint64(uint64(10)),
+		conns:      newConnTracker(),
+		socketMode: DefaultSocketMode,
+		memtables:  map[string]*mem.Table{},
+		schemas:    map[string]sql.Schema{},
+		extra:      map[string]map[string]sql.Schema{},
+		osexts:     map[string][]string{},
+		providers:  map[string]*providerSource{},
+		tableCalls: newTableCalls(),
 	}, nil
 }
 
@@ -65,14 +94,69 @@ func (d *Database) AddTable(tbl *osqt.Table, osexts []string) error {
 		return ErrDatabaseInitialized
 	}
 
+	schema, err := tbl.ToSQLSchema(osexts)
+	if err != nil {
+		return err
+	}
+
 	d.Lock()
 	defer d.Unlock()
 
-	schema := tbl.ToSQLSchema(osexts)
 	d.schemas[tbl.Name] = schema
+	d.setOSExts(d.name, osexts)
 	return nil
 }
 
+// AddTableTo adds table to the named database, creating it if this is its first table. Databases other than
+// the one the Database was created with are served by the same engine, so clients can switch between them with
+// USE (e.g. to check a query against osquery_darwin and osquery_windows from one connection). Their tables are
+// held in the Store given to SetStore, or else in memory; SetExtensionProvider and SetRowProvider only back the
+// tables of the primary database.
+func (d *Database) AddTableTo(database string, tbl *osqt.Table, osexts []string) error {
+	if database == d.name {
+		return d.AddTable(tbl, osexts)
+	}
+	if d.initialized {
+		return ErrDatabaseInitialized
+	}
+
+	schema, err := tbl.ToSQLSchema(osexts)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.extra[database] == nil {
+		d.extra[database] = map[string]sql.Schema{}
+	}
+	d.extra[database][tbl.Name] = schema
+	d.setOSExts(database, osexts)
+	return nil
+}
+
+// setOSExts records the platforms a database's tables were added for. The first is reported by the meta tables,
+// and ReloadTable builds the new schemas of the database's tables for them.
+func (d *Database) setOSExts(database string, osexts []string) {
+	if _, ok := d.osexts[database]; !ok && len(osexts) > 0 {
+		d.osexts[database] = osexts
+	}
+}
+
+// Databases returns the names of the databases served, beginning with the one the Database was created with.
+func (d *Database) Databases() []string {
+	d.RLock()
+	defer d.RUnlock()
+
+	names := make([]string, 0, len(d.extra))
+	for name := range d.extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{d.name}, names...)
+}
+
 // Initialize takes the schemas recorded via AddTable, and initializes a database engine supporting that schema set.
 func (d *Database) Initialize() error {
 	if d.initialized {
@@ -83,44 +167,272 @@ func (d *Database) Initialize() error {
 	defer d.Unlock()
 
 	db := mem.NewDatabase(d.name)
+	meta, err := d.newMetaSource(d.name, d.schemas)
+	if err != nil {
+		return err
+	}
 	for tblname, tblschema := range d.schemas {
-		table := mem.NewTable(tblname, tblschema)
-		db.AddTable(tblname, table)
-		d.memtables[tblname] = table
+		table, err := d.newTable(d.name, tblname, tblschema, meta)
+		if err != nil {
+			return err
+		}
+		db.AddTable(tblname, newReloadableTable(table))
 	}
+	db.AddTable(jsonRowsTable, newSourceTable(jsonRowsTable, jsonRowsSchema, d.tableCalls))
 	eng := sqle.NewDefault()
+	registerFunctions(eng.Catalog.FunctionRegistry, jsonFunctions, networkFunctions)
+	// the first database added is the default for new sessions
 	eng.AddDatabase(db)
-	err := eng.Init()
-	if err != nil {
+
+	extraNames := make([]string, 0, len(d.extra))
+	for name := range d.extra {
+		extraNames = append(extraNames, name)
+	}
+	sort.Strings(extraNames)
+	extras := make([]*mem.Database, 0, len(extraNames))
+	for _, name := range extraNames {
+		edb := mem.NewDatabase(name)
+		emeta, err := d.newMetaSource(name, d.extra[name])
+		if err != nil {
+			return err
+		}
+		for tblname, tblschema := range d.extra[name] {
+			table, err := d.newTable(name, tblname, tblschema, emeta)
+			if err != nil {
+				return err
+			}
+			edb.AddTable(tblname, newReloadableTable(table))
+		}
+		edb.AddTable(jsonRowsTable, newSourceTable(jsonRowsTable, jsonRowsSchema, d.tableCalls))
+		eng.AddDatabase(edb)
+		extras = append(extras, edb)
+	}
+
+	if err := eng.Init(); err != nil {
 		return xerrors.Errorf("error initializing database: %v", err)
 	}
 
 	d.initialized = true
 	d.eng = eng
 	d.instance = db
+	d.extras = extras
+	return nil
+}
+
+// newTable creates the table holding the rows of a table in the named database. Tables of the primary database are
+// backed by the table's row provider, the live osquery instance, its meta source, the Store or memory, in that
+// order. Row providers and the live instance produce the rows of the primary database's schemas, so the tables of
+// other databases are only backed by their meta source, the Store or memory. In the Store, the tables of the
+// primary database keep their own name as their bucket, and those of other databases are prefixed with the
+// database's name so tables present in several databases do not share rows.
+func (d *Database) newTable(database, name string, schema sql.Schema, meta *metaSource) (sql.Table, error) {
+	if database == d.name {
+		if p, ok := d.providers[name]; ok {
+			return newSourceTable(name, schema, p), nil
+		}
+		if d.source != nil {
+			return newSourceTable(name, schema, d.source), nil
+		}
+	}
+	if _, ok := metaTables[name]; ok {
+		return newSourceTable(name, schema, meta), nil
+	}
+	if d.store != nil {
+		bucket := name
+		if database != d.name {
+			bucket = database + "." + name
+		}
+		table, err := d.store.table(bucket, name, schema)
+		if err != nil {
+			return nil, err
+		}
+		return table, nil
+	}
+	table := mem.NewTable(name, schema)
+	if database == d.name {
+		d.memtables[name] = table
+	}
+	return table, nil
+}
+
+// newMetaSource adds any meta tables missing from a database's schemas and returns the source of their rows.
+// When the Database reads from a live osquery instance, the instance's own meta tables are queried instead.
+func (d *Database) newMetaSource(database string, schemas map[string]sql.Schema) (*metaSource, error) {
+	if err := addMetaTables(schemas); err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0, len(schemas))
+	for name := range schemas {
+		tables = append(tables, name)
+	}
+	platform := ""
+	if osexts := d.osexts[database]; len(osexts) > 0 {
+		platform = osexts[0]
+	}
+	return newMetaSource(platform, tables), nil
+}
+
+// SetExtensionProvider makes every table of the primary database read its rows from a live osquery instance instead
+// of from memory. It must be called before Initialize.
+func (d *Database) SetExtensionProvider(p *ExtensionProvider) error {
+	if d.initialized {
+		return ErrDatabaseInitialized
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.source = p
+	return nil
+}
+
+// SetStore keeps the rows of every table in store instead of in memory. It must be called before Initialize.
+func (d *Database) SetStore(store *Store) error {
+	if d.initialized {
+		return ErrDatabaseInitialized
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.store = store
+	return nil
+}
+
+// LoadFixtures inserts the fixture rows into their tables, in every database that has them. Tables that already
+// contain rows (e.g. from a previous run against the same Store) are skipped so restarting a server does not
+// duplicate its fixtures.
+func (d *Database) LoadFixtures(fixtures Fixtures) error {
+	if !d.initialized {
+		return xerrors.New("fixtures cannot be loaded until the database is initialized")
+	}
+
+	d.RLock()
+	defer d.RUnlock()
+
+	ctx := sql.NewEmptyContext()
+	instances := append([]*mem.Database{d.instance}, d.extras...)
+	for tname, rows := range fixtures {
+		matched := false
+		for _, db := range instances {
+			table, ok := db.Tables()[tname]
+			if !ok {
+				continue
+			}
+			matched = true
+			if err := d.loadFixture(ctx, table, tname, rows); err != nil {
+				return err
+			}
+		}
+		if !matched {
+			d.logger.Warnw("Fixture does not match a table in the database", "table", tname)
+		}
+	}
+
 	return nil
 }
 
+func (d *Database) loadFixture(ctx *sql.Context, table sql.Table, tname string, rows []map[string]string) error {
+	if rt, ok := table.(*reloadableTable); ok {
+		table = rt.current()
+	}
+	if st, ok := table.(*sourceTable); ok {
+		switch src := st.source.(type) {
+		case *metaSource:
+			src.setFixture(tname, rows)
+			d.logger.Debugw("Loaded fixture", "table", tname, "rows", len(rows))
+			return nil
+		case *providerSource:
+			d.logger.Warnw("Table is backed by a row provider, ignoring its fixture", "table", tname)
+			return nil
+		}
+	}
+	inserter, ok := table.(sql.Inserter)
+	if !ok {
+		return xerrors.Errorf("table %s does not support inserting fixture rows", tname)
+	}
+	if counter, ok := table.(interface{ rowCount() (int, error) }); ok {
+		if count, err := counter.rowCount(); err != nil {
+			return err
+		} else if count > 0 {
+			d.logger.Debugw("Table already has rows, skipping fixture", "table", tname, "rows", count)
+			return nil
+		}
+	}
+
+	schema := table.Schema()
+	for idx, fixture := range rows {
+		row := make(sql.Row, len(schema))
+		for cidx, col := range schema {
+			val, ok := fixture[col.Name]
+			if !ok {
+				continue
+			}
+			converted, err := col.Type.Convert(val)
+			if err != nil {
+				return xerrors.Errorf("fixture %s row %d: invalid value for column %s: %v", tname, idx, col.Name, err)
+			}
+			row[cidx] = converted
+		}
+		if err := inserter.Insert(ctx, row); err != nil {
+			return xerrors.Errorf("error inserting fixture %s row %d: %v", tname, idx, err)
+		}
+	}
+	d.logger.Debugw("Loaded fixture", "table", tname, "rows", len(rows))
+	return nil
+}
+
+// SetQueryPolicy restricts the queries the Database will execute. A nil policy permits every query.
+func (d *Database) SetQueryPolicy(p *QueryPolicy) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.policy = p
+}
+
+func (d *Database) checkPolicy(query string) error {
+	d.RLock()
+	defer d.RUnlock()
+
+	if d.policy == nil {
+		return nil
+	}
+
+	return d.policy.Check(query)
+}
+
 // Start is used to create a listener for the Database and start a server loop to handle sessions. This function will not return unless the server shuts down.
+// When proto is "unix", addr is the path of the socket to create, which is given the mode set with SetSocketMode.
 func (d *Database) Start(proto, addr string) error {
 	if !d.initialized {
 		return xerrors.New("server cannot start until the database is initialized")
 	}
-	cfg := server.Config{
-		Protocol: proto,
-		Address:  addr,
-		Auth:     &auth.None{},
-	}
+	a := &auth.None{}
+	sm := server.NewSessionManager(server.DefaultSessionBuilder, opentracing.NoopTracer{}, d.eng.Catalog.MemoryManager, addr)
+	h := newHandler(d, server.NewHandler(d.eng, sm, 0))
 
-	svr, err := server.NewDefaultServer(cfg, d.eng)
+	if err := prepareSocket(proto, addr); err != nil {
+		return err
+	}
+	l, err := mysql.NewListener(proto, addr, a.Mysql(), h, d.currentLimits().IdleTimeout, 0)
 	if err != nil {
 		return err
 	}
+	if err := d.secureSocket(proto, addr); err != nil {
+		l.Close()
+		return err
+	}
 
-	err = svr.Start()
+	err = d.addServer(func(ctx context.Context) error {
+		l.Close()
+		return d.conns.drain(ctx)
+	})
 	if err != nil {
+		l.Close()
 		return err
 	}
 
+	l.Accept()
 	return nil
 }
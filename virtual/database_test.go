@@ -0,0 +1,65 @@
+package virtual
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"github.com/gen0cide/osqt"
+)
+
+// TestRowProviderOnlyBacksPrimaryDatabase serves a table in a linux primary database and a windows database where
+// it has an extra column, with a row provider producing linux rows, and checks only the linux table uses it.
+func TestRowProviderOnlyBacksPrimaryDatabase(t *testing.T) {
+	tbl := osqt.NewTableBuilder("groups").
+		Description("Local system groups.").
+		Column("gid", "BIGINT", "Group ID.").
+		Column("groupname", "TEXT", "Group name.").
+		ExtendedColumn("WINDOWS", "group_sid", "TEXT", "Group SID.").
+		MustBuild()
+
+	db, err := NewDatabase("osquery_linux", osqt.NewParser(nil), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTableTo("osquery_linux", tbl, []string{"linux"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddTableTo("osquery_windows", tbl, []string{"windows"}); err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetRowProvider("groups", RowProviderFunc(func(ctx *sql.Context, table string) ([]sql.Row, error) {
+		return []sql.Row{{int64(0), "root"}}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := sql.NewEmptyContext()
+	linux, err := tableRows(ctx, db.instance.Tables()["groups"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(linux) != 1 {
+		t.Errorf("expected the provider's row in osquery_linux.groups, got %v", linux)
+	}
+
+	if len(db.extras) != 1 {
+		t.Fatalf("expected one extra database, got %d", len(db.extras))
+	}
+	windows := db.extras[0].Tables()["groups"]
+	if got := len(windows.Schema()); got != 3 {
+		t.Fatalf("osquery_windows.groups has %d columns, want 3", got)
+	}
+	rows, err := tableRows(ctx, windows)
+	if err != nil {
+		t.Fatalf("reading osquery_windows.groups: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("osquery_windows.groups should not be backed by the provider, got %v", rows)
+	}
+}
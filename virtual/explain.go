@@ -0,0 +1,101 @@
+package virtual
+
+import (
+	"context"
+	"sort"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/src-d/go-mysql-server.v0/sql/expression"
+	"gopkg.in/src-d/go-mysql-server.v0/sql/parse"
+	"gopkg.in/src-d/go-mysql-server.v0/sql/plan"
+)
+
+// Plan is the analyzed execution plan of a query. Tree is the engine's rendering of the plan, and Tables and
+// Columns (as table.column) are what it reads, sorted.
+type Plan struct {
+	Query   string   `json:"query"`
+	Tree    string   `json:"tree"`
+	Tables  []string `json:"tables"`
+	Columns []string `json:"columns"`
+}
+
+// Explain parses and analyzes query the way Query would run it, without running it, and returns the resolved
+// plan.
+func (d *Database) Explain(ctx context.Context, query string) (*Plan, error) {
+	if !d.initialized {
+		return nil, xerrors.New("queries cannot be explained until the database is initialized")
+	}
+	analyzed, err := d.analyze(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, columns := map[string]bool{}, map[string]bool{}
+	plan.Inspect(analyzed, func(node sql.Node) bool {
+		if rt, ok := node.(*plan.ResolvedTable); ok {
+			tables[rt.Name()] = true
+		}
+		return true
+	})
+	plan.InspectExpressions(analyzed, func(expr sql.Expression) bool {
+		if gf, ok := expr.(*expression.GetField); ok {
+			name := gf.Name()
+			if gf.Table() != "" {
+				name = gf.Table() + "." + name
+			}
+			columns[name] = true
+		}
+		return true
+	})
+
+	return &Plan{
+		Query:   query,
+		Tree:    analyzed.String(),
+		Tables:  sortedSet(tables),
+		Columns: sortedSet(columns),
+	}, nil
+}
+
+// ResultSchema returns the columns query would return, found by analyzing its plan without running it.
+func (d *Database) ResultSchema(ctx context.Context, query string) (sql.Schema, error) {
+	if !d.initialized {
+		return nil, xerrors.New("queries cannot be described until the database is initialized")
+	}
+	analyzed, err := d.analyze(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return analyzed.Schema(), nil
+}
+
+// analyze parses and analyzes query against the Database's engine.
+func (d *Database) analyze(ctx context.Context, query string) (sql.Node, error) {
+	d.reloading.RLock()
+	defer d.reloading.RUnlock()
+
+	query, release, err := d.expandTableFunctions(ctx, query, false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sctx := sql.NewContext(ctx,
+		sql.WithSession(sql.NewBaseSession()),
+		sql.WithQuery(query),
+	)
+	parsed, err := parse.Parse(sctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return d.eng.Analyzer.Analyze(sctx, parsed)
+}
+
+func sortedSet(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,196 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	osquery "github.com/osquery/osquery-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"github.com/gen0cide/osqt"
+)
+
+// rowSource supplies the rows of a table at query time instead of from an in-memory copy.
+type rowSource interface {
+	rows(ctx *sql.Context, table string, schema sql.Schema) ([]sql.Row, error)
+}
+
+// ExtensionProvider proxies table reads to a running osquery instance over its Thrift extension socket.
+// Tables backed by an ExtensionProvider execute "SELECT * FROM <table>" against the host every time they are queried.
+type ExtensionProvider struct {
+	sync.Mutex
+
+	socket string
+	client *osquery.ExtensionManagerClient
+}
+
+// NewExtensionProvider connects to the osquery extension socket at path.
+func NewExtensionProvider(socket string, timeout time.Duration) (*ExtensionProvider, error) {
+	client, err := osquery.NewClient(socket, timeout)
+	if err != nil {
+		return nil, xerrors.Errorf("error connecting to extension socket %s: %v", socket, err)
+	}
+
+	return &ExtensionProvider{
+		socket: socket,
+		client: client,
+	}, nil
+}
+
+// Close closes the connection to the extension socket.
+func (e *ExtensionProvider) Close() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.client.Close()
+}
+
+func (e *ExtensionProvider) rows(ctx *sql.Context, table string, schema sql.Schema) (ret []sql.Row, err error) {
+	query := fmt.Sprintf("SELECT * FROM %s", table)
+	_, span := osqt.Tracer().Start(ctx, "virtual.ExtensionQuery", trace.WithAttributes(
+		attribute.String("db.statement", query),
+		attribute.String("osqt.extension_socket", e.socket),
+	))
+	defer func() { osqt.EndSpan(span, err) }()
+
+	// the thrift client is not safe for concurrent use
+	e.Lock()
+	results, err := e.client.QueryRows(query)
+	e.Unlock()
+	if err != nil {
+		return nil, xerrors.Errorf("error querying %s over the extension socket: %v", table, err)
+	}
+
+	return stringRows(table, schema, results)
+}
+
+// query runs a query against the host, returning the names of its result columns in order along with its rows.
+func (e *ExtensionProvider) query(ctx context.Context, query string) (columns []string, rows []map[string]string, err error) {
+	_, span := osqt.Tracer().Start(ctx, "virtual.ExtensionQuery", trace.WithAttributes(
+		attribute.String("db.statement", query),
+		attribute.String("osqt.extension_socket", e.socket),
+	))
+	defer func() { osqt.EndSpan(span, err) }()
+
+	e.Lock()
+	defer e.Unlock()
+
+	resp, err := e.client.GetQueryColumns(query)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("error querying over the extension socket: %v", err)
+	}
+	if resp.Status != nil && resp.Status.Code != 0 {
+		return nil, nil, xerrors.Errorf("osquery could not run the query: %s", resp.Status.Message)
+	}
+	// each column is described by a map holding only its name and type
+	for _, col := range resp.Response {
+		for name := range col {
+			columns = append(columns, name)
+		}
+	}
+
+	rows, err = e.client.QueryRows(query)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("error querying over the extension socket: %v", err)
+	}
+	return columns, rows, nil
+}
+
+// stringRows converts rows of osquery's string values into rows matching schema. Empty values in columns that are
+// not text are treated as NULL, as osquery reports missing integers that way.
+func stringRows(table string, schema sql.Schema, results []map[string]string) ([]sql.Row, error) {
+	ret := make([]sql.Row, 0, len(results))
+	for _, result := range results {
+		row := make(sql.Row, len(schema))
+		for idx, col := range schema {
+			val, ok := result[col.Name]
+			if !ok || (val == "" && !sql.IsText(col.Type)) {
+				continue
+			}
+			converted, err := col.Type.Convert(val)
+			if err != nil {
+				return nil, xerrors.Errorf("error converting %s.%s value %q: %v", table, col.Name, val, err)
+			}
+			row[idx] = converted
+		}
+		ret = append(ret, row)
+	}
+
+	return ret, nil
+}
+
+// sourceTable is a sql.Table whose rows are fetched from a rowSource each time it is scanned.
+type sourceTable struct {
+	name   string
+	schema sql.Schema
+	source rowSource
+}
+
+func newSourceTable(name string, schema sql.Schema, source rowSource) *sourceTable {
+	return &sourceTable{
+		name:   name,
+		schema: schema,
+		source: source,
+	}
+}
+
+// Name implements the sql.Nameable interface.
+func (t *sourceTable) Name() string {
+	return t.name
+}
+
+// String implements the fmt.Stringer interface.
+func (t *sourceTable) String() string {
+	return t.name
+}
+
+// Schema implements the sql.Table interface.
+func (t *sourceTable) Schema() sql.Schema {
+	return t.schema
+}
+
+// Partitions implements the sql.Table interface.
+func (t *sourceTable) Partitions(*sql.Context) (sql.PartitionIter, error) {
+	return &singlePartitionIter{}, nil
+}
+
+// PartitionRows implements the sql.Table interface.
+func (t *sourceTable) PartitionRows(ctx *sql.Context, _ sql.Partition) (sql.RowIter, error) {
+	rows, err := t.source.rows(ctx, t.name, t.schema)
+	if err != nil {
+		return nil, err
+	}
+	return sql.RowsToRowIter(rows...), nil
+}
+
+// singlePartition is the only partition of a sourceTable.
+type singlePartition struct{}
+
+// Key implements the sql.Partition interface.
+func (singlePartition) Key() []byte {
+	return []byte("single")
+}
+
+type singlePartitionIter struct {
+	done bool
+}
+
+// Next implements the sql.PartitionIter interface.
+func (i *singlePartitionIter) Next() (sql.Partition, error) {
+	if i.done {
+		return nil, io.EOF
+	}
+	i.done = true
+	return singlePartition{}, nil
+}
+
+// Close implements the sql.PartitionIter interface.
+func (i *singlePartitionIter) Close() error {
+	return nil
+}
@@ -0,0 +1,272 @@
+package virtual
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"path"
+	"strings"
+
+	"github.com/gen0cide/osqt"
+)
+
+// FakeStrategy generates the values of the columns it matches.
+type FakeStrategy struct {
+	Name string
+	// Match returns true if the strategy generates values for col.
+	Match func(col *osqt.Column) bool
+	// Value returns the value of the column in the given row, drawing any randomness from r.
+	Value func(r *rand.Rand, row int) string
+}
+
+// Faker generates realistic values for the columns of tables, choosing a strategy for each column by its name and
+// type. Values depend only on the seed, the column name and the row number, so the same seed reproduces the same
+// dataset across runs, and key columns such as uid, pid and path hold the same values in every table that has
+// them so that joins between generated tables line up.
+type Faker struct {
+	seed       int64
+	strategies []FakeStrategy
+}
+
+// NewFaker creates a Faker using the built in strategies, seeded with seed.
+func NewFaker(seed int64) *Faker {
+	return &Faker{
+		seed:       seed,
+		strategies: append([]FakeStrategy{}, defaultFakeStrategies...),
+	}
+}
+
+// AddStrategy adds a strategy taking precedence over those already added.
+func (f *Faker) AddStrategy(s FakeStrategy) {
+	f.strategies = append([]FakeStrategy{s}, f.strategies...)
+}
+
+// Rows generates n rows of values for columns.
+func (f *Faker) Rows(columns []*osqt.Column, n int) []map[string]string {
+	rows := make([]map[string]string, 0, n)
+	for i := 0; i < n; i++ {
+		row := map[string]string{}
+		for _, col := range columns {
+			row[col.Name] = f.Value(col, i)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Value generates the value of col in the given row.
+func (f *Faker) Value(col *osqt.Column, row int) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(col.Name)))
+	r := rand.New(rand.NewSource((f.seed ^ int64(h.Sum64())) + int64(row)))
+
+	for _, s := range f.strategies {
+		if s.Match(col) {
+			return s.Value(r, row)
+		}
+	}
+	return placeholderValue(col, row)
+}
+
+// SyntheticRows generates n rows of values for columns, using a Faker with the default seed.
+func SyntheticRows(columns []*osqt.Column, n int) []map[string]string {
+	return NewFaker(0).Rows(columns, n)
+}
+
+// placeholderValue is the value of a column no strategy matches, shaped to match the column's type.
+func placeholderValue(col *osqt.Column, row int) string {
+	switch {
+	case col.Type == "DATETIME":
+		return fmt.Sprintf("%d", 1577836800+row*60)
+	case baseType(col) == "DOUBLE":
+		return fmt.Sprintf("%d.5", row+1)
+	case baseType(col) != "TEXT":
+		return fmt.Sprintf("%d", row+1)
+	default:
+		return fmt.Sprintf("%s_%d", col.Name, row+1)
+	}
+}
+
+// The pools key columns draw from by row number. Users are aligned across pools, so the user in a row has the
+// same uid, gid and username wherever they appear.
+var (
+	fakeUsernames = []string{"root", "daemon", "admin", "alice", "bob", "nobody"}
+	fakeUIDs      = []int{0, 1, 501, 1000, 1001, 65534}
+	fakeGIDs      = []int{0, 1, 20, 1000, 1001, 65534}
+	fakePIDs      = []int{1, 97, 312, 845, 1204, 2048, 3301, 4410}
+	fakePaths     = []string{
+		"/usr/lib/systemd/systemd",
+		"/usr/sbin/sshd",
+		"/bin/bash",
+		"/usr/bin/python3",
+		"/etc/passwd",
+		"/var/log/syslog",
+		"/home/alice/.bashrc",
+		"/tmp/update.sh",
+	}
+)
+
+var defaultFakeStrategies = []FakeStrategy{
+	{
+		Name:  "uid",
+		Match: columnNamed("INTEGER", "uid", "euid", "suid", "auid", "owner_uid", "user_id"),
+		Value: func(_ *rand.Rand, row int) string { return fmt.Sprintf("%d", fakeUIDs[row%len(fakeUIDs)]) },
+	},
+	{
+		Name:  "gid",
+		Match: columnNamed("INTEGER", "gid", "egid", "sgid", "owner_gid", "group_id"),
+		Value: func(_ *rand.Rand, row int) string { return fmt.Sprintf("%d", fakeGIDs[row%len(fakeGIDs)]) },
+	},
+	{
+		Name:  "username",
+		Match: columnNamed("TEXT", "username", "user", "owner"),
+		Value: func(_ *rand.Rand, row int) string { return fakeUsernames[row%len(fakeUsernames)] },
+	},
+	{
+		Name:  "pid",
+		Match: columnNamed("INTEGER", "pid"),
+		Value: func(_ *rand.Rand, row int) string { return fmt.Sprintf("%d", fakePIDs[row%len(fakePIDs)]) },
+	},
+	{
+		// each process is the child of the one in the previous row, so parent joins back to pid
+		Name:  "parent",
+		Match: columnNamed("INTEGER", "parent", "ppid", "parent_pid"),
+		Value: func(_ *rand.Rand, row int) string {
+			if row%len(fakePIDs) == 0 {
+				return "0"
+			}
+			return fmt.Sprintf("%d", fakePIDs[row%len(fakePIDs)-1])
+		},
+	},
+	{
+		Name:  "path",
+		Match: columnNamed("TEXT", "path", "target_path", "cmdline", "executable"),
+		Value: func(_ *rand.Rand, row int) string { return fakePaths[row%len(fakePaths)] },
+	},
+	{
+		Name:  "directory",
+		Match: columnNamed("TEXT", "directory", "cwd"),
+		Value: func(_ *rand.Rand, row int) string { return path.Dir(fakePaths[row%len(fakePaths)]) },
+	},
+	{
+		Name:  "filename",
+		Match: columnNamed("TEXT", "filename"),
+		Value: func(_ *rand.Rand, row int) string { return path.Base(fakePaths[row%len(fakePaths)]) },
+	},
+	{
+		Name: "mac",
+		Match: func(col *osqt.Column) bool {
+			return baseType(col) == "TEXT" && isMACColumn(col.Name)
+		},
+		Value: func(r *rand.Rand, _ int) string {
+			b := make([]byte, 6)
+			r.Read(b)
+			// a locally administered unicast address
+			b[0] = b[0]&0xfc | 0x02
+			return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", b[0], b[1], b[2], b[3], b[4], b[5])
+		},
+	},
+	{
+		Name: "address",
+		Match: func(col *osqt.Column) bool {
+			return baseType(col) == "TEXT" && isIPColumn(col.Name)
+		},
+		Value: func(r *rand.Rand, _ int) string {
+			return fmt.Sprintf("10.%d.%d.%d", r.Intn(256), r.Intn(256), 1+r.Intn(254))
+		},
+	},
+	{
+		Name: "port",
+		Match: func(col *osqt.Column) bool {
+			return isInteger(col) && (col.Name == "port" || strings.HasSuffix(col.Name, "_port"))
+		},
+		Value: func(r *rand.Rand, _ int) string { return fmt.Sprintf("%d", 1024+r.Intn(64511)) },
+	},
+	{
+		Name:  "md5",
+		Match: columnNamed("TEXT", "md5"),
+		Value: func(r *rand.Rand, _ int) string { return fakeHex(r, 16) },
+	},
+	{
+		Name:  "sha1",
+		Match: columnNamed("TEXT", "sha1"),
+		Value: func(r *rand.Rand, _ int) string { return fakeHex(r, 20) },
+	},
+	{
+		Name:  "sha256",
+		Match: columnNamed("TEXT", "sha256"),
+		Value: func(r *rand.Rand, _ int) string { return fakeHex(r, 32) },
+	},
+	{
+		Name:  "uuid",
+		Match: func(col *osqt.Column) bool { return baseType(col) == "TEXT" && strings.HasSuffix(col.Name, "uuid") },
+		Value: func(r *rand.Rand, _ int) string {
+			b := []byte(fakeHex(r, 16))
+			return fmt.Sprintf("%s-%s-4%s-a%s-%s", b[0:8], b[8:12], b[13:16], b[17:20], b[20:32])
+		},
+	},
+	{
+		Name: "time",
+		Match: func(col *osqt.Column) bool {
+			if !isInteger(col) {
+				return false
+			}
+			switch col.Name {
+			case "time", "atime", "mtime", "ctime", "btime":
+				return true
+			}
+			return col.Type == "DATETIME" || strings.HasSuffix(col.Name, "_time")
+		},
+		// within 2020, so generated timestamps stay stable rather than following the current date
+		Value: func(r *rand.Rand, _ int) string { return fmt.Sprintf("%d", 1577836800+r.Intn(366*24*60*60)) },
+	},
+}
+
+// columnNamed returns a FakeStrategy match for columns of the base type with one of the names.
+// isMACColumn returns true if the column named name holds a hardware address, such as mac or mac_address.
+func isMACColumn(name string) bool {
+	switch name {
+	case "mac", "mac_address", "hardware_address":
+		return true
+	}
+	return strings.HasSuffix(name, "_mac") || strings.HasSuffix(name, "_mac_address")
+}
+
+// isIPColumn returns true if the column named name holds an IP address, such as address, local_address or
+// gateway. Other kinds of address, such as mac_address or email_address, are not IP addresses.
+func isIPColumn(name string) bool {
+	switch name {
+	case "address", "ip", "ip_address", "gateway", "broadcast":
+		return true
+	}
+	if isMACColumn(name) || strings.HasSuffix(name, "email_address") {
+		return false
+	}
+	return strings.HasSuffix(name, "_address") || strings.HasSuffix(name, "_ip")
+}
+
+func columnNamed(base string, names ...string) func(*osqt.Column) bool {
+	return func(col *osqt.Column) bool {
+		if baseType(col) != base && !(base == "INTEGER" && isInteger(col)) {
+			return false
+		}
+		for _, name := range names {
+			if strings.EqualFold(col.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isInteger returns true if col holds INTEGER or BIGINT values.
+func isInteger(col *osqt.Column) bool {
+	return baseType(col) == "INTEGER" || baseType(col) == "BIGINT"
+}
+
+// fakeHex returns n random bytes from r, hex encoded.
+func fakeHex(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	r.Read(b)
+	return fmt.Sprintf("%x", b)
+}
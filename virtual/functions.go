@@ -0,0 +1,119 @@
+package virtual
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// scalarFunctionDef describes a SQL function that osquery provides (either through SQLite or its own extensions)
+// and the engine does not, or implements differently. Arguments are evaluated before fn is called, with NULL
+// arguments passed as nil. A negative maxArgs allows any number of arguments.
+type scalarFunctionDef struct {
+	name    string
+	minArgs int
+	maxArgs int
+	typ     sql.Type
+	fn      func(args []interface{}) (interface{}, error)
+}
+
+// registerFunctions adds each of defs to registry, replacing any of the engine's own functions of the same name
+// so results match what osquery would return.
+func registerFunctions(registry sql.FunctionRegistry, defs ...[]*scalarFunctionDef) {
+	for _, group := range defs {
+		for _, def := range group {
+			def := def
+			registry[def.name] = sql.FunctionN{
+				Name: def.name,
+				Fn: func(args ...sql.Expression) (sql.Expression, error) {
+					if len(args) < def.minArgs || (def.maxArgs >= 0 && len(args) > def.maxArgs) {
+						return nil, xerrors.Errorf("wrong number of arguments to function %s()", def.name)
+					}
+					return &scalarFunction{def: def, args: args}, nil
+				},
+			}
+		}
+	}
+}
+
+// scalarFunction is a call to a scalarFunctionDef.
+type scalarFunction struct {
+	def  *scalarFunctionDef
+	args []sql.Expression
+}
+
+// Resolved implements sql.Expression.
+func (f *scalarFunction) Resolved() bool {
+	for _, arg := range f.args {
+		if !arg.Resolved() {
+			return false
+		}
+	}
+	return true
+}
+
+// String implements sql.Expression.
+func (f *scalarFunction) String() string {
+	args := make([]string, len(f.args))
+	for idx, arg := range f.args {
+		args[idx] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", f.def.name, strings.Join(args, ", "))
+}
+
+// Type implements sql.Expression.
+func (f *scalarFunction) Type() sql.Type {
+	return f.def.typ
+}
+
+// IsNullable implements sql.Expression.
+func (f *scalarFunction) IsNullable() bool {
+	return true
+}
+
+// Children implements sql.Expression.
+func (f *scalarFunction) Children() []sql.Expression {
+	return f.args
+}
+
+// WithChildren implements sql.Expression.
+func (f *scalarFunction) WithChildren(children ...sql.Expression) (sql.Expression, error) {
+	if len(children) != len(f.args) {
+		return nil, xerrors.Errorf("%s() expects %d children, got %d", f.def.name, len(f.args), len(children))
+	}
+	return &scalarFunction{def: f.def, args: children}, nil
+}
+
+// Eval implements sql.Expression.
+func (f *scalarFunction) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	vals := make([]interface{}, len(f.args))
+	for idx, arg := range f.args {
+		val, err := arg.Eval(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		vals[idx] = val
+	}
+
+	ret, err := f.def.fn(vals)
+	if err != nil {
+		return nil, xerrors.Errorf("%s(): %v", f.def.name, err)
+	}
+	return ret, nil
+}
+
+// stringArg returns arg as a string, and false if it is NULL.
+func stringArg(arg interface{}) (string, bool) {
+	switch v := arg.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	default:
+		return fmt.Sprintf("%v", v), true
+	}
+}
@@ -0,0 +1,185 @@
+package virtual
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative virtualpb/virtual.proto
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/gen0cide/osqt/virtual/virtualpb"
+)
+
+// grpcService implements the VirtualDatabase gRPC service on top of a Database.
+type grpcService struct {
+	virtualpb.UnimplementedVirtualDatabaseServer
+
+	db *Database
+}
+
+// RegisterGRPC registers the Database as the VirtualDatabase service on srv.
+func (d *Database) RegisterGRPC(srv *grpc.Server) {
+	virtualpb.RegisterVirtualDatabaseServer(srv, &grpcService{db: d})
+}
+
+// StartGRPC serves the VirtualDatabase gRPC service on addr. This function will not return unless the server fails
+// or the Database is stopped.
+func (d *Database) StartGRPC(proto, addr string) error {
+	if !d.initialized {
+		return xerrors.New("server cannot start until the database is initialized")
+	}
+
+	l, err := net.Listen(proto, addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer()
+	d.RegisterGRPC(srv)
+	err = d.addServer(func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			srv.Stop()
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		l.Close()
+		return err
+	}
+
+	return srv.Serve(l)
+}
+
+// Query implements virtualpb.VirtualDatabaseServer.
+func (s *grpcService) Query(ctx context.Context, req *virtualpb.QueryRequest) (*virtualpb.QueryResponse, error) {
+	if req.GetQuery() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no query provided")
+	}
+
+	client := &ClientInfo{Protocol: "grpc"}
+	if p, ok := peer.FromContext(ctx); ok {
+		client.Address = p.Addr.String()
+	}
+	schema, rows, err := s.db.Query(WithClientInfo(ctx, client), req.GetQuery())
+	if err != nil {
+		if xerrors.Is(err, ErrQueryNotPermitted) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp := &virtualpb.QueryResponse{
+		Columns: make([]*virtualpb.Column, 0, len(schema)),
+		Rows:    make([]*virtualpb.Row, 0, len(rows)),
+	}
+	for _, col := range schema {
+		resp.Columns = append(resp.Columns, &virtualpb.Column{Name: col.Name, Type: col.Type.String(), Nullable: col.Nullable})
+	}
+	for _, row := range rows {
+		values := make([]*virtualpb.Value, 0, len(row))
+		for _, val := range row {
+			values = append(values, grpcValue(val))
+		}
+		resp.Rows = append(resp.Rows, &virtualpb.Row{Values: values})
+	}
+	return resp, nil
+}
+
+// ListTables implements virtualpb.VirtualDatabaseServer.
+func (s *grpcService) ListTables(context.Context, *virtualpb.ListTablesRequest) (*virtualpb.ListTablesResponse, error) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	resp := &virtualpb.ListTablesResponse{Tables: make([]string, 0, len(s.db.schemas))}
+	for name := range s.db.schemas {
+		resp.Tables = append(resp.Tables, name)
+	}
+	sort.Strings(resp.Tables)
+	return resp, nil
+}
+
+// DescribeTable implements virtualpb.VirtualDatabaseServer.
+func (s *grpcService) DescribeTable(_ context.Context, req *virtualpb.DescribeTableRequest) (*virtualpb.DescribeTableResponse, error) {
+	s.db.RLock()
+	schema, ok := s.db.schemas[req.GetName()]
+	s.db.RUnlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "table %s does not exist", req.GetName())
+	}
+
+	resp := &virtualpb.DescribeTableResponse{
+		Name:    req.GetName(),
+		Columns: make([]*virtualpb.Column, 0, len(schema)),
+	}
+	for _, ns := range s.db.parser.Namespaces {
+		if tbl, ok := ns.Tables[req.GetName()]; ok {
+			resp.Description = tbl.Description
+			break
+		}
+	}
+	for _, col := range schema {
+		resp.Columns = append(resp.Columns, &virtualpb.Column{Name: col.Name, Type: col.Type.String(), Nullable: col.Nullable})
+	}
+	return resp, nil
+}
+
+func grpcValue(val interface{}) *virtualpb.Value {
+	switch v := val.(type) {
+	case nil:
+		return &virtualpb.Value{}
+	case string:
+		return &virtualpb.Value{Kind: &virtualpb.Value_StringValue{StringValue: v}}
+	case []byte:
+		return &virtualpb.Value{Kind: &virtualpb.Value_BytesValue{BytesValue: v}}
+	case bool:
+		return &virtualpb.Value{Kind: &virtualpb.Value_BoolValue{BoolValue: v}}
+	case int:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case int8:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case int16:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case int32:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case int64:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: v}}
+	case uint8:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case uint16:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case uint32:
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case uint64:
+		// int_value cannot hold values above math.MaxInt64, which are sent as their decimal string instead
+		if v > math.MaxInt64 {
+			return &virtualpb.Value{Kind: &virtualpb.Value_StringValue{StringValue: strconv.FormatUint(v, 10)}}
+		}
+		return &virtualpb.Value{Kind: &virtualpb.Value_IntValue{IntValue: int64(v)}}
+	case float32:
+		return &virtualpb.Value{Kind: &virtualpb.Value_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &virtualpb.Value{Kind: &virtualpb.Value_DoubleValue{DoubleValue: v}}
+	case time.Time:
+		return &virtualpb.Value{Kind: &virtualpb.Value_StringValue{StringValue: v.Format(time.RFC3339Nano)}}
+	default:
+		return &virtualpb.Value{Kind: &virtualpb.Value_StringValue{StringValue: fmt.Sprintf("%v", v)}}
+	}
+}
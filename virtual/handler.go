@@ -0,0 +1,157 @@
+package virtual
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/server"
+	"gopkg.in/src-d/go-vitess.v1/mysql"
+	"gopkg.in/src-d/go-vitess.v1/sqltypes"
+
+	"github.com/gen0cide/osqt"
+	"github.com/gen0cide/osqt/query"
+)
+
+// handler wraps the go-mysql-server connection handler so the Database can inspect queries before the engine runs them.
+type handler struct {
+	db    *Database
+	inner *server.Handler
+}
+
+func newHandler(db *Database, inner *server.Handler) *handler {
+	return &handler{
+		db:    db,
+		inner: inner,
+	}
+}
+
+// NewConnection implements mysql.Handler.
+func (h *handler) NewConnection(c *mysql.Conn) {
+	if err := h.db.admit(c, c.Close); err != nil {
+		h.db.logger.Warnw("Rejecting connection", "conn", c.ConnectionID, "error", err)
+		c.Close()
+		return
+	}
+	h.inner.NewConnection(c)
+}
+
+// ConnectionClosed implements mysql.Handler.
+func (h *handler) ConnectionClosed(c *mysql.Conn) {
+	h.db.conns.remove(c)
+	h.inner.ConnectionClosed(c)
+}
+
+// ComQuery implements mysql.Handler. Inputs holding several statements are split and each statement is checked
+// against the policy, audited and run on its own. The MySQL protocol version served cannot return more than one
+// result set per query, so only the result of the last statement reaches the client; the statements before it
+// must succeed for it to run.
+func (h *handler) ComQuery(c *mysql.Conn, query string, callback func(*sqltypes.Result) error) (err error) {
+	ctx, span := osqt.Tracer().Start(context.Background(), "virtual.Query", trace.WithAttributes(
+		attribute.String("db.system", "osquery"),
+		attribute.String("db.statement", query),
+		attribute.Int64("osqt.connection_id", int64(c.ConnectionID)),
+	))
+	defer func() { osqt.EndSpan(span, err) }()
+
+	h.db.conns.setBusy(c, true)
+	defer h.db.conns.setBusy(c, false)
+
+	client := &ClientInfo{Protocol: "mysql", User: c.User, ConnectionID: c.ConnectionID}
+	if addr := c.RemoteAddr(); addr != nil {
+		client.Address = addr.String()
+	}
+
+	statements := splitQuery(query)
+	for idx, stmt := range statements {
+		send := callback
+		if idx < len(statements)-1 {
+			send = func(*sqltypes.Result) error { return nil }
+		}
+		if err := h.runStatement(ctx, c, client, stmt, send); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStatement checks a single statement against the policy and rate limit, runs it and audits it.
+func (h *handler) runStatement(ctx context.Context, c *mysql.Conn, client *ClientInfo, query string, callback func(*sqltypes.Result) error) (err error) {
+	start, rows := time.Now(), 0
+
+	if perr := h.db.checkPolicy(query); perr != nil {
+		h.db.logger.Infow("Query rejected by policy", "conn", c.ConnectionID, "fingerprint", Fingerprint(query))
+		h.db.audit(client, query, start, 0, perr)
+		return mysql.NewSQLError(mysql.ERUnknownError, mysql.SSUnknownSQLState, "Error: %v", perr)
+	}
+	if !h.db.conns.allow(c) {
+		h.db.audit(client, query, start, 0, ErrRateLimited)
+		return mysql.NewSQLError(mysql.ERUnknownError, mysql.SSUnknownSQLState, "Error: %v", ErrRateLimited)
+	}
+
+	if h.db.recorder != nil && !isSessionStatement(query) {
+		rec, rerr := h.db.recorder.Result(ctx, query)
+		if rerr != nil {
+			h.db.audit(client, query, start, 0, rerr)
+			return mysql.NewSQLError(mysql.ERUnknownError, mysql.SSUnknownSQLState, "Error: %v", rerr)
+		}
+		res := rec.result()
+		err = callback(res)
+		h.db.audit(client, query, start, len(res.Rows), err)
+		return err
+	}
+
+	// once the watchdog stops the statement, results the engine still produces must not reach the client. The
+	// engine's process for the connection is killed so its rows stop, and watch waits for it to finish.
+	var mu sync.Mutex
+	stopped := false
+	h.db.reloading.RLock()
+	err = h.db.watch(ctx, func(ctx context.Context) error {
+		defer h.db.reloading.RUnlock()
+
+		expanded, release, err := h.db.expandTableFunctions(ctx, query, true)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return h.inner.ComQuery(c, expanded, func(res *sqltypes.Result) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if stopped {
+				return ErrWatchdogLimit
+			}
+			rows += len(res.Rows)
+			return callback(res)
+		})
+	}, func() {
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+		h.db.eng.Catalog.Kill(c.ConnectionID)
+	})
+
+	h.db.audit(client, query, start, rows, err)
+	if xerrors.Is(err, ErrWatchdogLimit) {
+		return mysql.NewSQLError(mysql.ERUnknownError, mysql.SSUnknownSQLState, "%v", err)
+	}
+	return err
+}
+
+// splitQuery returns the statements of a query, split on the semicolons separating them. A query that cannot be
+// split, such as one with an unterminated string, is returned whole so the engine reports the problem.
+func splitQuery(sql string) []string {
+	segments, err := query.SplitStatements(sql)
+	if err != nil || len(segments) == 0 {
+		return []string{sql}
+	}
+	statements := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		statements = append(statements, seg.SQL)
+	}
+	return statements
+}
@@ -0,0 +1,175 @@
+package virtual
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// maxQueryBodySize bounds the size of a request body accepted by the HTTP query endpoint.
+const maxQueryBodySize = 1 << 20
+
+// HTTPColumn describes a column in the responses of the HTTP API.
+type HTTPColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// HTTPQueryRequest is the JSON body accepted by POST /query. A body that is not JSON is treated as the query itself.
+type HTTPQueryRequest struct {
+	Query string `json:"query"`
+}
+
+// HTTPQueryResponse is the JSON body returned by POST /query.
+type HTTPQueryResponse struct {
+	Columns  []*HTTPColumn            `json:"columns"`
+	Rows     []map[string]interface{} `json:"rows"`
+	RowCount int                      `json:"row_count"`
+	Duration string                   `json:"duration"`
+}
+
+// HTTPTable is an entry in the JSON body returned by GET /schema.
+type HTTPTable struct {
+	Name    string        `json:"name"`
+	Columns []*HTTPColumn `json:"columns"`
+}
+
+type httpError struct {
+	Error string `json:"error"`
+}
+
+// HTTPHandler returns an http.Handler exposing the Database as a JSON API:
+//
+//	POST /query   runs the SQL in the request body and returns the resulting rows
+//	GET  /schema  lists every table in the database along with its columns
+func (d *Database) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", d.serveQuery)
+	mux.HandleFunc("/schema", d.serveSchema)
+	return mux
+}
+
+// StartHTTP serves the HTTPHandler on addr. This function will not return unless the server fails or the Database
+// is stopped.
+func (d *Database) StartHTTP(addr string) error {
+	if !d.initialized {
+		return xerrors.New("server cannot start until the database is initialized")
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           d.HTTPHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       d.currentLimits().IdleTimeout,
+	}
+	if err := d.addServer(srv.Shutdown); err != nil {
+		return err
+	}
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (d *Database) serveQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, &httpError{Error: "queries must be submitted with POST"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxQueryBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, &httpError{Error: err.Error()})
+		return
+	}
+
+	query := string(body)
+	if strings.HasPrefix(strings.TrimSpace(r.Header.Get("Content-Type")), "application/json") {
+		req := &HTTPQueryRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			writeJSON(w, http.StatusBadRequest, &httpError{Error: "invalid JSON request: " + err.Error()})
+			return
+		}
+		query = req.Query
+	}
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if query == "" {
+		writeJSON(w, http.StatusBadRequest, &httpError{Error: "no query provided"})
+		return
+	}
+
+	start := time.Now()
+	ctx := WithClientInfo(r.Context(), &ClientInfo{Protocol: "http", Address: r.RemoteAddr})
+	schema, rows, err := d.Query(ctx, query)
+	if err != nil {
+		status := http.StatusBadRequest
+		if xerrors.Is(err, ErrQueryNotPermitted) {
+			status = http.StatusForbidden
+		}
+		writeJSON(w, status, &httpError{Error: err.Error()})
+		return
+	}
+
+	resp := &HTTPQueryResponse{
+		Columns:  make([]*HTTPColumn, 0, len(schema)),
+		Rows:     make([]map[string]interface{}, 0, len(rows)),
+		RowCount: len(rows),
+		Duration: time.Since(start).String(),
+	}
+	for _, col := range schema {
+		resp.Columns = append(resp.Columns, &HTTPColumn{Name: col.Name, Type: col.Type.String(), Nullable: col.Nullable})
+	}
+	for _, row := range rows {
+		obj := make(map[string]interface{}, len(schema))
+		for idx, col := range schema {
+			if idx >= len(row) {
+				break
+			}
+			val := row[idx]
+			if b, ok := val.([]byte); ok {
+				val = string(b)
+			}
+			obj[col.Name] = val
+		}
+		resp.Rows = append(resp.Rows, obj)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (d *Database) serveSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, &httpError{Error: "the schema must be requested with GET"})
+		return
+	}
+
+	d.RLock()
+	tables := make([]*HTTPTable, 0, len(d.schemas))
+	for name, schema := range d.schemas {
+		t := &HTTPTable{Name: name, Columns: make([]*HTTPColumn, 0, len(schema))}
+		for _, col := range schema {
+			t.Columns = append(t.Columns, &HTTPColumn{Name: col.Name, Type: col.Type.String(), Nullable: col.Nullable})
+		}
+		tables = append(tables, t)
+	}
+	d.RUnlock()
+
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	writeJSON(w, http.StatusOK, tables)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,465 @@
+package virtual
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// plainJSONKey matches the object keys JSON paths can name without quoting them.
+var plainJSONKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonFunctions implement the scalar functions of SQLite's JSON1 extension that osquery queries commonly use to
+// pick apart columns holding JSON documents.
+var jsonFunctions = []*scalarFunctionDef{
+	{"json", 1, 1, sql.Text, jsonMinify},
+	{"json_array", 0, -1, sql.Text, jsonArray},
+	{"json_array_length", 1, 2, sql.Int64, jsonArrayLength},
+	{"json_extract", 2, -1, sql.Text, jsonExtract},
+	{"json_object", 0, -1, sql.Text, jsonObject},
+	{"json_quote", 1, 1, sql.Text, jsonQuote},
+	{"json_type", 1, 2, sql.Text, jsonType},
+	{"json_valid", 1, 1, sql.Int64, jsonValid},
+}
+
+// parseJSONArg decodes a JSON document argument. Numbers are kept as json.Number so integers survive intact, and
+// objects as orderedObjects so their members keep the order of the document.
+func parseJSONArg(arg interface{}) (interface{}, error) {
+	data, _ := stringArg(arg)
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	doc, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, xerrors.New("malformed JSON")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, xerrors.New("malformed JSON")
+	}
+	return doc, nil
+}
+
+// decodeJSONValue decodes the next value of dec, which must use numbers.
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := orderedObject{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := tok.(string)
+			if !ok {
+				return nil, xerrors.New("malformed JSON")
+			}
+			val, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonMember{key: key, value: val})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			val, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return nil, xerrors.New("malformed JSON")
+}
+
+// orderedObject is a JSON object whose members keep the order they were decoded or built in, as SQLite keeps
+// them. A key may appear more than once, in which case lookups find its first member.
+type orderedObject []jsonMember
+
+// jsonMember is a member of an orderedObject.
+type jsonMember struct {
+	key   string
+	value interface{}
+}
+
+// get returns the value of the first member named key.
+func (o orderedObject) get(key string) (interface{}, bool) {
+	for _, m := range o {
+		if m.key == key {
+			return m.value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON implements the json.Marshaler interface, writing the members in order.
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for idx, m := range o {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshalJSON(m.key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := marshalJSON(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(key)
+		buf.WriteByte(':')
+		buf.WriteString(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalJSON encodes v as minified JSON text. Unlike json.Marshal, it leaves <, > and & unescaped, as SQLite
+// does.
+func marshalJSON(v interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// jsonPathStep is a single object key or array index in a JSON path. An index counted from the end of the array
+// (SQLite's [#-N] syntax) is stored as a negative fromEnd.
+type jsonPathStep struct {
+	key     string
+	isIndex bool
+	index   int
+	fromEnd int
+}
+
+// parseJSONPath parses a SQLite JSON path such as $.a.b[2] or $."dotted.key"[#-1].
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, xerrors.Errorf("JSON path error near '%s'", path)
+	}
+
+	steps := []jsonPathStep{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.Index(rest[1:], `"`)
+				if end < 0 {
+					return nil, xerrors.Errorf("JSON path error near '%s'", rest)
+				}
+				steps = append(steps, jsonPathStep{key: rest[1 : end+1]})
+				rest = rest[end+2:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, xerrors.Errorf("JSON path error near '%s'", rest)
+			}
+			steps = append(steps, jsonPathStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, xerrors.Errorf("JSON path error near '%s'", rest)
+			}
+			step := jsonPathStep{isIndex: true}
+			idx := rest[1:end]
+			if strings.HasPrefix(idx, "#") {
+				step.fromEnd = -1
+				if idx != "#" {
+					n, err := strconv.Atoi(strings.TrimPrefix(idx[1:], "-"))
+					if err != nil || !strings.HasPrefix(idx[1:], "-") {
+						return nil, xerrors.Errorf("JSON path error near '%s'", rest)
+					}
+					step.index = n
+				}
+			} else {
+				n, err := strconv.Atoi(idx)
+				if err != nil || n < 0 {
+					return nil, xerrors.Errorf("JSON path error near '%s'", rest)
+				}
+				step.index = n
+			}
+			steps = append(steps, step)
+			rest = rest[end+1:]
+		default:
+			return nil, xerrors.Errorf("JSON path error near '%s'", rest)
+		}
+	}
+	return steps, nil
+}
+
+// lookupJSONPath returns the element of doc at path, and false if there is none.
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool, error) {
+	elem, _, found, err := resolveJSONPath(doc, path)
+	return elem, found, err
+}
+
+// resolveJSONPath returns the element of doc at path along with the steps leading to it, indexes counted from
+// the end of arrays resolved to absolute ones, and false if there is none.
+func resolveJSONPath(doc interface{}, path string) (interface{}, []jsonPathStep, bool, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	cur := doc
+	for idx, step := range steps {
+		if step.isIndex {
+			arr, ok := cur.([]interface{})
+			if !ok {
+				return nil, nil, false, nil
+			}
+			i := step.index
+			if step.fromEnd < 0 {
+				i = len(arr) - step.index
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, nil, false, nil
+			}
+			steps[idx] = jsonPathStep{isIndex: true, index: i}
+			cur = arr[i]
+			continue
+		}
+
+		obj, ok := cur.(orderedObject)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		if cur, ok = obj.get(step.key); !ok {
+			return nil, nil, false, nil
+		}
+	}
+	return cur, steps, true, nil
+}
+
+// formatJSONPath renders steps as a SQLite JSON path, quoting keys that are not plain identifiers.
+func formatJSONPath(steps []jsonPathStep) string {
+	b := &strings.Builder{}
+	b.WriteByte('$')
+	for _, step := range steps {
+		if step.isIndex {
+			b.WriteString("[" + strconv.Itoa(step.index) + "]")
+			continue
+		}
+		b.WriteByte('.')
+		if plainJSONKey.MatchString(step.key) {
+			b.WriteString(step.key)
+		} else {
+			b.WriteString(`"` + step.key + `"`)
+		}
+	}
+	return b.String()
+}
+
+// sqlValue converts a decoded JSON element to the SQL value SQLite's json_extract would return: objects and
+// arrays as minified JSON text, booleans as 1 or 0 and numbers as integers where they are integral.
+func sqlValue(elem interface{}) (interface{}, error) {
+	switch v := elem.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	default:
+		return marshalJSON(v)
+	}
+}
+
+// jsonElement converts a SQL argument to the element it becomes inside a JSON document built by json_array or
+// json_object. Strings are stored as JSON strings, never parsed.
+func jsonElement(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case []byte:
+		return string(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil
+		}
+	}
+	return arg
+}
+
+func jsonMinify(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	doc, err := parseJSONArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(doc)
+}
+
+func jsonArray(args []interface{}) (interface{}, error) {
+	elems := make([]interface{}, len(args))
+	for idx, arg := range args {
+		elems[idx] = jsonElement(arg)
+	}
+	return marshalJSON(elems)
+}
+
+func jsonObject(args []interface{}) (interface{}, error) {
+	if len(args)%2 != 0 {
+		return nil, xerrors.New("json_object() requires an even number of arguments")
+	}
+
+	obj := orderedObject{}
+	for idx := 0; idx < len(args); idx += 2 {
+		key, ok := args[idx].(string)
+		if !ok {
+			return nil, xerrors.New("json_object() labels must be TEXT")
+		}
+		obj = append(obj, jsonMember{key: key, value: jsonElement(args[idx+1])})
+	}
+	return marshalJSON(obj)
+}
+
+func jsonQuote(args []interface{}) (interface{}, error) {
+	return marshalJSON(jsonElement(args[0]))
+}
+
+func jsonExtract(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	doc, err := parseJSONArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// with a single path the element itself is returned, with several they are returned as a JSON array
+	elems := make([]interface{}, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		path, ok := arg.(string)
+		if !ok {
+			return nil, nil
+		}
+		elem, found, err := lookupJSONPath(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 2 {
+			if !found {
+				return nil, nil
+			}
+			return sqlValue(elem)
+		}
+		elems = append(elems, elem)
+	}
+	return marshalJSON(elems)
+}
+
+// jsonTarget returns the document in args[0], or its element at the path in args[1] if one was given.
+func jsonTarget(args []interface{}) (interface{}, bool, error) {
+	if args[0] == nil {
+		return nil, false, nil
+	}
+	doc, err := parseJSONArg(args[0])
+	if err != nil {
+		return nil, false, err
+	}
+	if len(args) == 1 {
+		return doc, true, nil
+	}
+	path, ok := args[1].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	return lookupJSONPath(doc, path)
+}
+
+func jsonArrayLength(args []interface{}) (interface{}, error) {
+	elem, found, err := jsonTarget(args)
+	if err != nil || !found {
+		return nil, err
+	}
+	if arr, ok := elem.([]interface{}); ok {
+		return int64(len(arr)), nil
+	}
+	return int64(0), nil
+}
+
+func jsonType(args []interface{}) (interface{}, error) {
+	elem, found, err := jsonTarget(args)
+	if err != nil || !found {
+		return nil, err
+	}
+	return jsonTypeOf(elem), nil
+}
+
+// jsonTypeOf returns the JSON1 type name of a decoded JSON element.
+func jsonTypeOf(elem interface{}) string {
+	switch v := elem.(type) {
+	case nil:
+		return "null"
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case string:
+		return "text"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "real"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func jsonValid(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	if _, err := parseJSONArg(args[0]); err != nil {
+		return int64(0), nil
+	}
+	return int64(1), nil
+}
@@ -0,0 +1,74 @@
+package virtual
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+// ErrTooManyConnections is returned to clients connecting while the Database is at its connection limit.
+var ErrTooManyConnections = xerrors.New("too many connections")
+
+// ErrRateLimited is returned for statements a client sends faster than its query rate limit allows.
+var ErrRateLimited = xerrors.New("query rate limit exceeded for this connection")
+
+// Limits bound the resources the clients of the Database's MySQL and PostgreSQL servers can consume, so that a
+// shared server cannot be starved by a single runaway client. A zero value disables the corresponding limit.
+type Limits struct {
+	// MaxConnections is the number of client connections that may be open at once, across every server.
+	MaxConnections int
+
+	// QueriesPerSecond is the sustained rate at which each connection may execute statements, and QueryBurst
+	// the number it may execute back to back before being limited (defaulting to QueriesPerSecond).
+	QueriesPerSecond float64
+	QueryBurst       int
+
+	// IdleTimeout closes connections that have not sent a statement for this long.
+	IdleTimeout time.Duration
+
+	// WatchdogLatency and WatchdogCPU emulate osqueryd's watchdog, stopping statements that run for longer than
+	// WatchdogLatency or use more than WatchdogCPU of CPU time with the error osqueryd reports (ErrWatchdogLimit).
+	// CPU time is that of the thread running the statement, so statements running at the same time are not
+	// counted, and is only measured on Linux.
+	WatchdogLatency time.Duration
+	WatchdogCPU     time.Duration
+}
+
+// SetLimits applies limits to the connections accepted from then on. It should be called before a server is started.
+func (d *Database) SetLimits(limits Limits) error {
+	if limits.MaxConnections < 0 || limits.QueriesPerSecond < 0 || limits.QueryBurst < 0 || limits.IdleTimeout < 0 ||
+		limits.WatchdogLatency < 0 || limits.WatchdogCPU < 0 {
+		return xerrors.New("limits cannot be negative")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.limits = limits
+	return nil
+}
+
+func (d *Database) currentLimits() Limits {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.limits
+}
+
+// admit tracks a new client connection, returning ErrTooManyConnections if the connection limit has been reached.
+func (d *Database) admit(key interface{}, close func()) error {
+	limits := d.currentLimits()
+
+	var limiter *rate.Limiter
+	if limits.QueriesPerSecond > 0 {
+		burst := limits.QueryBurst
+		if burst == 0 {
+			burst = int(math.Max(1, math.Ceil(limits.QueriesPerSecond)))
+		}
+		limiter = rate.NewLimiter(rate.Limit(limits.QueriesPerSecond), burst)
+	}
+
+	return d.conns.add(key, close, limiter, limits.MaxConnections)
+}
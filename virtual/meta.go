@@ -0,0 +1,310 @@
+package virtual
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"github.com/gen0cide/osqt"
+)
+
+// metaOsqueryVersion is the osquery version reported by the synthesized osquery_info table.
+const metaOsqueryVersion = "5.12.1"
+
+// metaTables are the tables osquery uses to describe itself. Many real world queries join against them, e.g. to
+// report the agent version alongside their results, so the virtual database synthesizes plausible rows for them
+// instead of leaving them empty. Tables missing from the parsed schema are added with these columns.
+var metaTables = map[string][]*osqt.Column{
+	"osquery_info": {
+		{Name: "pid", Type: "INTEGER", Description: "Process (or thread/handle) ID"},
+		{Name: "uuid", Type: "TEXT", Description: "Unique ID provided by the system"},
+		{Name: "instance_id", Type: "TEXT", Description: "Unique, long-lived ID per instance of osquery"},
+		{Name: "version", Type: "TEXT", Description: "osquery toolkit version"},
+		{Name: "config_hash", Type: "TEXT", Description: "Hash of the working configuration state"},
+		{Name: "config_valid", Type: "INTEGER", Description: "1 if the config was loaded and considered valid, else 0"},
+		{Name: "extensions", Type: "TEXT", Description: "osquery extensions status"},
+		{Name: "build_platform", Type: "TEXT", Description: "osquery toolkit build platform"},
+		{Name: "build_distro", Type: "TEXT", Description: "osquery toolkit platform distribution name (os version)"},
+		{Name: "start_time", Type: "INTEGER", Description: "UNIX time in seconds when the process started"},
+		{Name: "watcher", Type: "INTEGER", Description: "Process (or thread/handle) ID of optional watcher process"},
+		{Name: "platform_mask", Type: "INTEGER", Description: "The osquery platform bitmask"},
+	},
+	"osquery_flags": {
+		{Name: "name", Type: "TEXT", Description: "Flag name"},
+		{Name: "type", Type: "TEXT", Description: "Flag type"},
+		{Name: "description", Type: "TEXT", Description: "Flag description"},
+		{Name: "default_value", Type: "TEXT", Description: "Flag default value"},
+		{Name: "value", Type: "TEXT", Description: "Flag value"},
+		{Name: "shell_only", Type: "INTEGER", Description: "Is the flag shell only?"},
+	},
+	"osquery_schedule": {
+		{Name: "name", Type: "TEXT", Description: "The given name for this query"},
+		{Name: "query", Type: "TEXT", Description: "The exact query to run"},
+		{Name: "interval", Type: "INTEGER", Description: "The interval in seconds to run this query, not an exact interval"},
+		{Name: "executions", Type: "BIGINT", Description: "Number of times the query was executed"},
+		{Name: "last_executed", Type: "BIGINT", Description: "UNIX time stamp in seconds of the last completed execution"},
+		{Name: "denylisted", Type: "INTEGER", Description: "1 if the query is denylisted else 0"},
+		{Name: "output_size", Type: "BIGINT", Description: "Cumulative total number of bytes generated by the resultant rows of the query"},
+		{Name: "wall_time", Type: "BIGINT", Description: "Total wall time in seconds spent executing (deprecated)"},
+		{Name: "wall_time_ms", Type: "BIGINT", Description: "Total wall time in milliseconds spent executing"},
+		{Name: "last_wall_time_ms", Type: "BIGINT", Description: "Wall time in milliseconds of the latest execution"},
+		{Name: "user_time", Type: "BIGINT", Description: "Total user time in milliseconds spent executing"},
+		{Name: "last_user_time", Type: "BIGINT", Description: "User time in milliseconds of the latest execution"},
+		{Name: "system_time", Type: "BIGINT", Description: "Total system time in milliseconds spent executing"},
+		{Name: "last_system_time", Type: "BIGINT", Description: "System time in milliseconds of the latest execution"},
+		{Name: "average_memory", Type: "BIGINT", Description: "Average of the bytes of resident memory left allocated after collecting results"},
+		{Name: "last_memory", Type: "BIGINT", Description: "Resident memory in bytes left allocated after collecting results of the latest execution"},
+	},
+	"osquery_registry": {
+		{Name: "registry", Type: "TEXT", Description: "Name of the osquery registry"},
+		{Name: "name", Type: "TEXT", Description: "Name of the plugin item"},
+		{Name: "owner_uuid", Type: "INTEGER", Description: "Extension route UUID (0 for core)"},
+		{Name: "internal", Type: "INTEGER", Description: "1 If the plugin is internal else 0"},
+		{Name: "active", Type: "INTEGER", Description: "1 If this plugin is active else 0"},
+	},
+}
+
+// metaTable returns the definition of one of the metaTables.
+func metaTable(name string) *osqt.Table {
+	tbl := osqt.NewEmptyTable()
+	tbl.Name = name
+	tbl.Schema = osqt.NewEmptySchema(tbl)
+	for idx, col := range metaTables[name] {
+		c := *col
+		c.Index = idx
+		tbl.Schema.Columns = append(tbl.Schema.Columns, &c)
+	}
+	return tbl
+}
+
+// addMetaTables adds the metaTables missing from schemas.
+func addMetaTables(schemas map[string]sql.Schema) error {
+	for name := range metaTables {
+		if _, ok := schemas[name]; ok {
+			continue
+		}
+		schema, err := metaTable(name).ToSQLSchema(nil)
+		if err != nil {
+			return err
+		}
+		schemas[name] = schema
+	}
+	return nil
+}
+
+// metaSchedule is the schedule reported by osquery_schedule.
+var metaSchedule = []struct {
+	name     string
+	query    string
+	interval int64
+}{
+	{"osquery_info", "SELECT version, config_hash, start_time FROM osquery_info;", 3600},
+	{"system_info", "SELECT hostname, cpu_brand, physical_memory, hardware_vendor, hardware_model FROM system_info;", 86400},
+	{"listening_ports", "SELECT pid, port, protocol, address FROM listening_ports WHERE address NOT IN ('127.0.0.1', '::1');", 600},
+	{"processes_binary_deleted", "SELECT pid, name, path, cmdline FROM processes WHERE on_disk = 0;", 300},
+}
+
+// metaFlag is a row of osquery_flags.
+type metaFlag struct {
+	name, typ, description, def, value string
+}
+
+// metaSource synthesizes the rows of the metaTables for one database. Rows are generated when the tables are
+// scanned, so times and counters advance the way they would on a running agent. Fixtures loaded for a meta table
+// replace its synthesized rows.
+type metaSource struct {
+	sync.RWMutex
+
+	platform   string
+	tables     []string
+	hostUUID   string
+	instanceID string
+	started    time.Time
+	fixtures   map[string][]map[string]string
+}
+
+func newMetaSource(platform string, tables []string) *metaSource {
+	hostname, _ := os.Hostname()
+	sum := sha1.Sum([]byte(hostname))
+	instance := make([]byte, 16)
+	rand.Read(instance)
+	// version 4, RFC 4122 variant
+	instance[6], instance[8] = instance[6]&0x0f|0x40, instance[8]&0x3f|0x80
+
+	names := append([]string{}, tables...)
+	sort.Strings(names)
+	return &metaSource{
+		platform:   platform,
+		tables:     names,
+		hostUUID:   fmt.Sprintf("%X-%X-%X-%X-%X", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]),
+		instanceID: fmt.Sprintf("%x-%x-%x-%x-%x", instance[0:4], instance[4:6], instance[6:8], instance[8:10], instance[10:16]),
+		started:    time.Now(),
+		fixtures:   map[string][]map[string]string{},
+	}
+}
+
+func (m *metaSource) setFixture(table string, rows []map[string]string) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.fixtures[table] = rows
+}
+
+func (m *metaSource) rows(ctx *sql.Context, table string, schema sql.Schema) ([]sql.Row, error) {
+	m.RLock()
+	rows, ok := m.fixtures[table]
+	m.RUnlock()
+
+	if !ok {
+		switch table {
+		case "osquery_info":
+			rows = m.info()
+		case "osquery_flags":
+			rows = m.flags()
+		case "osquery_schedule":
+			rows = m.schedule(time.Now())
+		case "osquery_registry":
+			rows = m.registry()
+		}
+	}
+	return stringRows(table, schema, rows)
+}
+
+func (m *metaSource) info() []map[string]string {
+	distro, mask := "centos7", 9
+	switch m.platform {
+	case "darwin":
+		distro, mask = "10.14", 21
+	case "windows":
+		distro, mask = "10", 2
+	case "freebsd":
+		distro, mask = "12", 37
+	}
+	platform := m.platform
+	if platform == "" {
+		platform = "linux"
+	}
+
+	return []map[string]string{{
+		"pid":            strconv.Itoa(os.Getpid()),
+		"uuid":           m.hostUUID,
+		"instance_id":    m.instanceID,
+		"version":        metaOsqueryVersion,
+		"config_hash":    fmt.Sprintf("%x", sha1.Sum([]byte(m.instanceID))),
+		"config_valid":   "1",
+		"extensions":     "active",
+		"build_platform": platform,
+		"build_distro":   distro,
+		"start_time":     strconv.FormatInt(m.started.Unix(), 10),
+		"watcher":        strconv.Itoa(os.Getppid()),
+		"platform_mask":  strconv.Itoa(mask),
+	}}
+}
+
+func (m *metaSource) flags() []map[string]string {
+	confDir, dbDir, logDir := "/etc/osquery", "/var/osquery", "/var/log/osquery"
+	switch m.platform {
+	case "darwin":
+		confDir = "/var/osquery"
+	case "windows":
+		confDir, dbDir, logDir = `C:\Program Files\osquery`, `C:\Program Files\osquery`, `C:\Program Files\osquery\log`
+	}
+	sep := "/"
+	if m.platform == "windows" {
+		sep = `\`
+	}
+
+	flags := []metaFlag{
+		{"config_path", "string", "Path to JSON config file", confDir + sep + "osquery.conf", confDir + sep + "osquery.conf"},
+		{"config_plugin", "string", "Config plugin name", "filesystem", "filesystem"},
+		{"database_path", "string", "If using a disk-based backing store, specify a path", dbDir + sep + "osquery.db", dbDir + sep + "osquery.db"},
+		{"disable_events", "bool", "Disable osquery publish/subscribe system", "false", "false"},
+		{"disable_watchdog", "bool", "Disable userland watchdog process", "false", "false"},
+		{"distributed_interval", "uint64", "Seconds between polling for new queries (default 60)", "60", "60"},
+		{"host_identifier", "string", "Field used to identify the host running osquery (hostname, uuid, instance, ephemeral, specified)", "hostname", "uuid"},
+		{"logger_path", "string", "Directory path for ERROR/WARN/INFO and results logging", logDir, logDir},
+		{"logger_plugin", "string", "Logger plugin name", "filesystem", "filesystem"},
+		{"pidfile", "string", "Path to the daemon pidfile mutex", dbDir + sep + "osqueryd.pidfile", dbDir + sep + "osqueryd.pidfile"},
+		{"schedule_splay_percent", "uint64", "Percent to splay config times", "10", "10"},
+		{"utc", "bool", "Convert all UNIX times to UTC", "true", "true"},
+		{"verbose", "bool", "Enable verbose informational messages", "false", "false"},
+		{"watchdog_level", "int32", "Performance limit level (0=normal, 1=restrictive, -1=off)", "0", "0"},
+	}
+
+	rows := make([]map[string]string, 0, len(flags))
+	for _, flag := range flags {
+		rows = append(rows, map[string]string{
+			"name":          flag.name,
+			"type":          flag.typ,
+			"description":   flag.description,
+			"default_value": flag.def,
+			"value":         flag.value,
+			"shell_only":    "0",
+		})
+	}
+	return rows
+}
+
+// schedule reports each scheduled query as having run once when the agent started and every interval since.
+func (m *metaSource) schedule(now time.Time) []map[string]string {
+	uptime := int64(now.Sub(m.started).Seconds())
+
+	rows := make([]map[string]string, 0, len(metaSchedule))
+	for idx, sched := range metaSchedule {
+		executions := uptime/sched.interval + 1
+		wall := int64(12 + 7*idx)
+		user, system := wall*2/3, wall/4
+		memory := int64(2097152 + 524288*idx)
+		row := map[string]string{
+			"name":              sched.name,
+			"query":             sched.query,
+			"interval":          strconv.FormatInt(sched.interval, 10),
+			"executions":        strconv.FormatInt(executions, 10),
+			"last_executed":     strconv.FormatInt(m.started.Unix()+(executions-1)*sched.interval, 10),
+			"denylisted":        "0",
+			"blacklisted":       "0",
+			"output_size":       strconv.FormatInt(executions*int64(180+64*idx), 10),
+			"wall_time":         strconv.FormatInt(executions*wall/1000, 10),
+			"wall_time_ms":      strconv.FormatInt(executions*wall, 10),
+			"last_wall_time_ms": strconv.FormatInt(wall, 10),
+			"user_time":         strconv.FormatInt(executions*user, 10),
+			"last_user_time":    strconv.FormatInt(user, 10),
+			"system_time":       strconv.FormatInt(executions*system, 10),
+			"last_system_time":  strconv.FormatInt(system, 10),
+			"average_memory":    strconv.FormatInt(memory, 10),
+			"last_memory":       strconv.FormatInt(memory, 10),
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// registry lists the core plugins of a default osquery configuration, and a table plugin for every table in the
+// database.
+func (m *metaSource) registry() []map[string]string {
+	plugin := func(registry, name string) map[string]string {
+		return map[string]string{"registry": registry, "name": name, "owner_uuid": "0", "internal": "0", "active": "1"}
+	}
+
+	rows := []map[string]string{
+		plugin("config", "filesystem"),
+		plugin("database", "rocksdb"),
+		plugin("distributed", "tls"),
+		plugin("enroll", "tls"),
+		plugin("killswitch", "killswitch_filesystem"),
+		plugin("logger", "filesystem"),
+		plugin("numeric_monitoring", "filesystem"),
+		plugin("sql", "sql"),
+	}
+	for _, name := range m.tables {
+		rows = append(rows, plugin("table", name))
+	}
+	return rows
+}
@@ -0,0 +1,208 @@
+package virtual
+
+import (
+	"container/list"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// networkFunctions implement the string and network helper functions osquery registers with SQLite, which
+// network hunting queries rely on to match addresses against CIDR blocks and pick fields out of strings.
+var networkFunctions = []*scalarFunctionDef{
+	{"in_cidr_block", 2, 2, sql.Int64, inCIDRBlock},
+	{"inet_aton", 1, 1, sql.Int64, inetAton},
+	{"regex_match", 3, 3, sql.Text, regexMatch},
+	{"regex_split", 3, 3, sql.Text, regexSplit},
+	{"split", 3, 3, sql.Text, splitTokens},
+}
+
+// regexCacheSize is the number of compiled patterns regexCache keeps.
+const regexCacheSize = 256
+
+// regexCache holds the patterns most recently compiled by regex_match and regex_split, since the same pattern is
+// evaluated for every row of a table. Once it holds regexCacheSize patterns, the least recently used is evicted,
+// so queries building patterns from row values cannot grow it without bound.
+var regexCache = struct {
+	sync.Mutex
+	order    *list.List
+	patterns map[string]*list.Element
+}{order: list.New(), patterns: map[string]*list.Element{}}
+
+// cachedRegex is an entry of regexCache.
+type cachedRegex struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	defer regexCache.Unlock()
+
+	if elem, ok := regexCache.patterns[pattern]; ok {
+		regexCache.order.MoveToFront(elem)
+		return elem.Value.(*cachedRegex).re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid regex %q: %v", pattern, err)
+	}
+	regexCache.patterns[pattern] = regexCache.order.PushFront(&cachedRegex{pattern: pattern, re: re})
+	if regexCache.order.Len() > regexCacheSize {
+		oldest := regexCache.order.Back()
+		regexCache.order.Remove(oldest)
+		delete(regexCache.patterns, oldest.Value.(*cachedRegex).pattern)
+	}
+	return re, nil
+}
+
+// intArg returns arg as an int, and false if it is NULL or not a number.
+func intArg(arg interface{}) (int, bool) {
+	switch v := arg.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// inetAton converts a dotted quad IPv4 address to its integer value. Anything else is NULL.
+func inetAton(args []interface{}) (interface{}, error) {
+	addr, ok := stringArg(args[0])
+	if !ok {
+		return nil, nil
+	}
+	ip := net.ParseIP(strings.TrimSpace(addr)).To4()
+	if ip == nil {
+		return nil, nil
+	}
+	return int64(ip[0])<<24 | int64(ip[1])<<16 | int64(ip[2])<<8 | int64(ip[3]), nil
+}
+
+// inCIDRBlock returns 1 if the address in args[1] is within the CIDR block in args[0], and 0 otherwise.
+func inCIDRBlock(args []interface{}) (interface{}, error) {
+	block, ok := stringArg(args[0])
+	if !ok {
+		return nil, nil
+	}
+	addr, ok := stringArg(args[1])
+	if !ok {
+		return nil, nil
+	}
+
+	_, network, err := net.ParseCIDR(strings.TrimSpace(block))
+	if err != nil {
+		return nil, xerrors.Errorf("invalid CIDR block %q", block)
+	}
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return nil, xerrors.Errorf("invalid IP address %q", addr)
+	}
+	if network.Contains(ip) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+// regexMatch returns the capture group args[2] (0 being the whole match) of the first match of the pattern in
+// args[1] against args[0], or NULL if there is none.
+func regexMatch(args []interface{}) (interface{}, error) {
+	str, ok := stringArg(args[0])
+	if !ok {
+		return nil, nil
+	}
+	pattern, ok := stringArg(args[1])
+	if !ok {
+		return nil, nil
+	}
+	idx, ok := intArg(args[2])
+	if !ok {
+		return nil, nil
+	}
+
+	re, err := compileRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+	match := re.FindStringSubmatch(str)
+	if idx < 0 || idx >= len(match) {
+		return nil, nil
+	}
+	return match[idx], nil
+}
+
+// regexSplit splits args[0] on the pattern in args[1] and returns the field at index args[2], or NULL if there
+// are not that many. Empty fields are discarded.
+func regexSplit(args []interface{}) (interface{}, error) {
+	str, ok := stringArg(args[0])
+	if !ok {
+		return nil, nil
+	}
+	pattern, ok := stringArg(args[1])
+	if !ok {
+		return nil, nil
+	}
+	idx, ok := intArg(args[2])
+	if !ok {
+		return nil, nil
+	}
+
+	re, err := compileRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return nthField(re.Split(str, -1), idx), nil
+}
+
+// splitTokens splits args[0] on any of the characters in args[1] and returns the field at index args[2], or
+// NULL if there are not that many. Empty fields are discarded.
+func splitTokens(args []interface{}) (interface{}, error) {
+	str, ok := stringArg(args[0])
+	if !ok {
+		return nil, nil
+	}
+	tokens, ok := stringArg(args[1])
+	if !ok {
+		return nil, nil
+	}
+	idx, ok := intArg(args[2])
+	if !ok {
+		return nil, nil
+	}
+
+	return nthField(strings.FieldsFunc(str, func(r rune) bool { return strings.ContainsRune(tokens, r) }), idx), nil
+}
+
+func nthField(fields []string, idx int) interface{} {
+	nonempty := fields[:0]
+	for _, field := range fields {
+		if field != "" {
+			nonempty = append(nonempty, field)
+		}
+	}
+	if idx < 0 || idx >= len(nonempty) {
+		return nil
+	}
+	return nonempty[idx]
+}
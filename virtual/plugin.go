@@ -0,0 +1,118 @@
+package virtual
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/osquery/osquery-go/plugin/table"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Fixtures holds canned rows for tables, keyed by table name.
+type Fixtures map[string][]map[string]string
+
+// LoadFixtures reads table fixtures from dir. Each fixture is a file named after its table (e.g. processes.json)
+// containing a JSON or YAML list of rows, where each row maps column names to values.
+func LoadFixtures(dir string) (Fixtures, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading fixtures directory: %v", err)
+	}
+
+	fixtures := Fixtures{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		raw := []map[string]interface{}{}
+		if ext == ".json" {
+			err = json.Unmarshal(data, &raw)
+		} else {
+			err = yaml.Unmarshal(data, &raw)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("error parsing fixture %s: %v", entry.Name(), err)
+		}
+
+		rows := make([]map[string]string, 0, len(raw))
+		for _, r := range raw {
+			row := map[string]string{}
+			for key, val := range r {
+				if val != nil {
+					row[key] = fmt.Sprintf("%v", val)
+				}
+			}
+			rows = append(rows, row)
+		}
+		fixtures[strings.TrimSuffix(entry.Name(), ext)] = rows
+	}
+
+	return fixtures, nil
+}
+
+// PlatformColumns returns the columns tbl exposes on goos, including its extended schema for that platform.
+func PlatformColumns(tbl *osqt.Table, goos string) []*osqt.Column {
+	cols := []*osqt.Column{}
+	if tbl.Schema != nil {
+		cols = append(cols, tbl.Schema.Columns...)
+	}
+	if ext := tbl.ExtendedSchemaFor(goos); ext != nil {
+		cols = append(cols, ext.Columns...)
+	}
+	return cols
+}
+
+// NewTablePlugin creates an osquery table plugin for tbl as it exists on goos. The plugin returns the rows from
+// fixtures when the table has any, or synthetic rows generated by faker otherwise. A nil faker uses the default
+// seed.
+func NewTablePlugin(tbl *osqt.Table, goos string, fixtures Fixtures, synthetic int, faker *Faker) *table.Plugin {
+	columns := PlatformColumns(tbl, goos)
+
+	defs := make([]table.ColumnDefinition, 0, len(columns))
+	for _, col := range columns {
+		switch baseType(col) {
+		case "INTEGER":
+			defs = append(defs, table.IntegerColumn(col.Name))
+		case "BIGINT":
+			defs = append(defs, table.BigIntColumn(col.Name))
+		case "DOUBLE":
+			defs = append(defs, table.DoubleColumn(col.Name))
+		default:
+			defs = append(defs, table.TextColumn(col.Name))
+		}
+	}
+
+	rows, ok := fixtures[tbl.Name]
+	if !ok {
+		if faker == nil {
+			faker = NewFaker(0)
+		}
+		rows = faker.Rows(columns, synthetic)
+	}
+
+	return table.NewPlugin(tbl.Name, defs, func(ctx context.Context, _ table.QueryContext) ([]map[string]string, error) {
+		return rows, nil
+	})
+}
+
+// baseType returns the osquery extension API column kind of col, treating unregistered types as TEXT.
+func baseType(col *osqt.Column) string {
+	if ct, ok := col.ColumnType(); ok {
+		return ct.Base
+	}
+	return "TEXT"
+}
@@ -0,0 +1,210 @@
+package virtual
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyMode determines how a QueryPolicy treats the queries it lists.
+type PolicyMode string
+
+const (
+	// PolicyAllowlist only permits queries that match the policy.
+	PolicyAllowlist PolicyMode = "allowlist"
+
+	// PolicyDenylist permits every query except the ones that match the policy.
+	PolicyDenylist PolicyMode = "denylist"
+)
+
+// ErrQueryNotPermitted is returned when a query is rejected by the active QueryPolicy.
+var ErrQueryNotPermitted = xerrors.New("query not permitted by the active query policy")
+
+// QueryPolicy is used to restrict which queries the virtual database will execute. Queries are matched exactly,
+// ignoring only differences in whitespace and trailing semicolons, and fingerprints match every query that
+// normalizes to the same form.
+type QueryPolicy struct {
+	Mode         PolicyMode `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Queries      []string   `json:"queries,omitempty" yaml:"queries,omitempty"`
+	Fingerprints []string   `json:"fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+
+	exact  map[string]bool
+	prints map[string]bool
+}
+
+// NewQueryPolicy creates a QueryPolicy of the given mode from a set of queries and fingerprints.
+func NewQueryPolicy(mode PolicyMode, queries, fingerprints []string) (*QueryPolicy, error) {
+	p := &QueryPolicy{
+		Mode:         mode,
+		Queries:      queries,
+		Fingerprints: fingerprints,
+	}
+
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// LoadQueryPolicy reads a YAML or JSON policy file. The mode argument overrides any mode declared in the file.
+func LoadQueryPolicy(fileloc string, mode PolicyMode) (*QueryPolicy, error) {
+	filebytes, err := ioutil.ReadFile(fileloc)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &QueryPolicy{}
+	err = yaml.Unmarshal(filebytes, p)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing query policy %s: %v", fileloc, err)
+	}
+
+	if mode != "" {
+		p.Mode = mode
+	}
+
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *QueryPolicy) compile() error {
+	if p.Mode != PolicyAllowlist && p.Mode != PolicyDenylist {
+		return xerrors.Errorf("invalid query policy mode %q (valid: %s, %s)", p.Mode, PolicyAllowlist, PolicyDenylist)
+	}
+
+	p.exact = map[string]bool{}
+	p.prints = map[string]bool{}
+	for _, q := range p.Queries {
+		p.exact[exactQuery(q)] = true
+	}
+	for _, fp := range p.Fingerprints {
+		p.prints[strings.ToLower(strings.TrimSpace(fp))] = true
+	}
+
+	return nil
+}
+
+// Matches returns true if the query is listed in the policy, either verbatim or by fingerprint.
+func (p *QueryPolicy) Matches(query string) bool {
+	if p.exact[exactQuery(query)] {
+		return true
+	}
+
+	return p.prints[Fingerprint(query)]
+}
+
+// Check returns ErrQueryNotPermitted if the policy does not allow the query to be executed.
+func (p *QueryPolicy) Check(query string) error {
+	matched := p.Matches(query)
+	if p.Mode == PolicyAllowlist && !matched {
+		return ErrQueryNotPermitted
+	}
+	if p.Mode == PolicyDenylist && matched {
+		return ErrQueryNotPermitted
+	}
+
+	return nil
+}
+
+// NormalizeQuery lowercases a query, collapses whitespace, strips trailing semicolons, and replaces
+// string and numeric literals with placeholders so that queries differing only in constants compare equal.
+// Both single and double quoted strings are literals, as they are in SQLite.
+func NormalizeQuery(query string) string {
+	var sb strings.Builder
+	runes := []rune(strings.TrimSpace(query))
+	space := false
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"':
+			i = quoteEnd(runes, i)
+			r = '?'
+		case unicode.IsDigit(r) && (i == 0 || !isIdentRune(runes[i-1])):
+			for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+			r = '?'
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		}
+
+		if space && sb.Len() > 0 {
+			sb.WriteRune(' ')
+		}
+		space = false
+		sb.WriteRune(unicode.ToLower(r))
+	}
+
+	return strings.TrimRight(sb.String(), "; ")
+}
+
+// exactQuery collapses the whitespace of a query outside its quoted strings and identifiers and strips trailing
+// semicolons, leaving everything else, including case and literals, as written.
+func exactQuery(query string) string {
+	var sb strings.Builder
+	runes := []rune(strings.TrimSpace(query))
+	space := false
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && sb.Len() > 0 {
+			sb.WriteRune(' ')
+		}
+		space = false
+
+		if r == '\'' || r == '"' || r == '`' {
+			end := quoteEnd(runes, i)
+			if end >= len(runes) {
+				end = len(runes) - 1
+			}
+			sb.WriteString(string(runes[i : end+1]))
+			i = end
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	return strings.TrimRight(sb.String(), "; ")
+}
+
+// quoteEnd returns the index of the quote closing the quoted string or identifier that opens at start, skipping
+// doubled quotes, or len(runes) if it is never closed.
+func quoteEnd(runes []rune, start int) int {
+	quote := runes[start]
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != quote {
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(runes)
+}
+
+// Fingerprint returns a short, stable hash of the normalized form of a query.
+func Fingerprint(query string) string {
+	sum := sha256.Sum256([]byte(NormalizeQuery(query)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
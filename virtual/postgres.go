@@ -0,0 +1,561 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgproto3/v2"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// pgMaxParameters is the most parameters a PostgreSQL statement can have, as Bind counts them with a 16-bit integer.
+const pgMaxParameters = 65535
+
+// PostgreSQL type OIDs used to describe result columns.
+const (
+	pgTypeInt8   = 20
+	pgTypeText   = 25
+	pgTypeFloat8 = 701
+)
+
+// ErrProtocolViolation is returned to PostgreSQL clients that send a message the protocol does not allow, such as
+// a statement with a $0 placeholder.
+var ErrProtocolViolation = xerrors.New("protocol violation")
+
+// pgPassthroughCommands are session and transaction statements PostgreSQL clients commonly issue on connect.
+// They are acknowledged without being run since the virtual database has no equivalent.
+var pgPassthroughCommands = map[string]bool{
+	"BEGIN":      true,
+	"COMMIT":     true,
+	"ROLLBACK":   true,
+	"SET":        true,
+	"RESET":      true,
+	"DISCARD":    true,
+	"DEALLOCATE": true,
+}
+
+// StartPostgres is the PostgreSQL wire protocol equivalent of Start: it listens on addr and serves the Database's
+// tables to clients that speak the PostgreSQL protocol. Both the simple and extended query protocols are
+// supported, with results always returned in text format. This function will not return unless the listener fails
+// or the Database is stopped.
+func (d *Database) StartPostgres(proto, addr string) error {
+	if !d.initialized {
+		return xerrors.New("server cannot start until the database is initialized")
+	}
+
+	if err := prepareSocket(proto, addr); err != nil {
+		return err
+	}
+	l, err := net.Listen(proto, addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	if err := d.secureSocket(proto, addr); err != nil {
+		return err
+	}
+
+	err = d.addServer(func(ctx context.Context) error {
+		l.Close()
+		return d.conns.drain(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	ids := atomic.NewUint32(0)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if d.isStopped() {
+				return nil
+			}
+			return err
+		}
+
+		c := &pgConn{
+			db:         d,
+			conn:       conn,
+			backend:    pgproto3.NewBackend(pgproto3.NewChunkReader(conn), conn),
+			id:         ids.Inc(),
+			statements: map[string]string{},
+			portals:    map[string]*pgPortal{},
+		}
+		c.logger = d.logger.Named("pg").With("conn", c.id, "remote", conn.RemoteAddr().String())
+		go c.serve()
+	}
+}
+
+// pgPortal is a bound statement along with its results, which are computed the first time they are needed.
+type pgPortal struct {
+	query  string
+	ran    bool
+	schema sql.Schema
+	rows   []sql.Row
+	err    error
+}
+
+// pgConn is a single PostgreSQL client session.
+type pgConn struct {
+	db         *Database
+	conn       net.Conn
+	backend    *pgproto3.Backend
+	id         uint32
+	user       string
+	logger     *zap.SugaredLogger
+	statements map[string]string
+	portals    map[string]*pgPortal
+
+	// failed is set when a message of the extended query protocol errors. The remaining messages are
+	// discarded until the client sends a Sync.
+	failed bool
+}
+
+func (c *pgConn) serve() {
+	admitErr := c.db.admit(c, func() { c.conn.Close() })
+	defer c.db.conns.remove(c)
+	defer c.conn.Close()
+
+	if err := c.startup(admitErr); err != nil {
+		c.logger.Debugw("Connection closed during startup", "error", err)
+		return
+	}
+	c.logger.Debug("Connection established")
+
+	idleTimeout := c.db.currentLimits().IdleTimeout
+	for {
+		c.db.conns.setBusy(c, false)
+		if idleTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
+		msg, err := c.backend.Receive()
+		if err != nil {
+			if err != io.EOF && !c.db.isStopped() {
+				c.logger.Debugw("Error reading from connection", "error", err)
+			}
+			return
+		}
+
+		c.db.conns.setBusy(c, true)
+		if err := c.handle(msg); err != nil {
+			if err != io.EOF {
+				c.logger.Debugw("Error writing to connection", "error", err)
+			}
+			return
+		}
+	}
+}
+
+// startup negotiates the session with the client. If admitErr is set, the connection was not admitted and the
+// client is sent it as a fatal error instead.
+func (c *pgConn) startup(admitErr error) error {
+	for {
+		msg, err := c.backend.ReceiveStartupMessage()
+		if err != nil {
+			return err
+		}
+
+		switch m := msg.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			// encryption is not supported, the client will continue in plaintext or disconnect
+			if _, err := c.conn.Write([]byte("N")); err != nil {
+				return err
+			}
+		case *pgproto3.StartupMessage:
+			if admitErr != nil {
+				c.logger.Warnw("Rejecting connection", "error", admitErr)
+				c.send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "53300", Message: admitErr.Error()})
+				return admitErr
+			}
+			c.user = m.Parameters["user"]
+			c.logger = c.logger.With("user", c.user)
+			return c.send(
+				&pgproto3.AuthenticationOk{},
+				&pgproto3.ParameterStatus{Name: "server_version", Value: "9.6.0"},
+				&pgproto3.ParameterStatus{Name: "server_encoding", Value: "UTF8"},
+				&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"},
+				&pgproto3.ParameterStatus{Name: "DateStyle", Value: "ISO, MDY"},
+				&pgproto3.ParameterStatus{Name: "integer_datetimes", Value: "on"},
+				&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"},
+				&pgproto3.BackendKeyData{ProcessID: c.id},
+				&pgproto3.ReadyForQuery{TxStatus: 'I'},
+			)
+		case *pgproto3.CancelRequest:
+			return xerrors.New("query cancellation is not supported")
+		default:
+			return xerrors.Errorf("unexpected startup message %T", msg)
+		}
+	}
+}
+
+func (c *pgConn) handle(msg pgproto3.FrontendMessage) error {
+	switch m := msg.(type) {
+	case *pgproto3.Query:
+		return c.simpleQuery(m.String)
+	case *pgproto3.Terminate:
+		return io.EOF
+	case *pgproto3.Sync:
+		c.failed = false
+		return c.send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	case *pgproto3.Flush:
+		return nil
+	}
+
+	if c.failed {
+		return nil
+	}
+
+	var err error
+	switch m := msg.(type) {
+	case *pgproto3.Parse:
+		if _, perr := countParameters(m.Query); perr != nil {
+			err = c.sendError(perr)
+			break
+		}
+		c.statements[m.Name] = m.Query
+		err = c.send(&pgproto3.ParseComplete{})
+	case *pgproto3.Bind:
+		err = c.bind(m)
+	case *pgproto3.Describe:
+		err = c.describe(m)
+	case *pgproto3.Execute:
+		err = c.execute(m)
+	case *pgproto3.Close:
+		if m.ObjectType == 'S' {
+			delete(c.statements, m.Name)
+		} else {
+			delete(c.portals, m.Name)
+		}
+		err = c.send(&pgproto3.CloseComplete{})
+	default:
+		err = c.sendError(xerrors.Errorf("unsupported message type %T", msg))
+	}
+	return err
+}
+
+// simpleQuery runs every statement of a simple query message in turn, as PostgreSQL does, stopping at the first
+// that fails.
+func (c *pgConn) simpleQuery(sql string) error {
+	for _, stmt := range splitQuery(sql) {
+		p := &pgPortal{query: stmt}
+		if err := c.sendResults(p, true); err != nil {
+			return err
+		}
+		if p.err != nil {
+			break
+		}
+	}
+	c.failed = false
+	return c.send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+}
+
+func (c *pgConn) bind(m *pgproto3.Bind) error {
+	query, ok := c.statements[m.PreparedStatement]
+	if !ok {
+		return c.sendError(xerrors.Errorf("prepared statement %q does not exist", m.PreparedStatement))
+	}
+	for _, code := range m.ResultFormatCodes {
+		if code != 0 {
+			return c.sendError(xerrors.New("only text result formats are supported"))
+		}
+	}
+
+	params := make([]*string, len(m.Parameters))
+	for idx, raw := range m.Parameters {
+		format := int16(0)
+		if len(m.ParameterFormatCodes) == 1 {
+			format = m.ParameterFormatCodes[0]
+		} else if idx < len(m.ParameterFormatCodes) {
+			format = m.ParameterFormatCodes[idx]
+		}
+		if format != 0 {
+			return c.sendError(xerrors.Errorf("parameter $%d uses an unsupported binary format", idx+1))
+		}
+		if raw != nil {
+			s := string(raw)
+			params[idx] = &s
+		}
+	}
+
+	bound, err := bindParameters(query, params)
+	if err != nil {
+		return c.sendError(err)
+	}
+	c.portals[m.DestinationPortal] = &pgPortal{query: bound}
+	return c.send(&pgproto3.BindComplete{})
+}
+
+func (c *pgConn) describe(m *pgproto3.Describe) error {
+	if m.ObjectType == 'P' {
+		p, ok := c.portals[m.Name]
+		if !ok {
+			return c.sendError(xerrors.Errorf("portal %q does not exist", m.Name))
+		}
+		c.run(p)
+		if p.err != nil {
+			return c.sendError(p.err)
+		}
+		return c.send(rowDescription(p.schema))
+	}
+
+	query, ok := c.statements[m.Name]
+	if !ok {
+		return c.sendError(xerrors.Errorf("prepared statement %q does not exist", m.Name))
+	}
+
+	count, err := countParameters(query)
+	if err != nil {
+		return c.sendError(err)
+	}
+	oids := make([]uint32, count)
+	for idx := range oids {
+		oids[idx] = pgTypeText
+	}
+	if pgPassthroughCommands[commandKeyword(query)] {
+		return c.send(&pgproto3.ParameterDescription{ParameterOIDs: oids}, &pgproto3.NoData{})
+	}
+
+	// the result columns are those of the statement's plan with every parameter set to NULL, which is analyzed
+	// without being run so describing a statement never has its side effects
+	bound, err := bindParameters(query, make([]*string, count))
+	if err != nil {
+		return c.sendError(err)
+	}
+	schema, err := c.db.ResultSchema(context.Background(), strings.TrimRight(strings.TrimSpace(bound), ";"))
+	if err != nil {
+		return c.sendError(err)
+	}
+	return c.send(&pgproto3.ParameterDescription{ParameterOIDs: oids}, rowDescription(schema))
+}
+
+func (c *pgConn) execute(m *pgproto3.Execute) error {
+	p, ok := c.portals[m.Portal]
+	if !ok {
+		return c.sendError(xerrors.Errorf("portal %q does not exist", m.Portal))
+	}
+	return c.sendResults(p, false)
+}
+
+// run executes the portal's query if it has not been run already.
+func (c *pgConn) run(p *pgPortal) {
+	if p.ran {
+		return
+	}
+	p.ran = true
+
+	if pgPassthroughCommands[commandKeyword(p.query)] {
+		return
+	}
+
+	client := &ClientInfo{
+		Protocol:     "postgres",
+		Address:      c.conn.RemoteAddr().String(),
+		User:         c.user,
+		ConnectionID: c.id,
+	}
+	query := strings.TrimRight(strings.TrimSpace(p.query), ";")
+	if !c.db.conns.allow(c) {
+		p.err = ErrRateLimited
+		c.db.audit(client, query, time.Now(), 0, p.err)
+		return
+	}
+	p.schema, p.rows, p.err = c.db.Query(WithClientInfo(context.Background(), client), query)
+}
+
+// sendResults runs the portal and writes its rows followed by a CommandComplete. Simple queries also
+// describe their rows first, whereas extended query clients ask for the description with Describe.
+func (c *pgConn) sendResults(p *pgPortal, describe bool) error {
+	if strings.TrimSpace(strings.TrimRight(strings.TrimSpace(p.query), ";")) == "" {
+		return c.send(&pgproto3.EmptyQueryResponse{})
+	}
+
+	c.run(p)
+	if p.err != nil {
+		return c.sendError(p.err)
+	}
+
+	msgs := []pgproto3.BackendMessage{}
+	if describe && len(p.schema) > 0 {
+		msgs = append(msgs, rowDescription(p.schema))
+	}
+	for _, row := range p.rows {
+		values := make([][]byte, len(row))
+		for idx, val := range row {
+			values[idx] = encodeText(val)
+		}
+		msgs = append(msgs, &pgproto3.DataRow{Values: values})
+	}
+	msgs = append(msgs, &pgproto3.CommandComplete{CommandTag: []byte(commandTag(p))})
+	return c.send(msgs...)
+}
+
+func (c *pgConn) send(msgs ...pgproto3.BackendMessage) error {
+	for _, msg := range msgs {
+		if err := c.backend.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *pgConn) sendError(err error) error {
+	c.failed = true
+
+	code := "42000"
+	if xerrors.Is(err, ErrQueryNotPermitted) {
+		code = "42501"
+	} else if xerrors.Is(err, ErrRateLimited) {
+		code = "53400"
+	} else if xerrors.Is(err, ErrProtocolViolation) {
+		code = "08P01"
+	}
+	return c.send(&pgproto3.ErrorResponse{
+		Severity: "ERROR",
+		Code:     code,
+		Message:  err.Error(),
+	})
+}
+
+func rowDescription(schema sql.Schema) pgproto3.BackendMessage {
+	if len(schema) == 0 {
+		return &pgproto3.NoData{}
+	}
+
+	fields := make([]pgproto3.FieldDescription, 0, len(schema))
+	for _, col := range schema {
+		oid, size := uint32(pgTypeText), int16(-1)
+		switch {
+		case sql.IsInteger(col.Type):
+			oid, size = pgTypeInt8, 8
+		case sql.IsNumber(col.Type):
+			oid, size = pgTypeFloat8, 8
+		}
+		fields = append(fields, pgproto3.FieldDescription{
+			Name:         []byte(col.Name),
+			DataTypeOID:  oid,
+			DataTypeSize: size,
+			TypeModifier: -1,
+		})
+	}
+	return &pgproto3.RowDescription{Fields: fields}
+}
+
+func encodeText(val interface{}) []byte {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	case bool:
+		if v {
+			return []byte("t")
+		}
+		return []byte("f")
+	case time.Time:
+		return []byte(v.Format("2006-01-02 15:04:05.999999"))
+	default:
+		return []byte(fmt.Sprintf("%v", v))
+	}
+}
+
+func commandKeyword(query string) string {
+	fields := strings.Fields(strings.TrimSpace(query))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimRight(fields[0], ";"))
+}
+
+func commandTag(p *pgPortal) string {
+	keyword := commandKeyword(p.query)
+	switch keyword {
+	case "INSERT":
+		affected := len(p.rows)
+		if len(p.rows) == 1 && len(p.rows[0]) == 1 {
+			if n, ok := p.rows[0][0].(int64); ok {
+				affected = int(n)
+			}
+		}
+		return fmt.Sprintf("INSERT 0 %d", affected)
+	case "SELECT", "SHOW", "DESCRIBE", "EXPLAIN", "WITH":
+		return fmt.Sprintf("SELECT %d", len(p.rows))
+	default:
+		return keyword
+	}
+}
+
+// countParameters returns the highest numbered $N placeholder in query, or an error if query numbers a
+// placeholder below $1.
+func countParameters(query string) (int, error) {
+	max := 0
+	_, err := scanParameters(query, func(n int) string {
+		if n > max {
+			max = n
+		}
+		return ""
+	})
+	return max, err
+}
+
+// pgLiteralEscaper escapes a parameter value for a quoted literal. The engine parses queries as MySQL does, where a
+// backslash escapes the character after it within a string, so backslashes are doubled as well as quotes.
+var pgLiteralEscaper = strings.NewReplacer(`\`, `\\`, `'`, `''`)
+
+// bindParameters replaces the $N placeholders in query with params[N-1] as a quoted literal, or NULL.
+func bindParameters(query string, params []*string) (string, error) {
+	return scanParameters(query, func(n int) string {
+		if n > len(params) || params[n-1] == nil {
+			return "NULL"
+		}
+		return "'" + pgLiteralEscaper.Replace(*params[n-1]) + "'"
+	})
+}
+
+// scanParameters rewrites every $N placeholder outside of quoted strings with the result of replace. Placeholders
+// are numbered from $1 to pgMaxParameters, so any other is a protocol violation.
+func scanParameters(query string, replace func(n int) string) (string, error) {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && i+1 < len(query) {
+				// an escaped character, such as a quote, never ends the string
+				b.WriteByte(ch)
+				i++
+				ch = query[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '$':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				n, err := strconv.Atoi(query[i+1 : j])
+				if err != nil || n < 1 || n > pgMaxParameters {
+					return "", xerrors.Errorf("invalid parameter placeholder %s: %w", query[i:j], ErrProtocolViolation)
+				}
+				b.WriteString(replace(n))
+				i = j - 1
+				continue
+			}
+		}
+		b.WriteByte(ch)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,73 @@
+package virtual
+
+import (
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// RowProvider supplies the rows of a table each time it is queried, allowing a table to be backed by a custom data
+// source or simulator instead of rows held by the Database. Rows must have one value per column of the table's
+// schema (see Database.TableSchema), in order, converted to the column's type.
+type RowProvider interface {
+	Rows(ctx *sql.Context, table string) ([]sql.Row, error)
+}
+
+// RowProviderFunc adapts a function to a RowProvider.
+type RowProviderFunc func(ctx *sql.Context, table string) ([]sql.Row, error)
+
+// Rows implements the RowProvider interface.
+func (f RowProviderFunc) Rows(ctx *sql.Context, table string) ([]sql.Row, error) {
+	return f(ctx, table)
+}
+
+// StringRows converts rows of string values keyed by column name, the form osquery itself returns results in, into
+// rows matching schema. It is intended for RowProviders whose data sources produce osquery style results.
+func StringRows(table string, schema sql.Schema, rows []map[string]string) ([]sql.Row, error) {
+	return stringRows(table, schema, rows)
+}
+
+// providerSource adapts a RowProvider to a rowSource, checking the rows it returns fit the table.
+type providerSource struct {
+	provider RowProvider
+}
+
+func (p *providerSource) rows(ctx *sql.Context, table string, schema sql.Schema) ([]sql.Row, error) {
+	rows, err := p.provider.Rows(ctx, table)
+	if err != nil {
+		return nil, xerrors.Errorf("error fetching rows for %s: %v", table, err)
+	}
+	for idx, row := range rows {
+		if len(row) != len(schema) {
+			return nil, xerrors.Errorf("row provider for %s returned %d values in row %d, the table has %d columns", table, len(row), idx, len(schema))
+		}
+	}
+	return rows, nil
+}
+
+// SetRowProvider backs the named table of the primary database with p. Providers take precedence over
+// SetExtensionProvider and SetStore, and fixtures for the table are ignored. Tables of the same name in other
+// databases (see AddTableTo) are not backed by p. It must be called before Initialize.
+func (d *Database) SetRowProvider(table string, p RowProvider) error {
+	if d.initialized {
+		return ErrDatabaseInitialized
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if p == nil {
+		delete(d.providers, table)
+		return nil
+	}
+	d.providers[table] = &providerSource{provider: p}
+	return nil
+}
+
+// TableSchema returns the schema of the named table in the Database's primary database.
+func (d *Database) TableSchema(table string) (sql.Schema, bool) {
+	d.RLock()
+	defer d.RUnlock()
+
+	schema, ok := d.schemas[table]
+	return schema, ok
+}
@@ -0,0 +1,76 @@
+package virtual
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Query runs query against the Database's engine, subject to the active QueryPolicy, and returns the result
+// schema and every row it produced. It is used by the frontends that do not speak the MySQL protocol natively.
+// The statement is audited on behalf of the client attached to ctx with WithClientInfo.
+func (d *Database) Query(ctx context.Context, query string) (schema sql.Schema, rows []sql.Row, err error) {
+	if !d.initialized {
+		return nil, nil, xerrors.New("queries cannot be run until the database is initialized")
+	}
+
+	start := time.Now()
+	defer func() { d.audit(clientInfoFrom(ctx), query, start, len(rows), err) }()
+
+	ctx, span := osqt.Tracer().Start(ctx, "virtual.Query", trace.WithAttributes(
+		attribute.String("db.system", "osquery"),
+		attribute.String("db.statement", query),
+	))
+	defer func() { osqt.EndSpan(span, err) }()
+
+	if err := d.checkPolicy(query); err != nil {
+		d.logger.Infow("Query rejected by policy", "fingerprint", Fingerprint(query))
+		return nil, nil, err
+	}
+
+	if d.recorder != nil && !isSessionStatement(query) {
+		rec, err := d.recorder.Result(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		schema, rows = rec.sqlRows()
+		return schema, rows, nil
+	}
+
+	pid := d.pid.Inc()
+	var qschema sql.Schema
+	var qrows []sql.Row
+	d.reloading.RLock()
+	err = d.watch(ctx, func(ctx context.Context) error {
+		defer d.reloading.RUnlock()
+
+		expanded, release, err := d.expandTableFunctions(ctx, query, true)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		sctx := sql.NewContext(ctx,
+			sql.WithSession(sql.NewBaseSession()),
+			sql.WithPid(pid),
+			sql.WithQuery(expanded),
+		)
+		schema, iter, err := d.eng.Query(sctx, expanded)
+		if err != nil {
+			return err
+		}
+		qrows, err = sql.RowIterToRows(iter)
+		qschema = schema
+		return err
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return qschema, qrows, nil
+}
@@ -0,0 +1,234 @@
+package virtual
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+	"gopkg.in/src-d/go-vitess.v1/sqltypes"
+	querypb "gopkg.in/src-d/go-vitess.v1/vt/proto/query"
+
+	"github.com/gen0cide/osqt/query"
+)
+
+// ErrNotRecorded is thrown when replaying a query that has no recorded result.
+var ErrNotRecorded = xerrors.New("query has no recorded result")
+
+// Recording is the result of a query as returned by a live osquery instance.
+type Recording struct {
+	Query    string              `json:"query"`
+	Columns  []string            `json:"columns"`
+	Rows     []map[string]string `json:"rows"`
+	Recorded time.Time           `json:"recorded"`
+}
+
+// Recorder answers queries with results recorded from a live osquery instance. Queries are forwarded to the
+// instance the first time they are seen and their results written to a directory, from which later runs replay
+// them without a live instance, e.g. to capture realistic results once and serve them deterministically in CI.
+// Session statements clients issue on connect, such as SET or SELECT @@version_comment, are not recorded: the
+// Database answers them itself.
+type Recorder struct {
+	sync.Mutex
+
+	dir      string
+	live     *ExtensionProvider
+	dryRun   bool
+	logger   *zap.SugaredLogger
+	fixtures map[string]*sync.Mutex
+}
+
+// NewRecorder creates a Recorder keeping its recordings in dir. Queries without a recording are forwarded to live,
+// or fail with ErrNotRecorded if live is nil. In dry-run mode, results forwarded to live are returned and logged
+// but never written, and dir is not created.
+func NewRecorder(dir string, live *ExtensionProvider, dryRun bool) (*Recorder, error) {
+	if !dryRun {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, xerrors.Errorf("error creating recording directory %s: %v", dir, err)
+		}
+	}
+
+	return &Recorder{
+		dir:      dir,
+		live:     live,
+		dryRun:   dryRun,
+		logger:   zap.NewNop().Sugar(),
+		fixtures: map[string]*sync.Mutex{},
+	}, nil
+}
+
+// lockFixture locks the recording at path, so a query is only forwarded once while queries with other recordings
+// proceed, and returns the function unlocking it.
+func (r *Recorder) lockFixture(path string) func() {
+	r.Lock()
+	mu, ok := r.fixtures[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		r.fixtures[path] = mu
+	}
+	r.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Result returns the recorded result of query, recording it first if it has not been seen before.
+func (r *Recorder) Result(ctx context.Context, query string) (*Recording, error) {
+	path := filepath.Join(r.dir, recordingKey(query)+".json")
+	defer r.lockFixture(path)()
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		rec := &Recording{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, xerrors.Errorf("error reading recording %s: %v", path, err)
+		}
+		return rec, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("error reading recording %s: %v", path, err)
+	}
+	if r.live == nil {
+		return nil, xerrors.Errorf("%s: %w", strings.TrimSpace(query), ErrNotRecorded)
+	}
+
+	columns, rows, err := r.live.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{
+		Query:    query,
+		Columns:  columns,
+		Rows:     rows,
+		Recorded: time.Now().UTC(),
+	}
+
+	data, err = json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, xerrors.Errorf("error encoding recording: %v", err)
+	}
+	if r.dryRun {
+		r.logger.Infow("Dry run: not writing recording", "path", path, "bytes", len(data), "rows", len(rows))
+		return rec, nil
+	}
+	// write to a temporary file first so an interrupted run never leaves a truncated recording behind
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return nil, xerrors.Errorf("error writing recording %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, xerrors.Errorf("error writing recording %s: %v", path, err)
+	}
+	return rec, nil
+}
+
+// isSessionStatement returns true if query is a statement that configures or inspects the client's session, such
+// as SET, SHOW or SELECT @@version_comment, rather than one reading osquery tables.
+func isSessionStatement(q string) bool {
+	tokens, err := query.Tokenize(q)
+	if err != nil || len(tokens) == 0 {
+		return false
+	}
+
+	switch strings.ToUpper(tokens[0].Text) {
+	case "SET", "SHOW", "USE", "BEGIN", "START", "COMMIT", "ROLLBACK":
+		return true
+	case "SELECT":
+		variable := false
+		for _, tok := range tokens[1:] {
+			if tok.Is("FROM") {
+				return false
+			}
+			if tok.Kind == query.TokenIdent && strings.HasPrefix(tok.Text, "@") {
+				variable = true
+			}
+		}
+		return variable
+	}
+	return false
+}
+
+// recordingKey identifies the recording of a query. Unlike Fingerprint it keeps literals and case, as queries
+// differing in them can return different rows. Whitespace and comments between tokens collapse to a single space,
+// while string literals and quoted identifiers are kept as written.
+func recordingKey(stmt string) string {
+	normalized := strings.TrimSpace(stmt)
+	if tokens, err := query.Tokenize(stmt); err == nil {
+		var b strings.Builder
+		for idx, tok := range tokens {
+			if idx > 0 && tok.Pos > tokens[idx-1].End {
+				b.WriteByte(' ')
+			}
+			b.WriteString(stmt[tok.Pos:tok.End])
+		}
+		normalized = b.String()
+	}
+	sum := sha256.Sum256([]byte(strings.TrimRight(normalized, "; ")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// sqlRows returns the recorded result as text columns.
+func (r *Recording) sqlRows() (sql.Schema, []sql.Row) {
+	schema := make(sql.Schema, 0, len(r.Columns))
+	for _, name := range r.Columns {
+		schema = append(schema, &sql.Column{Name: name, Type: sql.Text, Nullable: true})
+	}
+
+	rows := make([]sql.Row, 0, len(r.Rows))
+	for _, result := range r.Rows {
+		row := make(sql.Row, len(r.Columns))
+		for idx, name := range r.Columns {
+			if val, ok := result[name]; ok {
+				row[idx] = val
+			}
+		}
+		rows = append(rows, row)
+	}
+	return schema, rows
+}
+
+// result returns the recorded result in the form sent to MySQL clients.
+func (r *Recording) result() *sqltypes.Result {
+	res := &sqltypes.Result{
+		Fields: make([]*querypb.Field, 0, len(r.Columns)),
+		Rows:   make([][]sqltypes.Value, 0, len(r.Rows)),
+	}
+	for _, name := range r.Columns {
+		res.Fields = append(res.Fields, &querypb.Field{Name: name, Type: querypb.Type_TEXT})
+	}
+	for _, result := range r.Rows {
+		row := make([]sqltypes.Value, len(r.Columns))
+		for idx, name := range r.Columns {
+			row[idx] = sqltypes.NULL
+			if val, ok := result[name]; ok {
+				row[idx] = sqltypes.MakeTrusted(querypb.Type_TEXT, []byte(val))
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res
+}
+
+// SetRecorder answers every query from r instead of running it against the Database's tables. It must be called
+// before Initialize.
+func (d *Database) SetRecorder(r *Recorder) error {
+	if d.initialized {
+		return ErrDatabaseInitialized
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	r.logger = d.logger.Named("recorder")
+	d.recorder = r
+	return nil
+}
@@ -0,0 +1,244 @@
+package virtual
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/mem"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"github.com/gen0cide/osqt"
+)
+
+// ErrTableNotFound is thrown when reloading a table the Database does not serve. Tables cannot be added to a
+// Database once it is initialized.
+var ErrTableNotFound = xerrors.New("table is not served by the database")
+
+// ReloadTable replaces the schema of a table with the one tbl now defines, in every database serving it, without
+// restarting the Database or dropping its connections. Statements already executing finish against the old
+// schema before the table is swapped. Rows held in memory or in a Store are kept, matching columns by name:
+// columns that were removed are dropped, added columns are NULL, and values that cannot be converted to a
+// column's new type become NULL. It returns true if the schema changed in any database.
+func (d *Database) ReloadTable(tbl *osqt.Table) (bool, error) {
+	if !d.initialized {
+		return false, xerrors.New("tables cannot be reloaded until the database is initialized")
+	}
+	if tbl == nil {
+		return false, xerrors.New("must provide a table to reload")
+	}
+
+	d.reloading.Lock()
+	defer d.reloading.Unlock()
+
+	d.Lock()
+	defer d.Unlock()
+
+	ctx := sql.NewEmptyContext()
+	found, changed := false, false
+	for _, db := range append([]*mem.Database{d.instance}, d.extras...) {
+		rt, ok := db.Tables()[tbl.Name].(*reloadableTable)
+		if !ok {
+			continue
+		}
+		found = true
+
+		schema, err := tbl.ToSQLSchema(d.osexts[db.Name()])
+		if err != nil {
+			return changed, err
+		}
+		current := rt.current()
+		if current.Schema().Equals(schema) {
+			d.logger.Debugw("Table schema is unchanged, not reloading", "database", db.Name(), "table", tbl.Name)
+			continue
+		}
+
+		table, err := d.rebuildTable(ctx, current, schema)
+		if err != nil {
+			return changed, xerrors.Errorf("error reloading %s.%s: %v", db.Name(), tbl.Name, err)
+		}
+		rt.swap(table)
+		if db == d.instance {
+			d.schemas[tbl.Name] = schema
+		} else {
+			d.extra[db.Name()][tbl.Name] = schema
+		}
+		changed = true
+		d.logger.Infow("Reloaded table", "database", db.Name(), "table", tbl.Name, "columns", len(schema))
+	}
+
+	if !found {
+		return false, xerrors.Errorf("%s: %w", tbl.Name, ErrTableNotFound)
+	}
+	return changed, nil
+}
+
+// rebuildTable creates a table like current with the new schema, carrying its rows over.
+func (d *Database) rebuildTable(ctx *sql.Context, current sql.Table, schema sql.Schema) (sql.Table, error) {
+	switch current := current.(type) {
+	case *sourceTable:
+		return newSourceTable(current.name, schema, current.source), nil
+	case *storeTable:
+		if err := current.store.migrate(current, schema); err != nil {
+			return nil, err
+		}
+		table, err := current.store.table(current.bucket, current.name, schema)
+		if err != nil {
+			return nil, err
+		}
+		return table, nil
+	case *mem.Table:
+		rows, err := tableRows(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		table := mem.NewTable(current.Name(), schema)
+		for _, row := range rows {
+			row = remapRow(row, current.Schema(), schema)
+			for idx, col := range schema {
+				if row[idx] == nil {
+					continue
+				}
+				if row[idx], err = col.Type.Convert(row[idx]); err != nil {
+					row[idx] = nil
+				}
+			}
+			if err := table.Insert(ctx, row); err != nil {
+				return nil, err
+			}
+		}
+		if d.memtables[current.Name()] == current {
+			d.memtables[current.Name()] = table
+		}
+		return table, nil
+	}
+	return nil, xerrors.Errorf("table %s does not support reloading", current.Name())
+}
+
+// tableRows reads every row of table.
+func tableRows(ctx *sql.Context, table sql.Table) ([]sql.Row, error) {
+	partitions, err := table.Partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer partitions.Close()
+
+	rows := []sql.Row{}
+	for {
+		partition, err := partitions.Next()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		iter, err := table.PartitionRows(ctx, partition)
+		if err != nil {
+			return nil, err
+		}
+		prows, err := sql.RowIterToRows(iter)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, prows...)
+	}
+}
+
+// remapRow moves the values of a row of the from schema to the positions of the same columns in the to schema.
+func remapRow(row sql.Row, from, to sql.Schema) sql.Row {
+	remapped := make(sql.Row, len(to))
+	for idx, col := range to {
+		for fidx, fcol := range from {
+			if fidx < len(row) && strings.EqualFold(fcol.Name, col.Name) {
+				remapped[idx] = row[fidx]
+				break
+			}
+		}
+	}
+	return remapped
+}
+
+// reloadableTable is the table the engine sees for each osquery table. It delegates to the table holding the
+// rows, which ReloadTable swaps when the table's schema changes.
+type reloadableTable struct {
+	mu    sync.RWMutex
+	table sql.Table
+}
+
+func newReloadableTable(table sql.Table) *reloadableTable {
+	return &reloadableTable{table: table}
+}
+
+func (t *reloadableTable) current() sql.Table {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.table
+}
+
+func (t *reloadableTable) swap(table sql.Table) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.table = table
+}
+
+// Name implements the sql.Nameable interface.
+func (t *reloadableTable) Name() string {
+	return t.current().Name()
+}
+
+// String implements the fmt.Stringer interface.
+func (t *reloadableTable) String() string {
+	return t.current().String()
+}
+
+// Schema implements the sql.Table interface.
+func (t *reloadableTable) Schema() sql.Schema {
+	return t.current().Schema()
+}
+
+// Partitions implements the sql.Table interface.
+func (t *reloadableTable) Partitions(ctx *sql.Context) (sql.PartitionIter, error) {
+	return t.current().Partitions(ctx)
+}
+
+// PartitionRows implements the sql.Table interface. The rows end with the context's error once it is cancelled,
+// as it is when the watchdog stops a statement or the statement is killed.
+func (t *reloadableTable) PartitionRows(ctx *sql.Context, p sql.Partition) (sql.RowIter, error) {
+	iter, err := t.current().PartitionRows(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &contextRowIter{ctx: ctx, iter: iter}, nil
+}
+
+// Insert implements the sql.Inserter interface.
+func (t *reloadableTable) Insert(ctx *sql.Context, row sql.Row) error {
+	table := t.current()
+	inserter, ok := table.(sql.Inserter)
+	if !ok {
+		return xerrors.Errorf("table %s does not support inserting rows", table.Name())
+	}
+	return inserter.Insert(ctx, row)
+}
+
+// contextRowIter is a RowIter that stops once its context is done.
+type contextRowIter struct {
+	ctx  *sql.Context
+	iter sql.RowIter
+}
+
+// Next implements the sql.RowIter interface.
+func (i *contextRowIter) Next() (sql.Row, error) {
+	if err := i.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return i.iter.Next()
+}
+
+// Close implements the sql.RowIter interface.
+func (i *contextRowIter) Close() error {
+	return i.iter.Close()
+}
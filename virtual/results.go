@@ -0,0 +1,210 @@
+package virtual
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// maxResultLine is the longest line ParseResultsLog accepts. Snapshot results are logged on a single line, so
+// lines can be far longer than bufio's default limit.
+const maxResultLine = 64 * 1024 * 1024
+
+// QueryResults holds the rows of scheduled queries, keyed by the name osqueryd logged them under.
+type QueryResults map[string][]map[string]string
+
+// resultLogEntry is one line of an osqueryd results log, in the event, batch or snapshot format.
+type resultLogEntry struct {
+	Name           string                   `json:"name"`
+	HostIdentifier string                   `json:"hostIdentifier"`
+	Action         string                   `json:"action"`
+	Columns        map[string]interface{}   `json:"columns"`
+	Snapshot       []map[string]interface{} `json:"snapshot"`
+	DiffResults    *struct {
+		Added   []map[string]interface{} `json:"added"`
+		Removed []map[string]interface{} `json:"removed"`
+	} `json:"diffResults"`
+}
+
+// ParseResultsLog reads an osqueryd results log (e.g. /var/log/osquery/osqueryd.results.log) and returns the rows
+// each query last reported. Snapshot results replace the rows of their query, and differential results add and
+// remove rows as osqueryd reported them. Results from different hosts are kept apart, so the rows of a query are
+// those of every host in the log.
+func ParseResultsLog(path string) (QueryResults, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("error opening results log %s: %v", path, err)
+	}
+	defer f.Close()
+
+	type key struct{ name, host string }
+	state := map[key][]map[string]string{}
+	order := []key{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxResultLine)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		entry := &resultLogEntry{}
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(entry); err != nil {
+			return nil, xerrors.Errorf("%s:%d: invalid result log entry: %v", path, lineno, err)
+		}
+		if entry.Name == "" {
+			return nil, xerrors.Errorf("%s:%d: result log entry has no query name", path, lineno)
+		}
+
+		k := key{entry.Name, entry.HostIdentifier}
+		rows, seen := state[k]
+		if !seen {
+			order = append(order, k)
+		}
+		switch {
+		case entry.Action == "snapshot":
+			rows = resultRows(entry.Snapshot)
+		case entry.DiffResults != nil:
+			rows = removeResultRows(rows, resultRows(entry.DiffResults.Removed))
+			rows = append(rows, resultRows(entry.DiffResults.Added)...)
+		case entry.Action == "added":
+			rows = append(rows, resultRow(entry.Columns))
+		case entry.Action == "removed":
+			rows = removeResultRows(rows, []map[string]string{resultRow(entry.Columns)})
+		default:
+			return nil, xerrors.Errorf("%s:%d: unknown result log action %q", path, lineno, entry.Action)
+		}
+		state[k] = rows
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("error reading results log %s: %v", path, err)
+	}
+
+	results := QueryResults{}
+	for _, k := range order {
+		results[k.name] = append(results[k.name], state[k]...)
+	}
+	return results, nil
+}
+
+// resultRow converts a logged row to strings, whether or not osqueryd logged numeric values as numbers.
+func resultRow(columns map[string]interface{}) map[string]string {
+	row := make(map[string]string, len(columns))
+	for name, val := range columns {
+		if val != nil {
+			row[name] = fmt.Sprintf("%v", val)
+		}
+	}
+	return row
+}
+
+func resultRows(logged []map[string]interface{}) []map[string]string {
+	rows := make([]map[string]string, 0, len(logged))
+	for _, columns := range logged {
+		rows = append(rows, resultRow(columns))
+	}
+	return rows
+}
+
+// removeResultRows removes one occurrence of each of the removed rows from rows.
+func removeResultRows(rows, removed []map[string]string) []map[string]string {
+	for _, r := range removed {
+		for idx, row := range rows {
+			if equalResultRows(row, r) {
+				rows = append(rows[:idx], rows[idx+1:]...)
+				break
+			}
+		}
+	}
+	return rows
+}
+
+func equalResultRows(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, val := range a {
+		if bval, ok := b[name]; !ok || bval != val {
+			return false
+		}
+	}
+	return true
+}
+
+// ResultsFixtures matches the queries in results to the tables of the Database's primary database, returning
+// their rows as fixtures. Result logs name the query rather than the table it selected from, so a query matches
+// the table whose name it ends with (e.g. pack_incident_processes matches processes) if that table has every
+// column the query returned, or otherwise the only table that has every such column. Queries that match no table,
+// or several, are skipped with a warning.
+func (d *Database) ResultsFixtures(results QueryResults) Fixtures {
+	d.RLock()
+	defer d.RUnlock()
+
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fixtures := Fixtures{}
+	for _, name := range names {
+		rows := results[name]
+		if len(rows) == 0 {
+			continue
+		}
+
+		columns := map[string]bool{}
+		for _, row := range rows {
+			for col := range row {
+				columns[col] = true
+			}
+		}
+
+		candidates := []string{}
+		suffixed := ""
+		for tname, schema := range d.schemas {
+			if !schemaHasColumns(schema, columns) {
+				continue
+			}
+			candidates = append(candidates, tname)
+			if (name == tname || strings.HasSuffix(name, "_"+tname)) && len(tname) > len(suffixed) {
+				suffixed = tname
+			}
+		}
+
+		tname := suffixed
+		if tname == "" && len(candidates) == 1 {
+			tname = candidates[0]
+		}
+		if tname == "" {
+			sort.Strings(candidates)
+			d.logger.Warnw("Query results do not match a single table, skipping them", "query", name, "candidates", candidates)
+			continue
+		}
+		d.logger.Debugw("Matched query results to table", "query", name, "table", tname, "rows", len(rows))
+		fixtures[tname] = append(fixtures[tname], rows...)
+	}
+	return fixtures
+}
+
+// schemaHasColumns returns true if schema has every one of the columns.
+func schemaHasColumns(schema sql.Schema, columns map[string]bool) bool {
+	found := 0
+	for _, col := range schema {
+		if columns[col.Name] {
+			found++
+		}
+	}
+	return found == len(columns)
+}
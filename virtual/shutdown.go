@@ -0,0 +1,178 @@
+package virtual
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+// ErrDatabaseStopped is returned when a server is started on a Database that has already been stopped.
+var ErrDatabaseStopped = xerrors.New("database has been stopped")
+
+// drainPollInterval is how often Stop checks whether the remaining client connections have gone idle.
+const drainPollInterval = 50 * time.Millisecond
+
+// connTracker tracks the open connections of a server so they can be drained when the Database is stopped.
+// A connection is busy while it is executing a statement; idle connections are closed as soon as draining
+// begins, and busy ones as soon as they finish.
+type connTracker struct {
+	sync.Mutex
+
+	conns map[interface{}]*trackedConn
+}
+
+type trackedConn struct {
+	close   func()
+	busy    bool
+	limiter *rate.Limiter
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{
+		conns: map[interface{}]*trackedConn{},
+	}
+}
+
+// add starts tracking a connection, unless max (if non-zero) connections are already open. The connection's
+// statements are rate limited by limiter if it is not nil.
+func (t *connTracker) add(key interface{}, close func(), limiter *rate.Limiter, max int) error {
+	t.Lock()
+	defer t.Unlock()
+
+	if max > 0 && len(t.conns) >= max {
+		return ErrTooManyConnections
+	}
+	t.conns[key] = &trackedConn{close: close, limiter: limiter}
+	return nil
+}
+
+// allow returns false if the connection has exceeded its query rate limit.
+func (t *connTracker) allow(key interface{}) bool {
+	t.Lock()
+	conn, ok := t.conns[key]
+	t.Unlock()
+
+	return !ok || conn.limiter == nil || conn.limiter.Allow()
+}
+
+func (t *connTracker) remove(key interface{}) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.conns, key)
+}
+
+func (t *connTracker) setBusy(key interface{}, busy bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if conn, ok := t.conns[key]; ok {
+		conn.busy = busy
+	}
+}
+
+// closeIdle closes every connection that is not executing a statement and returns how many remain open.
+func (t *connTracker) closeIdle(force bool) int {
+	t.Lock()
+	defer t.Unlock()
+
+	for key, conn := range t.conns {
+		if conn.busy && !force {
+			continue
+		}
+		conn.close()
+		delete(t.conns, key)
+	}
+	return len(t.conns)
+}
+
+// drain closes connections as they go idle until none remain. If ctx expires first, the remaining connections
+// are closed regardless and ctx's error is returned.
+func (t *connTracker) drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if t.closeIdle(false) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			t.closeIdle(true)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// addServer registers the shutdown function of a running server so Stop can shut it down.
+func (d *Database) addServer(shutdown func(context.Context) error) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.stopped {
+		return ErrDatabaseStopped
+	}
+	d.servers = append(d.servers, shutdown)
+	return nil
+}
+
+func (d *Database) isStopped() bool {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.stopped
+}
+
+// Stop gracefully shuts down every server started on the Database: listeners stop accepting connections,
+// statements that are already executing are allowed to finish, and idle connections are closed. If ctx expires
+// before the connections drain they are closed forcefully. Once the servers are down, the audit log is flushed
+// to disk. The Start functions return nil once Stop has been called.
+func (d *Database) Stop(ctx context.Context) error {
+	d.Lock()
+	if d.stopped {
+		d.Unlock()
+		return nil
+	}
+	d.stopped = true
+	servers := d.servers
+	d.servers = nil
+	d.Unlock()
+
+	errs := make(chan error, len(servers))
+	for _, shutdown := range servers {
+		go func(shutdown func(context.Context) error) {
+			errs <- shutdown(ctx)
+		}(shutdown)
+	}
+
+	var err error
+	for range servers {
+		if serr := <-errs; serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	d.RLock()
+	auditLog, store := d.auditLog, d.store
+	d.RUnlock()
+	if auditLog != nil {
+		if serr := auditLog.Sync(); serr != nil && err == nil {
+			err = xerrors.Errorf("error flushing audit log: %v", serr)
+		}
+	}
+	if store != nil {
+		if serr := store.Sync(); serr != nil && err == nil {
+			err = xerrors.Errorf("error flushing store: %v", serr)
+		}
+	}
+
+	if err != nil {
+		return xerrors.Errorf("error stopping database: %v", err)
+	}
+	d.logger.Info("Database stopped")
+	return nil
+}
@@ -0,0 +1,143 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"github.com/gen0cide/osqt"
+)
+
+// DefaultEventRetention is the number of rows an EventSimulator keeps for each table before discarding the oldest.
+const DefaultEventRetention = 10000
+
+// EventSimulator appends rows to evented tables (e.g. process_events) at a steady rate while the server runs, as
+// osquery's event subscribers buffer events between queries. Each row's time column holds the time the row was
+// generated and never decreases, and its eid column increases with every row, so interval and differential query
+// logic can be tested against the virtual server.
+type EventSimulator struct {
+	sync.Mutex
+
+	db       *Database
+	faker    *Faker
+	interval time.Duration
+	retain   int
+	tables   map[string]*simulatedTable
+}
+
+// simulatedTable holds the rows generated for one table.
+type simulatedTable struct {
+	columns   []*osqt.Column
+	rows      []map[string]string
+	generated int
+	last      int64
+}
+
+// NewEventSimulator creates an EventSimulator generating rate rows per second for each table, with values from
+// faker.
+func NewEventSimulator(rate float64, faker *Faker) (*EventSimulator, error) {
+	if rate <= 0 {
+		return nil, xerrors.Errorf("event rate must be positive, got %v", rate)
+	}
+	if faker == nil {
+		faker = NewFaker(0)
+	}
+
+	return &EventSimulator{
+		faker:    faker,
+		interval: time.Duration(float64(time.Second) / rate),
+		retain:   DefaultEventRetention,
+		tables:   map[string]*simulatedTable{},
+	}, nil
+}
+
+// SetRetention sets the number of rows kept for each table.
+func (s *EventSimulator) SetRetention(n int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.retain = n
+}
+
+// Simulate backs tbl, as it exists on goos, in db's primary database with simulated events. Tables of the same
+// name in db's other databases, whose schemas can differ, hold their own rows and are not simulated. It must be
+// called before db is initialized, and every table an EventSimulator simulates must belong to the same Database.
+func (s *EventSimulator) Simulate(db *Database, tbl *osqt.Table, goos string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.db != nil && s.db != db {
+		return xerrors.New("an event simulator can only simulate the tables of one database")
+	}
+	if err := db.SetRowProvider(tbl.Name, s); err != nil {
+		return err
+	}
+	s.db = db
+	s.tables[tbl.Name] = &simulatedTable{columns: PlatformColumns(tbl, goos)}
+	return nil
+}
+
+// Run generates events until ctx is done.
+func (s *EventSimulator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			s.tick(now)
+		}
+	}
+}
+
+// tick appends one event to every simulated table.
+func (s *EventSimulator) tick(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, st := range s.tables {
+		row := map[string]string{}
+		for _, col := range st.columns {
+			row[col.Name] = s.faker.Value(col, st.generated)
+		}
+
+		// several events can arrive within a second, but time never goes backwards
+		ts := now.Unix()
+		if ts < st.last {
+			ts = st.last
+		}
+		st.last = ts
+		st.generated++
+		row["time"] = fmt.Sprintf("%d", ts)
+		row["eid"] = fmt.Sprintf("%010d", st.generated)
+
+		st.rows = append(st.rows, row)
+		if s.retain > 0 && len(st.rows) > s.retain {
+			st.rows = st.rows[len(st.rows)-s.retain:]
+		}
+	}
+}
+
+// Rows implements the RowProvider interface.
+func (s *EventSimulator) Rows(ctx *sql.Context, table string) ([]sql.Row, error) {
+	s.Lock()
+	st, ok := s.tables[table]
+	var rows []map[string]string
+	if ok {
+		rows = append(rows, st.rows...)
+	}
+	db := s.db
+	s.Unlock()
+
+	if !ok {
+		return nil, xerrors.Errorf("table %s is not simulated", table)
+	}
+	schema, _ := db.TableSchema(table)
+	return StringRows(table, schema, rows)
+}
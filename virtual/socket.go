@@ -0,0 +1,64 @@
+package virtual
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultSocketMode is the permission given to the unix domain sockets the Database listens on unless
+// SetSocketMode is called. It restricts connections to the user running the server.
+const DefaultSocketMode os.FileMode = 0600
+
+// SetSocketMode sets the permission given to the unix domain sockets the Database listens on.
+func (d *Database) SetSocketMode(mode os.FileMode) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.socketMode = mode
+}
+
+// prepareSocket removes a stale socket file left at addr by a server that did not shut down cleanly. It refuses
+// to remove anything that is not a socket, or a socket another server is still accepting connections on.
+func prepareSocket(proto, addr string) error {
+	if proto != "unix" {
+		return nil
+	}
+
+	fi, err := os.Lstat(addr)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return xerrors.Errorf("error checking socket path %s: %v", addr, err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return xerrors.Errorf("%s already exists and is not a socket", addr)
+	}
+
+	conn, err := net.DialTimeout(proto, addr, time.Second)
+	if err == nil {
+		conn.Close()
+		return xerrors.Errorf("another server is already listening on %s", addr)
+	}
+	if err := os.Remove(addr); err != nil {
+		return xerrors.Errorf("error removing stale socket %s: %v", addr, err)
+	}
+	return nil
+}
+
+// secureSocket applies the Database's socket mode to the unix domain socket at addr once it is listening.
+func (d *Database) secureSocket(proto, addr string) error {
+	if proto != "unix" {
+		return nil
+	}
+
+	d.RLock()
+	mode := d.socketMode
+	d.RUnlock()
+	if err := os.Chmod(addr, mode); err != nil {
+		return xerrors.Errorf("error setting permissions on socket %s: %v", addr, err)
+	}
+	return nil
+}
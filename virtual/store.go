@@ -0,0 +1,287 @@
+package virtual
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+)
+
+// Store is a persistent, on-disk home for the rows of the virtual database's tables. Rows inserted into a
+// Database backed by a Store survive restarts, and table scans stream from disk instead of holding every row in memory.
+type Store struct {
+	path string
+	db   *bolt.DB
+}
+
+// OpenStore opens (or creates) a bbolt backed Store at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("error opening store %s: %v", path, err)
+	}
+
+	return &Store{
+		path: path,
+		db:   db,
+	}, nil
+}
+
+// Close closes the underlying database file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Sync flushes the database file to disk.
+func (s *Store) Sync() error {
+	return s.db.Sync()
+}
+
+// Path returns the location of the database file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// table returns the table name of schema, keeping its rows in the named bucket of the Store.
+func (s *Store) table(bucket, name string, schema sql.Schema) (*storeTable, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("error creating bucket for table %s: %v", name, err)
+	}
+
+	return &storeTable{
+		store:  s,
+		bucket: bucket,
+		name:   name,
+		schema: schema,
+	}, nil
+}
+
+// storeTable is a sql.Table whose rows live in a bucket of a Store.
+type storeTable struct {
+	store  *Store
+	bucket string
+	name   string
+	schema sql.Schema
+}
+
+// Name implements the sql.Nameable interface.
+func (t *storeTable) Name() string {
+	return t.name
+}
+
+// String implements the fmt.Stringer interface.
+func (t *storeTable) String() string {
+	return t.name
+}
+
+// Schema implements the sql.Table interface.
+func (t *storeTable) Schema() sql.Schema {
+	return t.schema
+}
+
+// Partitions implements the sql.Table interface.
+func (t *storeTable) Partitions(*sql.Context) (sql.PartitionIter, error) {
+	return &singlePartitionIter{}, nil
+}
+
+// PartitionRows implements the sql.Table interface.
+func (t *storeTable) PartitionRows(*sql.Context, sql.Partition) (sql.RowIter, error) {
+	tx, err := t.store.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := tx.Bucket([]byte(t.bucket))
+	if bucket == nil {
+		tx.Rollback()
+		return nil, xerrors.Errorf("table %s does not exist in the store", t.name)
+	}
+
+	return &storeRowIter{
+		table:  t,
+		tx:     tx,
+		cursor: bucket.Cursor(),
+	}, nil
+}
+
+// storedBlob is the stored form of a []byte value. JSON has no binary type, so blobs are tagged to tell them
+// apart from text when rows are read back.
+type storedBlob struct {
+	Blob []byte `json:"blob"`
+}
+
+// encodeRow encodes a row for storage.
+func encodeRow(row []interface{}) ([]byte, error) {
+	stored := make([]interface{}, len(row))
+	for idx, val := range row {
+		if b, ok := val.([]byte); ok {
+			val = storedBlob{Blob: b}
+		}
+		stored[idx] = val
+	}
+	return json.Marshal(stored)
+}
+
+// decodeRow decodes a stored row, restoring blobs and keeping numbers as json.Number so integers survive intact.
+func decodeRow(data []byte) ([]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	raw := []interface{}{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	for idx, val := range raw {
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text, _ := obj["blob"].(string)
+		blob, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, xerrors.Errorf("error decoding stored blob: %v", err)
+		}
+		raw[idx] = blob
+	}
+	return raw, nil
+}
+
+// Insert implements the sql.Inserter interface.
+func (t *storeTable) Insert(_ *sql.Context, row sql.Row) error {
+	data, err := encodeRow(row)
+	if err != nil {
+		return xerrors.Errorf("error encoding row for table %s: %v", t.name, err)
+	}
+
+	return t.store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(t.bucket))
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, data)
+	})
+}
+
+func (t *storeTable) rowCount() (int, error) {
+	count := 0
+	err := t.store.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket([]byte(t.bucket)).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// decode converts a stored row back into values of the table's column types.
+func (t *storeTable) decode(data []byte) (sql.Row, error) {
+	raw, err := decodeRow(data)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make(sql.Row, len(t.schema))
+	for idx, col := range t.schema {
+		if idx >= len(raw) || raw[idx] == nil {
+			continue
+		}
+		stored := raw[idx]
+		if n, ok := stored.(json.Number); ok {
+			// unsigned values above MaxInt64 (inodes, hashes, counters) would lose precision as a float
+			if stored, err = n.Int64(); err != nil {
+				if stored, err = strconv.ParseUint(string(n), 10, 64); err != nil {
+					stored, err = n.Float64()
+				}
+			}
+			if err != nil {
+				return nil, xerrors.Errorf("error decoding %s.%s: %v", t.name, col.Name, err)
+			}
+		}
+		val, err := col.Type.Convert(stored)
+		if err != nil {
+			return nil, xerrors.Errorf("error decoding %s.%s: %v", t.name, col.Name, err)
+		}
+		row[idx] = val
+	}
+	return row, nil
+}
+
+// storeRowIter streams rows out of a bucket, holding a read transaction open until it is closed.
+type storeRowIter struct {
+	table   *storeTable
+	tx      *bolt.Tx
+	cursor  *bolt.Cursor
+	started bool
+}
+
+// Next implements the sql.RowIter interface.
+func (i *storeRowIter) Next() (sql.Row, error) {
+	var v []byte
+	if !i.started {
+		_, v = i.cursor.First()
+		i.started = true
+	} else {
+		_, v = i.cursor.Next()
+	}
+	if v == nil {
+		return nil, io.EOF
+	}
+	return i.table.decode(v)
+}
+
+// Close implements the sql.RowIter interface.
+func (i *storeRowIter) Close() error {
+	return i.tx.Rollback()
+}
+
+// migrate rewrites the rows stored for a table from its schema's column order to the new one's. Values are
+// left as stored, and are converted to the new column types when read.
+func (s *Store) migrate(t *storeTable, new sql.Schema) error {
+	old := t.schema
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(t.bucket))
+		if bucket == nil {
+			return nil
+		}
+
+		// buckets cannot be modified while they are iterated, so collect the rewritten rows first
+		rewritten := map[string][]byte{}
+		err := bucket.ForEach(func(k, v []byte) error {
+			raw, err := decodeRow(v)
+			if err != nil {
+				return err
+			}
+			data, err := encodeRow(remapRow(raw, old, new))
+			if err != nil {
+				return err
+			}
+			rewritten[string(k)] = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, v := range rewritten {
+			if err := bucket.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("error migrating rows of table %s: %v", t.name, err)
+	}
+	return nil
+}
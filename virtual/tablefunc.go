@@ -0,0 +1,540 @@
+package virtual
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/src-d/go-mysql-server.v0/sql"
+
+	"github.com/gen0cide/osqt/query"
+)
+
+// jsonRowsTable is the table the rows of json_each and json_tree calls are served from. The engine has no table
+// valued functions, so each call is rewritten into a subquery of this table selecting the rows generated for it.
+const jsonRowsTable = "osqt_json_rows"
+
+// jsonRowsSchema is the schema of jsonRowsTable: the columns of SQLite's json_each and json_tree, and the call the
+// row was generated for.
+var jsonRowsSchema = sql.Schema{
+	{Name: "key", Type: sql.Text, Nullable: true, Source: jsonRowsTable},
+	{Name: "value", Type: sql.Text, Nullable: true, Source: jsonRowsTable},
+	{Name: "type", Type: sql.Text, Nullable: false, Source: jsonRowsTable},
+	{Name: "atom", Type: sql.Text, Nullable: true, Source: jsonRowsTable},
+	{Name: "id", Type: sql.Int64, Nullable: false, Source: jsonRowsTable},
+	{Name: "parent", Type: sql.Int64, Nullable: true, Source: jsonRowsTable},
+	{Name: "fullkey", Type: sql.Text, Nullable: false, Source: jsonRowsTable},
+	{Name: "path", Type: sql.Text, Nullable: false, Source: jsonRowsTable},
+	{Name: "json", Type: sql.Text, Nullable: false, Source: jsonRowsTable},
+	{Name: "root", Type: sql.Text, Nullable: false, Source: jsonRowsTable},
+	{Name: "call_id", Type: sql.Int64, Nullable: false, Source: jsonRowsTable},
+}
+
+// tableFunctions are the table valued functions of SQLite's JSON1 extension.
+var tableFunctions = map[string]bool{
+	"json_each": true,
+	"json_tree": true,
+}
+
+// tableCalls holds the rows generated for the table function calls of the statements being run.
+type tableCalls struct {
+	sync.Mutex
+
+	next  int64
+	calls map[int64][]sql.Row
+}
+
+func newTableCalls() *tableCalls {
+	return &tableCalls{calls: map[int64][]sql.Row{}}
+}
+
+// add stores the rows of a new call and returns its id.
+func (t *tableCalls) add(rows []sql.Row) int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	t.next++
+	for _, row := range rows {
+		row[len(row)-1] = t.next
+	}
+	t.calls[t.next] = rows
+	return t.next
+}
+
+// remove drops the rows of the given calls.
+func (t *tableCalls) remove(ids []int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, id := range ids {
+		delete(t.calls, id)
+	}
+}
+
+func (t *tableCalls) rows(*sql.Context, string, sql.Schema) ([]sql.Row, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	rows := []sql.Row{}
+	for _, call := range t.calls {
+		rows = append(rows, call...)
+	}
+	return rows, nil
+}
+
+// tableCall is a json_each or json_tree call found in a statement, with the byte offsets of the text it spans.
+type tableCall struct {
+	name  string
+	args  []string
+	alias string
+	start int
+	end   int
+
+	// from is the text of the FROM items before the call, empty if it is the first, and sep the token joining it
+	// to them.
+	from string
+	sep  query.Token
+}
+
+// expandTableFunctions rewrites every json_each and json_tree call in q into a subquery of jsonRowsTable. If
+// evaluate is set, the arguments of each call are evaluated and the rows it produces generated; otherwise the
+// rewritten statement can only be analyzed. The returned func releases the generated rows once the statement
+// has run. The caller must hold the reloading lock.
+func (d *Database) expandTableFunctions(ctx context.Context, q string, evaluate bool) (string, func(), error) {
+	ids := []int64{}
+	release := func() { d.tableCalls.remove(ids) }
+	for {
+		call, tokens, err := findTableFunction(q)
+		if err != nil || call == nil {
+			return q, release, err
+		}
+
+		var id int64
+		if evaluate {
+			rows, err := d.evaluateTableFunction(ctx, call)
+			if err != nil {
+				release()
+				return "", func() {}, err
+			}
+			id = d.tableCalls.add(rows)
+			ids = append(ids, id)
+		}
+		if q, err = rewriteTableFunction(q, tokens, call, id); err != nil {
+			release()
+			return "", func() {}, err
+		}
+	}
+}
+
+// evaluateTableFunction generates the rows of call. The arguments of a call following other FROM items may
+// reference their columns, so they are evaluated for every row of those items.
+func (d *Database) evaluateTableFunction(ctx context.Context, call *tableCall) ([]sql.Row, error) {
+	eval := "SELECT DISTINCT " + strings.Join(call.args, ", ")
+	if call.from != "" {
+		eval += " FROM " + call.from
+	}
+
+	sctx := sql.NewContext(ctx,
+		sql.WithSession(sql.NewBaseSession()),
+		sql.WithPid(d.pid.Inc()),
+		sql.WithQuery(eval),
+	)
+	_, iter, err := d.eng.Query(sctx, eval)
+	if err != nil {
+		return nil, xerrors.Errorf("error evaluating the arguments of %s: %v", call.name, err)
+	}
+	args, err := sql.RowIterToRows(iter)
+	if err != nil {
+		return nil, xerrors.Errorf("error evaluating the arguments of %s: %v", call.name, err)
+	}
+
+	rows := []sql.Row{}
+	for _, arg := range args {
+		if arg[0] == nil || (len(arg) > 1 && arg[1] == nil) {
+			continue
+		}
+		doc, path := textArg(arg[0]), "$"
+		if len(arg) > 1 {
+			path = textArg(arg[1])
+		}
+		generated, err := jsonTableFunctionRows(call.name, doc, path)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, generated...)
+	}
+	return rows, nil
+}
+
+// textArg converts an evaluated argument to the text it is compared against in the rewritten statement.
+func textArg(v interface{}) string {
+	if s, ok := stringArg(v); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonTableFunctionRows generates the rows SQLite's json_each or json_tree returns for doc and root. json_each
+// returns the children of the element at root, or the element itself if it is neither an array nor an object;
+// json_tree returns the element and all of its descendants, parents before their children.
+func jsonTableFunctionRows(name, doc, root string) ([]sql.Row, error) {
+	parsed, err := parseJSONArg(doc)
+	if err != nil {
+		return nil, err
+	}
+	elem, steps, found, err := resolveJSONPath(parsed, root)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	rows := []sql.Row{}
+	var id int64
+	var walk func(elem interface{}, steps []jsonPathStep, parent interface{}, recurse bool) error
+	walk = func(elem interface{}, steps []jsonPathStep, parent interface{}, recurse bool) error {
+		id++
+		self := id
+		row, err := jsonTableRow(elem, steps, self, parent, doc, root)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+		if !recurse {
+			return nil
+		}
+		return walkJSONChildren(elem, steps, func(child interface{}, steps []jsonPathStep) error {
+			return walk(child, steps, self, true)
+		})
+	}
+
+	if name == "json_tree" {
+		err = walk(elem, steps, nil, true)
+		return rows, err
+	}
+	switch elem.(type) {
+	case []interface{}, orderedObject:
+		err = walkJSONChildren(elem, steps, func(child interface{}, steps []jsonPathStep) error {
+			return walk(child, steps, nil, false)
+		})
+	default:
+		err = walk(elem, steps, nil, false)
+	}
+	return rows, err
+}
+
+// walkJSONChildren calls fn with each element of an array or member of an object, in document order.
+func walkJSONChildren(elem interface{}, steps []jsonPathStep, fn func(interface{}, []jsonPathStep) error) error {
+	child := func(step jsonPathStep) []jsonPathStep {
+		return append(append(make([]jsonPathStep, 0, len(steps)+1), steps...), step)
+	}
+	switch v := elem.(type) {
+	case []interface{}:
+		for idx, item := range v {
+			if err := fn(item, child(jsonPathStep{isIndex: true, index: idx})); err != nil {
+				return err
+			}
+		}
+	case orderedObject:
+		for _, member := range v {
+			if err := fn(member.value, child(jsonPathStep{key: member.key})); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonTableRow builds the jsonRowsSchema row of elem, found at steps in doc. Its call_id is set when the rows
+// are stored.
+func jsonTableRow(elem interface{}, steps []jsonPathStep, id int64, parent interface{}, doc, root string) (sql.Row, error) {
+	var key interface{}
+	path := formatJSONPath(steps)
+	if len(steps) > 0 {
+		last := steps[len(steps)-1]
+		if last.isIndex {
+			key = strconv.Itoa(last.index)
+		} else {
+			key = last.key
+		}
+		path = formatJSONPath(steps[:len(steps)-1])
+	}
+
+	var value, atom interface{}
+	switch v := elem.(type) {
+	case nil:
+	case bool:
+		value = "0"
+		if v {
+			value = "1"
+		}
+		atom = value
+	case string:
+		value, atom = v, v
+	case json.Number:
+		value, atom = v.String(), v.String()
+	default:
+		text, err := marshalJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		value = text
+	}
+
+	return sql.NewRow(key, value, jsonTypeOf(elem), atom, id, parent, formatJSONPath(steps), path, doc, root, int64(0)), nil
+}
+
+// findTableFunction returns the innermost, then leftmost, table function call in q, or nil if there is none,
+// along with the tokens of q.
+func findTableFunction(q string) (*tableCall, []query.Token, error) {
+	tokens, err := query.Tokenize(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	depths := tokenDepths(tokens)
+
+	found := -1
+	for idx, tok := range tokens {
+		if tok.Kind != query.TokenIdent || !tableFunctions[strings.ToLower(tok.Text)] || isQuoted(q, tok) {
+			continue
+		}
+		if idx+1 >= len(tokens) || !tokens[idx+1].Is("(") || (idx > 0 && tokens[idx-1].Is(".")) {
+			continue
+		}
+		if found < 0 || depths[idx] > depths[found] {
+			found = idx
+		}
+	}
+	if found < 0 {
+		return nil, tokens, nil
+	}
+
+	call := &tableCall{name: strings.ToLower(tokens[found].Text), start: tokens[found].Pos}
+	if err := call.parseArgs(q, tokens, depths, found); err != nil {
+		return nil, nil, err
+	}
+	if err := call.parseFrom(q, tokens, depths, found); err != nil {
+		return nil, nil, err
+	}
+	return call, tokens, nil
+}
+
+// parseArgs records the arguments of the call whose name is tokens[idx], the alias following it, and the end of
+// the text they span.
+func (c *tableCall) parseArgs(q string, tokens []query.Token, depths []int, idx int) error {
+	depth := depths[idx]
+	argStart := tokenEnd(q, tokens[idx+1])
+	closed := -1
+	for i := idx + 2; i < len(tokens); i++ {
+		if depths[i] < depth || (depths[i] == depth && !tokens[i].Is(")")) {
+			break
+		}
+		if (depths[i] == depth+1 && tokens[i].Is(",")) || depths[i] == depth {
+			if arg := strings.TrimSpace(q[argStart:tokens[i].Pos]); arg != "" {
+				c.args = append(c.args, arg)
+			}
+			argStart = tokenEnd(q, tokens[i])
+		}
+		if depths[i] == depth {
+			closed = i
+			break
+		}
+	}
+	if closed < 0 {
+		return xerrors.Errorf("unterminated call to %s", c.name)
+	}
+	if len(c.args) < 1 || len(c.args) > 2 {
+		return xerrors.Errorf("wrong number of arguments to function %s()", c.name)
+	}
+
+	c.alias, c.end = c.name, tokenEnd(q, tokens[closed])
+	next := closed + 1
+	if next < len(tokens) && tokens[next].Is("AS") {
+		next++
+	}
+	if next < len(tokens) && tokens[next].Kind == query.TokenIdent {
+		c.alias, c.end = tokens[next].Text, tokenEnd(q, tokens[next])
+	}
+	return nil
+}
+
+// parseFrom checks the call whose name is tokens[idx] is an item of a FROM clause, and records the items before it.
+func (c *tableCall) parseFrom(q string, tokens []query.Token, depths []int, idx int) error {
+	depth := depths[idx]
+	if idx == 0 {
+		return xerrors.Errorf("%s can only be used in a FROM clause", c.name)
+	}
+	c.sep = tokens[idx-1]
+	if !c.sep.Is("FROM") && !c.sep.Is(",") && !c.sep.Is("JOIN") {
+		return xerrors.Errorf("%s can only be used in a FROM clause", c.name)
+	}
+
+	// the items before the call end where the operator joining it to them begins
+	fromEnd := idx - 1
+	if c.sep.Is("JOIN") {
+		for fromEnd > 0 && isJoinKeyword(tokens[fromEnd-1]) {
+			fromEnd--
+			if tokens[fromEnd].Is("RIGHT") || tokens[fromEnd].Is("NATURAL") {
+				return xerrors.Errorf("%s cannot be the right side of a %s join", c.name, strings.ToUpper(tokens[fromEnd].Text))
+			}
+		}
+	}
+
+	for i := idx - 1; i >= 0; i-- {
+		if depths[i] != depth {
+			continue
+		}
+		switch {
+		case tokens[i].Is("FROM"):
+			if i != idx-1 {
+				c.from = strings.TrimSpace(q[tokenEnd(q, tokens[i]):tokens[fromEnd].Pos])
+			}
+			return nil
+		case isClauseKeyword(tokens[i]) || tokens[i].Is("SELECT"):
+			return xerrors.Errorf("%s can only be used in a FROM clause", c.name)
+		}
+	}
+	return xerrors.Errorf("%s can only be used in a FROM clause", c.name)
+}
+
+// rewriteTableFunction replaces call in q with a subquery selecting the rows stored for it under id. A call
+// following other FROM items is correlated with them by matching its rows on the arguments they were generated
+// for, which is added to the join's ON clause or the statement's WHERE clause.
+func rewriteTableFunction(q string, tokens []query.Token, call *tableCall, id int64) (string, error) {
+	cols := []string{"key", "value", "type", "atom", "id", "parent", "fullkey", "path"}
+	if call.from != "" {
+		cols = append(cols, "json", "root")
+	}
+	alias := quoteIdent(call.alias)
+	subquery := fmt.Sprintf("(SELECT `%s` FROM %s WHERE call_id = %d) AS %s",
+		strings.Join(cols, "`, `"), jsonRowsTable, id, alias)
+	if call.from == "" {
+		return q[:call.start] + subquery + q[call.end:], nil
+	}
+
+	root := "'$'"
+	if len(call.args) > 1 {
+		root = "(" + call.args[1] + ")"
+	}
+	cond := fmt.Sprintf("%s.`json` = (%s) AND %s.`root` = %s", alias, call.args[0], alias, root)
+
+	depths := tokenDepths(tokens)
+	after := len(tokens)
+	for i, tok := range tokens {
+		if tok.Pos >= call.end {
+			after = i
+			break
+		}
+	}
+	depth := 0
+	for i, tok := range tokens {
+		if tok.Pos == call.start {
+			depth = depths[i]
+		}
+	}
+
+	// end returns the offset the clause beginning at tokens[from] ends at, before the next clause keyword at the
+	// call's depth or the end of the enclosing statement.
+	end := func(from int, stops func(query.Token) bool) (int, int) {
+		last := call.end
+		for i := from; i < len(tokens); i++ {
+			if depths[i] < depth || (depths[i] == depth && (tokens[i].Is(";") || stops(tokens[i]))) {
+				return i, last
+			}
+			last = tokenEnd(q, tokens[i])
+		}
+		return len(tokens), last
+	}
+
+	if call.sep.Is("JOIN") {
+		if after < len(tokens) && tokens[after].Is("USING") {
+			return "", xerrors.Errorf("%s cannot be joined with USING", call.name)
+		}
+		if after < len(tokens) && tokens[after].Is("ON") {
+			_, onEnd := end(after+1, func(tok query.Token) bool {
+				return tok.Is(",") || tok.Is("JOIN") || isJoinKeyword(tok) || isClauseKeyword(tok)
+			})
+			on := tokenEnd(q, tokens[after])
+			return q[:call.start] + subquery + q[call.end:on] + " " + cond + " AND (" + q[on:onEnd] + ")" + q[onEnd:], nil
+		}
+		return q[:call.start] + subquery + " ON " + cond + q[call.end:], nil
+	}
+
+	stop, fromEnd := end(after, func(tok query.Token) bool { return isClauseKeyword(tok) })
+	if stop < len(tokens) && depths[stop] == depth && tokens[stop].Is("WHERE") {
+		_, whereEnd := end(stop+1, func(tok query.Token) bool { return isClauseKeyword(tok) && !tok.Is("WHERE") })
+		where := tokenEnd(q, tokens[stop])
+		return q[:call.start] + subquery + q[call.end:where] + " " + cond + " AND (" + q[where:whereEnd] + ")" + q[whereEnd:], nil
+	}
+	return q[:call.start] + subquery + q[call.end:fromEnd] + " WHERE " + cond + q[fromEnd:], nil
+}
+
+// tokenDepths returns the parenthesis nesting depth of each token.
+func tokenDepths(tokens []query.Token) []int {
+	depths := make([]int, len(tokens))
+	depth := 0
+	for idx, tok := range tokens {
+		if tok.Is(")") {
+			depth--
+		}
+		depths[idx] = depth
+		if tok.Is("(") {
+			depth++
+		}
+	}
+	return depths
+}
+
+// tokenEnd returns the offset just past tok in q. The Text of quoted identifiers omits their quotes and escapes.
+func tokenEnd(q string, tok query.Token) int {
+	if !isQuoted(q, tok) {
+		return tok.Pos + len(tok.Text)
+	}
+	closer := q[tok.Pos]
+	if closer == '[' {
+		closer = ']'
+	}
+	for i := tok.Pos + 1; i < len(q); i++ {
+		if q[i] != closer {
+			continue
+		}
+		if i+1 < len(q) && q[i+1] == closer && closer != ']' {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(q)
+}
+
+// isQuoted returns true if tok is a quoted identifier.
+func isQuoted(q string, tok query.Token) bool {
+	return tok.Kind == query.TokenIdent && strings.IndexByte("\"`[", q[tok.Pos]) >= 0
+}
+
+// isJoinKeyword returns true if tok is one of the keywords that may precede JOIN.
+func isJoinKeyword(tok query.Token) bool {
+	for _, kw := range []string{"INNER", "LEFT", "RIGHT", "CROSS", "NATURAL", "OUTER"} {
+		if tok.Is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// isClauseKeyword returns true if tok begins a clause that follows the FROM clause.
+func isClauseKeyword(tok query.Token) bool {
+	for _, kw := range []string{"WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "UNION", "EXCEPT", "INTERSECT"} {
+		if tok.Is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteIdent quotes name as a MySQL identifier.
+func quoteIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
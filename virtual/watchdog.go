@@ -0,0 +1,77 @@
+package virtual
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrWatchdogLimit is the error statements stopped by the watchdog fail with. Its text is the reason osqueryd's
+// watchdog gives when it stops a worker for exceeding its CPU utilization limit, so clients can match on it.
+var ErrWatchdogLimit = xerrors.New("Maximum sustainable CPU utilization limit exceeded")
+
+// watchdogInterval is how often running statements are checked against the watchdog limits.
+const watchdogInterval = 50 * time.Millisecond
+
+// watchdogError reports how many seconds a statement ran for before the watchdog stopped it, as osqueryd does.
+type watchdogError struct {
+	elapsed time.Duration
+}
+
+func (e *watchdogError) Error() string {
+	return fmt.Sprintf("%v: %d", ErrWatchdogLimit, int(e.elapsed.Seconds()))
+}
+
+// Is implements xerrors.Is, so watchdog errors match ErrWatchdogLimit.
+func (e *watchdogError) Is(target error) bool {
+	return target == ErrWatchdogLimit
+}
+
+// watch runs fn, stopping it once it exceeds the watchdog limits. A statement is stopped by cancelling the context
+// passed to fn, which the virtual tables check between rows, and by calling kill if it is set. watch waits for fn
+// to return before reporting the watchdog error, so nothing fn holds or writes to outlives the statement.
+func (d *Database) watch(ctx context.Context, fn func(context.Context) error, kill func()) error {
+	limits := d.currentLimits()
+	if limits.WatchdogLatency == 0 && limits.WatchdogCPU == 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the statement runs on a thread of its own, so the CPU time of that thread is the statement's alone. Work the
+	// engine hands to other goroutines is not counted.
+	done, tid := make(chan error, 1), make(chan int, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		tid <- threadID()
+		done <- fn(ctx)
+	}()
+	thread := <-tid
+
+	start, cpu := time.Now(), threadCPUTime(thread)
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			elapsed, used := time.Since(start), threadCPUTime(thread)-cpu
+			if (limits.WatchdogLatency > 0 && elapsed > limits.WatchdogLatency) || (limits.WatchdogCPU > 0 && used > limits.WatchdogCPU) {
+				d.logger.Warnw("Watchdog stopped a statement", "elapsed", elapsed, "cpu", used)
+				cancel()
+				if kill != nil {
+					kill()
+				}
+				<-done
+				return &watchdogError{elapsed: elapsed}
+			}
+		}
+	}
+}
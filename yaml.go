@@ -0,0 +1,224 @@
+package osqt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlExplainContext is the number of lines shown before the offending line by YAMLError.Explain.
+const yamlExplainContext = 2
+
+var (
+	yamlLineRegexp  = regexp.MustCompile(`line (\d+)`)
+	yamlValueRegexp = regexp.MustCompile("`([^`]*)`|\"([^\"]*)\"")
+)
+
+// YAMLErrorLocation is a problem at a position in a YAML document. Line and Column start at 1.
+type YAMLErrorLocation struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// YAMLError is returned when a YAML schema file cannot be decoded. It records the position of every problem, so
+// they can be shown in the context of the file with Explain.
+type YAMLError struct {
+	File   string
+	Errors []*YAMLErrorLocation
+
+	source []byte
+}
+
+// Error implements the error interface.
+func (e *YAMLError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, loc := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s:%d:%d: %s", e.File, loc.Line, loc.Column, loc.Message))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Explain renders every problem followed by the lines of the file leading up to it, with a caret under the
+// offending column.
+func (e *YAMLError) Explain() string {
+	lines := strings.Split(string(e.source), "\n")
+	width := len(strconv.Itoa(len(lines)))
+
+	buf := new(bytes.Buffer)
+	for _, loc := range e.Errors {
+		fmt.Fprintf(buf, "%s:%d:%d: %s\n", e.File, loc.Line, loc.Column, loc.Message)
+		if loc.Line < 1 || loc.Line > len(lines) {
+			continue
+		}
+		start := loc.Line - yamlExplainContext
+		if start < 1 {
+			start = 1
+		}
+		for n := start; n <= loc.Line; n++ {
+			fmt.Fprintf(buf, " %*d | %s\n", width, n, strings.TrimRight(lines[n-1], "\r"))
+		}
+		fmt.Fprintf(buf, " %*s | %s^\n\n", width, "", strings.Repeat(" ", loc.Column-1))
+	}
+	return buf.String()
+}
+
+// decodeYAMLSchema decodes a YAML schema file into namespaces. Anchors, aliases and merge keys are resolved, and
+// top level keys beginning with "x-" or "." are ignored, so anchors shared by several tables can be defined there.
+// The metadata of versioned exports is returned along with their namespaces, and is nil for unversioned ones.
+// Errors are returned as a *YAMLError.
+func decodeYAMLSchema(file string, data []byte) (map[string]*Namespace, *SchemaMetadata, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, nil, newYAMLError(file, data, doc, err)
+	}
+
+	namespaces := map[string]*Namespace{}
+	if len(doc.Content) == 0 {
+		return namespaces, nil, nil
+	}
+	root := doc.Content[0]
+
+	var meta *SchemaMetadata
+	if root.Kind == yaml.MappingNode {
+		var body *yaml.Node
+		for idx := 0; idx+1 < len(root.Content); idx += 2 {
+			switch root.Content[idx].Value {
+			case SchemaMetadataKey:
+				meta = &SchemaMetadata{}
+				if err := root.Content[idx+1].Decode(meta); err != nil {
+					return nil, nil, newYAMLError(file, data, doc, err)
+				}
+			case "namespaces":
+				body = root.Content[idx+1]
+			}
+		}
+		if meta != nil {
+			if body == nil || body.Tag == "!!null" {
+				return nil, meta, nil
+			}
+			root = body
+		}
+	}
+	if root.Kind == yaml.MappingNode {
+		content := []*yaml.Node{}
+		for idx := 0; idx+1 < len(root.Content); idx += 2 {
+			key := root.Content[idx].Value
+			if strings.HasPrefix(key, "x-") || strings.HasPrefix(key, ".") {
+				continue
+			}
+			content = append(content, root.Content[idx], root.Content[idx+1])
+		}
+		root.Content = content
+	}
+	if err := root.Decode(&namespaces); err != nil {
+		return nil, nil, newYAMLError(file, data, doc, err)
+	}
+
+	// versioned exports are written by osqt with the indexes their checksum covers, so are decoded as they are
+	if meta != nil {
+		return namespaces, meta, nil
+	}
+
+	// columns reused through anchors keep the index of the place they were defined, so number them by position
+	for _, ns := range namespaces {
+		if ns == nil {
+			continue
+		}
+		for _, table := range ns.Tables {
+			if table == nil {
+				continue
+			}
+			renumberColumns(table.Schema)
+			for _, ext := range table.ExtendedSchemas {
+				renumberColumns(ext)
+			}
+		}
+	}
+	return namespaces, nil, nil
+}
+
+func renumberColumns(s *Schema) {
+	if s == nil {
+		return
+	}
+	for idx, col := range s.Columns {
+		col.Index = idx
+	}
+}
+
+// newYAMLError locates the problems err reports in the document. The YAML decoder only reports lines, so the
+// column is that of the value the message quotes, or of the first node on the line.
+func newYAMLError(file string, data []byte, doc *yaml.Node, err error) *YAMLError {
+	msgs := []string{err.Error()}
+	if terr, ok := err.(*yaml.TypeError); ok {
+		msgs = terr.Errors
+	}
+
+	yerr := &YAMLError{File: file, source: data}
+	for _, msg := range msgs {
+		loc := &YAMLErrorLocation{Message: strings.TrimPrefix(msg, "yaml: "), Column: 1}
+		if m := yamlLineRegexp.FindStringSubmatch(msg); m != nil {
+			loc.Line, _ = strconv.Atoi(m[1])
+			loc.Message = strings.TrimPrefix(strings.TrimPrefix(loc.Message, m[0]), ": ")
+		}
+
+		value := ""
+		if m := yamlValueRegexp.FindStringSubmatch(msg); m != nil {
+			value = m[1] + m[2]
+		}
+		if node := yamlNodeAt(doc, loc.Line, value, strings.HasPrefix(loc.Message, "cannot unmarshal")); node != nil {
+			loc.Column = node.Column
+		} else if lines := bytes.Split(data, []byte("\n")); loc.Line >= 1 && loc.Line <= len(lines) {
+			line := lines[loc.Line-1]
+			loc.Column = len(line) - len(bytes.TrimLeft(line, " \t")) + 1
+		}
+		yerr.Errors = append(yerr.Errors, loc)
+	}
+	return yerr
+}
+
+// yamlNodeAt returns the node on line whose value is value. Without one, it returns the first mapping value on line
+// when mappingValue is set, and otherwise the first node on line.
+func yamlNodeAt(node *yaml.Node, line int, value string, mappingValue bool) *yaml.Node {
+	var first, firstValue, match *yaml.Node
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n == nil || match != nil {
+			return
+		}
+		if n.Line == line && n.Kind != yaml.DocumentNode {
+			if first == nil {
+				first = n
+			}
+			if value != "" && n.Value == value {
+				match = n
+				return
+			}
+		}
+		if n.Kind == yaml.MappingNode && firstValue == nil {
+			for idx := 0; idx+1 < len(n.Content); idx += 2 {
+				if n.Content[idx].Line == line && n.Content[idx+1].Line == line {
+					firstValue = n.Content[idx+1]
+					break
+				}
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	switch {
+	case match != nil:
+		return match
+	case mappingValue && firstValue != nil:
+		return firstValue
+	}
+	return first
+}
@@ -0,0 +1,27 @@
+// Package zaplog adapts zap loggers to the osqt.Logger interface, keeping zap out of the dependencies of programs
+// that use osqt with another logging library.
+package zaplog
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/gen0cide/osqt"
+)
+
+// Logger is an osqt.Logger writing to a zap SugaredLogger.
+type Logger struct {
+	*zap.SugaredLogger
+}
+
+// New returns an osqt.Logger writing to l. A nil l returns osqt.NopLogger().
+func New(l *zap.SugaredLogger) osqt.Logger {
+	if l == nil {
+		return osqt.NopLogger()
+	}
+	return &Logger{SugaredLogger: l}
+}
+
+// Named implements the osqt.Logger interface.
+func (l *Logger) Named(name string) osqt.Logger {
+	return &Logger{SugaredLogger: l.SugaredLogger.Named(name)}
+}